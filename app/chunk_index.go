@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"meliocool/bytesize/internal/repository"
+	"meliocool/bytesize/internal/storage"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type chunkHashSource struct {
+	DB              *pgxpool.Pool
+	ChunkRepository repository.ChunkRepository
+}
+
+func (c chunkHashSource) CountChunks(ctx context.Context) (int64, error) {
+	tx, err := c.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	return c.ChunkRepository.Count(ctx, tx)
+}
+
+func (c chunkHashSource) EachChunkHash(ctx context.Context, fn func(hash string) error) error {
+	tx, err := c.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	return c.ChunkRepository.ForEachHash(ctx, tx, fn)
+}
+
+// NewChunkIndex wraps store in a Bloom-filter existence index built from the chunks table.
+// Blobs are stored before their rows, so a blob without a row (a tus or manifest chunk not yet
+// committed, or left by a failed upload) is missing from every rebuilt filter and reads as
+// absent; the caller then Puts it again, which costs a rewrite but never loses data.
+// The first load runs in the background (Exists passes through until it finishes) and the
+// filter is rebuilt every CHUNK_INDEX_REBUILD_INTERVAL (default 6h) to shed deleted hashes,
+// until ctx is cancelled; wg is done once the rebuild loop has returned. CHUNK_INDEX=off
+// disables it; CHUNK_INDEX_FP_RATE sets the target false-positive rate.
+func NewChunkIndex(ctx context.Context, wg *sync.WaitGroup, store storage.ChunkStore, db *pgxpool.Pool, chunkRepo repository.ChunkRepository, logger *slog.Logger) storage.ChunkStore {
+	if os.Getenv("CHUNK_INDEX") == "off" {
+		return store
+	}
+	fpRate, err := strconv.ParseFloat(os.Getenv("CHUNK_INDEX_FP_RATE"), 64)
+	if err != nil || fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	interval, err := time.ParseDuration(os.Getenv("CHUNK_INDEX_REBUILD_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 6 * time.Hour
+	}
+
+	indexed := storage.NewIndexedChunkStore(store, chunkHashSource{DB: db, ChunkRepository: chunkRepo}, fpRate)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runIndexRebuild(ctx, indexed, interval, logger)
+	}()
+	return indexed
+}
+
+// runIndexRebuild rebuilds the index right away and then once per interval until ctx is done.
+func runIndexRebuild(ctx context.Context, indexed *storage.IndexedChunkStore, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := indexed.Rebuild(ctx); err != nil {
+			if ctx.Err() == nil {
+				logger.Error("chunk_index_err", slog.String("stage", "rebuild"), slog.Any("err", err))
+			}
+		} else {
+			logger.Info("chunk_index_ok", slog.Duration("took", time.Since(start)))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
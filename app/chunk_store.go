@@ -0,0 +1,119 @@
+package app
+
+import (
+	"meliocool/bytesize/internal/storage"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewChunkStore builds the chunk store from the environment. The backing store is:
+//   - EC_DIRS (comma separated, EC_DATA_SHARDS + EC_PARITY_SHARDS entries) erasure-codes
+//     chunks across FSChunkStore mounts, EC_WRITE_QUORUM defaulting to every shard;
+//   - REPLICA_DIRS mirrors chunks across FSChunkStore mounts with REPLICA_WRITE_QUORUM
+//     (default: all);
+//   - PACK_DIR appends chunks into PackChunkStore segments (PACK_SEGMENT_BYTES), compacted
+//     every PACK_COMPACT_INTERVAL once PACK_COMPACT_THRESHOLD of a segment is dead;
+//   - otherwise a single FSChunkStore under BASE_DIR.
+//
+// HOT_DIR puts a size-bounded FSChunkStore tier (HOT_CAPACITY_BYTES, TIER_POLICY lru|lfu,
+// TIER_WRITE_MODE through|back) in front of that store, and CACHE_BYTES adds an in-memory
+// read cache (CACHE_SHARDS, default 16) on top of everything.
+func NewChunkStore() storage.ChunkStore {
+	store := newTieredStore(newBackingStore())
+	cacheBytes, err := strconv.ParseInt(os.Getenv("CACHE_BYTES"), 10, 64)
+	if err != nil || cacheBytes <= 0 {
+		return store
+	}
+	return storage.NewCachedChunkStore(store, cacheBytes, envInt("CACHE_SHARDS", 16))
+}
+
+func newTieredStore(cold storage.ChunkStore) storage.ChunkStore {
+	hotDir := os.Getenv("HOT_DIR")
+	if hotDir == "" {
+		return cold
+	}
+	capacity, err := strconv.ParseInt(os.Getenv("HOT_CAPACITY_BYTES"), 10, 64)
+	if err != nil || capacity <= 0 {
+		capacity = 10 << 30
+	}
+	writeBack := os.Getenv("TIER_WRITE_MODE") == "back"
+	store, err := storage.NewTieredChunkStore(storage.NewFSChunkStore(hotDir), cold, capacity, os.Getenv("TIER_POLICY"), writeBack)
+	if err != nil {
+		panic("failed to open tiered chunk store: " + err.Error())
+	}
+	return store
+}
+
+func newBackingStore() storage.ChunkStore {
+	if dirs := splitList(os.Getenv("EC_DIRS")); len(dirs) > 0 {
+		parity := envInt("EC_PARITY_SHARDS", 2)
+		data := envInt("EC_DATA_SHARDS", len(dirs)-parity)
+		store, err := storage.NewErasureChunkStore(data, parity, envInt("EC_WRITE_QUORUM", len(dirs)), fsTargets(dirs)...)
+		if err != nil {
+			panic("failed to build erasure chunk store: " + err.Error())
+		}
+		return store
+	}
+
+	if dirs := splitList(os.Getenv("REPLICA_DIRS")); len(dirs) > 0 {
+		store, err := storage.NewReplicatedChunkStore(envInt("REPLICA_WRITE_QUORUM", len(dirs)), fsTargets(dirs)...)
+		if err != nil {
+			panic("failed to build replicated chunk store: " + err.Error())
+		}
+		return store
+	}
+
+	if dir := os.Getenv("PACK_DIR"); dir != "" {
+		return newPackStore(dir)
+	}
+
+	return storage.NewFSChunkStore(os.Getenv("BASE_DIR"))
+}
+
+func newPackStore(dir string) storage.ChunkStore {
+	segmentSize, err := strconv.ParseInt(os.Getenv("PACK_SEGMENT_BYTES"), 10, 64)
+	if err != nil || segmentSize <= 0 {
+		segmentSize = 1 << 30
+	}
+	store, err := storage.NewPackChunkStore(dir, segmentSize)
+	if err != nil {
+		panic("failed to open pack chunk store: " + err.Error())
+	}
+	interval, err := time.ParseDuration(os.Getenv("PACK_COMPACT_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	threshold, err := strconv.ParseFloat(os.Getenv("PACK_COMPACT_THRESHOLD"), 64)
+	if err != nil || threshold <= 0 || threshold > 1 {
+		threshold = 0.5
+	}
+	store.StartCompactor(interval, threshold)
+	return store
+}
+
+func fsTargets(dirs []string) []storage.Replica {
+	targets := make([]storage.Replica, 0, len(dirs))
+	for _, dir := range dirs {
+		targets = append(targets, storage.Replica{Name: dir, Store: storage.NewFSChunkStore(dir)})
+	}
+	return targets
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"meliocool/bytesize/internal/controller"
+	"meliocool/bytesize/internal/middleware"
+	"net/http"
+)
+
+type Controllers struct {
+	Upload       controller.UploadController
+	FileList     controller.FileListController
+	FileMetaData controller.FileMetaDataController
+	Download     controller.DownloadController
+	Delete       controller.DeleteController
+	Archive      controller.ArchiveController
+	Tus          controller.TusController
+	Manifest     controller.ManifestController
+	Snapshot     controller.SnapshotController
+	Bundle       controller.BundleController
+	Replication  controller.ReplicationController
+}
+
+// NewRouter mounts the REST API routes behind API key authentication.
+func NewRouter(c Controllers) http.Handler {
+	router := httprouter.New()
+
+	router.POST("/files/upload", c.Upload.Upload)
+	router.POST("/files/upload/archive", c.Upload.UploadArchive)
+	router.GET("/files", c.FileList.List)
+	router.GET("/files/metadata/:id", c.FileMetaData.Get)
+	router.PATCH("/files/metadata/:id", c.FileMetaData.Patch)
+	router.GET("/files/download/:id", c.Download.Download)
+	router.DELETE("/files/del/:id", c.Delete.Delete)
+	router.POST("/files/archive", c.Archive.Archive)
+	router.OPTIONS("/files/tus", c.Tus.Options)
+	router.POST("/files/tus", c.Tus.Create)
+	router.HEAD("/files/tus/:id", c.Tus.Head)
+	router.PATCH("/files/tus/:id", c.Tus.Patch)
+	router.DELETE("/files/tus/:id", c.Tus.Delete)
+	router.POST("/files/chunks/missing", c.Manifest.Missing)
+	router.PUT("/files/chunks/:hash", c.Manifest.PutChunk)
+	router.POST("/files/manifest", c.Manifest.Commit)
+	router.GET("/files/manifest/:id", c.Manifest.Get)
+	router.POST("/snapshots", c.Snapshot.Create)
+	router.GET("/snapshots", c.Snapshot.List)
+	router.POST("/snapshots/forget", c.Snapshot.ForgetPolicy)
+	router.GET("/snapshots/:id", c.Snapshot.Get)
+	router.GET("/snapshots/:id/diff/:other", c.Snapshot.Diff)
+	router.GET("/snapshots/:id/restore", c.Snapshot.Restore)
+	router.DELETE("/snapshots/:id", c.Snapshot.Forget)
+	router.GET("/export", c.Bundle.Export)
+	router.POST("/import", c.Bundle.Import)
+	router.PUT("/replication/files/:id", c.Replication.Apply)
+	router.DELETE("/replication/files/:id", c.Replication.Remove)
+
+	return middleware.NewAuthMiddleware(router)
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"meliocool/bytesize/internal/controller"
+	"meliocool/bytesize/internal/middleware"
+	"net/http"
+)
+
+// NewS3Handler mounts the S3 gateway routes behind SigV4 authentication. domain, when set,
+// enables virtual-hosted-style bucket addressing.
+func NewS3Handler(s3Controller controller.S3Controller, accessKey string, secretKey string, domain string) http.Handler {
+	router := httprouter.New()
+	router.GET("/", s3Controller.ListBuckets)
+	router.GET("/:bucket", s3Controller.ListObjects)
+	router.HEAD("/:bucket", s3Controller.HeadBucket)
+	router.PUT("/:bucket", s3Controller.CreateBucket)
+	router.DELETE("/:bucket", s3Controller.DeleteBucket)
+	router.POST("/:bucket", s3Controller.DeleteObjects)
+	router.GET("/:bucket/*key", s3Controller.GetObject)
+	router.HEAD("/:bucket/*key", s3Controller.HeadObject)
+	router.PUT("/:bucket/*key", s3Controller.PutObject)
+	router.DELETE("/:bucket/*key", s3Controller.DeleteObject)
+	router.POST("/:bucket/*key", s3Controller.PostObject)
+	router.RedirectTrailingSlash = false
+
+	return middleware.NewSigV4Middleware(middleware.NewS3Middleware(router, domain), accessKey, secretKey)
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"meliocool/bytesize/pkg/client"
+	"os"
+)
+
+type exportResult struct {
+	Path string `json:"path"`
+	client.ExportResult
+}
+
+func setupExport(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	options := listFlags(fs)
+	output := fs.String("o", "", "write the bundle here instead of stdout")
+	resume := fs.Bool("continue", false, "finish the partial bundle an interrupted export left in -o")
+	force := fs.Bool("force", false, "overwrite an existing -o file")
+
+	return func(ctx context.Context, args []string) error {
+		opts, err := options(args)
+		if err != nil {
+			return err
+		}
+		if *resume && *force {
+			return usagef("--continue and --force are mutually exclusive")
+		}
+		if *resume && (opts.Prefix != "" || len(opts.Tags) > 0 || len(opts.Metadata) > 0) {
+			return usagef("--continue takes no filters; the bundle records the ones it was started with")
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+		exportOpts := &client.ExportOptions{Prefix: opts.Prefix, Tags: opts.Tags, Metadata: opts.Metadata}
+
+		if *output == "" || *output == "-" {
+			if *resume {
+				return usagef("--continue needs -o FILE")
+			}
+			if isTerminal(e.stdout) {
+				return usagef("not writing a bundle to a terminal; pass -o FILE or redirect stdout")
+			}
+			bar := e.newProgress("export", -1, 0)
+			_, err := c.Export(ctx, bar.writer(e.stdout), exportOpts)
+			bar.finish()
+			return err
+		}
+
+		flags := os.O_RDWR | os.O_CREATE | os.O_EXCL
+		switch {
+		case *resume:
+			flags = os.O_RDWR
+		case *force:
+			flags = os.O_RDWR | os.O_CREATE | os.O_TRUNC
+		}
+		f, err := os.OpenFile(*output, flags, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s exists; use --continue to finish it or --force to overwrite", *output)
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var result client.ExportResult
+		if *resume {
+			result, err = c.ResumeExport(ctx, f)
+		} else {
+			bar := e.newProgress("export", -1, 0)
+			result, err = c.Export(ctx, bar.writer(f), exportOpts)
+			bar.finish()
+		}
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil && !*resume && result.Bytes == 0 {
+			os.Remove(*output)
+			return err
+		}
+		if err != nil {
+			// * unlike a snapshot restore, a partial bundle is kept: everything up to its last
+			// * complete segment is reused
+			return fmt.Errorf("%w (rerun with --continue -o %s to finish the bundle)", err, *output)
+		}
+
+		summary := exportResult{Path: *output, ExportResult: result}
+		return e.emit(summary, func(w io.Writer) {
+			fmt.Fprintf(w, "%s  %s: %d files, %d chunks in %d segments", summary.Path, humanBytes(result.Resumed+result.Bytes), result.Files, result.Chunks, result.Segments)
+			if result.Resumed > 0 {
+				fmt.Fprintf(w, "  (resumed at %s)", humanBytes(result.Resumed))
+			}
+			fmt.Fprintln(w)
+		})
+	}
+}
+
+func setupImport(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return usagef("import takes one bundle file (- reads stdin)")
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+
+		var r io.Reader = e.stdin
+		total := int64(-1)
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			r, total = f, info.Size()
+		}
+
+		bar := e.newProgress("import", total, 0)
+		result, err := c.Import(ctx, r, &client.ImportOptions{Progress: bar.set})
+		bar.finish()
+		if err != nil {
+			// * files and chunks the server already has are skipped, so a rerun only adds the rest
+			return fmt.Errorf("%w (the import is safe to run again)", err)
+		}
+		return e.emit(result, func(w io.Writer) {
+			fmt.Fprintf(w, "imported %d files (%d already present) from %d segments; stored %d chunks (%s), %d already present\n",
+				result.FilesCreated, result.FilesSkipped, result.Segments, result.ChunksStored, humanBytes(result.BytesStored), result.ChunksPresent)
+		})
+	}
+}
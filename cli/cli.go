@@ -0,0 +1,248 @@
+// Package cli implements bytesize-cli, the command line client for a ByteSize server. It is a
+// thin layer over pkg/client; cmd/bytesize-cli is the binary.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"meliocool/bytesize/pkg/client"
+	"os"
+	"strings"
+)
+
+const name = "bytesize-cli"
+
+// env is one invocation: its streams, the global flags and the resolved connection settings.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	profile string
+	url     string
+	apiKey  string
+	json    bool
+	quiet   bool
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	// setup registers the command's flags on fs and returns the function that runs it with the
+	// positional arguments.
+	setup func(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error
+}
+
+// usageError is a wrong invocation; Run prints the command's usage and exits with 2.
+type usageError struct{ msg string }
+
+func (u usageError) Error() string { return u.msg }
+
+func usagef(format string, args ...any) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+func commands() []command {
+	return []command{
+		{"put", "FILE...", "upload files (- reads stdin)", setupPut},
+		{"get", "ID", "download a file, resuming a partial one with --continue", setupGet},
+		{"ls", "[PREFIX]", "list files, newest first", setupLs},
+		{"stat", "ID...", "show file metadata", setupStat},
+		{"rm", "ID...", "delete files", setupRm},
+		{"share", "ID", "print a download link that works without the API key", setupShare},
+		{"du", "[PREFIX]", "sum file sizes per directory", setupDu},
+		{"sync", "SRC DST", "mirror a directory to a prefix, or a prefix to a directory with --reverse", setupSync},
+		{"snapshot", "create DIR | ls | show ID | diff ID ID | restore ID | forget [ID...]", "back up a directory tree as a snapshot, and list, compare, restore or expire snapshots", setupSnapshot},
+		{"export", "[PREFIX]", "write files and their chunks to a bundle, finishing a partial one with --continue", setupExport},
+		{"import", "BUNDLE", "recreate the files of a bundle, skipping the ones already present", setupImport},
+		{"profile", "ls | set NAME | use NAME | rm NAME", "manage server profiles", setupProfile},
+		{"completion", "bash | zsh | fish", "print a shell completion script", setupCompletion},
+	}
+}
+
+// Run executes bytesize-cli with args (without the program name) and returns the exit code.
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	e := &env{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	top := flag.NewFlagSet(name, flag.ContinueOnError)
+	top.SetOutput(io.Discard)
+	e.globalFlags(top)
+	if err := top.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(stdout)
+			return 0
+		}
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		printUsage(stderr)
+		return 2
+	}
+	if top.NArg() == 0 || top.Arg(0) == "help" {
+		printUsage(stderr)
+		return 2
+	}
+
+	var cmd *command
+	for _, c := range commands() {
+		if c.name == top.Arg(0) {
+			cmd = &c
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "%s: unknown command %q\n", name, top.Arg(0))
+		printUsage(stderr)
+		return 2
+	}
+
+	fs := flag.NewFlagSet(name+" "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s %s [flags] %s\n\n%s.\n\nflags:\n", name, cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	// * the globals are accepted after the command too; registering them again keeps the values parsed so far
+	e.globalFlags(fs)
+	run := cmd.setup(fs, e)
+	positional, err := parseInterspersed(fs, top.Args()[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	err = run(ctx, positional)
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "%s %s: %v\n", name, cmd.name, err)
+		fs.Usage()
+		return 2
+	default:
+		fmt.Fprintf(stderr, "%s %s: %v\n", name, cmd.name, err)
+		return 1
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s [--profile NAME] [--url URL] [--api-key KEY] [--json] [--quiet] COMMAND [ARGS]\n\ncommands:\n", name)
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-11s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s COMMAND --help' for a command's flags.\n", name)
+}
+
+func (e *env) globalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&e.profile, "profile", e.profile, "config profile to use (default: the current profile, or $BYTESIZE_PROFILE)")
+	fs.StringVar(&e.url, "url", e.url, "server URL, overriding the profile (or $BYTESIZE_URL)")
+	fs.StringVar(&e.apiKey, "api-key", e.apiKey, "API key, overriding the profile (or $BYTESIZE_API_KEY)")
+	fs.BoolVar(&e.json, "json", e.json, "print results as JSON, one object per line")
+	fs.BoolVar(&e.quiet, "quiet", e.quiet, "no progress bars")
+}
+
+// parseInterspersed parses fs from args, allowing flags after positional arguments; "--" ends
+// flag parsing.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		consumed := len(args) - fs.NArg()
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, fs.Args()...), nil
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// client builds a client from the flags, the environment and the selected profile, in that
+// order of precedence.
+func (e *env) client() (*client.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	profileName := firstNonEmpty(e.profile, os.Getenv("BYTESIZE_PROFILE"), cfg.Current, defaultProfile)
+	profile, ok := cfg.Profiles[profileName]
+	if !ok && (e.profile != "" || os.Getenv("BYTESIZE_PROFILE") != "") {
+		return nil, fmt.Errorf("no profile %q; create it with '%s profile set %s --url URL --api-key KEY'", profileName, name, profileName)
+	}
+
+	url := firstNonEmpty(e.url, os.Getenv("BYTESIZE_URL"), profile.URL, defaultURL)
+	apiKey := firstNonEmpty(e.apiKey, os.Getenv("BYTESIZE_API_KEY"), profile.APIKey)
+	return client.New(url, apiKey), nil
+}
+
+// emit prints v as one JSON line in --json mode, and calls human otherwise.
+func (e *env) emit(v any, human func(w io.Writer)) error {
+	if e.json {
+		return json.NewEncoder(e.stdout).Encode(v)
+	}
+	human(e.stdout)
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// metaFlags is a repeatable key=value flag.
+type metaFlags map[string]string
+
+func (m metaFlags) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m metaFlags) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("want key=value, got %q", v)
+	}
+	m[key] = value
+	return nil
+}
+
+// splitTags accepts repeated and comma-separated --tag values.
+func splitTags(raw []string) []string {
+	var tags []string
+	for _, r := range raw {
+		for _, tag := range strings.Split(r, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
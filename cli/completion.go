@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+func setupCompletion(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return usagef("name one shell")
+		}
+		switch args[0] {
+		case "bash":
+			writeBash(e.stdout)
+		case "zsh":
+			// * zsh runs the bash script through bashcompinit
+			fmt.Fprintln(e.stdout, "autoload -U +X bashcompinit && bashcompinit")
+			writeBash(e.stdout)
+		case "fish":
+			writeFish(e.stdout)
+		default:
+			return usagef("unsupported shell %q", args[0])
+		}
+		return nil
+	}
+}
+
+// commandFlags lists the flags of cmd, globals included, by running its setup on a scratch
+// FlagSet; the scripts are generated from the same definitions the parser uses.
+func commandFlags(cmd command) []*flag.Flag {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	e := &env{}
+	e.globalFlags(fs)
+	cmd.setup(fs, e)
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	return flags
+}
+
+// flagName is how the scripts spell f: -o for one letter, --name otherwise.
+func flagName(f *flag.Flag) string {
+	if len(f.Name) == 1 {
+		return "-" + f.Name
+	}
+	return "--" + f.Name
+}
+
+// fishQuote single-quotes s, so fish does not expand the $VARS in flag usages.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// takesValue reports whether f consumes the next argument, i.e. is not a boolean flag.
+func takesValue(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+func writeBash(w io.Writer) {
+	var names []string
+	valueFlags := map[string]bool{}
+	for _, cmd := range commands() {
+		names = append(names, cmd.name)
+		for _, f := range commandFlags(cmd) {
+			if takesValue(f) {
+				valueFlags[flagName(f)] = true
+			}
+		}
+	}
+	var skip []string
+	for f := range valueFlags {
+		skip = append(skip, f)
+	}
+	slices.Sort(skip)
+
+	fmt.Fprintf(w, `_bytesize_cli() {
+  local cur=${COMP_WORDS[COMP_CWORD]} cmd="" i
+  for ((i = 1; i < COMP_CWORD; i++)); do
+    case ${COMP_WORDS[i]} in
+      %s) ((i++)) ;;
+      -*) ;;
+      *) cmd=${COMP_WORDS[i]}; break ;;
+    esac
+  done
+  if [[ -z $cmd ]]; then
+    COMPREPLY=($(compgen -W "%s" -- "$cur"))
+    return
+  fi
+  local opts args
+  case $cmd in
+`, strings.Join(skip, "|"), strings.Join(names, " "))
+	for _, cmd := range commands() {
+		var opts []string
+		for _, f := range commandFlags(cmd) {
+			opts = append(opts, flagName(f))
+		}
+		args := ""
+		switch cmd.name {
+		case "snapshot":
+			args = "create ls show diff restore forget"
+		case "profile":
+			args = "ls set use rm"
+		case "completion":
+			args = "bash zsh fish"
+		}
+		fmt.Fprintf(w, "    %s) opts=%q; args=%q ;;\n", cmd.name, strings.Join(opts, " "), args)
+	}
+	fmt.Fprintf(w, `  esac
+  if [[ $cur == -* ]]; then
+    COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+  elif [[ -n $args ]]; then
+    COMPREPLY=($(compgen -W "$args" -- "$cur"))
+  else
+    COMPREPLY=($(compgen -f -- "$cur"))
+  fi
+}
+complete -o filenames -F _bytesize_cli %s
+`, name)
+}
+
+func writeFish(w io.Writer) {
+	fmt.Fprintf(w, "complete -c %s -f\n", name)
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", name, cmd.name, fishQuote(cmd.summary))
+	}
+	for _, cmd := range commands() {
+		cond := "__fish_seen_subcommand_from " + cmd.name
+		for _, f := range commandFlags(cmd) {
+			option := "-l"
+			if len(f.Name) == 1 {
+				option = "-s"
+			}
+			line := fmt.Sprintf("complete -c %s -n %s %s %s -d %s", name, fishQuote(cond), option, f.Name, fishQuote(f.Usage))
+			if takesValue(f) {
+				line += " -r"
+			}
+			fmt.Fprintln(w, line)
+		}
+		switch cmd.name {
+		case "put", "sync", "import":
+			fmt.Fprintf(w, "complete -c %s -n %s -F\n", name, fishQuote(cond))
+		case "snapshot":
+			fmt.Fprintf(w, "complete -c %s -n %s -a 'create ls show diff restore forget'\n", name, fishQuote(cond))
+		case "profile":
+			fmt.Fprintf(w, "complete -c %s -n %s -a 'ls set use rm'\n", name, fishQuote(cond))
+		case "completion":
+			fmt.Fprintf(w, "complete -c %s -n %s -a 'bash zsh fish'\n", name, fishQuote(cond))
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+)
+
+const (
+	defaultProfile = "default"
+	defaultURL     = "http://localhost:8080"
+)
+
+type profile struct {
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+}
+
+// config is the profiles file, $BYTESIZE_CONFIG or <user config dir>/bytesize/config.json.
+type config struct {
+	Current  string             `json:"current,omitempty"`
+	Profiles map[string]profile `json:"profiles"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("BYTESIZE_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bytesize", "config.json"), nil
+}
+
+// loadConfig reads the profiles file; a missing file is an empty config.
+func loadConfig() (*config, error) {
+	cfg := &config{Profiles: map[string]profile{}}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]profile{}
+	}
+	return cfg, nil
+}
+
+// save writes the config through a temp file; it holds API keys, so only the owner can read it.
+func (c *config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(raw, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+type profileRow struct {
+	Name    string
+	URL     string
+	Current bool
+}
+
+func setupProfile(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	// * set stores the global --url and --api-key
+	use := fs.Bool("use", false, "make the profile current (set)")
+
+	return func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return usagef("missing subcommand")
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		switch args[0] {
+		case "ls":
+			if len(args) != 1 {
+				return usagef("ls takes no arguments")
+			}
+			names := make([]string, 0, len(cfg.Profiles))
+			for name := range cfg.Profiles {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			current := firstNonEmpty(cfg.Current, defaultProfile)
+			if e.json {
+				for _, name := range names {
+					row := profileRow{Name: name, URL: cfg.Profiles[name].URL, Current: name == current}
+					if err := e.emit(row, nil); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+			for _, name := range names {
+				marker := " "
+				if name == current {
+					marker = "*"
+				}
+				fmt.Fprintf(tw, "%s %s\t%s\n", marker, name, cfg.Profiles[name].URL)
+			}
+			return tw.Flush()
+
+		case "set":
+			if len(args) != 2 {
+				return usagef("set takes one profile name")
+			}
+			p := cfg.Profiles[args[1]]
+			if e.url != "" {
+				p.URL = e.url
+			}
+			if e.apiKey != "" {
+				p.APIKey = e.apiKey
+			}
+			if p.URL == "" {
+				return usagef("--url is required for a new profile")
+			}
+			cfg.Profiles[args[1]] = p
+			if *use || len(cfg.Profiles) == 1 {
+				cfg.Current = args[1]
+			}
+			return cfg.save()
+
+		case "use":
+			if len(args) != 2 {
+				return usagef("use takes one profile name")
+			}
+			if _, ok := cfg.Profiles[args[1]]; !ok {
+				return fmt.Errorf("no profile %q", args[1])
+			}
+			cfg.Current = args[1]
+			return cfg.save()
+
+		case "rm":
+			if len(args) != 2 {
+				return usagef("rm takes one profile name")
+			}
+			if _, ok := cfg.Profiles[args[1]]; !ok {
+				return fmt.Errorf("no profile %q", args[1])
+			}
+			delete(cfg.Profiles, args[1])
+			if cfg.Current == args[1] {
+				cfg.Current = ""
+			}
+			return cfg.save()
+		}
+		return usagef("unknown subcommand %q", args[0])
+	}
+}
@@ -0,0 +1,295 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"meliocool/bytesize/pkg/client"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// listFlags registers the filters ls and du share; the optional PREFIX argument is the same as
+// --prefix.
+func listFlags(fs *flag.FlagSet) func(args []string) (client.ListOptions, error) {
+	prefix := fs.String("prefix", "", "only filenames starting with this")
+	var tags stringList
+	fs.Var(&tags, "tag", "only files with this tag, repeatable")
+	meta := metaFlags{}
+	fs.Var(meta, "meta", "only files with metadata key=value, repeatable")
+
+	return func(args []string) (client.ListOptions, error) {
+		opts := client.ListOptions{Prefix: *prefix, Tags: splitTags(tags), Metadata: meta}
+		switch {
+		case len(args) > 1:
+			return opts, usagef("at most one prefix")
+		case len(args) == 1 && *prefix != "":
+			return opts, usagef("give the prefix as an argument or with --prefix, not both")
+		case len(args) == 1:
+			opts.Prefix = args[0]
+		}
+		return opts, nil
+	}
+}
+
+func setupLs(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	options := listFlags(fs)
+	long := fs.Bool("l", false, "long listing: content type, expiry and tags too")
+	limit := fs.Int("limit", 0, "stop after this many files (0: all)")
+
+	return func(ctx context.Context, args []string) error {
+		opts, err := options(args)
+		if err != nil {
+			return err
+		}
+		if *limit < 0 {
+			return usagef("--limit must not be negative")
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+		count := 0
+		for file, err := range c.List(ctx, opts) {
+			if err != nil {
+				tw.Flush()
+				return err
+			}
+			err = e.emit(file, func(io.Writer) {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t", file.ID, humanBytes(file.TotalSize), file.CreatedAt.Local().Format(time.DateTime))
+				if *long {
+					expires := "-"
+					if file.ExpiresAt != nil {
+						expires = file.ExpiresAt.Local().Format(time.DateTime)
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t", firstNonEmpty(file.ContentType, "-"), expires, firstNonEmpty(strings.Join(file.Tags, ","), "-"))
+				}
+				fmt.Fprintln(tw, file.Filename)
+			})
+			if err != nil {
+				return err
+			}
+			if count++; count == *limit {
+				break
+			}
+		}
+		return tw.Flush()
+	}
+}
+
+func setupStat(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		ids, err := parseIDs(args)
+		if err != nil {
+			return err
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+		for i, id := range ids {
+			file, err := c.Stat(ctx, id)
+			if err != nil {
+				return fmt.Errorf("%s: %w", id, err)
+			}
+			err = e.emit(file, func(w io.Writer) {
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				printFile(w, file)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func printFile(w io.Writer, file client.File) {
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%s\n", file.ID)
+	fmt.Fprintf(tw, "Filename:\t%s\n", file.Filename)
+	fmt.Fprintf(tw, "Size:\t%s (%d bytes)\n", humanBytes(file.TotalSize), file.TotalSize)
+	fmt.Fprintf(tw, "Content-Type:\t%s\n", firstNonEmpty(file.ContentType, "-"))
+	fmt.Fprintf(tw, "Chunks:\t%d\n", file.ChunksCount)
+	fmt.Fprintf(tw, "Created:\t%s\n", file.CreatedAt.Local().Format(time.RFC3339))
+	fmt.Fprintf(tw, "Updated:\t%s\n", file.UpdatedAt.Local().Format(time.RFC3339))
+	if file.ExpiresAt != nil {
+		fmt.Fprintf(tw, "Expires:\t%s\n", file.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	if len(file.Tags) > 0 {
+		fmt.Fprintf(tw, "Tags:\t%s\n", strings.Join(file.Tags, ", "))
+	}
+	keys := make([]string, 0, len(file.Metadata))
+	for k := range file.Metadata {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "meta.%s:\t%s\n", k, file.Metadata[k])
+	}
+	tw.Flush()
+}
+
+func setupRm(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		ids, err := parseIDs(args)
+		if err != nil {
+			return err
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+		// * keep going past failures so one bad id does not strand the rest
+		var failed int
+		for _, id := range ids {
+			result, err := c.Delete(ctx, id)
+			if err != nil {
+				fmt.Fprintf(e.stderr, "%s rm: %s: %v\n", name, id, err)
+				failed++
+				continue
+			}
+			err = e.emit(result, func(w io.Writer) {
+				fmt.Fprintf(w, "deleted %s  (%d orphan chunks, %s freed)\n", result.FileID, result.OrphanChunksDeleted, humanBytes(result.OrphanBytesDeleted))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d deletes failed", failed, len(ids))
+		}
+		return nil
+	}
+}
+
+type shareResult struct {
+	ID        uuid.UUID
+	URL       string
+	ExpiresAt time.Time
+}
+
+func setupShare(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	ttl := fs.Duration("ttl", 24*time.Hour, "how long the link works")
+	inline := fs.Bool("inline", false, "ask browsers to display the file instead of saving it")
+
+	return func(ctx context.Context, args []string) error {
+		ids, err := parseIDs(args)
+		if err != nil {
+			return err
+		}
+		if len(ids) != 1 {
+			return usagef("share takes one file id")
+		}
+		if *ttl <= 0 {
+			return usagef("--ttl must be positive")
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+		// * the link is signed locally; stat first so a mistyped id fails here, not for the recipient
+		if _, err := c.Stat(ctx, ids[0]); err != nil {
+			return err
+		}
+
+		expiresAt := time.Now().Add(*ttl).Truncate(time.Second)
+		result := shareResult{ID: ids[0], URL: c.ShareURL(ids[0], expiresAt, *inline), ExpiresAt: expiresAt}
+		return e.emit(result, func(w io.Writer) {
+			fmt.Fprintln(w, result.URL)
+		})
+	}
+}
+
+type duEntry struct {
+	Path  string
+	Files int64
+	Bytes int64
+}
+
+func setupDu(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	options := listFlags(fs)
+	depth := fs.Int("depth", 1, "directory levels below the prefix to report; 0 prints only the total")
+
+	return func(ctx context.Context, args []string) error {
+		opts, err := options(args)
+		if err != nil {
+			return err
+		}
+		if *depth < 0 {
+			return usagef("--depth must not be negative")
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+
+		// * sizes are logical; chunks shared between files are counted once per file
+		total := duEntry{Path: firstNonEmpty(opts.Prefix, ".")}
+		dirs := map[string]*duEntry{}
+		for file, err := range c.List(ctx, opts) {
+			if err != nil {
+				return err
+			}
+			total.Files++
+			total.Bytes += file.TotalSize
+
+			parts := strings.Split(strings.TrimPrefix(file.Filename, opts.Prefix), "/")
+			for d := 1; d <= *depth && d < len(parts); d++ {
+				dir := opts.Prefix + strings.Join(parts[:d], "/") + "/"
+				entry, ok := dirs[dir]
+				if !ok {
+					entry = &duEntry{Path: dir}
+					dirs[dir] = entry
+				}
+				entry.Files++
+				entry.Bytes += file.TotalSize
+			}
+		}
+
+		paths := make([]string, 0, len(dirs))
+		for dir := range dirs {
+			paths = append(paths, dir)
+		}
+		slices.Sort(paths)
+		entries := make([]duEntry, 0, len(paths)+1)
+		for _, dir := range paths {
+			entries = append(entries, *dirs[dir])
+		}
+		entries = append(entries, total)
+
+		tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+		for _, entry := range entries {
+			err := e.emit(entry, func(io.Writer) {
+				fmt.Fprintf(tw, "%s\t%d files\t  %s\n", humanBytes(entry.Bytes), entry.Files, entry.Path)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	}
+}
+
+func parseIDs(args []string) ([]uuid.UUID, error) {
+	if len(args) == 0 {
+		return nil, usagef("no file ids given")
+	}
+	ids := make([]uuid.UUID, 0, len(args))
+	for _, arg := range args {
+		id, err := uuid.Parse(arg)
+		if err != nil {
+			return nil, usagef("bad file id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
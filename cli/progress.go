@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const barWidth = 30
+
+// progressBar redraws one stderr line at most every 100ms. A total of -1 means unknown, which
+// shows the byte count and rate without a bar.
+type progressBar struct {
+	w      io.Writer
+	label  string
+	total  int64
+	start  time.Time
+	base   int64
+	mu     sync.Mutex
+	done   int64
+	drawn  time.Time
+	active bool
+}
+
+// newProgress returns a bar drawing to stderr, or nil when bars are off: --quiet, or stderr is
+// not a terminal. All progressBar methods accept a nil receiver.
+func (e *env) newProgress(label string, total int64, base int64) *progressBar {
+	if e.quiet || !isTerminal(e.stderr) {
+		return nil
+	}
+	return &progressBar{w: e.stderr, label: label, total: total, start: time.Now(), base: base, done: base}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// set records the bytes transferred so far, counting base, and redraws if due.
+func (p *progressBar) set(done int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = done
+	if time.Since(p.drawn) >= 100*time.Millisecond {
+		p.draw()
+	}
+}
+
+// writer counts what passes through w into the bar.
+func (p *progressBar) writer(w io.Writer) io.Writer {
+	if p == nil {
+		return w
+	}
+	return &progressWriter{w: w, bar: p}
+}
+
+// finish draws the final state and ends the line.
+func (p *progressBar) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active {
+		p.draw()
+		fmt.Fprintln(p.w)
+	}
+}
+
+func (p *progressBar) draw() {
+	p.drawn = time.Now()
+	p.active = true
+	rate := ""
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = humanBytes(int64(float64(p.done-p.base)/elapsed)) + "/s"
+	}
+
+	if p.total < 0 {
+		fmt.Fprintf(p.w, "\r%s  %s  %s\033[K", p.label, humanBytes(p.done), rate)
+		return
+	}
+	ratio := 1.0
+	if p.total > 0 {
+		ratio = min(float64(p.done)/float64(p.total), 1)
+	}
+	filled := int(ratio * barWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", barWidth-filled)
+	fmt.Fprintf(p.w, "\r%s [%s] %3.0f%%  %s / %s  %s\033[K", p.label, bar, ratio*100, humanBytes(p.done), humanBytes(p.total), rate)
+}
+
+type progressWriter struct {
+	w   io.Writer
+	bar *progressBar
+	n   int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	p.bar.set(p.bar.base + p.n)
+	return n, err
+}
+
+// humanBytes formats n in binary units, e.g. 1.5 MiB.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,382 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"io/fs"
+	"meliocool/bytesize/pkg/client"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type snapshotResult struct {
+	client.Snapshot
+	ChunksSent  int64 `json:"chunks_sent"`
+	BytesSent   int64 `json:"bytes_sent"`
+	BytesReused int64 `json:"bytes_reused"`
+}
+
+type forgetRow struct {
+	Action   string          `json:"action"`
+	Snapshot client.Snapshot `json:"snapshot"`
+	Reasons  []string        `json:"reasons,omitempty"`
+}
+
+func setupSnapshot(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	host := fs.String("host", "", "hostname to record (create; default: this host) or filter by (ls, forget)")
+	var tags stringList
+	fs.Var(&tags, "tag", "tag to record (create) or filter by (ls, forget), repeatable")
+	jobs := fs.Int("jobs", 4, "chunks uploaded in parallel (create)")
+	output := fs.String("o", "", "write the tar stream here instead of stdout (restore)")
+	subpath := fs.String("path", "", "restore only this path and what is below it (restore)")
+	gzipped := fs.Bool("gzip", false, "gzip the tar stream (restore)")
+	keepLast := fs.Int("keep-last", 0, "keep the newest N snapshots (forget)")
+	keepDaily := fs.Int("keep-daily", 0, "keep the newest snapshot of each of the last N days (forget)")
+	keepWeekly := fs.Int("keep-weekly", 0, "keep the newest snapshot of each of the last N weeks (forget)")
+	keepMonthly := fs.Int("keep-monthly", 0, "keep the newest snapshot of each of the last N months (forget)")
+	dryRun := fs.Bool("dry-run", false, "only print what forget would remove")
+
+	return func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return usagef("missing subcommand")
+		}
+		if *jobs < 1 {
+			return usagef("--jobs must be at least 1")
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+		filter := client.SnapshotFilter{Hostname: *host, Tags: splitTags(tags)}
+
+		switch args[0] {
+		case "create":
+			if len(args) != 2 {
+				return usagef("create takes one directory")
+			}
+			opts := client.SnapshotOptions{Hostname: *host, Tags: splitTags(tags)}
+			if opts.Hostname == "" {
+				opts.Hostname, _ = os.Hostname()
+			}
+			return e.snapshotCreate(ctx, c, args[1], opts, *jobs)
+
+		case "ls":
+			if len(args) != 1 {
+				return usagef("ls takes no arguments")
+			}
+			snapshots, err := c.ListSnapshots(ctx, filter)
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+			for _, s := range snapshots {
+				err := e.emit(s, func(io.Writer) {
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%d files\t%s\t%s\t%s\n", s.ID, s.Time.Local().Format(time.DateTime), firstNonEmpty(s.Hostname, "-"),
+						s.FileCount, humanBytes(s.TotalSize), firstNonEmpty(strings.Join(s.Tags, ","), "-"), strings.Join(s.Paths, " "))
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return tw.Flush()
+
+		case "show":
+			ids, err := parseIDs(args[1:])
+			if err != nil {
+				return err
+			}
+			if len(ids) != 1 {
+				return usagef("show takes one snapshot id")
+			}
+			s, err := c.Snapshot(ctx, ids[0])
+			if err != nil {
+				return err
+			}
+			if e.json {
+				return e.emit(s, nil)
+			}
+			tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+			for _, entry := range s.Entries {
+				name := entry.Path
+				switch entry.Type {
+				case client.EntryDir:
+					name += "/"
+				case client.EntrySymlink:
+					name += " -> " + entry.Target
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entryMode(entry), humanBytes(entry.Size), entry.ModTime.Local().Format(time.DateTime), name)
+			}
+			return tw.Flush()
+
+		case "diff":
+			ids, err := parseIDs(args[1:])
+			if err != nil {
+				return err
+			}
+			if len(ids) != 2 {
+				return usagef("diff takes two snapshot ids")
+			}
+			diff, err := c.DiffSnapshots(ctx, ids[0], ids[1])
+			if err != nil {
+				return err
+			}
+			return e.emit(diff, func(w io.Writer) {
+				markers := map[string]string{"added": "+", "removed": "-", "modified": "M", "metadata": "U"}
+				for _, change := range diff.Changes {
+					fmt.Fprintf(w, "%s %s\n", markers[change.Change], change.Path)
+				}
+				fmt.Fprintf(w, "%d added, %d removed, %d modified, %d metadata only; +%s -%s\n",
+					diff.Added, diff.Removed, diff.Modified, diff.Metadata, humanBytes(diff.AddedBytes), humanBytes(diff.RemovedBytes))
+			})
+
+		case "restore":
+			ids, err := parseIDs(args[1:])
+			if err != nil {
+				return err
+			}
+			if len(ids) != 1 {
+				return usagef("restore takes one snapshot id")
+			}
+			return e.snapshotRestore(ctx, c, ids[0], *output, &client.RestoreOptions{Path: *subpath, Gzip: *gzipped})
+
+		case "forget":
+			policy := client.ForgetPolicy{
+				Hostname:    *host,
+				Tags:        filter.Tags,
+				KeepLast:    *keepLast,
+				KeepDaily:   *keepDaily,
+				KeepWeekly:  *keepWeekly,
+				KeepMonthly: *keepMonthly,
+				DryRun:      *dryRun,
+			}
+			if policy.KeepLast < 0 || policy.KeepDaily < 0 || policy.KeepWeekly < 0 || policy.KeepMonthly < 0 {
+				return usagef("--keep-* must not be negative")
+			}
+			withPolicy := policy.KeepLast+policy.KeepDaily+policy.KeepWeekly+policy.KeepMonthly > 0
+			switch {
+			case withPolicy && len(args) > 1:
+				return usagef("give snapshot ids or --keep-* flags, not both")
+			case withPolicy:
+				return e.snapshotForgetPolicy(ctx, c, policy)
+			case len(args) == 1:
+				return usagef("forget takes snapshot ids or --keep-* flags")
+			}
+			if *dryRun {
+				return usagef("--dry-run only applies to --keep-* policies")
+			}
+			ids, err := parseIDs(args[1:])
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := c.ForgetSnapshot(ctx, id); err != nil {
+					return fmt.Errorf("%s: %w", id, err)
+				}
+				err := e.emit(forgetRow{Action: "remove", Snapshot: client.Snapshot{ID: id}}, func(w io.Writer) {
+					fmt.Fprintf(w, "forgot %s\n", id)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return usagef("unknown subcommand %q", args[0])
+	}
+}
+
+// entryMode renders an entry's type and permissions the way ls -l does.
+func entryMode(entry client.SnapshotEntry) string {
+	mode := fs.FileMode(entry.Mode) & fs.ModePerm
+	switch entry.Type {
+	case client.EntryDir:
+		mode |= fs.ModeDir
+	case client.EntrySymlink:
+		mode |= fs.ModeSymlink
+	}
+	return mode.String()
+}
+
+// snapshotCreate reads the tree under dir, sends the chunks the server lacks and records the
+// snapshot. Unreadable files are left out with a warning, and make the command fail after the
+// snapshot is saved.
+func (e *env) snapshotCreate(ctx context.Context, c *client.Client, dir string, opts client.SnapshotOptions, jobs int) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	opts.Paths = []string{filepath.ToSlash(root)}
+	opts.Time = time.Now()
+
+	var entries []client.SnapshotEntry
+	var files []pushFile
+	skipped := 0
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			fmt.Fprintf(e.stderr, "%s snapshot: skipping %s: %v\n", name, path, err)
+			skipped++
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			fmt.Fprintf(e.stderr, "%s snapshot: skipping %s: %v\n", name, path, err)
+			skipped++
+			return nil
+		}
+		entry := client.SnapshotEntry{Path: filepath.ToSlash(rel), Mode: int64(info.Mode().Perm()), ModTime: info.ModTime()}
+		switch {
+		case info.IsDir():
+			entry.Type = client.EntryDir
+		case info.Mode()&fs.ModeSymlink != 0:
+			entry.Type = client.EntrySymlink
+			if entry.Target, err = os.Readlink(path); err != nil {
+				fmt.Fprintf(e.stderr, "%s snapshot: skipping %s: %v\n", name, path, err)
+				skipped++
+				return nil
+			}
+		case info.Mode().IsRegular():
+			entry.Type = client.EntryFile
+			if entry.Chunks, err = hashFile(path); err != nil {
+				fmt.Fprintf(e.stderr, "%s snapshot: skipping %s: %v\n", name, path, err)
+				skipped++
+				return nil
+			}
+			files = append(files, pushFile{rel: entry.Path, path: path, info: info, chunks: entry.Chunks})
+		default:
+			fmt.Fprintf(e.stderr, "%s snapshot: skipping %s: not a file, directory or symlink\n", name, path)
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%s is empty", dir)
+	}
+
+	s := &syncer{e: e, c: c, jobs: jobs}
+	send := func() error {
+		for start := 0; start < len(files); {
+			end, hashes := start, 0
+			for end < len(files) && (end == start || hashes+len(files[end].chunks) <= pushBatchHashes) {
+				hashes += len(files[end].chunks)
+				end++
+			}
+			failed, err := s.sendMissing(ctx, files[start:end])
+			if err != nil {
+				return err
+			}
+			for _, f := range files[start:end] {
+				if err := failed[f.rel]; err != nil {
+					return fmt.Errorf("%s: %w", f.path, err)
+				}
+			}
+			start = end
+		}
+		return nil
+	}
+	if err := send(); err != nil {
+		return err
+	}
+	snapshot, err := c.CreateSnapshot(ctx, entries, &opts)
+	if errors.Is(err, client.ErrMissingChunks) {
+		// * a chunk was collected between the check and the create; send again once
+		if err = send(); err == nil {
+			snapshot, err = c.CreateSnapshot(ctx, entries, &opts)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	result := snapshotResult{Snapshot: snapshot, ChunksSent: s.summary.ChunksSent, BytesSent: s.summary.BytesSent, BytesReused: s.summary.BytesReused}
+	err = e.emit(result, func(w io.Writer) {
+		fmt.Fprintf(w, "snapshot %s saved: %d files, %s; sent %s in %d chunks, %s deduplicated\n",
+			snapshot.ID, snapshot.FileCount, humanBytes(snapshot.TotalSize), humanBytes(result.BytesSent), result.ChunksSent, humanBytes(result.BytesReused))
+	})
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		return fmt.Errorf("%d paths could not be read and are not in the snapshot", skipped)
+	}
+	return nil
+}
+
+func (e *env) snapshotRestore(ctx context.Context, c *client.Client, id uuid.UUID, output string, opts *client.RestoreOptions) error {
+	if output == "" || output == "-" {
+		if isTerminal(e.stdout) {
+			return usagef("not writing a tar stream to a terminal; pass -o FILE or pipe it into tar")
+		}
+		bar := e.newProgress("restore "+id.String()[:8], -1, 0)
+		_, err := c.RestoreSnapshot(ctx, id, bar.writer(e.stdout), opts)
+		bar.finish()
+		return err
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bar := e.newProgress("restore "+id.String()[:8], -1, 0)
+	_, err = c.RestoreSnapshot(ctx, id, bar.writer(f), opts)
+	bar.finish()
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		// * a cut-off tar stream is not worth keeping; the server rebuilds it from scratch anyway
+		os.Remove(output)
+		return err
+	}
+	return nil
+}
+
+func (e *env) snapshotForgetPolicy(ctx context.Context, c *client.Client, policy client.ForgetPolicy) error {
+	result, err := c.ForgetSnapshots(ctx, policy)
+	if err != nil {
+		return err
+	}
+	verb := "remove"
+	if result.DryRun {
+		verb = "would remove"
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	for _, kept := range result.Keep {
+		err := e.emit(forgetRow{Action: "keep", Snapshot: kept.Snapshot, Reasons: kept.Reasons}, func(io.Writer) {
+			fmt.Fprintf(tw, "keep\t%s\t%s\t%s\n", kept.Snapshot.ID, kept.Snapshot.Time.Local().Format(time.DateTime), strings.Join(kept.Reasons, ", "))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, removed := range result.Remove {
+		err := e.emit(forgetRow{Action: "remove", Snapshot: removed}, func(io.Writer) {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t\n", verb, removed.ID, removed.Time.Local().Format(time.DateTime))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,635 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"io/fs"
+	"maps"
+	"meliocool/bytesize/pkg/client"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// * synced files carry their source mtime and a digest of their chunk list, so the next run
+// * can skip a file without hashing it, or without sending it when only the mtime changed
+const (
+	metaSyncMtime    = "sync:mtime"
+	metaSyncManifest = "sync:manifest"
+)
+
+// pushBatchHashes is how many chunk hashes push collects before asking the server which it lacks.
+const pushBatchHashes = 1000
+
+// directoryContentType marks the empty directory entries WebDAV MKCOL creates; pull skips them.
+const directoryContentType = "application/x-directory"
+
+type syncAction struct {
+	Action string
+	Path   string
+	ID     uuid.UUID
+	Bytes  int64
+}
+
+type syncSummary struct {
+	Action    string
+	Files     int
+	Changed   int
+	Unchanged int
+	Deleted   int
+	Failed    int
+	// ChunksSent and BytesSent are what crossed the network; BytesReused is what did not have to,
+	// because the other side already held those chunks.
+	ChunksSent  int64
+	BytesSent   int64
+	BytesReused int64
+}
+
+type syncer struct {
+	e       *env
+	c       *client.Client
+	jobs    int
+	dryRun  bool
+	summary syncSummary
+}
+
+func setupSync(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	reverse := fs.Bool("reverse", false, "restore: copy REMOTE_PREFIX into LOCAL_DIR")
+	deleteExtra := fs.Bool("delete", false, "delete destination files the source does not have")
+	dryRun := fs.Bool("dry-run", false, "print what would change without changing anything")
+	jobs := fs.Int("jobs", 4, "chunks uploaded in parallel")
+	var tags stringList
+	fs.Var(&tags, "tag", "tag for uploaded files, repeatable")
+	meta := metaFlags{}
+	fs.Var(meta, "meta", "metadata key=value for uploaded files, repeatable")
+
+	return func(ctx context.Context, args []string) error {
+		if len(args) != 2 {
+			return usagef("sync takes a source and a destination")
+		}
+		if *jobs < 1 {
+			return usagef("--jobs must be at least 1")
+		}
+		for k := range meta {
+			if strings.HasPrefix(k, "sync:") {
+				return usagef("metadata keys under sync: are reserved")
+			}
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+
+		s := &syncer{e: e, c: c, jobs: *jobs, dryRun: *dryRun}
+		if *reverse {
+			s.summary.Action = "pull"
+			err = s.pull(ctx, syncPrefix(args[0]), args[1], *deleteExtra)
+		} else {
+			s.summary.Action = "push"
+			opts := client.CommitOptions{Metadata: meta, Tags: splitTags(tags), Replace: true}
+			err = s.push(ctx, args[0], syncPrefix(args[1]), *deleteExtra, opts)
+		}
+		if err != nil {
+			return err
+		}
+
+		summary := s.summary
+		if err := e.emit(summary, func(w io.Writer) { s.printSummary(w) }); err != nil {
+			return err
+		}
+		if summary.Failed > 0 {
+			return fmt.Errorf("%d of %d files failed", summary.Failed, summary.Files)
+		}
+		return nil
+	}
+}
+
+// syncPrefix makes a remote prefix name a directory, so "builds" does not also match "builds2/".
+func syncPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+func (s *syncer) printSummary(w io.Writer) {
+	changed, sent, reused := "uploaded", "sent", "deduplicated"
+	if s.summary.Action == "pull" {
+		changed, sent, reused = "downloaded", "fetched", "reused from local files"
+	}
+	if s.dryRun {
+		changed = "to be " + changed
+	}
+	fmt.Fprintf(w, "%d files: %d %s, %d unchanged, %d deleted, %d failed; %s %s in %d chunks, %s %s\n",
+		s.summary.Files, s.summary.Changed, changed, s.summary.Unchanged, s.summary.Deleted, s.summary.Failed,
+		sent, humanBytes(s.summary.BytesSent), s.summary.ChunksSent, humanBytes(s.summary.BytesReused), reused)
+}
+
+func (s *syncer) act(action syncAction) error {
+	return s.e.emit(action, func(w io.Writer) {
+		marker := "+"
+		if action.Action == "delete" {
+			marker = "-"
+		}
+		fmt.Fprintf(w, "%s %s\n", marker, action.Path)
+	})
+}
+
+func (s *syncer) fail(path string, err error) {
+	s.summary.Failed++
+	fmt.Fprintf(s.e.stderr, "%s sync: %s: %v\n", name, path, err)
+}
+
+// walkLocal lists the regular files under dir by slash-separated relative path. Anything else,
+// symlinks included, is skipped with a warning.
+func (s *syncer) walkLocal(dir string) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			fmt.Fprintf(s.e.stderr, "%s sync: skipping %s: not a regular file\n", name, path)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	return files, err
+}
+
+// walkRemote lists the files under prefix by path relative to it, the newest of each name.
+func (s *syncer) walkRemote(ctx context.Context, prefix string) (map[string]client.File, error) {
+	files := make(map[string]client.File)
+	for file, err := range s.c.List(ctx, client.ListOptions{Prefix: prefix, PageSize: 1000}) {
+		if err != nil {
+			return nil, err
+		}
+		rel := strings.TrimPrefix(file.Filename, prefix)
+		if _, seen := files[rel]; !seen {
+			files[rel] = file
+		}
+	}
+	return files, nil
+}
+
+func mtimeString(info fs.FileInfo) string {
+	return strconv.FormatInt(info.ModTime().UnixNano(), 10)
+}
+
+// manifestDigest identifies a file's content by its chunk list.
+func manifestDigest(chunks []client.Chunk) string {
+	h := sha256.New()
+	for _, c := range chunks {
+		io.WriteString(h, c.Hash)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashFile(path string) ([]client.Chunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return client.HashChunks(f)
+}
+
+// readChunk reads one chunk back and checks it still has the hash it was listed under.
+func readChunk(path string, offset int64, chunk client.Chunk) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, chunk.Size)
+	if _, err := f.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != chunk.Hash {
+		return nil, errors.New("file changed while syncing")
+	}
+	return data, nil
+}
+
+type pushFile struct {
+	rel    string
+	path   string
+	info   fs.FileInfo
+	chunks []client.Chunk
+	digest string
+}
+
+// push mirrors dir into prefix. Changed files are hashed locally, only the chunks the server
+// lacks are sent, and each file is committed from its manifest, replacing the older version.
+func (s *syncer) push(ctx context.Context, dir string, prefix string, deleteExtra bool, opts client.CommitOptions) error {
+	local, err := s.walkLocal(dir)
+	if err != nil {
+		return err
+	}
+	remote, err := s.walkRemote(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	var batch []pushFile
+	hashes := 0
+	for _, rel := range slices.Sorted(maps.Keys(local)) {
+		s.summary.Files++
+		info := local[rel]
+		r, exists := remote[rel]
+		if exists && r.TotalSize == info.Size() && r.Metadata[metaSyncMtime] == mtimeString(info) {
+			s.summary.Unchanged++
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		chunks, err := hashFile(path)
+		if err != nil {
+			s.fail(path, err)
+			continue
+		}
+		digest := manifestDigest(chunks)
+		if exists && r.Metadata[metaSyncManifest] == digest {
+			s.summary.Unchanged++
+			continue
+		}
+
+		batch = append(batch, pushFile{rel: rel, path: path, info: info, chunks: chunks, digest: digest})
+		if hashes += len(chunks); hashes >= pushBatchHashes {
+			s.pushBatch(ctx, prefix, batch, opts)
+			batch, hashes = nil, 0
+		}
+	}
+	s.pushBatch(ctx, prefix, batch, opts)
+
+	if !deleteExtra {
+		return nil
+	}
+	// * a source that could not be fully read must not be mistaken for deletions
+	if s.summary.Failed > 0 {
+		fmt.Fprintf(s.e.stderr, "%s sync: not deleting anything after failures\n", name)
+		return nil
+	}
+	for _, rel := range slices.Sorted(maps.Keys(remote)) {
+		if _, ok := local[rel]; ok {
+			continue
+		}
+		if err := s.deleteRemote(ctx, prefix, rel, remote[rel]); err != nil {
+			s.fail(prefix+rel, err)
+		}
+	}
+	return nil
+}
+
+func (s *syncer) deleteRemote(ctx context.Context, prefix string, rel string, file client.File) error {
+	if !s.dryRun {
+		if _, err := s.c.Delete(ctx, file.ID); err != nil && !errors.Is(err, client.ErrNotFound) {
+			return err
+		}
+	}
+	s.summary.Deleted++
+	return s.act(syncAction{Action: "delete", Path: prefix + rel, ID: file.ID, Bytes: file.TotalSize})
+}
+
+// pushBatch sends the chunks of batch the server lacks, then commits each file.
+func (s *syncer) pushBatch(ctx context.Context, prefix string, batch []pushFile, opts client.CommitOptions) {
+	if len(batch) == 0 {
+		return
+	}
+	failed, err := s.sendMissing(ctx, batch)
+	if err != nil {
+		for _, f := range batch {
+			s.fail(f.path, err)
+		}
+		return
+	}
+
+	for _, f := range batch {
+		if err := failed[f.rel]; err != nil {
+			s.fail(f.path, err)
+			continue
+		}
+		if s.dryRun {
+			s.summary.Changed++
+			if err := s.act(syncAction{Action: "upload", Path: prefix + f.rel, Bytes: f.info.Size()}); err != nil {
+				s.fail(f.path, err)
+			}
+			continue
+		}
+
+		commitOpts := opts
+		commitOpts.Metadata = map[string]string{metaSyncMtime: mtimeString(f.info), metaSyncManifest: f.digest}
+		maps.Copy(commitOpts.Metadata, opts.Metadata)
+		result, err := s.c.Commit(ctx, prefix+f.rel, f.chunks, &commitOpts)
+		if errors.Is(err, client.ErrMissingChunks) {
+			// * a chunk was collected between the check and the commit; send it again once
+			if failed, err = s.sendMissing(ctx, []pushFile{f}); err == nil && failed[f.rel] == nil {
+				result, err = s.c.Commit(ctx, prefix+f.rel, f.chunks, &commitOpts)
+			} else if err == nil {
+				err = failed[f.rel]
+			}
+		}
+		if err != nil {
+			s.fail(f.path, err)
+			continue
+		}
+		s.summary.Changed++
+		if err := s.act(syncAction{Action: "upload", Path: result.Filename, ID: result.FileID, Bytes: result.TotalSize}); err != nil {
+			s.fail(f.path, err)
+		}
+	}
+}
+
+// sendMissing uploads the chunks of files the server lacks, --jobs at a time. It returns the
+// error of each file whose chunks could not all be sent; a dry run only counts them.
+func (s *syncer) sendMissing(ctx context.Context, files []pushFile) (map[string]error, error) {
+	type source struct {
+		file   *pushFile
+		offset int64
+		chunk  client.Chunk
+	}
+	sources := make(map[string]source)
+	var hashes []string
+	var total int64
+	for i := range files {
+		var offset int64
+		for _, c := range files[i].chunks {
+			if _, ok := sources[c.Hash]; !ok {
+				sources[c.Hash] = source{file: &files[i], offset: offset, chunk: c}
+				hashes = append(hashes, c.Hash)
+			}
+			offset += c.Size
+			total += c.Size
+		}
+	}
+	missing, err := s.c.MissingChunks(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	var missingBytes int64
+	for _, hash := range missing {
+		missingBytes += sources[hash].chunk.Size
+	}
+	s.summary.ChunksSent += int64(len(missing))
+	s.summary.BytesSent += missingBytes
+	s.summary.BytesReused += total - missingBytes
+	if s.dryRun || len(missing) == 0 {
+		return nil, nil
+	}
+
+	bar := s.e.newProgress("sending chunks", missingBytes, 0)
+	defer bar.finish()
+	var sent atomic.Int64
+	errs := make([]error, len(missing))
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(s.jobs)
+	for i, hash := range missing {
+		src := sources[hash]
+		group.Go(func() error {
+			data, err := readChunk(src.file.path, src.offset, src.chunk)
+			if err == nil {
+				err = s.c.PutChunk(groupCtx, hash, data)
+			}
+			if err != nil {
+				errs[i] = err
+			}
+			bar.set(sent.Add(src.chunk.Size))
+			// * a failed chunk only fails the files using it; cancellation stops everything
+			return ctx.Err()
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	failed := make(map[string]error)
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		hash := missing[i]
+		for _, f := range files {
+			if _, done := failed[f.rel]; done {
+				continue
+			}
+			if slices.ContainsFunc(f.chunks, func(c client.Chunk) bool { return c.Hash == hash }) {
+				failed[f.rel] = err
+			}
+		}
+	}
+	return failed, nil
+}
+
+// pull mirrors prefix into dir. A changed file is rebuilt from the chunks its old local copy
+// already has, and only the rest is downloaded.
+func (s *syncer) pull(ctx context.Context, prefix string, dir string, deleteExtra bool) error {
+	remote, err := s.walkRemote(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range slices.Sorted(maps.Keys(remote)) {
+		file := remote[rel]
+		if file.ContentType == directoryContentType || rel == "" || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		s.summary.Files++
+		// * a stored name must not write outside dir
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			s.fail(file.Filename, errors.New("name is not a safe local path"))
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := s.pullFile(ctx, target, file); err != nil {
+			s.fail(target, err)
+		}
+	}
+
+	if !deleteExtra {
+		return nil
+	}
+	if s.summary.Failed > 0 {
+		fmt.Fprintf(s.e.stderr, "%s sync: not deleting anything after failures\n", name)
+		return nil
+	}
+	local, err := s.walkLocal(dir)
+	if err != nil {
+		return err
+	}
+	for _, rel := range slices.Sorted(maps.Keys(local)) {
+		if _, ok := remote[rel]; ok {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if !s.dryRun {
+			if err := os.Remove(path); err != nil {
+				s.fail(path, err)
+				continue
+			}
+		}
+		s.summary.Deleted++
+		if err := s.act(syncAction{Action: "delete", Path: path, Bytes: local[rel].Size()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syncer) pullFile(ctx context.Context, target string, file client.File) error {
+	info, err := os.Stat(target)
+	exists := err == nil && info.Mode().IsRegular()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if exists && info.Size() == file.TotalSize && file.Metadata[metaSyncMtime] == mtimeString(info) {
+		s.summary.Unchanged++
+		return nil
+	}
+
+	manifest, err := s.c.Manifest(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+	// * have maps each chunk of the old local copy to its offset there
+	have := make(map[string]int64)
+	if exists {
+		local, err := hashFile(target)
+		if err != nil {
+			return err
+		}
+		if slices.Equal(local, manifest) {
+			s.summary.Unchanged++
+			return s.setMtime(target, file)
+		}
+		var offset int64
+		for _, c := range local {
+			if _, ok := have[c.Hash]; !ok {
+				have[c.Hash] = offset
+			}
+			offset += c.Size
+		}
+	}
+
+	var fetch int64
+	var fetchChunks int64
+	for _, c := range manifest {
+		if _, ok := have[c.Hash]; !ok {
+			fetch += c.Size
+			fetchChunks++
+		}
+	}
+	s.summary.ChunksSent += fetchChunks
+	s.summary.BytesSent += fetch
+	s.summary.BytesReused += file.TotalSize - fetch
+	if !s.dryRun {
+		if err := s.rebuild(ctx, target, file, manifest, have, fetch); err != nil {
+			return err
+		}
+	}
+	s.summary.Changed++
+	return s.act(syncAction{Action: "download", Path: target, ID: file.ID, Bytes: file.TotalSize})
+}
+
+// rebuild writes file to a temporary file next to target, copying the chunks in have from the
+// old target and downloading runs of the others, checks the result against manifest and renames
+// it over target.
+func (s *syncer) rebuild(ctx context.Context, target string, file client.File, manifest []client.Chunk, have map[string]int64, fetch int64) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".bytesize-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var old *os.File
+	if len(have) > 0 {
+		if old, err = os.Open(target); err != nil {
+			return err
+		}
+		defer old.Close()
+	}
+
+	bar := s.e.newProgress(filepath.Base(target), fetch, 0)
+	defer bar.finish()
+	out := bar.writer(tmp)
+	for i := 0; i < len(manifest); {
+		if offset, ok := have[manifest[i].Hash]; ok {
+			if _, err := io.Copy(tmp, io.NewSectionReader(old, offset, manifest[i].Size)); err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+		// * consecutive missing chunks are one ranged download
+		start := int64(i) * client.ChunkSize
+		var length int64
+		for ; i < len(manifest); i++ {
+			if _, ok := have[manifest[i].Hash]; ok {
+				break
+			}
+			length += manifest[i].Size
+		}
+		if _, err := s.c.Download(ctx, file.ID, out, &client.DownloadOptions{Offset: start, Length: length}); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	got, err := client.HashChunks(tmp)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(got, manifest) {
+		return errors.New("rebuilt file does not match the server's manifest")
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	return s.setMtime(target, file)
+}
+
+// setMtime gives a pulled file the mtime it was pushed with, so the next sync in either
+// direction recognises it without hashing.
+func (s *syncer) setMtime(target string, file client.File) error {
+	nanos, err := strconv.ParseInt(file.Metadata[metaSyncMtime], 10, 64)
+	if err != nil {
+		return nil
+	}
+	mtime := time.Unix(0, nanos)
+	return os.Chtimes(target, mtime, mtime)
+}
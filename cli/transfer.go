@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"meliocool/bytesize/pkg/client"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+func setupPut(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	remoteName := fs.String("name", "", "stored filename; required for stdin, only valid with one file")
+	prefix := fs.String("prefix", "", "prepended to each stored filename, e.g. photos/")
+	contentType := fs.String("content-type", "", "content type instead of server-side sniffing")
+	ttl := fs.Duration("ttl", 0, "delete the file after this long, e.g. 72h")
+	expiresAt := fs.String("expires-at", "", "delete the file at this RFC 3339 time")
+	var tags stringList
+	fs.Var(&tags, "tag", "tag, repeatable or comma separated")
+	meta := metaFlags{}
+	fs.Var(meta, "meta", "metadata key=value, repeatable")
+
+	return func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return usagef("no files given")
+		}
+		if *remoteName != "" && len(args) > 1 {
+			return usagef("--name only works with one file")
+		}
+		if *ttl != 0 && *expiresAt != "" {
+			return usagef("--ttl and --expires-at are mutually exclusive")
+		}
+		opts := client.UploadOptions{ContentType: *contentType, TTL: *ttl, Metadata: meta, Tags: splitTags(tags)}
+		if *expiresAt != "" {
+			t, err := time.Parse(time.RFC3339, *expiresAt)
+			if err != nil {
+				return usagef("--expires-at: %v", err)
+			}
+			opts.ExpiresAt = t
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+
+		for _, local := range args {
+			filename := *remoteName
+			if filename == "" {
+				if local == "-" {
+					return usagef("stdin needs --name")
+				}
+				filename = filepath.Base(local)
+			}
+			filename = *prefix + filename
+
+			result, err := e.put(ctx, c, local, filename, opts)
+			if err != nil {
+				return fmt.Errorf("%s: %w", local, err)
+			}
+			err = e.emit(result, func(w io.Writer) {
+				fmt.Fprintf(w, "%s  %s  %s", result.FileID, result.Filename, humanBytes(result.TotalSize))
+				if result.DedupeSavedBytes > 0 {
+					fmt.Fprintf(w, "  (%s deduplicated)", humanBytes(result.DedupeSavedBytes))
+				}
+				fmt.Fprintln(w)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (e *env) put(ctx context.Context, c *client.Client, local string, filename string, opts client.UploadOptions) (client.UploadResult, error) {
+	var r io.Reader = e.stdin
+	var size int64 = -1
+	if local != "-" {
+		f, err := os.Open(local)
+		if err != nil {
+			return client.UploadResult{}, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return client.UploadResult{}, err
+		}
+		if info.IsDir() {
+			return client.UploadResult{}, errors.New("is a directory")
+		}
+		r, size = f, info.Size()
+	}
+
+	bar := e.newProgress(filename, size, 0)
+	defer bar.finish()
+	if bar != nil {
+		opts.Progress = bar.set
+	}
+	return c.Upload(ctx, filename, r, &opts)
+}
+
+type getResult struct {
+	ID      uuid.UUID
+	Path    string
+	Bytes   int64
+	Resumed int64
+}
+
+func setupGet(fs *flag.FlagSet, e *env) func(ctx context.Context, args []string) error {
+	output := fs.String("o", "", "output path; - writes to stdout (default: the stored filename's base name)")
+	resume := fs.Bool("continue", false, "resume a partial download into an existing output file")
+	force := fs.Bool("force", false, "overwrite an existing output file")
+
+	return func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return usagef("get takes one file id")
+		}
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			return usagef("bad file id %q", args[0])
+		}
+		if *resume && *force {
+			return usagef("--continue and --force are mutually exclusive")
+		}
+		c, err := e.client()
+		if err != nil {
+			return err
+		}
+		file, err := c.Stat(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		target := *output
+		if target == "" {
+			// * stored names may hold directories; only the base name is written locally
+			target = path.Base(file.Filename)
+			if target == "." || target == "/" || target == ".." {
+				return usagef("cannot derive a local name from %q; pass -o", file.Filename)
+			}
+		}
+		if target == "-" {
+			if *resume {
+				return usagef("--continue needs an output file")
+			}
+			bar := e.newProgress(file.Filename, file.TotalSize, 0)
+			_, err := c.Download(ctx, id, bar.writer(e.stdout), nil)
+			bar.finish()
+			return err
+		}
+
+		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		switch {
+		case *resume:
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		case *force:
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		f, err := os.OpenFile(target, flags, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s exists; use --continue to resume or --force to overwrite", target)
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		have := info.Size()
+		if have > file.TotalSize {
+			return fmt.Errorf("%s is larger than the stored file (%d > %d bytes)", target, have, file.TotalSize)
+		}
+
+		var n int64
+		if have < file.TotalSize {
+			bar := e.newProgress(file.Filename, file.TotalSize, have)
+			n, err = c.Download(ctx, id, bar.writer(f), &client.DownloadOptions{Offset: have})
+			bar.finish()
+			if err != nil {
+				return fmt.Errorf("%w (%d of %d bytes written; rerun with --continue)", err, have+n, file.TotalSize)
+			}
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		result := getResult{ID: id, Path: target, Bytes: have + n, Resumed: have}
+		return e.emit(result, func(w io.Writer) {
+			fmt.Fprintf(w, "%s  %s", result.Path, humanBytes(result.Bytes))
+			if result.Resumed > 0 {
+				fmt.Fprintf(w, "  (resumed at %s)", humanBytes(result.Resumed))
+			}
+			fmt.Fprintln(w)
+		})
+	}
+}
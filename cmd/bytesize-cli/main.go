@@ -0,0 +1,21 @@
+// Command bytesize-cli is the command line client for a ByteSize server: put, get, ls, stat,
+// rm, share and du, with config profiles and JSON output.
+//
+//	go install ./cmd/bytesize-cli
+//	bytesize-cli profile set local --url http://localhost:8080 --api-key LOVEMELOVEME
+//	bytesize-cli put report.pdf --tag q3
+package main
+
+import (
+	"context"
+	"meliocool/bytesize/cli"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := cli.Run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
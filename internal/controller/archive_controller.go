@@ -0,0 +1,10 @@
+package controller
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type ArchiveController interface {
+	Archive(writer http.ResponseWriter, request *http.Request, _ httprouter.Params)
+}
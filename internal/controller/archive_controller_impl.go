@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/service/archive"
+	"net/http"
+	"time"
+)
+
+type ArchiveControllerImpl struct {
+	ArchiveService archive.ArchiveService
+}
+
+func NewArchiveController(archiveService archive.ArchiveService) ArchiveController {
+	return &ArchiveControllerImpl{
+		ArchiveService: archiveService,
+	}
+}
+
+func (a *ArchiveControllerImpl) Archive(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	ctx := request.Context()
+
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxMemoryBytes)
+	archiveReq := web.ArchiveRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&archiveReq); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	plan, err := a.ArchiveService.Prepare(ctx, archiveReq)
+	if err != nil {
+		switch {
+		case errors.Is(err, helper.ErrInvalidInput):
+			helper.WriteErr(writer, helper.ErrBadRequest)
+		case errors.Is(err, helper.ErrNotFound):
+			helper.WriteErr(writer, helper.ErrNotFound)
+		case errors.Is(err, helper.ErrTooLarge):
+			helper.WriteErr(writer, helper.ErrTooLarge)
+		default:
+			helper.WriteErr(writer, helper.ErrInternal)
+		}
+		return
+	}
+
+	// * no Content-Length: the archive is built on the fly
+	writer.Header().Set("Content-Type", plan.ContentType())
+	writer.Header().Set("Content-Disposition", helper.ContentDisposition("attachment", plan.Filename(time.Now())))
+
+	streamErr := a.ArchiveService.Stream(ctx, plan, writer)
+	if streamErr != nil {
+		return
+	}
+}
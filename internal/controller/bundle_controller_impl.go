@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/service/bundle"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type BundleControllerImpl struct {
+	BundleService bundle.BundleService
+}
+
+func NewBundleController(bundleService bundle.BundleService) BundleController {
+	return &BundleControllerImpl{BundleService: bundleService}
+}
+
+// Export takes the GET /files filters, plus ?after=<cursor>&segment=<n> to continue an
+// interrupted export past its last complete segment.
+func (b *BundleControllerImpl) Export(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	ctx := request.Context()
+	filter := parseFileFilter(request)
+	query := request.URL.Query()
+	exportReq := web.BundleExportRequest{
+		Prefix:   filter.Prefix,
+		Tags:     filter.Tags,
+		Metadata: filter.Metadata,
+		After:    query.Get("after"),
+	}
+	if raw := query.Get("segment"); raw != "" {
+		segment, err := strconv.Atoi(raw)
+		if err != nil {
+			helper.WriteErr(writer, helper.ErrBadRequest)
+			return
+		}
+		exportReq.Segment = segment
+	}
+
+	plan, err := b.BundleService.PrepareExport(ctx, exportReq)
+	if err != nil {
+		if errors.Is(err, helper.ErrInvalidInput) {
+			helper.WriteErr(writer, helper.ErrBadRequest)
+			return
+		}
+		helper.WriteErr(writer, helper.ErrInternal)
+		return
+	}
+
+	// * no Content-Length: the bundle is built on the fly, and a stream cut short has no end.json
+	writer.Header().Set("Content-Type", "application/x-tar")
+	writer.Header().Set("Content-Disposition", helper.ContentDisposition("attachment", plan.Filename(time.Now())))
+
+	streamErr := b.BundleService.Export(ctx, plan, writer)
+	if streamErr != nil {
+		return
+	}
+}
+
+func (b *BundleControllerImpl) Import(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	// * chunks are buffered to check their hashes, so an import takes an upload slot like any body
+	release, admitErr := b.BundleService.Admit()
+	if admitErr != nil {
+		helper.WriteErr(writer, admitErr)
+		return
+	}
+	defer release()
+
+	resp, err := b.BundleService.Import(request.Context(), request.Body)
+	if err != nil {
+		if errors.Is(err, bundle.ErrBadBundle) {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusBadRequest)
+			helper.WriteToResponseBody(writer, web.WebResponse{Code: http.StatusBadRequest, Status: "Bad Request!", Data: err.Error()})
+			return
+		}
+		helper.WriteErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   resp,
+	})
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/webdav"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/service/dav"
+	"meliocool/bytesize/internal/service/upload"
+	"net/http"
+)
+
+// DavMethods are the methods the WebDAV handler answers; every one is routed to Serve.
+var DavMethods = []string{
+	http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+type DavControllerImpl struct {
+	Handler       *webdav.Handler
+	UploadService upload.UploadService
+}
+
+func NewDavController(davService dav.DavService, uploadService upload.UploadService, logger *slog.Logger) DavController {
+	return &DavControllerImpl{
+		Handler: &webdav.Handler{
+			FileSystem: davService,
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(request *http.Request, err error) {
+				if err != nil {
+					logger.Error("dav_err", slog.String("method", request.Method), slog.String("path", request.URL.Path), slog.Any("err", err))
+				}
+			},
+		},
+		UploadService: uploadService,
+	}
+}
+
+func (d *DavControllerImpl) Serve(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	if request.Method == http.MethodPut {
+		request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxBytes)
+
+		// * take an upload slot before the body is read, so a busy server sheds load early
+		release, admitErr := d.UploadService.Admit()
+		if admitErr != nil {
+			helper.WriteErr(writer, admitErr)
+			return
+		}
+		defer release()
+	}
+
+	d.Handler.ServeHTTP(writer, request)
+}
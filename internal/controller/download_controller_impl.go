@@ -2,28 +2,25 @@ package controller
 
 import (
 	"errors"
-	"fmt"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/julienschmidt/httprouter"
 	"meliocool/bytesize/internal/helper"
-	"meliocool/bytesize/internal/repository"
 	"meliocool/bytesize/internal/service/download"
+	"meliocool/bytesize/internal/service/filemeta"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 type DownloadControllerImpl struct {
-	DownloadService download.DownloadService
-	FileRepository  repository.FileRepository
-	DB              *pgxpool.Pool
+	DownloadService     download.DownloadService
+	FileMetaDataService filemeta.FileMetaDataService
 }
 
-func NewDownloadController(downloadService download.DownloadService, fileRepository repository.FileRepository, db *pgxpool.Pool) DownloadController {
+func NewDownloadController(downloadService download.DownloadService, fileMetaDataService filemeta.FileMetaDataService) DownloadController {
 	return &DownloadControllerImpl{
-		DownloadService: downloadService,
-		FileRepository:  fileRepository,
-		DB:              db,
+		DownloadService:     downloadService,
+		FileMetaDataService: fileMetaDataService,
 	}
 }
 
@@ -37,38 +34,100 @@ func (d *DownloadControllerImpl) Download(writer http.ResponseWriter, request *h
 		return
 	}
 
-	tx, dbErr := d.DB.Begin(ctx)
-	if dbErr != nil {
+	meta, metaErr := d.FileMetaDataService.GetMeta(ctx, fileID)
+	if metaErr != nil {
+		if errors.Is(metaErr, helper.ErrNotFound) {
+			helper.WriteErr(writer, helper.ErrNotFound)
+			return
+		} else if errors.Is(metaErr, helper.ErrInvalidInput) {
+			helper.WriteErr(writer, helper.ErrBadRequest)
+			return
+		}
 		helper.WriteErr(writer, helper.ErrInternal)
 		return
 	}
 
-	fileRow, fileRowErr := d.FileRepository.FindByID(ctx, tx, fileID)
-	if errors.Is(fileRowErr, helper.ErrNotFound) {
-		_ = tx.Rollback(ctx)
-		helper.WriteErr(writer, helper.ErrNotFound)
+	totalSize := meta.TotalSize
+	fileName := meta.Filename
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	disposition := "attachment"
+	if inline, _ := strconv.ParseBool(request.URL.Query().Get("inline")); inline {
+		disposition = "inline"
+		// * uploaders choose the content type, so an inline HTML or SVG file must not run
+		// * script in this origin
+		writer.Header().Set("Content-Security-Policy", "sandbox")
+	}
+
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.Header().Set("Content-Disposition", helper.ContentDisposition(disposition, fileName))
+	writer.Header().Set("Accept-Ranges", "bytes")
+
+	// * files never change under an id, so a Range needs no validator to resume safely
+	offset, length, partial, satisfiable := parseRange(request.Header.Get("Range"), totalSize)
+	if !satisfiable {
+		writer.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(totalSize, 10))
+		writer.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
 		return
 	}
-	if fileRowErr != nil {
-		_ = tx.Rollback(ctx)
-		helper.WriteErr(writer, helper.ErrInternal)
+	writer.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if partial {
+		writer.Header().Set("Content-Range", "bytes "+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+length-1, 10)+"/"+strconv.FormatInt(totalSize, 10))
+		writer.WriteHeader(http.StatusPartialContent)
+	}
+	if length == 0 {
 		return
 	}
 
-	totalSize := fileRow.TotalSize
-	fileName := fileRow.Filename
-	commErr := tx.Commit(ctx)
-	if commErr != nil {
-		helper.WriteErr(writer, helper.ErrInternal)
+	downloadErr := d.DownloadService.StreamRange(ctx, fileID, offset, length, writer)
+	if downloadErr != nil {
 		return
 	}
+}
 
-	writer.Header().Set("Content-Type", "application/octet-stream")
-	writer.Header().Set("Content-Length", strconv.FormatInt(totalSize, 10))
-	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+// parseRange resolves a single-range Range header against size. Multi-range and malformed
+// headers are ignored, so the whole file is served.
+func parseRange(header string, size int64) (offset int64, length int64, partial bool, satisfiable bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, false, true
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, false, true
+	}
 
-	downloadErr := d.DownloadService.Stream(ctx, fileID, writer)
-	if downloadErr != nil {
-		return
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, size, false, true
+		}
+		// * an empty file has no last byte for a suffix to count back from
+		if n == 0 || size == 0 {
+			return 0, 0, false, false
+		}
+		n = min(n, size)
+		return size - n, n, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, false, true
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, size, false, true
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, false, false
 	}
+	return start, end - start + 1, true, true
 }
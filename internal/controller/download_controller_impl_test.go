@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/service/filemeta"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header      string
+		size        int64
+		offset      int64
+		length      int64
+		partial     bool
+		satisfiable bool
+	}{
+		{"", 100, 0, 100, false, true},
+		{"bytes=0-0", 100, 0, 1, true, true},
+		{"bytes=0-99", 100, 0, 100, true, true},
+		{"bytes=10-19", 100, 10, 10, true, true},
+		{"bytes=90-", 100, 90, 10, true, true},
+		{"bytes=90-500", 100, 90, 10, true, true},
+		{"bytes=99-99", 100, 99, 1, true, true},
+		// * suffix ranges count back from the end and are clamped to the file
+		{"bytes=-10", 100, 90, 10, true, true},
+		{"bytes=-100", 100, 0, 100, true, true},
+		{"bytes=-500", 100, 0, 100, true, true},
+		{"bytes=-0", 100, 0, 0, false, false},
+		{"bytes=-5", 0, 0, 0, false, false},
+		// * a first byte at or past the end cannot be served
+		{"bytes=100-", 100, 0, 0, false, false},
+		{"bytes=100-200", 100, 0, 0, false, false},
+		{"bytes=0-", 0, 0, 0, false, false},
+		// * malformed and multi-range headers are ignored
+		{"bytes=20-10", 100, 0, 100, false, true},
+		{"bytes=a-b", 100, 0, 100, false, true},
+		{"bytes=-x", 100, 0, 100, false, true},
+		{"bytes=5", 100, 0, 100, false, true},
+		{"bytes=0-1,5-6", 100, 0, 100, false, true},
+		{"items=0-1", 100, 0, 100, false, true},
+	}
+	for _, tc := range cases {
+		offset, length, partial, satisfiable := parseRange(tc.header, tc.size)
+		if offset != tc.offset || length != tc.length || partial != tc.partial || satisfiable != tc.satisfiable {
+			t.Errorf("parseRange(%q, %d) = %d, %d, %v, %v; want %d, %d, %v, %v", tc.header, tc.size,
+				offset, length, partial, satisfiable, tc.offset, tc.length, tc.partial, tc.satisfiable)
+		}
+	}
+}
+
+type stubDownloadService struct {
+	body string
+}
+
+func (s stubDownloadService) Stream(ctx context.Context, fileID uuid.UUID, w io.Writer) error {
+	_, err := io.WriteString(w, s.body)
+	return err
+}
+
+func (s stubDownloadService) StreamRange(ctx context.Context, fileID uuid.UUID, offset int64, length int64, w io.Writer) error {
+	_, err := io.WriteString(w, s.body[offset:offset+length])
+	return err
+}
+
+type stubMetaService struct {
+	meta filemeta.MetaDataDTO
+}
+
+func (s stubMetaService) GetMeta(ctx context.Context, fileID uuid.UUID) (filemeta.MetaDataDTO, error) {
+	return s.meta, nil
+}
+
+func (s stubMetaService) UpdateMeta(ctx context.Context, fileID uuid.UUID, req web.MetadataPatchRequest) (filemeta.MetaDataDTO, error) {
+	return s.meta, nil
+}
+
+func TestDownloadSandboxesInlineContent(t *testing.T) {
+	body := "<script>alert(document.cookie)</script>"
+	controller := NewDownloadController(stubDownloadService{body: body}, stubMetaService{meta: filemeta.MetaDataDTO{
+		Filename:    "page.html",
+		ContentType: "text/html; charset=utf-8",
+		TotalSize:   int64(len(body)),
+	}})
+	params := httprouter.Params{{Key: "id", Value: uuid.NewString()}}
+
+	rec := httptest.NewRecorder()
+	controller.Download(rec, httptest.NewRequest(http.MethodGet, "/files/download/x?inline=1", nil), params)
+	if got := rec.Header().Get("Content-Security-Policy"); got != "sandbox" {
+		t.Fatalf("inline Content-Security-Policy = %q; want sandbox", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "inline") {
+		t.Fatalf("inline Content-Disposition = %q", got)
+	}
+	if rec.Body.String() != body {
+		t.Fatalf("inline body = %q; want %q", rec.Body, body)
+	}
+
+	rec = httptest.NewRecorder()
+	controller.Download(rec, httptest.NewRequest(http.MethodGet, "/files/download/x", nil), params)
+	if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment") {
+		t.Fatalf("default Content-Disposition = %q; want attachment", got)
+	}
+}
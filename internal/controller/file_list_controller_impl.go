@@ -1,10 +1,14 @@
 package controller
 
 import (
+	"errors"
 	"github.com/julienschmidt/httprouter"
 	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/domain"
 	"meliocool/bytesize/internal/service/filelist"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type FileListControllerImpl struct {
@@ -17,10 +21,49 @@ func NewFileListController(svc filelist.FileListService) FileListController {
 
 func (c *FileListControllerImpl) List(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
 	ctx := request.Context()
-	items, err := c.Service.List(ctx)
+	filter := parseFileFilter(request)
+	query := request.URL.Query()
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > helper.MaxListLimit {
+			helper.WriteErr(writer, helper.ErrBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 || filter.Limit == 0 {
+			helper.WriteErr(writer, helper.ErrBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	items, err := c.Service.List(ctx, filter)
 	if err != nil {
+		if errors.Is(err, helper.ErrInvalidInput) {
+			helper.WriteErr(writer, helper.ErrBadRequest)
+			return
+		}
 		helper.WriteErr(writer, helper.ErrInternal)
 		return
 	}
 	helper.WriteToResponseBody(writer, items)
 }
+
+// parseFileFilter maps ?prefix=p&tag=a&tag=b&meta.<key>=<value> onto a FileFilter.
+func parseFileFilter(request *http.Request) domain.FileFilter {
+	query := request.URL.Query()
+	filter := domain.FileFilter{
+		Prefix:   query.Get("prefix"),
+		Tags:     helper.SplitTags(query["tag"]),
+		Metadata: make(map[string]string),
+	}
+	for name, values := range query {
+		if key, ok := strings.CutPrefix(name, "meta."); ok && len(values) > 0 {
+			filter.Metadata[key] = values[0]
+		}
+	}
+	return filter
+}
@@ -7,4 +7,5 @@ import (
 
 type FileMetaDataController interface {
 	Get(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Patch(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
 }
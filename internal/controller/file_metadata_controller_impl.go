@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/web"
 	"meliocool/bytesize/internal/service/filemeta"
 	"net/http"
 )
@@ -44,3 +46,35 @@ func (f *FileMetaDataControllerImpl) Get(writer http.ResponseWriter, request *ht
 	// * Already sets Content-Type to application/json
 	helper.WriteToResponseBody(writer, DTO)
 }
+
+func (f *FileMetaDataControllerImpl) Patch(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	id := params.ByName("id")
+	fileID, err := uuid.Parse(id)
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrInvalidInput)
+		return
+	}
+
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxMemoryBytes)
+	patch := web.MetadataPatchRequest{}
+	if decErr := json.NewDecoder(request.Body).Decode(&patch); decErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	DTO, patchErr := f.FileMetaDataService.UpdateMeta(ctx, fileID, patch)
+	if patchErr != nil {
+		if errors.Is(patchErr, helper.ErrInvalidInput) {
+			helper.WriteErr(writer, helper.ErrBadRequest)
+			return
+		} else if errors.Is(patchErr, helper.ErrNotFound) {
+			helper.WriteErr(writer, helper.ErrNotFound)
+			return
+		}
+		helper.WriteErr(writer, helper.ErrInternal)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, DTO)
+}
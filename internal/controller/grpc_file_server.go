@@ -0,0 +1,329 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	deletefile "meliocool/bytesize/internal/service/delete"
+	"meliocool/bytesize/internal/service/download"
+	"meliocool/bytesize/internal/service/filelist"
+	"meliocool/bytesize/internal/service/filemeta"
+	"meliocool/bytesize/internal/service/upload"
+	bytesizev1 "meliocool/bytesize/pkg/pb/bytesize/v1"
+	"strconv"
+	"time"
+)
+
+// GrpcFileServer serves bytesize.v1.FileService on top of the same services as the REST API.
+type GrpcFileServer struct {
+	bytesizev1.UnimplementedFileServiceServer
+	UploadService       upload.UploadService
+	DownloadService     download.DownloadService
+	FileMetaDataService filemeta.FileMetaDataService
+	FileListService     filelist.FileListService
+	DeleteService       deletefile.DeleteService
+}
+
+func NewGrpcFileServer(
+	uploadService upload.UploadService,
+	downloadService download.DownloadService,
+	fileMetaDataService filemeta.FileMetaDataService,
+	fileListService filelist.FileListService,
+	deleteService deletefile.DeleteService,
+) bytesizev1.FileServiceServer {
+	return &GrpcFileServer{
+		UploadService:       uploadService,
+		DownloadService:     downloadService,
+		FileMetaDataService: fileMetaDataService,
+		FileListService:     fileListService,
+		DeleteService:       deleteService,
+	}
+}
+
+// grpcErr maps service errors onto status codes the way helper.WriteErr maps them onto HTTP.
+func grpcErr(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, helper.ErrInvalidInput), errors.Is(err, helper.ErrBadRequest):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, helper.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, helper.ErrTooLarge):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, helper.ErrUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, helper.ErrInternal.Error())
+	}
+}
+
+func parseFileID(raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid file_id")
+	}
+	return id, nil
+}
+
+func timestampOrNil(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func grpcFileFromMeta(m filemeta.MetaDataDTO) *bytesizev1.File {
+	return &bytesizev1.File{
+		Id:          m.ID.String(),
+		Filename:    m.Filename,
+		TotalSize:   m.TotalSize,
+		ContentType: m.ContentType,
+		CreatedAt:   timestamppb.New(m.CreatedAt),
+		UpdatedAt:   timestamppb.New(m.UpdatedAt),
+		ExpiresAt:   timestampOrNil(m.ExpiresAt),
+		Metadata:    m.Metadata,
+		Tags:        m.Tags,
+	}
+}
+
+func grpcFileFromList(f filelist.FileDTO) *bytesizev1.File {
+	return &bytesizev1.File{
+		Id:          f.ID.String(),
+		Filename:    f.Filename,
+		TotalSize:   f.TotalSize,
+		ContentType: f.ContentType,
+		CreatedAt:   timestamppb.New(f.CreatedAt),
+		UpdatedAt:   timestamppb.New(f.UpdatedAt),
+		ExpiresAt:   timestampOrNil(f.ExpiresAt),
+		Metadata:    f.Metadata,
+		Tags:        f.Tags,
+	}
+}
+
+// uploadStreamReader turns the data messages that follow the header into an io.Reader. The
+// pipeline reports any read failure as ErrInternal, so the real cause is kept in err.
+type uploadStreamReader struct {
+	stream grpc.ClientStreamingServer[bytesizev1.UploadRequest, bytesizev1.UploadResponse]
+	buf    []byte
+	read   int64
+	err    error
+}
+
+func (r *uploadStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		data, ok := msg.GetPayload().(*bytesizev1.UploadRequest_Data)
+		if !ok {
+			r.err = status.Error(codes.InvalidArgument, "header may only be sent once")
+			return 0, r.err
+		}
+		r.buf = data.Data
+	}
+	if r.read+int64(len(r.buf)) > helper.MaxBytes {
+		r.err = helper.ErrTooLarge
+		return 0, r.err
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.read += int64(n)
+	return n, nil
+}
+
+func (g *GrpcFileServer) Upload(stream grpc.ClientStreamingServer[bytesizev1.UploadRequest, bytesizev1.UploadResponse]) error {
+	// * take an upload slot before any data is read, as the REST handler does
+	release, err := g.UploadService.Admit()
+	if err != nil {
+		return grpcErr(err)
+	}
+	defer release()
+
+	first, err := stream.Recv()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return status.Error(codes.InvalidArgument, "missing upload header")
+		}
+		return err
+	}
+	header := first.GetHeader()
+	if header == nil || header.GetFilename() == "" {
+		return status.Error(codes.InvalidArgument, "first message must be a header with a filename")
+	}
+	contentType, err := parseContentType(header.GetContentType(), "")
+	if err != nil {
+		return grpcErr(err)
+	}
+	var expiresAt *time.Time
+	if header.GetExpiresAt() != nil {
+		t := header.GetExpiresAt().AsTime()
+		expiresAt = &t
+	}
+
+	ctx := stream.Context()
+	reader := &uploadStreamReader{stream: stream}
+	resp, err := g.UploadService.Upload(ctx, web.UploadRequest{
+		Ctx:         ctx,
+		FileName:    header.GetFilename(),
+		Reader:      reader,
+		ContentType: contentType,
+		ExpiresAt:   expiresAt,
+		Metadata:    header.GetMetadata(),
+		Tags:        helper.SplitTags(header.GetTags()),
+	})
+	if err != nil {
+		if reader.err != nil {
+			return grpcErr(reader.err)
+		}
+		return grpcErr(err)
+	}
+	return stream.SendAndClose(&bytesizev1.UploadResponse{
+		FileId:              resp.FileID.String(),
+		Filename:            resp.Filename,
+		TotalSize:           resp.TotalSize,
+		ContentType:         resp.ContentType,
+		ChunksCount:         resp.ChunksCount,
+		UniqueChunksWritten: resp.UniqueChunksWritten,
+		DedupeSavedBytes:    resp.DedupeSavedBytes,
+	})
+}
+
+// downloadStreamWriter splits the byte stream into data messages of at most GRPCMessageBytes.
+type downloadStreamWriter struct {
+	stream grpc.ServerStreamingServer[bytesizev1.DownloadResponse]
+}
+
+func (w *downloadStreamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), helper.GRPCMessageBytes)
+		err := w.stream.Send(&bytesizev1.DownloadResponse{Payload: &bytesizev1.DownloadResponse_Data{Data: p[:n]}})
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (g *GrpcFileServer) Download(req *bytesizev1.DownloadRequest, stream grpc.ServerStreamingServer[bytesizev1.DownloadResponse]) error {
+	id, err := parseFileID(req.GetFileId())
+	if err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	meta, err := g.FileMetaDataService.GetMeta(ctx, id)
+	if err != nil {
+		return grpcErr(err)
+	}
+
+	offset, length := req.GetOffset(), int64(-1)
+	if req.Length != nil {
+		length = req.GetLength()
+	}
+	if offset < 0 || offset > meta.TotalSize || (req.Length != nil && length < 0) {
+		return status.Error(codes.OutOfRange, "offset/length outside the file")
+	}
+	if length >= 0 {
+		length = min(length, meta.TotalSize-offset)
+	}
+
+	if err := stream.Send(&bytesizev1.DownloadResponse{Payload: &bytesizev1.DownloadResponse_File{File: grpcFileFromMeta(meta)}}); err != nil {
+		return err
+	}
+	if offset == meta.TotalSize || length == 0 {
+		return nil
+	}
+	return grpcErr(g.DownloadService.StreamRange(ctx, id, offset, length, &downloadStreamWriter{stream: stream}))
+}
+
+func (g *GrpcFileServer) Stat(ctx context.Context, req *bytesizev1.StatRequest) (*bytesizev1.StatResponse, error) {
+	id, err := parseFileID(req.GetFileId())
+	if err != nil {
+		return nil, err
+	}
+	meta, err := g.FileMetaDataService.GetMeta(ctx, id)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return &bytesizev1.StatResponse{File: grpcFileFromMeta(meta), ChunksCount: meta.ChunksCount}, nil
+}
+
+// List pages through the same newest-first listing as GET /files; the page token is the offset
+// of the next page.
+func (g *GrpcFileServer) List(ctx context.Context, req *bytesizev1.ListRequest) (*bytesizev1.ListResponse, error) {
+	pageSize := int(req.GetPageSize())
+	if pageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "negative page_size")
+	}
+	if pageSize == 0 {
+		pageSize = helper.GRPCDefaultPageSize
+	}
+	pageSize = min(pageSize, helper.MaxListLimit)
+
+	offset := 0
+	if token := req.GetPageToken(); token != "" {
+		v, err := strconv.Atoi(token)
+		if err != nil || v < 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		offset = v
+	}
+
+	// * one extra row tells whether another page follows
+	files, err := g.FileListService.List(ctx, domain.FileFilter{
+		Prefix:   req.GetPrefix(),
+		Tags:     helper.SplitTags(req.GetTags()),
+		Metadata: req.GetMetadata(),
+		Limit:    pageSize + 1,
+		Offset:   offset,
+	})
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+
+	resp := &bytesizev1.ListResponse{}
+	for _, f := range files[:min(pageSize, len(files))] {
+		resp.Files = append(resp.Files, grpcFileFromList(f))
+	}
+	if len(files) > pageSize {
+		resp.NextPageToken = strconv.Itoa(offset + pageSize)
+	}
+	return resp, nil
+}
+
+func (g *GrpcFileServer) Delete(ctx context.Context, req *bytesizev1.DeleteRequest) (*bytesizev1.DeleteResponse, error) {
+	id, err := parseFileID(req.GetFileId())
+	if err != nil {
+		return nil, err
+	}
+	res, err := g.DeleteService.Delete(ctx, id)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return &bytesizev1.DeleteResponse{
+		FileId:              res.FileID.String(),
+		OrphanChunksDeleted: res.OrphanChunksDeleted,
+		OrphanBytesDeleted:  res.OrphanBytesDeleted,
+	}, nil
+}
@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type ManifestController interface {
+	Missing(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	PutChunk(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Commit(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Get(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+}
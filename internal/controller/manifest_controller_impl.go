@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/service/manifest"
+	"net/http"
+)
+
+type ManifestControllerImpl struct {
+	ManifestService manifest.ManifestService
+}
+
+func NewManifestController(manifestService manifest.ManifestService) ManifestController {
+	return &ManifestControllerImpl{ManifestService: manifestService}
+}
+
+func writeManifestErr(writer http.ResponseWriter, err error) {
+	var missingErr *manifest.MissingChunksError
+	switch {
+	case errors.As(err, &missingErr):
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusConflict)
+		helper.WriteToResponseBody(writer, web.WebResponse{
+			Code:   http.StatusConflict,
+			Status: "Conflict!",
+			Data:   web.ChunkMissingResponse{Missing: missingErr.Hashes},
+		})
+	case errors.Is(err, manifest.ErrChunkMismatch), errors.Is(err, manifest.ErrChunkSizeMismatch):
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusBadRequest)
+		helper.WriteToResponseBody(writer, web.WebResponse{Code: http.StatusBadRequest, Status: "Bad Request!", Data: err.Error()})
+	case errors.Is(err, helper.ErrInvalidInput):
+		helper.WriteErr(writer, helper.ErrBadRequest)
+	default:
+		helper.WriteErr(writer, err)
+	}
+}
+
+func (m *ManifestControllerImpl) Missing(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxMemoryBytes)
+	missingReq := web.ChunkMissingRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&missingReq); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	missing, err := m.ManifestService.Missing(request.Context(), missingReq.Hashes)
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   web.ChunkMissingResponse{Missing: missing},
+	})
+}
+
+func (m *ManifestControllerImpl) PutChunk(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.ChunkSize)
+
+	// * the chunk is buffered to check its hash, so it takes an upload slot like any body
+	release, admitErr := m.ManifestService.Admit()
+	if admitErr != nil {
+		helper.WriteErr(writer, admitErr)
+		return
+	}
+	defer release()
+
+	stored, err := m.ManifestService.PutChunk(request.Context(), params.ByName("hash"), request.Body)
+	if err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			helper.WriteErr(writer, helper.ErrTooLarge)
+			return
+		}
+		writeManifestErr(writer, err)
+		return
+	}
+
+	code := http.StatusOK
+	if stored {
+		code = http.StatusCreated
+	}
+	helper.WriteToResponseBody(writer, web.WebResponse{Code: code, Status: "Success!", Data: stored})
+}
+
+func (m *ManifestControllerImpl) Commit(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxMemoryBytes)
+	commitReq := web.ManifestCommitRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&commitReq); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	resp, err := m.ManifestService.Commit(request.Context(), commitReq)
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusCreated,
+		Status: "Success!",
+		Data:   resp,
+	})
+}
+
+func (m *ManifestControllerImpl) Get(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	fileID, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	chunks, err := m.ManifestService.Get(request.Context(), fileID)
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   chunks,
+	})
+}
@@ -0,0 +1,11 @@
+package controller
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type ReplicationController interface {
+	Apply(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Remove(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/service/replication"
+	"net/http"
+	"time"
+)
+
+type ReplicationControllerImpl struct {
+	ReplicationService replication.ReplicationService
+}
+
+func NewReplicationController(replicationService replication.ReplicationService) ReplicationController {
+	return &ReplicationControllerImpl{ReplicationService: replicationService}
+}
+
+// Apply takes the file as a bundle segment line. Missing chunks answer 409 with their hashes,
+// a newer local version 412.
+func (r *ReplicationControllerImpl) Apply(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	id, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxMemoryBytes)
+	file := web.BundleFile{}
+	if err := json.NewDecoder(request.Body).Decode(&file); err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			helper.WriteErr(writer, helper.ErrTooLarge)
+			return
+		}
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	resp, err := r.ReplicationService.Apply(request.Context(), id, file)
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   resp,
+	})
+}
+
+// Remove takes ?version=<RFC 3339 updated_at of the deleted file>&force=true.
+func (r *ReplicationControllerImpl) Remove(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	id, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+	query := request.URL.Query()
+	version, err := time.Parse(time.RFC3339Nano, query.Get("version"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+	force := query.Get("force") == "true"
+
+	resp, err := r.ReplicationService.Remove(request.Context(), id, version, force)
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   resp,
+	})
+}
@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type S3Controller interface {
+	ListBuckets(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	ListObjects(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	HeadBucket(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	CreateBucket(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	DeleteBucket(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	DeleteObjects(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	GetObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	HeadObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	PutObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	DeleteObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	PostObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+}
@@ -0,0 +1,570 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/middleware"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/service/object"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+// * presigned GETs may override these response headers through the query string
+var s3ResponseOverrides = map[string]string{
+	"response-content-type":        "Content-Type",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-language":    "Content-Language",
+	"response-content-encoding":    "Content-Encoding",
+	"response-cache-control":       "Cache-Control",
+	"response-expires":             "Expires",
+}
+
+type S3ControllerImpl struct {
+	ObjectService object.ObjectService
+}
+
+func NewS3Controller(objectService object.ObjectService) S3Controller {
+	return &S3ControllerImpl{
+		ObjectService: objectService,
+	}
+}
+
+func (s *S3ControllerImpl) ListBuckets(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	buckets, err := s.ObjectService.Buckets(request.Context())
+	if err != nil {
+		writeS3ServiceErr(writer, request, err)
+		return
+	}
+
+	result := web.S3ListBucketsResult{
+		Xmlns: web.S3Namespace,
+		Owner: web.S3Owner{ID: "bytesize", DisplayName: "bytesize"},
+	}
+	for _, b := range buckets {
+		result.Buckets = append(result.Buckets, web.S3Bucket{Name: b.Name, CreationDate: b.CreatedAt.UTC().Format(s3TimeFormat)})
+	}
+	writeS3XML(writer, http.StatusOK, result)
+}
+
+// ListObjects serves ListObjects (v1) and ListObjectsV2 (list-type=2), including delimiter
+// grouping into common prefixes and pagination by key.
+func (s *S3ControllerImpl) ListObjects(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	bucket, ok := s3Bucket(writer, request, params)
+	if !ok {
+		return
+	}
+	query := request.URL.Query()
+	if query.Has("location") {
+		writeS3XML(writer, http.StatusOK, web.S3LocationConstraint{Xmlns: web.S3Namespace})
+		return
+	}
+
+	v2 := query.Get("list-type") == "2"
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	encode := query.Get("encoding-type") == "url"
+	if query.Has("encoding-type") && !encode {
+		writeS3Err(writer, request, http.StatusBadRequest, "InvalidArgument", "Invalid Encoding Method specified in Request")
+		return
+	}
+
+	maxKeys := helper.S3MaxKeys
+	if raw := query.Get("max-keys"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeS3Err(writer, request, http.StatusBadRequest, "InvalidArgument", "max-keys must be a non-negative integer")
+			return
+		}
+		maxKeys = min(n, helper.S3MaxKeys)
+	}
+
+	after := query.Get("marker")
+	if v2 {
+		after = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				writeS3Err(writer, request, http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+				return
+			}
+			after = string(decoded)
+		}
+	}
+
+	infos, err := s.ObjectService.List(request.Context(), bucket+"/"+prefix)
+	if err != nil {
+		writeS3ServiceErr(writer, request, err)
+		return
+	}
+
+	escape := func(v string) string { return v }
+	if encode {
+		escape = func(v string) string { return strings.ReplaceAll(url.QueryEscape(v), "+", "%20") }
+	}
+
+	result := web.S3ListBucketResult{
+		Xmlns:     web.S3Namespace,
+		Name:      bucket,
+		Prefix:    escape(prefix),
+		Delimiter: escape(delimiter),
+		MaxKeys:   maxKeys,
+	}
+	if encode {
+		result.EncodingType = "url"
+	}
+
+	var count int
+	var next, lastPrefix string
+	for _, info := range infos {
+		key := strings.TrimPrefix(info.Key, bucket+"/")
+		if key <= after {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				// * a page may end on a common prefix; its remaining keys must not reopen it
+				if common == lastPrefix || common <= after {
+					continue
+				}
+				if count == maxKeys {
+					result.IsTruncated = true
+					break
+				}
+				result.CommonPrefixes = append(result.CommonPrefixes, web.S3CommonPrefix{Prefix: escape(common)})
+				lastPrefix, next = common, common
+				count++
+				continue
+			}
+		}
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.Contents = append(result.Contents, web.S3Object{
+			Key:          escape(key),
+			LastModified: info.LastModified.UTC().Format(s3TimeFormat),
+			ETag:         strconv.Quote(info.ETag),
+			Size:         info.Size,
+			StorageClass: "STANDARD",
+		})
+		next = key
+		count++
+	}
+
+	if v2 {
+		result.KeyCount = count
+		result.StartAfter = escape(query.Get("start-after"))
+		result.ContinuationToken = query.Get("continuation-token")
+		if result.IsTruncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(next))
+		}
+	} else {
+		result.Marker = escape(query.Get("marker"))
+		if result.IsTruncated {
+			result.NextMarker = escape(next)
+		}
+	}
+	writeS3XML(writer, http.StatusOK, result)
+}
+
+// HeadBucket always succeeds for a valid name: buckets are implied by keys, so a freshly
+// "created" bucket is simply empty.
+func (s *S3ControllerImpl) HeadBucket(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if _, ok := s3Bucket(writer, request, params); !ok {
+		return
+	}
+	writer.WriteHeader(http.StatusOK)
+}
+
+func (s *S3ControllerImpl) CreateBucket(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	bucket, ok := s3Bucket(writer, request, params)
+	if !ok {
+		return
+	}
+	writer.Header().Set("Location", "/"+bucket)
+	writer.WriteHeader(http.StatusOK)
+}
+
+func (s *S3ControllerImpl) DeleteBucket(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	bucket, ok := s3Bucket(writer, request, params)
+	if !ok {
+		return
+	}
+	infos, err := s.ObjectService.List(request.Context(), bucket+"/")
+	if err != nil {
+		writeS3ServiceErr(writer, request, err)
+		return
+	}
+	if len(infos) > 0 {
+		writeS3Err(writer, request, http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (s *S3ControllerImpl) DeleteObjects(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	bucket, ok := s3Bucket(writer, request, params)
+	if !ok {
+		return
+	}
+	if !request.URL.Query().Has("delete") {
+		writeS3Err(writer, request, http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented")
+		return
+	}
+
+	var req web.S3DeleteRequest
+	if !readS3XML(writer, request, &req) {
+		return
+	}
+	if len(req.Objects) > helper.S3MaxKeys {
+		writeS3Err(writer, request, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema")
+		return
+	}
+
+	result := web.S3DeleteResult{Xmlns: web.S3Namespace}
+	for _, obj := range req.Objects {
+		if err := s.ObjectService.Delete(request.Context(), bucket+"/"+obj.Key); err != nil {
+			_, code, message := s3ErrorFor(err)
+			result.Errors = append(result.Errors, web.S3DeleteError{Key: obj.Key, Code: code, Message: message})
+			continue
+		}
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, web.S3DeletedObject{Key: obj.Key})
+		}
+	}
+	writeS3XML(writer, http.StatusOK, result)
+}
+
+func (s *S3ControllerImpl) GetObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	s.serveObject(writer, request, params, true)
+}
+
+func (s *S3ControllerImpl) HeadObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	s.serveObject(writer, request, params, false)
+}
+
+func (s *S3ControllerImpl) serveObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params, body bool) {
+	bucket, key, ok := s3Object(writer, request, params)
+	if !ok {
+		return
+	}
+	if key == "" {
+		if body {
+			s.ListObjects(writer, request, params)
+		} else {
+			s.HeadBucket(writer, request, params)
+		}
+		return
+	}
+
+	info, err := s.ObjectService.Head(request.Context(), bucket+"/"+key)
+	if err != nil {
+		if !body {
+			// * HEAD responses carry no error body, only the status
+			status, _, _ := s3ErrorFor(err)
+			writer.WriteHeader(status)
+			return
+		}
+		writeS3ServiceErr(writer, request, err)
+		return
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("ETag", strconv.Quote(info.ETag))
+	writer.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	writer.Header().Set("Accept-Ranges", "bytes")
+	for k, v := range info.Metadata {
+		writer.Header().Set("X-Amz-Meta-"+k, v)
+	}
+	query := request.URL.Query()
+	for param, header := range s3ResponseOverrides {
+		if v := query.Get(param); v != "" {
+			writer.Header().Set(header, v)
+		}
+	}
+
+	offset, length, partial, satisfiable := parseRange(request.Header.Get("Range"), info.Size)
+	if !satisfiable {
+		writer.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(info.Size, 10))
+		writeS3Err(writer, request, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+		return
+	}
+	writer.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	status := http.StatusOK
+	if partial {
+		writer.Header().Set("Content-Range", "bytes "+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+length-1, 10)+"/"+strconv.FormatInt(info.Size, 10))
+		status = http.StatusPartialContent
+	}
+	writer.WriteHeader(status)
+	if !body || length == 0 {
+		return
+	}
+
+	// * headers are already out; a mid-stream failure can only cut the body short
+	_ = s.ObjectService.Stream(request.Context(), info, offset, length, writer)
+}
+
+// PutObject stores an object or, with uploadId and partNumber, one part of a multipart upload.
+func (s *S3ControllerImpl) PutObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	bucket, key, ok := s3Object(writer, request, params)
+	if !ok {
+		return
+	}
+	if key == "" {
+		s.CreateBucket(writer, request, params)
+		return
+	}
+	if request.Header.Get("X-Amz-Copy-Source") != "" {
+		writeS3Err(writer, request, http.StatusNotImplemented, "NotImplemented", "Server-side copy is not implemented")
+		return
+	}
+	if request.ContentLength > helper.MaxBytes {
+		writeS3Err(writer, request, http.StatusBadRequest, "EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size")
+		return
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxBytes)
+
+	// * take an upload slot before the body is read, so a busy server sheds load early
+	release, admitErr := s.ObjectService.Admit()
+	if admitErr != nil {
+		writeS3ServiceErr(writer, request, admitErr)
+		return
+	}
+	defer release()
+
+	query := request.URL.Query()
+	var info object.Info
+	var err error
+	if query.Has("uploadId") {
+		partNumber, convErr := strconv.Atoi(query.Get("partNumber"))
+		if convErr != nil {
+			writeS3Err(writer, request, http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive")
+			return
+		}
+		info, err = s.ObjectService.PutPart(request.Context(), query.Get("uploadId"), partNumber, request.Body)
+	} else {
+		contentType, ctErr := s3ContentType(request)
+		if ctErr != nil {
+			writeS3Err(writer, request, http.StatusBadRequest, "InvalidArgument", "Invalid Content-Type")
+			return
+		}
+		info, err = s.ObjectService.Put(request.Context(), web.ObjectPutRequest{
+			Key:         bucket + "/" + key,
+			Reader:      request.Body,
+			ContentType: contentType,
+			Metadata:    s3Metadata(request),
+		})
+	}
+	if err != nil {
+		writeS3BodyErr(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("ETag", strconv.Quote(info.ETag))
+	writer.WriteHeader(http.StatusOK)
+}
+
+func (s *S3ControllerImpl) DeleteObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	bucket, key, ok := s3Object(writer, request, params)
+	if !ok {
+		return
+	}
+	if key == "" {
+		s.DeleteBucket(writer, request, params)
+		return
+	}
+
+	var err error
+	if uploadID := request.URL.Query().Get("uploadId"); uploadID != "" {
+		err = s.ObjectService.AbortMultipart(request.Context(), uploadID)
+	} else {
+		err = s.ObjectService.Delete(request.Context(), bucket+"/"+key)
+	}
+	if err != nil {
+		writeS3ServiceErr(writer, request, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// PostObject starts (?uploads) or completes (?uploadId=) a multipart upload.
+func (s *S3ControllerImpl) PostObject(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	bucket, key, ok := s3Object(writer, request, params)
+	if !ok {
+		return
+	}
+	if key == "" {
+		s.DeleteObjects(writer, request, params)
+		return
+	}
+
+	query := request.URL.Query()
+	switch {
+	case query.Has("uploads"):
+		contentType, ctErr := s3ContentType(request)
+		if ctErr != nil {
+			writeS3Err(writer, request, http.StatusBadRequest, "InvalidArgument", "Invalid Content-Type")
+			return
+		}
+		uploadID, err := s.ObjectService.CreateMultipart(request.Context(), bucket+"/"+key, contentType, s3Metadata(request))
+		if err != nil {
+			writeS3ServiceErr(writer, request, err)
+			return
+		}
+		writeS3XML(writer, http.StatusOK, web.S3InitiateMultipartUploadResult{
+			Xmlns:    web.S3Namespace,
+			Bucket:   bucket,
+			Key:      key,
+			UploadID: uploadID,
+		})
+	case query.Has("uploadId"):
+		var req web.S3CompleteMultipartUpload
+		if !readS3XML(writer, request, &req) {
+			return
+		}
+		info, err := s.ObjectService.CompleteMultipart(request.Context(), query.Get("uploadId"), bucket+"/"+key, req.Parts)
+		if err != nil {
+			writeS3ServiceErr(writer, request, err)
+			return
+		}
+		writeS3XML(writer, http.StatusOK, web.S3CompleteMultipartUploadResult{
+			Xmlns:    web.S3Namespace,
+			Location: "/" + bucket + "/" + key,
+			Bucket:   bucket,
+			Key:      key,
+			ETag:     strconv.Quote(info.ETag),
+		})
+	default:
+		writeS3Err(writer, request, http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented")
+	}
+}
+
+func s3Bucket(writer http.ResponseWriter, request *http.Request, params httprouter.Params) (string, bool) {
+	bucket := params.ByName("bucket")
+	if !helper.BucketRegex().MatchString(bucket) {
+		writeS3Err(writer, request, http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid.")
+		return "", false
+	}
+	return bucket, true
+}
+
+// s3Object splits the path into bucket and key; an empty key means the request was for the bucket.
+func s3Object(writer http.ResponseWriter, request *http.Request, params httprouter.Params) (string, string, bool) {
+	bucket, ok := s3Bucket(writer, request, params)
+	if !ok {
+		return "", "", false
+	}
+	key := strings.TrimPrefix(params.ByName("key"), "/")
+	if len(key) > 1024 {
+		writeS3Err(writer, request, http.StatusBadRequest, "KeyTooLongError", "Your key is too long")
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+func s3ContentType(request *http.Request) (string, error) {
+	raw := request.Header.Get("Content-Type")
+	if raw == "" {
+		return "", nil
+	}
+	return parseContentType(raw, "")
+}
+
+// s3Metadata collects x-amz-meta-* headers; S3 user metadata keys are case-insensitive.
+func s3Metadata(request *http.Request) map[string]string {
+	metadata := make(map[string]string)
+	for name, values := range request.Header {
+		if key, ok := strings.CutPrefix(name, "X-Amz-Meta-"); ok && len(values) > 0 {
+			metadata[strings.ToLower(key)] = values[0]
+		}
+	}
+	return metadata
+}
+
+func readS3XML(writer http.ResponseWriter, request *http.Request, v any) bool {
+	data, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, helper.S3MaxRequestXMLBytes))
+	if err != nil {
+		writeS3BodyErr(writer, request, err)
+		return false
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		writeS3Err(writer, request, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema")
+		return false
+	}
+	return true
+}
+
+// writeS3BodyErr reports a failure that may have come from reading the request body: a body
+// that failed signature verification or was too large is the client's fault, not ours.
+func writeS3BodyErr(writer http.ResponseWriter, request *http.Request, err error) {
+	if payloadErr := middleware.PayloadError(request.Context()); payloadErr != nil {
+		writeS3Err(writer, request, http.StatusBadRequest, "XAmzContentSHA256Mismatch", payloadErr.Error())
+		return
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeS3Err(writer, request, http.StatusBadRequest, "EntityTooLarge", "Your proposed upload exceeds the maximum allowed size")
+		return
+	}
+	writeS3ServiceErr(writer, request, err)
+}
+
+func writeS3ServiceErr(writer http.ResponseWriter, request *http.Request, err error) {
+	status, code, message := s3ErrorFor(err)
+	if status == http.StatusServiceUnavailable {
+		writer.Header().Set("Retry-After", strconv.Itoa(helper.RetryAfterSeconds))
+	}
+	writeS3Err(writer, request, status, code, message)
+}
+
+func s3ErrorFor(err error) (int, string, string) {
+	switch {
+	case errors.Is(err, object.ErrNoSuchUpload):
+		return http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist."
+	case errors.Is(err, object.ErrInvalidPart):
+		return http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found or its entity tag did not match."
+	case errors.Is(err, object.ErrInvalidPartOrder):
+		return http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order."
+	case errors.Is(err, helper.ErrNotFound):
+		return http.StatusNotFound, "NoSuchKey", "The specified key does not exist."
+	case errors.Is(err, helper.ErrInvalidInput), errors.Is(err, helper.ErrBadRequest):
+		return http.StatusBadRequest, "InvalidArgument", err.Error()
+	case errors.Is(err, helper.ErrTooLarge):
+		return http.StatusBadRequest, "EntityTooLarge", "Your proposed upload exceeds the maximum allowed size"
+	case errors.Is(err, helper.ErrUnavailable):
+		return http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate."
+	default:
+		return http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."
+	}
+}
+
+func writeS3Err(writer http.ResponseWriter, request *http.Request, status int, code string, message string) {
+	writeS3XML(writer, status, web.S3Error{
+		Code:      code,
+		Message:   message,
+		Resource:  request.URL.EscapedPath(),
+		RequestID: writer.Header().Get("X-Amz-Request-Id"),
+	})
+}
+
+func writeS3XML(writer http.ResponseWriter, status int, v any) {
+	writer.Header().Set("Content-Type", "application/xml")
+	writer.Header().Del("Content-Length")
+	writer.WriteHeader(status)
+	_, _ = io.WriteString(writer, xml.Header)
+	_ = xml.NewEncoder(writer).Encode(v)
+}
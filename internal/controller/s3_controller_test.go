@@ -0,0 +1,471 @@
+package controller_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/app"
+	"meliocool/bytesize/internal/controller"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/middleware"
+	"meliocool/bytesize/internal/repository"
+	deletefile "meliocool/bytesize/internal/service/delete"
+	"meliocool/bytesize/internal/service/download"
+	"meliocool/bytesize/internal/service/object"
+	"meliocool/bytesize/internal/service/upload"
+	"meliocool/bytesize/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDBYTESIZETEST"
+	testSecretKey = "bytesize-test-secret"
+	testRegion    = "us-east-1"
+)
+
+// testSchema gives the test a freshly migrated schema of TEST_DATABASE_URL. Without it the
+// test is skipped.
+func testSchema(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := "s3_gateway_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		admin.Close()
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+		admin.Close()
+	})
+
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parse url: %v", err)
+	}
+	// * public stays on the path for the extensions the migrations expect to find there
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ", public"
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	migrations, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("find migrations: %v", err)
+	}
+	slices.Sort(migrations)
+	for _, path := range migrations {
+		sql, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		if _, err := db.Exec(ctx, string(sql)); err != nil {
+			t.Fatalf("apply %s: %v", filepath.Base(path), err)
+		}
+	}
+	return db
+}
+
+// newTestGateway serves the real S3 handler over the real object service, backed by a fresh
+// schema and chunk directory, and returns an SDK client pointed at it.
+func newTestGateway(t *testing.T) (*httptest.Server, *s3.Client, object.ObjectService) {
+	t.Helper()
+	db := testSchema(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	validate := validator.New()
+
+	chunkRepository := repository.NewChunkRepository()
+	fileRepository := repository.NewFileRepository()
+	fileChunksRepository := repository.NewFileChunksRepository()
+	chunkStorage := storage.NewFSChunkStore(t.TempDir())
+
+	deleteService := deletefile.NewDeleteService(fileRepository, fileChunksRepository, chunkRepository, chunkStorage, db)
+	admission := upload.NewAdmission(helper.MaxConcurrentUploads, helper.UploadMemoryBytes)
+	uploadService := upload.NewUploadService(chunkRepository, fileRepository, fileChunksRepository, chunkStorage, deleteService, helper.HashWorkers, admission, db, validate, logger)
+	downloadService := download.NewDownloadService(fileRepository, fileChunksRepository, chunkStorage, 0, db, logger)
+	objects := object.NewObjectService(uploadService, downloadService, deleteService, fileRepository, fileChunksRepository, db, validate, logger)
+
+	srv := httptest.NewServer(app.NewS3Handler(controller.NewS3Controller(objects), testAccessKey, testSecretKey, ""))
+	t.Cleanup(srv.Close)
+
+	client := s3.New(s3.Options{
+		Region:       testRegion,
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider(testAccessKey, testSecretKey, ""),
+	})
+	return srv, client, objects
+}
+
+func readBody(t *testing.T, rc io.ReadCloser) string {
+	t.Helper()
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return string(data)
+}
+
+func TestS3GatewayObjectLifecycle(t *testing.T) {
+	_, client, _ := newTestGateway(t)
+	ctx := context.Background()
+
+	put, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String("photos"),
+		Key:         aws.String("2024/cat.txt"),
+		Body:        strings.NewReader("hello, gateway"),
+		ContentType: aws.String("text/plain"),
+		Metadata:    map[string]string{"Owner": "tester"},
+	})
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	sum := md5.Sum([]byte("hello, gateway"))
+	if want := strconv.Quote(hex.EncodeToString(sum[:])); aws.ToString(put.ETag) != want {
+		t.Fatalf("put etag = %s; want %s", aws.ToString(put.ETag), want)
+	}
+
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("photos"), Key: aws.String("2024/cat.txt")})
+	if err != nil {
+		t.Fatalf("head: %v", err)
+	}
+	if aws.ToInt64(head.ContentLength) != 14 || aws.ToString(head.ContentType) != "text/plain" || head.Metadata["owner"] != "tester" {
+		t.Fatalf("head = %d %q %v", aws.ToInt64(head.ContentLength), aws.ToString(head.ContentType), head.Metadata)
+	}
+
+	get, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("photos"), Key: aws.String("2024/cat.txt")})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if body := readBody(t, get.Body); body != "hello, gateway" {
+		t.Fatalf("get body = %q", body)
+	}
+
+	ranged, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("photos"), Key: aws.String("2024/cat.txt"), Range: aws.String("bytes=7-13")})
+	if err != nil {
+		t.Fatalf("ranged get: %v", err)
+	}
+	if body := readBody(t, ranged.Body); body != "gateway" {
+		t.Fatalf("ranged body = %q; want %q", body, "gateway")
+	}
+	if got := aws.ToString(ranged.ContentRange); got != "bytes 7-13/14" {
+		t.Fatalf("content-range = %q", got)
+	}
+
+	suffix, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("photos"), Key: aws.String("2024/cat.txt"), Range: aws.String("bytes=-7")})
+	if err != nil {
+		t.Fatalf("suffix get: %v", err)
+	}
+	if body := readBody(t, suffix.Body); body != "gateway" {
+		t.Fatalf("suffix body = %q; want %q", body, "gateway")
+	}
+
+	if _, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String("photos"), Key: aws.String("2024/cat.txt")}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("photos"), Key: aws.String("2024/cat.txt")})
+	var noSuchKey *types.NoSuchKey
+	if !errors.As(err, &noSuchKey) {
+		t.Fatalf("get after delete = %v; want NoSuchKey", err)
+	}
+}
+
+func TestS3GatewayListObjectsV2(t *testing.T) {
+	_, client, _ := newTestGateway(t)
+	ctx := context.Background()
+
+	keys := []string{"a.txt", "b.txt", "docs/one.md", "docs/two.md", "img/x.png", "z.txt"}
+	for _, k := range keys {
+		if _, err := client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("bkt"), Key: aws.String(k), Body: strings.NewReader(k)}); err != nil {
+			t.Fatalf("put %s: %v", k, err)
+		}
+	}
+
+	// * two entries per page, so the pager has to follow continuation tokens
+	var gotKeys, gotPrefixes []string
+	pages := 0
+	pager := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String("bkt"),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(2),
+	})
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			t.Fatalf("list page %d: %v", pages, err)
+		}
+		pages++
+		for _, o := range page.Contents {
+			gotKeys = append(gotKeys, aws.ToString(o.Key))
+		}
+		for _, p := range page.CommonPrefixes {
+			gotPrefixes = append(gotPrefixes, aws.ToString(p.Prefix))
+		}
+	}
+	if want := []string{"a.txt", "b.txt", "z.txt"}; !slices.Equal(gotKeys, want) {
+		t.Fatalf("keys = %v; want %v", gotKeys, want)
+	}
+	if want := []string{"docs/", "img/"}; !slices.Equal(gotPrefixes, want) {
+		t.Fatalf("common prefixes = %v; want %v", gotPrefixes, want)
+	}
+	if pages != 3 {
+		t.Fatalf("pages = %d; want 3", pages)
+	}
+
+	docs, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String("bkt"), Prefix: aws.String("docs/")})
+	if err != nil {
+		t.Fatalf("list docs: %v", err)
+	}
+	if aws.ToInt32(docs.KeyCount) != 2 || aws.ToString(docs.Contents[0].Key) != "docs/one.md" {
+		t.Fatalf("docs listing = %d keys, first %q", aws.ToInt32(docs.KeyCount), aws.ToString(docs.Contents[0].Key))
+	}
+}
+
+func TestS3GatewayMultipart(t *testing.T) {
+	_, client, _ := newTestGateway(t)
+	ctx := context.Background()
+
+	created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("bkt"), Key: aws.String("big.bin")})
+	if err != nil {
+		t.Fatalf("create multipart: %v", err)
+	}
+	partData := [][]byte{bytes.Repeat([]byte("a"), 5<<20), []byte("tail")}
+	var completed []types.CompletedPart
+	for i, data := range partData {
+		out, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String("bkt"),
+			Key:        aws.String("big.bin"),
+			UploadId:   created.UploadId,
+			PartNumber: aws.Int32(int32(i + 1)),
+			Body:       bytes.NewReader(data),
+		})
+		if err != nil {
+			t.Fatalf("upload part %d: %v", i+1, err)
+		}
+		completed = append(completed, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(int32(i + 1))})
+	}
+	done, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String("bkt"),
+		Key:             aws.String("big.bin"),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		t.Fatalf("complete multipart: %v", err)
+	}
+	if !strings.HasSuffix(strings.Trim(aws.ToString(done.ETag), `"`), "-2") {
+		t.Fatalf("multipart etag = %s; want a -2 suffix", aws.ToString(done.ETag))
+	}
+
+	get, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("bkt"), Key: aws.String("big.bin")})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if body := readBody(t, get.Body); body != string(bytes.Join(partData, nil)) {
+		t.Fatalf("multipart object is %d bytes; want %d", len(body), 5<<20+4)
+	}
+
+	aborted, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("bkt"), Key: aws.String("gone.bin")})
+	if err != nil {
+		t.Fatalf("create multipart: %v", err)
+	}
+	if _, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: aws.String("bkt"), Key: aws.String("gone.bin"), UploadId: aborted.UploadId}); err != nil {
+		t.Fatalf("abort: %v", err)
+	}
+	_, err = client.UploadPart(ctx, &s3.UploadPartInput{Bucket: aws.String("bkt"), Key: aws.String("gone.bin"), UploadId: aborted.UploadId, PartNumber: aws.Int32(1), Body: strings.NewReader("x")})
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NoSuchUpload" {
+		t.Fatalf("part after abort = %v; want NoSuchUpload", err)
+	}
+}
+
+func TestS3GatewayPresignedURLs(t *testing.T) {
+	srv, client, _ := newTestGateway(t)
+	ctx := context.Background()
+	presigner := s3.NewPresignClient(client)
+
+	putReq, err := presigner.PresignPutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("bkt"), Key: aws.String("shared.txt")}, s3.WithPresignExpires(time.Minute))
+	if err != nil {
+		t.Fatalf("presign put: %v", err)
+	}
+	req, _ := http.NewRequest(putReq.Method, putReq.URL, strings.NewReader("via presigned put"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("presigned put: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("presigned put status = %d", resp.StatusCode)
+	}
+
+	getReq, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:              aws.String("bkt"),
+		Key:                 aws.String("shared.txt"),
+		ResponseContentType: aws.String("text/x-shared"),
+	}, s3.WithPresignExpires(time.Minute))
+	if err != nil {
+		t.Fatalf("presign get: %v", err)
+	}
+	resp, err = http.Get(getReq.URL)
+	if err != nil {
+		t.Fatalf("presigned get: %v", err)
+	}
+	if body := readBody(t, resp.Body); resp.StatusCode != http.StatusOK || body != "via presigned put" {
+		t.Fatalf("presigned get = %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/x-shared" {
+		t.Fatalf("presigned get content-type = %q; want the response-content-type override", got)
+	}
+
+	// * the same URL with its signature altered is refused
+	tampered := strings.Replace(getReq.URL, "shared.txt", "shared.txt2", 1)
+	resp, err = http.Get(tampered)
+	if err != nil {
+		t.Fatalf("tampered get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("tampered presigned get status = %d; want 403", resp.StatusCode)
+	}
+
+	// * and so is one past its expiry
+	handler := srv.Config.Handler.(*middleware.SigV4Middleware)
+	handler.Now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	resp, err = http.Get(getReq.URL)
+	if err != nil {
+		t.Fatalf("expired get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expired presigned get status = %d; want 403", resp.StatusCode)
+	}
+}
+
+func TestS3GatewayStreamingSignedPayload(t *testing.T) {
+	srv, _, objects := newTestGateway(t)
+	body := bytes.Repeat([]byte("0123456789abcdef"), 5000)
+	chunks := [][]byte{body[:64<<10], body[64<<10:]}
+
+	resp := putStreaming(t, srv.URL+"/bkt/streamed.bin", chunks, false)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("streaming put status = %d: %s", resp.StatusCode, readBody(t, resp.Body))
+	}
+	resp.Body.Close()
+	ctx := context.Background()
+	info, err := objects.Head(ctx, "bkt/streamed.bin")
+	if err != nil || info.Size != int64(len(body)) {
+		t.Fatalf("streamed object = %+v, %v; want %d bytes", info, err, len(body))
+	}
+	var got bytes.Buffer
+	if err := objects.Stream(ctx, info, 0, info.Size, &got); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), body) {
+		t.Fatal("streamed object differs from the payload sent")
+	}
+
+	resp = putStreaming(t, srv.URL+"/bkt/tampered.bin", chunks, true)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(readBody(t, resp.Body), "XAmzContentSHA256Mismatch") {
+		t.Fatalf("tampered streaming put status = %d; want 400 XAmzContentSHA256Mismatch", resp.StatusCode)
+	}
+}
+
+// putStreaming sends chunks as an aws-chunked STREAMING-AWS4-HMAC-SHA256-PAYLOAD body: the
+// SDK signer signs the headers (the seed signature) and each chunk signature chains from it.
+// tamper flips a byte of the second chunk after it was signed.
+func putStreaming(t *testing.T, url string, chunks [][]byte, tamper bool) *http.Response {
+	t.Helper()
+	const streaming = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + testRegion + "/s3/aws4_request"
+
+	var decoded int
+	for _, c := range chunks {
+		decoded += len(c)
+	}
+	req, _ := http.NewRequest(http.MethodPut, url, nil)
+	req.Header.Set("Content-Encoding", "aws-chunked")
+	req.Header.Set("X-Amz-Content-Sha256", streaming)
+	req.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(decoded))
+
+	signer := v4.NewSigner()
+	creds := aws.Credentials{AccessKeyID: testAccessKey, SecretAccessKey: testSecretKey}
+	if err := signer.SignHTTP(context.Background(), creds, req, streaming, "s3", testRegion, now); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	_, seed, _ := strings.Cut(req.Header.Get("Authorization"), "Signature=")
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{now.Format("20060102"), testRegion, "s3", "aws4_request"} {
+		key = hmacSum(key, part)
+	}
+	emptyHash := sha256.Sum256(nil)
+
+	var encoded bytes.Buffer
+	prev := seed
+	for i, c := range append(chunks, nil) {
+		dataHash := sha256.Sum256(c)
+		stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256-PAYLOAD", amzDate, scope, prev, hex.EncodeToString(emptyHash[:]), hex.EncodeToString(dataHash[:])}, "\n")
+		sig := hex.EncodeToString(hmacSum(key, stringToSign))
+		prev = sig
+		if tamper && i == 1 {
+			c = append([]byte{c[0] ^ 0xff}, c[1:]...)
+		}
+		fmt.Fprintf(&encoded, "%x;chunk-signature=%s\r\n", len(c), sig)
+		encoded.Write(c)
+		encoded.WriteString("\r\n")
+	}
+	req.Body = io.NopCloser(&encoded)
+	req.ContentLength = int64(encoded.Len())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("streaming put: %v", err)
+	}
+	return resp
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
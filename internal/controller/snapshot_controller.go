@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type SnapshotController interface {
+	Create(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	List(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Get(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Diff(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Restore(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Forget(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	ForgetPolicy(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+}
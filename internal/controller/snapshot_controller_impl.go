@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/service/snapshot"
+	"net/http"
+)
+
+type SnapshotControllerImpl struct {
+	SnapshotService snapshot.SnapshotService
+}
+
+func NewSnapshotController(snapshotService snapshot.SnapshotService) SnapshotController {
+	return &SnapshotControllerImpl{SnapshotService: snapshotService}
+}
+
+func (s *SnapshotControllerImpl) Create(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxSnapshotRequestBytes)
+	createReq := web.SnapshotCreateRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&createReq); err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			helper.WriteErr(writer, helper.ErrTooLarge)
+			return
+		}
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	resp, err := s.SnapshotService.Create(request.Context(), createReq)
+	if err != nil {
+		// * missing chunks answer 409 with their hashes, as a manifest commit does
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusCreated,
+		Status: "Success!",
+		Data:   resp,
+	})
+}
+
+// List takes ?host=<hostname>&tag=a&tag=b.
+func (s *SnapshotControllerImpl) List(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	query := request.URL.Query()
+	filter := domain.SnapshotFilter{Hostname: query.Get("host"), Tags: helper.SplitTags(query["tag"])}
+
+	snapshots, err := s.SnapshotService.List(request.Context(), filter)
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   snapshots,
+	})
+}
+
+func (s *SnapshotControllerImpl) Get(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	id, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	resp, err := s.SnapshotService.Get(request.Context(), id)
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   resp,
+	})
+}
+
+func (s *SnapshotControllerImpl) Diff(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	from, fromErr := uuid.Parse(params.ByName("id"))
+	to, toErr := uuid.Parse(params.ByName("other"))
+	if fromErr != nil || toErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	diff, err := s.SnapshotService.Diff(request.Context(), from, to)
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   diff,
+	})
+}
+
+// Restore takes ?path=<entry> to restore one subtree and ?format=tar|tar.gz.
+func (s *SnapshotControllerImpl) Restore(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	id, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+	query := request.URL.Query()
+
+	plan, err := s.SnapshotService.PrepareRestore(ctx, id, query.Get("path"), query.Get("format"))
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	// * no Content-Length: the archive is built on the fly
+	writer.Header().Set("Content-Type", plan.ContentType())
+	writer.Header().Set("Content-Disposition", helper.ContentDisposition("attachment", plan.Filename()))
+
+	streamErr := s.SnapshotService.Restore(ctx, plan, writer)
+	if streamErr != nil {
+		return
+	}
+}
+
+func (s *SnapshotControllerImpl) Forget(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	id, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	if err := s.SnapshotService.Forget(request.Context(), id); err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   id,
+	})
+}
+
+func (s *SnapshotControllerImpl) ForgetPolicy(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxMemoryBytes)
+	forgetReq := web.SnapshotForgetRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&forgetReq); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	resp, err := s.SnapshotService.ForgetPolicy(request.Context(), forgetReq)
+	if err != nil {
+		writeManifestErr(writer, err)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, web.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Success!",
+		Data:   resp,
+	})
+}
@@ -0,0 +1,14 @@
+package controller
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type TusController interface {
+	Options(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Create(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Head(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Patch(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+	Delete(writer http.ResponseWriter, request *http.Request, params httprouter.Params)
+}
@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/service/tus"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const tusExtensions = "creation,termination,checksum,expiration"
+
+// * tus defines 460 for a body that fails its Upload-Checksum
+const statusChecksumMismatch = 460
+
+type TusControllerImpl struct {
+	TusService tus.TusService
+	BasePath   string
+}
+
+func NewTusController(tusService tus.TusService, basePath string) TusController {
+	return &TusControllerImpl{TusService: tusService, BasePath: basePath}
+}
+
+func writeTusStatus(writer http.ResponseWriter, code int, status string, err error) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+	helper.WriteToResponseBody(writer, web.WebResponse{Code: code, Status: status, Data: err.Error()})
+}
+
+func writeTusErr(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, tus.ErrOffsetMismatch):
+		writeTusStatus(writer, http.StatusConflict, "Conflict!", err)
+	case errors.Is(err, tus.ErrChecksumMismatch):
+		writeTusStatus(writer, statusChecksumMismatch, "Checksum Mismatch!", err)
+	case errors.Is(err, helper.ErrInvalidInput):
+		helper.WriteErr(writer, helper.ErrBadRequest)
+	default:
+		helper.WriteErr(writer, err)
+	}
+}
+
+// checkResumable answers 412 to clients speaking another protocol version. Every response
+// carries Tus-Resumable.
+func checkResumable(writer http.ResponseWriter, request *http.Request) bool {
+	writer.Header().Set("Tus-Resumable", helper.TusVersion)
+	if request.Header.Get("Tus-Resumable") != helper.TusVersion {
+		writer.Header().Set("Tus-Version", helper.TusVersion)
+		writeTusStatus(writer, http.StatusPreconditionFailed, "Precondition Failed!", errors.New("unsupported tus version"))
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes "key base64value,key2 ..." pairs; a key may come without a value.
+func parseUploadMetadata(raw string) (map[string]string, error) {
+	out := make(map[string]string)
+	if strings.TrimSpace(raw) == "" {
+		return out, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, helper.ErrBadRequest
+		}
+		if _, dup := out[key]; dup {
+			return nil, helper.ErrBadRequest
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, helper.ErrBadRequest
+		}
+		out[key] = string(value)
+	}
+	return out, nil
+}
+
+// parseUploadChecksum reads "Upload-Checksum: <algorithm> <base64 digest>".
+func parseUploadChecksum(raw string) (*tus.Checksum, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	algorithm, encoded, ok := strings.Cut(raw, " ")
+	if !ok {
+		return nil, helper.ErrBadRequest
+	}
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, helper.ErrBadRequest
+	}
+	return &tus.Checksum{Algorithm: algorithm, Sum: sum}, nil
+}
+
+func (t *TusControllerImpl) uploadHeaders(writer http.ResponseWriter, up tus.Upload) {
+	writer.Header().Set("Upload-Offset", strconv.FormatInt(up.Offset, 10))
+	writer.Header().Set("Cache-Control", "no-store")
+	if up.ExpiresAt != nil {
+		writer.Header().Set("Upload-Expires", up.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	if up.FileID != uuid.Nil {
+		writer.Header().Set("X-File-Id", up.FileID.String())
+	}
+}
+
+func (t *TusControllerImpl) Options(writer http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writer.Header().Set("Tus-Resumable", helper.TusVersion)
+	writer.Header().Set("Tus-Version", helper.TusVersion)
+	writer.Header().Set("Tus-Extension", tusExtensions)
+	writer.Header().Set("Tus-Max-Size", strconv.FormatInt(helper.MaxBytes, 10))
+	writer.Header().Set("Tus-Checksum-Algorithm", strings.Join(tus.ChecksumAlgorithms, ","))
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// Create takes the file's name, type, expiry and labels from Upload-Metadata: filename,
+// filetype, expires_at or ttl, tags, and meta.<key>.
+func (t *TusControllerImpl) Create(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	if !checkResumable(writer, request) {
+		return
+	}
+	if request.Header.Get("Upload-Defer-Length") != "" {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(request.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+	if length > helper.MaxBytes {
+		helper.WriteErr(writer, helper.ErrTooLarge)
+		return
+	}
+	fields, err := parseUploadMetadata(request.Header.Get("Upload-Metadata"))
+	if err != nil {
+		helper.WriteErr(writer, err)
+		return
+	}
+
+	contentType, err := parseContentType(fields["filetype"], "")
+	if err != nil {
+		helper.WriteErr(writer, err)
+		return
+	}
+	expiresAt, err := resolveExpiry(fields["expires_at"], fields["ttl"])
+	if err != nil {
+		helper.WriteErr(writer, err)
+		return
+	}
+	metadata := make(map[string]string)
+	for k, v := range fields {
+		if key, ok := strings.CutPrefix(k, "meta."); ok {
+			metadata[key] = v
+		}
+	}
+
+	up, err := t.TusService.Create(request.Context(), web.TusCreateRequest{
+		Filename:    fields["filename"],
+		Length:      length,
+		ContentType: contentType,
+		ExpiresAt:   expiresAt,
+		Metadata:    metadata,
+		Tags:        helper.SplitTags([]string{fields["tags"]}),
+	})
+	if err != nil {
+		writeTusErr(writer, err)
+		return
+	}
+	t.uploadHeaders(writer, up)
+	writer.Header().Set("Location", t.BasePath+"/"+up.ID.String())
+	writer.WriteHeader(http.StatusCreated)
+}
+
+func (t *TusControllerImpl) Head(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !checkResumable(writer, request) {
+		return
+	}
+	id, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+	up, err := t.TusService.Get(request.Context(), id)
+	if err != nil {
+		writeTusErr(writer, err)
+		return
+	}
+	t.uploadHeaders(writer, up)
+	writer.Header().Set("Upload-Length", strconv.FormatInt(up.Length, 10))
+	writer.WriteHeader(http.StatusOK)
+}
+
+func (t *TusControllerImpl) Patch(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !checkResumable(writer, request) {
+		return
+	}
+	if request.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		helper.WriteErr(writer, helper.ErrUnsupportedMediaType)
+		return
+	}
+	id, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+	offset, err := strconv.ParseInt(request.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+	checksum, err := parseUploadChecksum(request.Header.Get("Upload-Checksum"))
+	if err != nil {
+		helper.WriteErr(writer, err)
+		return
+	}
+
+	// * PATCH bodies go through the same upload slots as REST uploads
+	release, admitErr := t.TusService.Admit()
+	if admitErr != nil {
+		helper.WriteErr(writer, admitErr)
+		return
+	}
+	defer release()
+
+	up, err := t.TusService.Write(request.Context(), id, offset, request.Body, checksum)
+	if err != nil {
+		writeTusErr(writer, err)
+		return
+	}
+	t.uploadHeaders(writer, up)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (t *TusControllerImpl) Delete(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !checkResumable(writer, request) {
+		return
+	}
+	id, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+	if err := t.TusService.Terminate(request.Context(), id); err != nil {
+		writeTusErr(writer, err)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
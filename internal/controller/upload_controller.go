@@ -7,4 +7,5 @@ import (
 
 type UploadController interface {
 	Upload(writer http.ResponseWriter, request *http.Request, _ httprouter.Params)
+	UploadArchive(writer http.ResponseWriter, request *http.Request, _ httprouter.Params)
 }
@@ -6,8 +6,11 @@ import (
 	"meliocool/bytesize/internal/helper"
 	"meliocool/bytesize/internal/model/web"
 	"meliocool/bytesize/internal/service/upload"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type UploadControllerImpl struct {
@@ -27,6 +30,15 @@ func (u *UploadControllerImpl) Upload(writer http.ResponseWriter, request *http.
 		helper.WriteErr(writer, helper.ErrUnsupportedMediaType)
 		return
 	}
+
+	// * take an upload slot before the body is read, so a busy server sheds load early
+	release, admitErr := u.UploadService.Admit()
+	if admitErr != nil {
+		helper.WriteErr(writer, admitErr)
+		return
+	}
+	defer release()
+
 	err := request.ParseMultipartForm(helper.MaxMemoryBytes)
 	if err != nil {
 		if _, ok := err.(*http.MaxBytesError); ok {
@@ -54,10 +66,28 @@ func (u *UploadControllerImpl) Upload(writer http.ResponseWriter, request *http.
 		}
 	}
 
+	expiresAt, expErr := parseExpiry(request)
+	if expErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	metadata, tags := parseLabels(request)
+
+	contentType, ctErr := parseContentType(request.FormValue("content_type"), fileHeader.Header.Get("Content-Type"))
+	if ctErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
 	uploadReq := web.UploadRequest{
-		Ctx:      request.Context(),
-		FileName: formFieldName,
-		Reader:   fileReader,
+		Ctx:         request.Context(),
+		FileName:    formFieldName,
+		Reader:      fileReader,
+		ContentType: contentType,
+		ExpiresAt:   expiresAt,
+		Metadata:    metadata,
+		Tags:        tags,
 	}
 
 	resp, uploadErr := u.UploadService.Upload(request.Context(), uploadReq)
@@ -82,3 +112,169 @@ func (u *UploadControllerImpl) Upload(writer http.ResponseWriter, request *http.
 
 	helper.WriteToResponseBody(writer, webResponse)
 }
+
+func (u *UploadControllerImpl) UploadArchive(writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	request.Body = http.MaxBytesReader(writer, request.Body, helper.MaxBytes)
+
+	if !strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/form-data") {
+		helper.WriteErr(writer, helper.ErrUnsupportedMediaType)
+		return
+	}
+
+	// * take an upload slot before the body is read, so a busy server sheds load early
+	release, admitErr := u.UploadService.Admit()
+	if admitErr != nil {
+		helper.WriteErr(writer, admitErr)
+		return
+	}
+	defer release()
+
+	err := request.ParseMultipartForm(helper.MaxMemoryBytes)
+	if err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			helper.WriteErr(writer, helper.ErrTooLarge)
+			return
+		}
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+	defer request.MultipartForm.RemoveAll()
+
+	// * multipart.File is an io.ReaderAt, which zip needs to reach the central directory
+	fileReader, fileHeader, reqErr := request.FormFile("file")
+	if reqErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+	defer fileReader.Close()
+
+	expiresAt, expErr := parseExpiry(request)
+	if expErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	metadata, tags := parseLabels(request)
+
+	archiveReq := web.ArchiveUploadRequest{
+		Ctx:       request.Context(),
+		Reader:    fileReader,
+		Size:      fileHeader.Size,
+		Prefix:    request.FormValue("prefix"),
+		ExpiresAt: expiresAt,
+		Metadata:  metadata,
+		Tags:      tags,
+	}
+
+	resp, uploadErr := u.UploadService.UploadArchive(request.Context(), archiveReq)
+	if uploadErr != nil {
+		if errors.Is(uploadErr, helper.ErrInvalidInput) {
+			helper.WriteErr(writer, helper.ErrBadRequest)
+			return
+		} else if errors.Is(uploadErr, helper.ErrTooLarge) {
+			helper.WriteErr(writer, helper.ErrTooLarge)
+			return
+		} else {
+			helper.WriteErr(writer, helper.ErrInternal)
+			return
+		}
+	}
+
+	webResponse := web.WebResponse{
+		Code:   http.StatusCreated,
+		Status: "Success!",
+		Data:   resp,
+	}
+
+	helper.WriteToResponseBody(writer, webResponse)
+}
+
+// parseExpiry reads an absolute expires_at (RFC 3339) or a relative ttl (Go duration or seconds)
+// from the form, falling back to the X-Expires-At / X-TTL headers. Returns nil when neither is set.
+func parseExpiry(request *http.Request) (*time.Time, error) {
+	expiresAt := request.FormValue("expires_at")
+	if expiresAt == "" {
+		expiresAt = request.Header.Get("X-Expires-At")
+	}
+	ttl := request.FormValue("ttl")
+	if ttl == "" {
+		ttl = request.Header.Get("X-TTL")
+	}
+
+	return resolveExpiry(expiresAt, ttl)
+}
+
+// resolveExpiry turns an RFC 3339 expires_at or a ttl (Go duration or seconds) into an expiry;
+// setting both is an error.
+func resolveExpiry(expiresAt string, ttl string) (*time.Time, error) {
+	if expiresAt != "" && ttl != "" {
+		return nil, helper.ErrBadRequest
+	}
+	if expiresAt != "" {
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return nil, helper.ErrBadRequest
+		}
+		return &t, nil
+	}
+	if ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			secs, convErr := strconv.ParseInt(ttl, 10, 64)
+			if convErr != nil {
+				return nil, helper.ErrBadRequest
+			}
+			d = time.Duration(secs) * time.Second
+		}
+		if d <= 0 {
+			return nil, helper.ErrBadRequest
+		}
+		t := time.Now().Add(d)
+		return &t, nil
+	}
+	return nil, nil
+}
+
+// parseLabels collects user metadata from meta.<key> form fields and X-Meta-<Key> headers
+// (form wins on conflict), and tags from the tags field / X-Tags header.
+func parseLabels(request *http.Request) (map[string]string, []string) {
+	metadata := make(map[string]string)
+	for name, values := range request.Header {
+		if key, ok := strings.CutPrefix(name, "X-Meta-"); ok && len(values) > 0 {
+			metadata[strings.ToLower(key)] = values[0]
+		}
+	}
+	if request.MultipartForm != nil {
+		for name, values := range request.MultipartForm.Value {
+			if key, ok := strings.CutPrefix(name, "meta."); ok && len(values) > 0 {
+				metadata[strings.ToLower(key)] = values[0]
+			}
+		}
+	}
+
+	var rawTags []string
+	if request.MultipartForm != nil {
+		rawTags = append(rawTags, request.MultipartForm.Value["tags"]...)
+	}
+	rawTags = append(rawTags, request.Header.Values("X-Tags")...)
+
+	return metadata, helper.SplitTags(rawTags)
+}
+
+// parseContentType prefers the explicit content_type field over the multipart part header.
+// application/octet-stream from the part header is what browsers send when they don't know,
+// so it is treated as absent and left to sniffing.
+func parseContentType(field string, partHeader string) (string, error) {
+	raw := field
+	if raw == "" {
+		raw = partHeader
+		if raw == "" || strings.HasPrefix(raw, "application/octet-stream") {
+			return "", nil
+		}
+	}
+	mediaType, params, err := mime.ParseMediaType(raw)
+	if err != nil {
+		return "", helper.ErrBadRequest
+	}
+	return mime.FormatMediaType(mediaType, params), nil
+}
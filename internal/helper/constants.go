@@ -1,8 +1,43 @@
 package helper
 
+import "time"
+
 const MaxBytes = 2 << 30
 const MaxMemoryBytes = 32 << 20
 const ChunkSize = 4 * 1024 * 1024
 const BatchSize = 200
 const Workers = 10
-const StreamByteSize = 128 * 1024
+const HashWorkers = 4
+const MaxConcurrentUploads = 32
+const UploadMemoryBytes = 512 << 20
+const RetryAfterSeconds = 5
+const ReaperInterval = time.Minute
+const ReaperBatchSize = 100
+const ShutdownTimeout = 30 * time.Second
+const MaxMetadataEntries = 64
+const MaxMetadataValueBytes = 1024
+const MaxTags = 64
+const SniffBytes = 3072
+const MaxArchiveFiles = 1000
+const MaxArchiveMembers = 10000
+const MaxArchiveExpandedBytes = 64 << 30
+const MultipartPrefix = ".s3-multipart/"
+const TusUploadPrefix = ".tus/"
+const SnapshotPrefix = ".snapshots/"
+const DirectoryContentType = "application/x-directory"
+const MultipartUploadTTL = 7 * 24 * time.Hour
+const MaxMultipartParts = 10000
+const S3MaxKeys = 1000
+const S3MaxRequestXMLBytes = 1 << 20
+const GRPCMessageBytes = 1 << 20
+const GRPCDefaultPageSize = 100
+const TusVersion = "1.0.0"
+const TusUploadTTL = 24 * time.Hour
+const MaxListLimit = 1000
+const MaxMissingHashes = 10000
+const MaxSnapshotRequestBytes = 64 << 20
+const BundlePageSize = 100
+const ReplicationInterval = 5 * time.Second
+const ReplicationBatchSize = 100
+const ReplicationGapTimeout = 30 * time.Second
+const ReplicationMaxBackoff = 5 * time.Minute
@@ -0,0 +1,49 @@
+package helper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ContentDisposition builds an RFC 6266 header value carrying both an ASCII-safe
+// filename fallback and an RFC 5987 UTF-8 filename* parameter.
+func ContentDisposition(disposition string, filename string) string {
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", disposition, asciiFallback(filename), encodeRFC5987(filename))
+}
+
+// asciiFallback replaces anything a legacy quoted-string parser could choke on.
+func asciiFallback(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			b.WriteByte('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func encodeRFC5987(name string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"meliocool/bytesize/internal/model/web"
 	"net/http"
+	"strconv"
 )
 
 var ErrBadRequest = errors.New("invalid request")
@@ -13,6 +14,8 @@ var ErrNotFound = errors.New("resource not found")
 var ErrInvalidInput = errors.New("invalid input")
 var ErrInternal = errors.New("internal server error")
 var ErrUnsupportedMediaType = errors.New("unsupported media type")
+var ErrUnavailable = errors.New("server busy, retry later")
+var ErrConflict = errors.New("a newer version exists")
 
 func WriteErr(w http.ResponseWriter, err error) {
 	w.Header().Set("Content-Type", "application/json")
@@ -52,6 +55,25 @@ func WriteErr(w http.ResponseWriter, err error) {
 			Data:   err.Error(),
 		}
 		encoder.Encode(webResponse)
+	} else if errors.Is(err, ErrUnavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		encoder := json.NewEncoder(w)
+		webResponse := web.WebResponse{
+			Code:   http.StatusServiceUnavailable,
+			Status: "Service Unavailable!",
+			Data:   err.Error(),
+		}
+		encoder.Encode(webResponse)
+	} else if errors.Is(err, ErrConflict) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		encoder := json.NewEncoder(w)
+		webResponse := web.WebResponse{
+			Code:   http.StatusPreconditionFailed,
+			Status: "Precondition Failed!",
+			Data:   err.Error(),
+		}
+		encoder.Encode(webResponse)
 	} else {
 		w.WriteHeader(http.StatusInternalServerError)
 		encoder := json.NewEncoder(w)
@@ -0,0 +1,52 @@
+package helper
+
+import "strings"
+
+// ValidateLabels checks user-defined metadata keys, values and tags against the label limits.
+// Metadata keys are case-insensitive, so two keys that differ only in case are rejected.
+func ValidateLabels(metadata map[string]string, tags []string) error {
+	regex := LabelRegex()
+	if len(metadata) > MaxMetadataEntries || len(tags) > MaxTags {
+		return ErrInvalidInput
+	}
+	seen := make(map[string]bool, len(metadata))
+	for k, v := range metadata {
+		if !regex.MatchString(k) || len(v) > MaxMetadataValueBytes || seen[strings.ToLower(k)] {
+			return ErrInvalidInput
+		}
+		seen[strings.ToLower(k)] = true
+	}
+	for _, t := range tags {
+		if !regex.MatchString(t) {
+			return ErrInvalidInput
+		}
+	}
+	return nil
+}
+
+// LowerKeys returns a copy of metadata with every key lowercased, the form keys are stored and
+// matched in.
+func LowerKeys(metadata map[string]string) map[string]string {
+	out := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
+
+// SplitTags flattens repeated and comma-separated tag values, trimming blanks and duplicates.
+func SplitTags(values []string) []string {
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t == "" || seen[t] {
+				continue
+			}
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
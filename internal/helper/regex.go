@@ -9,3 +9,19 @@ func HashRegex() *regexp.Regexp {
 	}
 	return regex
 }
+
+func LabelRegex() *regexp.Regexp {
+	regex, err := regexp.Compile("^[A-Za-z0-9_.:-]{1,64}$")
+	if err != nil {
+		panic("Regex Failed to Compile!")
+	}
+	return regex
+}
+
+func BucketRegex() *regexp.Regexp {
+	regex, err := regexp.Compile("^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$")
+	if err != nil {
+		panic("Regex Failed to Compile!")
+	}
+	return regex
+}
@@ -0,0 +1,31 @@
+package helper
+
+import "strings"
+
+// ReservedPrefixes hold in-progress uploads (S3 multipart parts, tus uploads) or snapshot
+// manifests rather than user files.
+var ReservedPrefixes = []string{MultipartPrefix, TusUploadPrefix, SnapshotPrefix}
+
+// ReservedMetadataPrefixes namespace the metadata keys the S3 gateway and tus uploads keep
+// their own state under.
+var ReservedMetadataPrefixes = []string{"s3:", "tus:"}
+
+// ReservedMetadataKey reports whether key lives under one of ReservedMetadataPrefixes.
+func ReservedMetadataKey(key string) bool {
+	for _, prefix := range ReservedMetadataPrefixes {
+		if strings.HasPrefix(strings.ToLower(key), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReservedFilename reports whether filename lives under one of ReservedPrefixes.
+func ReservedFilename(filename string) bool {
+	for _, prefix := range ReservedPrefixes {
+		if strings.HasPrefix(filename+"/", prefix) {
+			return true
+		}
+	}
+	return false
+}
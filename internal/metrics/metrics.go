@@ -43,3 +43,236 @@ var BytesStreamedTotal = promauto.NewCounter(
 		Help: "Sum of streamed bytes on successful downloads.",
 	},
 )
+
+var ExpiredFilesReapedTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_expired_files_reaped_total",
+		Help: "Total files deleted by the expiry reaper.",
+	},
+)
+
+var ReclaimedBytesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bytesize_reclaimed_bytes_total",
+		Help: "Sum of orphan chunk bytes reclaimed by source (delete, expiry).",
+	},
+	[]string{"source"},
+)
+
+var ReplicaHealthy = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "bytesize_chunkstore_replica_healthy",
+		Help: "1 if the last operation against the replica succeeded, 0 otherwise.",
+	},
+	[]string{"replica"},
+)
+
+var ReplicaErrorsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunkstore_replica_errors_total",
+		Help: "Total replica operation failures by replica and op.",
+	},
+	[]string{"replica", "op"},
+)
+
+var ReplicaRepairsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunkstore_replica_repairs_total",
+		Help: "Total chunks re-written to a replica that was missing them.",
+	},
+	[]string{"replica"},
+)
+
+var ErasureReconstructionsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunkstore_erasure_reconstructions_total",
+		Help: "Total chunk reads that had to rebuild missing or corrupt shards from parity.",
+	},
+)
+
+var ErasureShardsRepairedTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunkstore_erasure_shards_repaired_total",
+		Help: "Total shards rewritten by the erasure repair routine.",
+	},
+	[]string{"replica"},
+)
+
+var TierHitsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunkstore_tier_hits_total",
+		Help: "Total chunk reads served by tier (hot, cold).",
+	},
+	[]string{"tier"},
+)
+
+var TierMissesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunkstore_tier_misses_total",
+		Help: "Total chunk reads not found in tier (hot, cold).",
+	},
+	[]string{"tier"},
+)
+
+var TierEvictionsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunkstore_tier_evictions_total",
+		Help: "Total chunks evicted from the hot tier.",
+	},
+)
+
+var TierHotBytes = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_chunkstore_tier_hot_bytes",
+		Help: "Bytes currently tracked in the hot tier.",
+	},
+)
+
+var TierDirtyChunks = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_chunkstore_tier_dirty_chunks",
+		Help: "Hot-tier chunks not yet written back to the cold tier.",
+	},
+)
+
+var PackSegments = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_chunkstore_pack_segments",
+		Help: "Pack segment files currently on disk.",
+	},
+)
+
+var PackDeadBytes = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_chunkstore_pack_dead_bytes",
+		Help: "Bytes in pack segments held by deleted chunks and tombstones.",
+	},
+)
+
+var PackCompactionsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunkstore_pack_compactions_total",
+		Help: "Total pack segments rewritten by compaction.",
+	},
+)
+
+var ChunkCacheHitsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunk_cache_hits_total",
+		Help: "Total chunk reads served from the in-memory cache.",
+	},
+)
+
+var ChunkCacheMissesTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunk_cache_misses_total",
+		Help: "Total chunk reads that missed the in-memory cache.",
+	},
+)
+
+var ChunkCacheCoalescedTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunk_cache_coalesced_total",
+		Help: "Total cache misses that shared an in-flight read of the same chunk.",
+	},
+)
+
+var ChunkCacheEvictionsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunk_cache_evictions_total",
+		Help: "Total chunks evicted from the in-memory cache.",
+	},
+)
+
+var ChunkCacheBytes = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_chunk_cache_bytes",
+		Help: "Bytes currently held by the in-memory chunk cache.",
+	},
+)
+
+var ChunkIndexSkippedTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunk_index_skipped_total",
+		Help: "Total Exists checks answered by the in-memory chunk index without touching the store.",
+	},
+)
+
+var ChunkIndexFalsePositivesTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_chunk_index_false_positives_total",
+		Help: "Total Exists checks where the chunk index said maybe and the store said no.",
+	},
+)
+
+var ChunkIndexEntries = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_chunk_index_entries",
+		Help: "Approximate number of hashes added to the chunk index since the last rebuild.",
+	},
+)
+
+var UploadsInFlight = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_uploads_in_flight",
+		Help: "Uploads currently holding an admission slot.",
+	},
+)
+
+var UploadsRejectedTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_uploads_rejected_total",
+		Help: "Total uploads rejected with 503 because every upload slot was taken.",
+	},
+)
+
+var UploadInFlightBytes = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_upload_in_flight_bytes",
+		Help: "Chunk buffer bytes currently held by upload pipelines against the memory budget.",
+	},
+)
+
+var DownloadPrefetchWaitSeconds = promauto.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "bytesize_download_prefetch_wait_seconds",
+		Help:    "Time a download waited for its next prefetched chunk.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	},
+)
+
+var DavCopiedBytesTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_dav_copied_bytes_total",
+		Help: "Bytes copied by WebDAV COPY as manifest clones, without reading or writing chunk data.",
+	},
+)
+
+var ReplicationLagSeconds = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_replication_lag_seconds",
+		Help: "Age of the oldest change not yet replicated to the peer, 0 when caught up.",
+	},
+)
+
+var ReplicationPendingEvents = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bytesize_replication_pending_events",
+		Help: "Change log events not yet replicated to the peer.",
+	},
+)
+
+var ReplicationEventsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bytesize_replication_events_total",
+		Help: "Total changes sent to the peer by op (upsert, delete, backfill) and result.",
+	},
+	[]string{"op", "result"},
+)
+
+var ReplicationBytesSentTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bytesize_replication_bytes_sent_total",
+		Help: "Sum of chunk bytes sent to the peer.",
+	},
+)
@@ -1,10 +1,18 @@
 package middleware
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/google/uuid"
 	"meliocool/bytesize/internal/helper"
 	"meliocool/bytesize/internal/model/web"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type AuthMiddleware struct {
@@ -15,17 +23,55 @@ func NewAuthMiddleware(handler http.Handler) *AuthMiddleware {
 	return &AuthMiddleware{Handler: handler}
 }
 
-func (middleware *AuthMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	expected := os.Getenv("MIDDLEWARE_KEY")
-	if expected == "" {
-		expected = "LOVEMELOVEME"
+// ValidAPIKey reports whether apiKey matches MIDDLEWARE_KEY; REST and gRPC share it.
+func ValidAPIKey(apiKey string) bool {
+	return subtle.ConstantTimeCompare([]byte(apiKey), []byte(expectedAPIKey())) == 1
+}
+
+func expectedAPIKey() string {
+	if key := os.Getenv("MIDDLEWARE_KEY"); key != "" {
+		return key
+	}
+	return "LOVEMELOVEME"
+}
+
+// ValidShareLink reports whether request is a GET of /files/download/:id carrying an unexpired
+// share signature: expires (unix seconds) and signature, the hex HMAC-SHA256 of
+// "<id>\n<expires>" keyed with the API key.
+func ValidShareLink(request *http.Request) bool {
+	if request.Method != http.MethodGet {
+		return false
+	}
+	id, ok := strings.CutPrefix(request.URL.Path, "/files/download/")
+	if !ok {
+		return false
 	}
+	fileID, err := uuid.Parse(id)
+	if err != nil {
+		return false
+	}
+	query := request.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(expectedAPIKey()))
+	mac.Write([]byte(fileID.String() + "\n" + strconv.FormatInt(expires, 10)))
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+func (middleware *AuthMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	apiKey := request.Header.Get("X-API-Key")
 	if apiKey == "" {
 		apiKey = request.URL.Query().Get("api_key")
 	}
 
-	if apiKey == expected && expected != "" {
+	if ValidAPIKey(apiKey) || ValidShareLink(request) {
 		middleware.Handler.ServeHTTP(writer, request)
 		return
 	}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/web"
+	"net/http"
+)
+
+// BasicAuthMiddleware guards frontends whose clients can only send HTTP Basic credentials,
+// such as WebDAV mounts in file managers.
+type BasicAuthMiddleware struct {
+	Handler  http.Handler
+	Username string
+	Password string
+	Realm    string
+}
+
+func NewBasicAuthMiddleware(handler http.Handler, username string, password string, realm string) *BasicAuthMiddleware {
+	return &BasicAuthMiddleware{Handler: handler, Username: username, Password: password, Realm: realm}
+}
+
+func (middleware *BasicAuthMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	username, password, ok := request.BasicAuth()
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(middleware.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(middleware.Password)) == 1
+	if ok && userOK && passOK {
+		middleware.Handler.ServeHTTP(writer, request)
+		return
+	}
+
+	writer.Header().Set("WWW-Authenticate", `Basic realm="`+middleware.Realm+`", charset="UTF-8"`)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusUnauthorized)
+
+	webResponse := web.WebResponse{
+		Code:   http.StatusUnauthorized,
+		Status: "UNAUTHORIZED",
+	}
+	helper.WriteToResponseBody(writer, webResponse)
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"meliocool/bytesize/internal/metrics"
+	"path"
+	"strings"
+	"time"
+)
+
+// * gRPC calls authenticate with the REST API key, sent as "x-api-key" metadata
+func grpcAuthorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-api-key"); len(values) > 0 && ValidAPIKey(values[0]) {
+		return nil
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid x-api-key")
+}
+
+func UnaryAuthInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := grpcAuthorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func StreamAuthInterceptor(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := grpcAuthorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// grpcEndpoint turns "/bytesize.v1.FileService/Upload" into the endpoint label "grpc_upload".
+func grpcEndpoint(fullMethod string) string {
+	return "grpc_" + strings.ToLower(path.Base(fullMethod))
+}
+
+// UnaryMetricsInterceptor records gRPC calls in the same request, error and duration series as
+// the REST controllers.
+func UnaryMetricsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	endpoint := grpcEndpoint(info.FullMethod)
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues(endpoint).Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds()) }()
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues(endpoint).Inc()
+	}
+	return resp, err
+}
+
+func StreamMetricsInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	endpoint := grpcEndpoint(info.FullMethod)
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues(endpoint).Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds()) }()
+
+	err := handler(srv, stream)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues(endpoint).Inc()
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"github.com/google/uuid"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// S3Middleware tags every gateway response with a request ID and, when Domain is set, rewrites
+// virtual-hosted-style requests (<bucket>.<Domain>/key) to path style (/<bucket>/key). It must
+// run after SigV4Middleware, because the signature covers the path the client actually sent.
+type S3Middleware struct {
+	Handler http.Handler
+	Domain  string
+}
+
+func NewS3Middleware(handler http.Handler, domain string) *S3Middleware {
+	return &S3Middleware{Handler: handler, Domain: strings.ToLower(domain)}
+}
+
+func (m *S3Middleware) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("X-Amz-Request-Id", strings.ToUpper(strings.ReplaceAll(uuid.NewString(), "-", "")))
+
+	if m.Domain != "" {
+		host := request.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if bucket, ok := strings.CutSuffix(strings.ToLower(host), "."+m.Domain); ok && bucket != "" {
+			request = request.Clone(request.Context())
+			request.URL.Path = "/" + bucket + request.URL.Path
+			request.URL.RawPath = ""
+		}
+	}
+
+	m.Handler.ServeHTTP(writer, request)
+}
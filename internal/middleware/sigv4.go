@@ -0,0 +1,480 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"meliocool/bytesize/internal/model/web"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4MaxSkew         = 15 * time.Minute
+	unsignedPayload      = "UNSIGNED-PAYLOAD"
+	streamingSigned      = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingSignedTrail = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsigned    = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	emptySHA256          = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// ErrPayloadMismatch is reported by the body reader when the payload does not match the
+// x-amz-content-sha256 header or an aws-chunked chunk signature.
+var ErrPayloadMismatch = errors.New("payload does not match its signature")
+
+type payloadErrKey struct{}
+
+// PayloadError returns the body verification failure recorded for this request, if any, so
+// handlers can answer with a client error instead of a generic 500.
+func PayloadError(ctx context.Context) error {
+	if v, ok := ctx.Value(payloadErrKey{}).(*error); ok {
+		return *v
+	}
+	return nil
+}
+
+// SigV4Middleware authenticates S3 requests signed with AWS Signature Version 4, either in the
+// Authorization header or as a presigned URL, and verifies the request body against the signed
+// payload hash (plain SHA-256 or aws-chunked streaming signatures).
+type SigV4Middleware struct {
+	Handler   http.Handler
+	AccessKey string
+	SecretKey string
+	Now       func() time.Time
+}
+
+func NewSigV4Middleware(handler http.Handler, accessKey string, secretKey string) *SigV4Middleware {
+	return &SigV4Middleware{Handler: handler, AccessKey: accessKey, SecretKey: secretKey, Now: time.Now}
+}
+
+type sigV4Auth struct {
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       string
+	payloadHash   string
+	presigned     bool
+	expires       time.Duration
+}
+
+func (m *SigV4Middleware) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	auth, code, err := parseSigV4(request)
+	if err != nil {
+		writeSigV4Err(writer, request, code, err.Error())
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.accessKey), []byte(m.AccessKey)) != 1 {
+		writeSigV4Err(writer, request, "InvalidAccessKeyId", "The AWS access key Id you provided does not exist in our records.")
+		return
+	}
+
+	signedAt, err := time.Parse("20060102T150405Z", auth.amzDate)
+	if err != nil || !strings.HasPrefix(auth.amzDate, auth.date) {
+		writeSigV4Err(writer, request, "AccessDenied", "invalid X-Amz-Date")
+		return
+	}
+	now := m.Now()
+	if auth.presigned {
+		if now.After(signedAt.Add(auth.expires)) {
+			writeSigV4Err(writer, request, "AccessDenied", "Request has expired")
+			return
+		}
+		// * a URL dated ahead would otherwise stay valid for its expiry plus however far ahead it is
+		if signedAt.Sub(now) > sigV4MaxSkew {
+			writeSigV4Err(writer, request, "AccessDenied", "Request is not valid yet")
+			return
+		}
+	} else if d := now.Sub(signedAt); d > sigV4MaxSkew || d < -sigV4MaxSkew {
+		writeSigV4Err(writer, request, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.")
+		return
+	}
+
+	key := signingKey(m.SecretKey, auth.date, auth.region, auth.service)
+	scope := strings.Join([]string{auth.date, auth.region, auth.service, "aws4_request"}, "/")
+	canonical := canonicalRequest(request, auth)
+	stringToSign := strings.Join([]string{sigV4Algorithm, auth.amzDate, scope, hexSHA256([]byte(canonical))}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(auth.signature)) != 1 {
+		writeSigV4Err(writer, request, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.")
+		return
+	}
+
+	var payloadErr error
+	request = request.WithContext(context.WithValue(request.Context(), payloadErrKey{}, &payloadErr))
+
+	switch auth.payloadHash {
+	case unsignedPayload:
+	case streamingSigned, streamingSignedTrail, streamingUnsigned:
+		decoded, err := strconv.ParseInt(request.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil {
+			writeSigV4Err(writer, request, "MissingContentLength", "missing x-amz-decoded-content-length")
+			return
+		}
+		chunked := &awsChunkedReader{
+			src:       bufio.NewReaderSize(request.Body, maxChunkLine),
+			body:      request.Body,
+			signed:    auth.payloadHash != streamingUnsigned,
+			trailer:   auth.payloadHash == streamingSignedTrail,
+			key:       key,
+			scope:     scope,
+			amzDate:   auth.amzDate,
+			prevSig:   auth.signature,
+			remaining: decoded,
+			errOut:    &payloadErr,
+		}
+		request.Body = chunked
+		request.ContentLength = decoded
+		request.Header.Del("Content-Encoding")
+	default:
+		request.Body = &sha256Reader{body: request.Body, hash: sha256.New(), want: auth.payloadHash, errOut: &payloadErr}
+	}
+
+	m.Handler.ServeHTTP(writer, request)
+}
+
+func parseSigV4(request *http.Request) (sigV4Auth, string, error) {
+	query := request.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		if query.Get("X-Amz-Algorithm") != sigV4Algorithm {
+			return sigV4Auth{}, "AuthorizationQueryParametersError", fmt.Errorf("unsupported algorithm")
+		}
+		auth := sigV4Auth{
+			signature:     query.Get("X-Amz-Signature"),
+			amzDate:       query.Get("X-Amz-Date"),
+			signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+			payloadHash:   unsignedPayload,
+			presigned:     true,
+		}
+		if err := auth.parseCredential(query.Get("X-Amz-Credential")); err != nil {
+			return sigV4Auth{}, "AuthorizationQueryParametersError", err
+		}
+		secs, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if err != nil || secs <= 0 || secs > 7*24*3600 {
+			return sigV4Auth{}, "AuthorizationQueryParametersError", fmt.Errorf("invalid X-Amz-Expires")
+		}
+		auth.expires = time.Duration(secs) * time.Second
+		if !slices.Contains(auth.signedHeaders, "host") {
+			return sigV4Auth{}, "AuthorizationQueryParametersError", fmt.Errorf("host must be a signed header")
+		}
+		return auth, "", nil
+	}
+
+	header := request.Header.Get("Authorization")
+	if header == "" {
+		return sigV4Auth{}, "AccessDenied", fmt.Errorf("Access Denied")
+	}
+	rest, ok := strings.CutPrefix(header, sigV4Algorithm+" ")
+	if !ok {
+		return sigV4Auth{}, "AuthorizationHeaderMalformed", fmt.Errorf("only %s is supported", sigV4Algorithm)
+	}
+	auth := sigV4Auth{
+		amzDate:     request.Header.Get("X-Amz-Date"),
+		payloadHash: request.Header.Get("X-Amz-Content-Sha256"),
+	}
+	for _, part := range strings.Split(rest, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "Credential":
+			if err := auth.parseCredential(value); err != nil {
+				return sigV4Auth{}, "AuthorizationHeaderMalformed", err
+			}
+		case "SignedHeaders":
+			auth.signedHeaders = strings.Split(value, ";")
+		case "Signature":
+			auth.signature = value
+		}
+	}
+	if auth.signature == "" || len(auth.signedHeaders) == 0 || auth.accessKey == "" {
+		return sigV4Auth{}, "AuthorizationHeaderMalformed", fmt.Errorf("incomplete Authorization header")
+	}
+	if !slices.Contains(auth.signedHeaders, "host") {
+		return sigV4Auth{}, "AuthorizationHeaderMalformed", fmt.Errorf("host must be a signed header")
+	}
+	if auth.payloadHash == "" {
+		return sigV4Auth{}, "InvalidRequest", fmt.Errorf("missing x-amz-content-sha256")
+	}
+	return auth, "", nil
+}
+
+func (a *sigV4Auth) parseCredential(credential string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" || parts[3] != "s3" {
+		return fmt.Errorf("malformed credential scope")
+	}
+	a.accessKey, a.date, a.region, a.service = parts[0], parts[1], parts[2], parts[3]
+	return nil
+}
+
+func canonicalRequest(request *http.Request, auth sigV4Auth) string {
+	headers := make([]string, 0, len(auth.signedHeaders))
+	for _, name := range auth.signedHeaders {
+		headers = append(headers, name+":"+canonicalHeaderValue(request, name))
+	}
+
+	params := make([]string, 0)
+	for name, values := range request.URL.Query() {
+		if auth.presigned && name == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range values {
+			params = append(params, sigV4Escape(name, true)+"="+sigV4Escape(v, true))
+		}
+	}
+	sort.Strings(params)
+
+	return strings.Join([]string{
+		request.Method,
+		sigV4Escape(request.URL.Path, false),
+		strings.Join(params, "&"),
+		strings.Join(headers, "\n") + "\n",
+		strings.Join(auth.signedHeaders, ";"),
+		auth.payloadHash,
+	}, "\n")
+}
+
+// canonicalHeaderValue reads a signed header, including the ones net/http lifts out of Header.
+func canonicalHeaderValue(request *http.Request, name string) string {
+	var values []string
+	switch name {
+	case "host":
+		values = []string{request.Host}
+	case "content-length":
+		values = request.Header.Values("Content-Length")
+		if len(values) == 0 {
+			values = []string{strconv.FormatInt(request.ContentLength, 10)}
+		}
+	case "transfer-encoding":
+		values = request.TransferEncoding
+	default:
+		values = request.Header.Values(name)
+	}
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(trimmed, ",")
+}
+
+// sigV4Escape percent-encodes everything outside the RFC 3986 unreserved set; slashes are
+// kept in paths. S3 paths are encoded once (no double encoding as for other services).
+func sigV4Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func signingKey(secret string, date string, region string, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), []byte(date))
+	k = hmacSHA256(k, []byte(region))
+	k = hmacSHA256(k, []byte(service))
+	return hmacSHA256(k, []byte("aws4_request"))
+}
+
+func hmacSHA256(key []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sha256Reader fails the read that reaches EOF when the body hash differs from the signed one.
+type sha256Reader struct {
+	body   io.ReadCloser
+	hash   hash.Hash
+	want   string
+	errOut *error
+}
+
+func (r *sha256Reader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != r.want {
+		*r.errOut = ErrPayloadMismatch
+		return n, ErrPayloadMismatch
+	}
+	return n, err
+}
+
+func (r *sha256Reader) Close() error {
+	return r.body.Close()
+}
+
+// awsChunkedReader decodes an aws-chunked body ("<hex-size>[;chunk-signature=<sig>]\r\n<data>\r\n"
+// repeated, then a zero-size chunk and optional trailers), verifying each chunk signature
+// against the previous one when the payload is signed, and the trailer signature against the
+// last chunk's when the trailers are signed too.
+type awsChunkedReader struct {
+	src       *bufio.Reader
+	body      io.Closer
+	signed    bool
+	trailer   bool
+	key       []byte
+	scope     string
+	amzDate   string
+	prevSig   string
+	remaining int64
+	chunk     []byte
+	done      bool
+	errOut    *error
+}
+
+func (r *awsChunkedReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			*r.errOut = err
+			return 0, err
+		}
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (r *awsChunkedReader) Close() error {
+	return r.body.Close()
+}
+
+func (r *awsChunkedReader) next() error {
+	line, err := readLine(r.src)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPayloadMismatch, err)
+	}
+	sizeField, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeField, 16, 64)
+	if err != nil || size < 0 || size > r.remaining {
+		return fmt.Errorf("%w: bad chunk size %q", ErrPayloadMismatch, sizeField)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.src, data); err != nil {
+		return fmt.Errorf("%w: %v", ErrPayloadMismatch, err)
+	}
+	if size > 0 {
+		if crlf, err := readLine(r.src); err != nil || crlf != "" {
+			return fmt.Errorf("%w: missing chunk terminator", ErrPayloadMismatch)
+		}
+	}
+
+	if r.signed {
+		sig, _ := strings.CutPrefix(ext, "chunk-signature=")
+		stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256-PAYLOAD", r.amzDate, r.scope, r.prevSig, emptySHA256, hexSHA256(data)}, "\n")
+		expected := hex.EncodeToString(hmacSHA256(r.key, []byte(stringToSign)))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(sig)) != 1 {
+			return ErrPayloadMismatch
+		}
+		r.prevSig = sig
+	}
+
+	r.remaining -= size
+	r.chunk = data
+	if size == 0 {
+		if r.remaining != 0 {
+			return fmt.Errorf("%w: body shorter than x-amz-decoded-content-length", ErrPayloadMismatch)
+		}
+		if err := r.readTrailers(); err != nil {
+			return err
+		}
+		r.done = true
+	}
+	return nil
+}
+
+// readTrailers consumes the trailers (x-amz-checksum-*, x-amz-trailer-signature) up to the empty
+// line that ends the body. With signed trailers, the signature covers every other trailer as
+// "name:value\n" in the order sent.
+func (r *awsChunkedReader) readTrailers() error {
+	var canonical strings.Builder
+	var sig string
+	for {
+		line, err := readLine(r.src)
+		if err != nil {
+			// * a body that ends right after the final chunk has no trailers to check
+			if err == io.EOF && !r.trailer {
+				return nil
+			}
+			return fmt.Errorf("%w: %v", ErrPayloadMismatch, err)
+		}
+		if line == "" {
+			break
+		}
+		name, value, _ := strings.Cut(line, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "x-amz-trailer-signature" {
+			sig = value
+			continue
+		}
+		canonical.WriteString(name + ":" + value + "\n")
+	}
+	if !r.trailer {
+		return nil
+	}
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256-TRAILER", r.amzDate, r.scope, r.prevSig, hexSHA256([]byte(canonical.String()))}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(r.key, []byte(stringToSign)))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(sig)) != 1 {
+		return fmt.Errorf("%w: trailer signature", ErrPayloadMismatch)
+	}
+	return nil
+}
+
+// maxChunkLine bounds a chunk header or trailer line; bufio.Reader.ReadSlice fails with
+// ErrBufferFull past it.
+const maxChunkLine = 4096
+
+// readLine reads one CRLF-terminated line from br without the terminator.
+func readLine(br *bufio.Reader) (string, error) {
+	raw, err := br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("line too long")
+	}
+	if err != nil {
+		return "", err
+	}
+	line, ok := bytes.CutSuffix(raw, []byte("\r\n"))
+	if !ok {
+		return "", fmt.Errorf("line not terminated by CRLF")
+	}
+	return string(line), nil
+}
+
+func writeSigV4Err(writer http.ResponseWriter, request *http.Request, code string, message string) {
+	status := http.StatusForbidden
+	if code == "AuthorizationHeaderMalformed" || code == "AuthorizationQueryParametersError" || code == "InvalidRequest" || code == "MissingContentLength" {
+		status = http.StatusBadRequest
+	}
+	writer.Header().Set("Content-Type", "application/xml")
+	writer.WriteHeader(status)
+	_, _ = io.WriteString(writer, xml.Header)
+	_ = xml.NewEncoder(writer).Encode(web.S3Error{Code: code, Message: message, Resource: (&url.URL{Path: request.URL.Path}).EscapedPath()})
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDBYTESIZETEST"
+	testSecretKey = "bytesize-test-secret"
+	testRegion    = "us-east-1"
+)
+
+var testCreds = aws.Credentials{AccessKeyID: testAccessKey, SecretAccessKey: testSecretKey}
+
+// newTestSigV4 wraps a handler that reads the whole body and answers 400 when the middleware's
+// body verification fails.
+func newTestSigV4() *SigV4Middleware {
+	return NewSigV4Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if _, err := io.ReadAll(request.Body); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+		}
+	}), testAccessKey, testSecretKey)
+}
+
+func serve(m *SigV4Middleware, request *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, request)
+	return rec
+}
+
+func TestSigV4RejectsPresignedURLsDatedAhead(t *testing.T) {
+	m := newTestSigV4()
+	presign := func(signedAt time.Time) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://s3.local/bkt/key.txt?X-Amz-Expires=60", nil)
+		signed, _, err := v4.NewSigner().PresignHTTP(context.Background(), testCreds, req, unsignedPayload, "s3", testRegion, signedAt)
+		if err != nil {
+			t.Fatalf("presign: %v", err)
+		}
+		return httptest.NewRequest(http.MethodGet, signed, nil)
+	}
+
+	if rec := serve(m, presign(time.Now())); rec.Code != http.StatusOK {
+		t.Fatalf("current presigned url = %d: %s", rec.Code, rec.Body)
+	}
+	rec := serve(m, presign(time.Now().Add(time.Hour)))
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "not valid yet") {
+		t.Fatalf("presigned url dated an hour ahead = %d: %s; want 403", rec.Code, rec.Body)
+	}
+}
+
+func TestSigV4RequiresSignedHost(t *testing.T) {
+	m := newTestSigV4()
+	now := time.Now().UTC()
+	req := httptest.NewRequest(http.MethodGet, "http://s3.local/bkt/key.txt", nil)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+
+	// * a signature that is valid for its signed headers, which leave out host
+	auth := sigV4Auth{
+		date:          now.Format("20060102"),
+		region:        testRegion,
+		service:       "s3",
+		signedHeaders: []string{"x-amz-content-sha256", "x-amz-date"},
+		amzDate:       now.Format("20060102T150405Z"),
+		payloadHash:   emptySHA256,
+	}
+	scope := strings.Join([]string{auth.date, auth.region, auth.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{sigV4Algorithm, auth.amzDate, scope, hexSHA256([]byte(canonicalRequest(req, auth)))}, "\n")
+	sig := hex.EncodeToString(hmacSHA256(signingKey(testSecretKey, auth.date, auth.region, auth.service), []byte(stringToSign)))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, testAccessKey, scope, strings.Join(auth.signedHeaders, ";"), sig))
+
+	rec := serve(m, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "AuthorizationHeaderMalformed") {
+		t.Fatalf("request without a signed host = %d: %s; want 400 AuthorizationHeaderMalformed", rec.Code, rec.Body)
+	}
+}
+
+func TestSigV4VerifiesTrailerSignature(t *testing.T) {
+	m := newTestSigV4()
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+
+	if rec := serve(m, signedTrailerRequest(t, body, "", false)); rec.Code != http.StatusOK {
+		t.Fatalf("signed trailer put = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(m, signedTrailerRequest(t, body, "", true)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("put with a trailer changed after signing = %d; want 400", rec.Code)
+	}
+	if rec := serve(m, signedTrailerRequest(t, body, "omit", false)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("put without a trailer signature = %d; want 400", rec.Code)
+	}
+}
+
+// signedTrailerRequest builds a STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER put of body in one
+// chunk with an x-amz-checksum-crc32c trailer. tamper changes the trailer after it was signed;
+// sigMode "omit" leaves the trailer signature out.
+func signedTrailerRequest(t *testing.T, body []byte, sigMode string, tamper bool) *http.Request {
+	t.Helper()
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + testRegion + "/s3/aws4_request"
+	key := signingKey(testSecretKey, now.Format("20060102"), testRegion, "s3")
+
+	req := httptest.NewRequest(http.MethodPut, "http://s3.local/bkt/streamed.bin", nil)
+	req.Header.Set("Content-Encoding", "aws-chunked")
+	req.Header.Set("X-Amz-Content-Sha256", streamingSignedTrail)
+	req.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(len(body)))
+	req.Header.Set("X-Amz-Trailer", "x-amz-checksum-crc32c")
+	if err := v4.NewSigner().SignHTTP(context.Background(), testCreds, req, streamingSignedTrail, "s3", testRegion, now); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	_, prev, _ := strings.Cut(req.Header.Get("Authorization"), "Signature=")
+
+	var encoded bytes.Buffer
+	for _, c := range [][]byte{body, nil} {
+		stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256-PAYLOAD", amzDate, scope, prev, emptySHA256, hexSHA256(c)}, "\n")
+		prev = hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+		fmt.Fprintf(&encoded, "%x;chunk-signature=%s\r\n", len(c), prev)
+		if len(c) > 0 {
+			encoded.Write(c)
+			encoded.WriteString("\r\n")
+		}
+	}
+	trailer := "x-amz-checksum-crc32c:sOO8/Q=="
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256-TRAILER", amzDate, scope, prev, hexSHA256([]byte(trailer + "\n"))}, "\n")
+	trailerSig := hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+	if tamper {
+		trailer = "x-amz-checksum-crc32c:AAAAAA=="
+	}
+	encoded.WriteString(trailer + "\r\n")
+	if sigMode != "omit" {
+		encoded.WriteString("x-amz-trailer-signature:" + trailerSig + "\r\n")
+	}
+	encoded.WriteString("\r\n")
+
+	req.Body = io.NopCloser(&encoded)
+	req.ContentLength = int64(encoded.Len())
+	return req
+}
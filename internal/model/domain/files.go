@@ -6,9 +6,30 @@ import (
 )
 
 type File struct {
-	ID        uuid.UUID
-	Filename  string
-	TotalSize int64
+	ID          uuid.UUID
+	Filename    string
+	TotalSize   int64
+	ContentType string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ExpiresAt   *time.Time
+	Metadata    map[string]string
+	Tags        []string
+}
+
+// FileFilter narrows a file listing; every set criterion must match. Limit > 0 pages the
+// newest-first listing, skipping Offset files.
+type FileFilter struct {
+	Prefix   string
+	Tags     []string
+	Metadata map[string]string
+	Limit    int
+	Offset   int
+}
+
+// FileCursor is a position in the oldest-first listing: the files after it are those created
+// later, or at the same time with a greater id.
+type FileCursor struct {
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        uuid.UUID
 }
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	ReplicationUpsert = "upsert"
+	ReplicationDelete = "delete"
+)
+
+// ReplicationEvent is one row of the change log: a file was written (upsert) or deleted.
+// UpdatedAt is the file's version at that point; for a delete, the version that was removed.
+type ReplicationEvent struct {
+	Seq       int64
+	FileID    uuid.UUID
+	Op        string
+	Filename  string
+	UpdatedAt time.Time
+	LoggedAt  time.Time
+}
+
+// ReplicationCheckpoint is how far Peer has been brought up to date: every event up to Seq,
+// and, while Backfill is set, the files that predate the checkpoint up to Cursor.
+type ReplicationCheckpoint struct {
+	Peer      string
+	Seq       int64
+	Backfill  bool
+	Cursor    FileCursor
+	UpdatedAt time.Time
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	EntryFile    = "file"
+	EntryDir     = "dir"
+	EntrySymlink = "symlink"
+)
+
+// Snapshot is a directory tree as it was at TakenAt. FileCount and TotalSize cover regular files.
+type Snapshot struct {
+	ID        uuid.UUID
+	Hostname  string
+	Paths     []string
+	Tags      []string
+	TakenAt   time.Time
+	FileCount int64
+	TotalSize int64
+	CreatedAt time.Time
+}
+
+// SnapshotEntry is one path in a snapshot. Regular files point at the hidden file row holding
+// their manifest; Digest identifies their content by its chunk list.
+type SnapshotEntry struct {
+	SnapshotID uuid.UUID
+	Path       string
+	Type       string
+	Mode       int64
+	ModTime    time.Time
+	Size       int64
+	LinkTarget string
+	Digest     string
+	FileID     *uuid.UUID
+}
+
+// SnapshotFilter narrows a snapshot listing; every set criterion must match.
+type SnapshotFilter struct {
+	Hostname string
+	Tags     []string
+}
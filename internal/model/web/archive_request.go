@@ -0,0 +1,13 @@
+package web
+
+import "github.com/google/uuid"
+
+// ArchiveRequest selects files either by explicit ids or by a filename prefix / tag / metadata filter.
+type ArchiveRequest struct {
+	IDs         []uuid.UUID       `json:"ids" validate:"omitempty,max=1000"`
+	Prefix      string            `json:"prefix"`
+	Tags        []string          `json:"tags"`
+	Metadata    map[string]string `json:"meta"`
+	Format      string            `json:"format" validate:"omitempty,oneof=zip tar tar.gz"`
+	Compression string            `json:"compression" validate:"omitempty,oneof=auto store deflate"`
+}
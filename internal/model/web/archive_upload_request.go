@@ -0,0 +1,19 @@
+package web
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ArchiveUploadRequest carries a tar (plain, gzip or zstd) or zip stream whose members
+// are stored as individual files. Zip needs Reader to also be an io.ReaderAt of Size bytes.
+type ArchiveUploadRequest struct {
+	Ctx       context.Context
+	Reader    io.Reader `validate:"required"`
+	Size      int64
+	Prefix    string
+	ExpiresAt *time.Time
+	Metadata  map[string]string
+	Tags      []string
+}
@@ -0,0 +1,10 @@
+package web
+
+type ArchiveUploadResponse struct {
+	Members             []UploadResponse
+	FilesCount          int64
+	TotalSize           int64
+	ChunksCount         int64
+	UniqueChunksWritten int64
+	DedupeSavedBytes    int64
+}
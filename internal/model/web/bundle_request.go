@@ -0,0 +1,12 @@
+package web
+
+// BundleExportRequest selects the files of an export the way GET /files does. After and Segment
+// continue an interrupted export: the stream then starts past the file at After, numbers its
+// segments from Segment+1 and has no bundle.json header.
+type BundleExportRequest struct {
+	Prefix   string
+	Tags     []string
+	Metadata map[string]string
+	After    string
+	Segment  int
+}
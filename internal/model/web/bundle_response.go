@@ -0,0 +1,52 @@
+package web
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// BundleFilter is the file filter an export was taken with, recorded so it can be resumed.
+type BundleFilter struct {
+	Prefix   string            `json:"prefix,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"meta,omitempty"`
+}
+
+// BundleHeader is bundle.json, the first entry of a bundle.
+type BundleHeader struct {
+	Format    string       `json:"format"`
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	ChunkSize int64        `json:"chunk_size"`
+	Filter    BundleFilter `json:"filter"`
+}
+
+// BundleFile is one line of a files/NNNNNN.jsonl segment. Every chunk it lists comes earlier in
+// the bundle, or is already in the importing store.
+type BundleFile struct {
+	ID          uuid.UUID         `json:"id"`
+	Filename    string            `json:"filename"`
+	ContentType string            `json:"content_type"`
+	TotalSize   int64             `json:"total_size"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty"`
+	Metadata    map[string]string `json:"meta"`
+	Tags        []string          `json:"tags"`
+	Chunks      []ManifestChunk   `json:"chunks"`
+}
+
+// BundleEnd is end.json, the last entry; a bundle without it is incomplete.
+type BundleEnd struct {
+	Segments int    `json:"segments"`
+	Cursor   string `json:"cursor"`
+}
+
+type BundleImportResponse struct {
+	Segments      int   `json:"segments"`
+	FilesCreated  int64 `json:"files_created"`
+	FilesSkipped  int64 `json:"files_skipped"`
+	ChunksStored  int64 `json:"chunks_stored"`
+	ChunksPresent int64 `json:"chunks_present"`
+	BytesStored   int64 `json:"bytes_stored"`
+}
@@ -0,0 +1,29 @@
+package web
+
+import "time"
+
+type ManifestChunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+type ChunkMissingRequest struct {
+	Hashes []string `json:"hashes" validate:"max=10000"`
+}
+
+type ChunkMissingResponse struct {
+	Missing []string `json:"missing"`
+}
+
+// ManifestCommitRequest creates a file from chunks already in the store. Chunks are cut like
+// uploads: every chunk but the last is exactly helper.ChunkSize bytes.
+type ManifestCommitRequest struct {
+	Filename    string            `json:"filename" validate:"required,max=1024"`
+	ContentType string            `json:"content_type"`
+	ExpiresAt   *time.Time        `json:"expires_at"`
+	Metadata    map[string]string `json:"meta"`
+	Tags        []string          `json:"tags"`
+	// Replace deletes the other files with this filename once the new one is committed.
+	Replace bool            `json:"replace"`
+	Chunks  []ManifestChunk `json:"chunks"`
+}
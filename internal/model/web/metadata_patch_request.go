@@ -0,0 +1,8 @@
+package web
+
+// MetadataPatchRequest follows JSON merge-patch rules for metadata: a null value removes the key.
+// Tags, when present, replace the file's tag set.
+type MetadataPatchRequest struct {
+	Metadata map[string]*string `json:"metadata"`
+	Tags     *[]string          `json:"tags"`
+}
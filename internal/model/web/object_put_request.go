@@ -0,0 +1,10 @@
+package web
+
+import "io"
+
+type ObjectPutRequest struct {
+	Key         string `validate:"required,max=1024"`
+	Reader      io.Reader
+	ContentType string
+	Metadata    map[string]string
+}
@@ -0,0 +1,10 @@
+package web
+
+import "github.com/google/uuid"
+
+// ReplicationResponse says what a replicated write did to the peer's copy of a file: created,
+// updated, unchanged, deleted or absent.
+type ReplicationResponse struct {
+	FileID uuid.UUID `json:"file_id"`
+	Result string    `json:"result"`
+}
@@ -0,0 +1,23 @@
+package web
+
+import "encoding/xml"
+
+type S3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type S3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []S3CompletedPart `xml:"Part"`
+}
+
+type S3ObjectIdentifier struct {
+	Key string `xml:"Key"`
+}
+
+type S3DeleteRequest struct {
+	XMLName xml.Name             `xml:"Delete"`
+	Quiet   bool                 `xml:"Quiet"`
+	Objects []S3ObjectIdentifier `xml:"Object"`
+}
@@ -0,0 +1,36 @@
+package web
+
+import "time"
+
+// SnapshotEntryRequest is one path of the tree. Regular files list their chunks the way
+// ManifestCommitRequest does; directories and symlinks have none.
+type SnapshotEntryRequest struct {
+	Path    string          `json:"path" validate:"required,max=4096"`
+	Type    string          `json:"type" validate:"required,oneof=file dir symlink"`
+	Mode    int64           `json:"mode" validate:"min=0,max=4095"`
+	ModTime time.Time       `json:"mtime"`
+	Target  string          `json:"target,omitempty" validate:"max=4096"`
+	Chunks  []ManifestChunk `json:"chunks,omitempty"`
+}
+
+type SnapshotCreateRequest struct {
+	Hostname string                 `json:"hostname" validate:"max=255"`
+	Paths    []string               `json:"paths" validate:"max=64,dive,max=4096"`
+	Tags     []string               `json:"tags"`
+	TakenAt  *time.Time             `json:"time"`
+	Entries  []SnapshotEntryRequest `json:"entries" validate:"dive"`
+}
+
+// SnapshotForgetRequest applies a retention policy to the snapshots matching Hostname and Tags.
+// Within each group of snapshots with the same hostname and paths, the newest snapshot of each
+// of the last KeepDaily days, KeepWeekly weeks and KeepMonthly months is kept, as are the
+// KeepLast newest; the rest are forgotten.
+type SnapshotForgetRequest struct {
+	Hostname    string   `json:"hostname"`
+	Tags        []string `json:"tags"`
+	KeepLast    int      `json:"keep_last" validate:"min=0"`
+	KeepDaily   int      `json:"keep_daily" validate:"min=0"`
+	KeepWeekly  int      `json:"keep_weekly" validate:"min=0"`
+	KeepMonthly int      `json:"keep_monthly" validate:"min=0"`
+	DryRun      bool     `json:"dry_run"`
+}
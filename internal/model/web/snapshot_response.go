@@ -0,0 +1,60 @@
+package web
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type SnapshotResponse struct {
+	ID        uuid.UUID               `json:"id"`
+	Hostname  string                  `json:"hostname"`
+	Paths     []string                `json:"paths"`
+	Tags      []string                `json:"tags"`
+	TakenAt   time.Time               `json:"time"`
+	FileCount int64                   `json:"file_count"`
+	TotalSize int64                   `json:"total_size"`
+	Entries   []SnapshotEntryResponse `json:"entries,omitempty"`
+}
+
+type SnapshotEntryResponse struct {
+	Path    string    `json:"path"`
+	Type    string    `json:"type"`
+	Mode    int64     `json:"mode"`
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+	Target  string    `json:"target,omitempty"`
+	Digest  string    `json:"digest,omitempty"`
+}
+
+// SnapshotChange is one path that differs between two snapshots. Change is added, removed,
+// modified (content, type or link target) or metadata (mode or mtime only).
+type SnapshotChange struct {
+	Path    string `json:"path"`
+	Change  string `json:"change"`
+	Type    string `json:"type"`
+	OldSize int64  `json:"old_size"`
+	NewSize int64  `json:"new_size"`
+}
+
+type SnapshotDiffResponse struct {
+	From         uuid.UUID        `json:"from"`
+	To           uuid.UUID        `json:"to"`
+	Added        int              `json:"added"`
+	Removed      int              `json:"removed"`
+	Modified     int              `json:"modified"`
+	Metadata     int              `json:"metadata"`
+	AddedBytes   int64            `json:"added_bytes"`
+	RemovedBytes int64            `json:"removed_bytes"`
+	Changes      []SnapshotChange `json:"changes"`
+}
+
+type SnapshotKept struct {
+	Snapshot SnapshotResponse `json:"snapshot"`
+	Reasons  []string         `json:"reasons"`
+}
+
+type SnapshotForgetResponse struct {
+	Keep   []SnapshotKept     `json:"keep"`
+	Remove []SnapshotResponse `json:"remove"`
+	DryRun bool               `json:"dry_run"`
+}
@@ -0,0 +1,12 @@
+package web
+
+import "time"
+
+type TusCreateRequest struct {
+	Filename    string `validate:"required,max=1024"`
+	Length      int64  `validate:"gte=0"`
+	ContentType string
+	ExpiresAt   *time.Time
+	Metadata    map[string]string
+	Tags        []string
+}
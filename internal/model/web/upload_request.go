@@ -3,10 +3,20 @@ package web
 import (
 	"context"
 	"io"
+	"time"
 )
 
 type UploadRequest struct {
-	Ctx      context.Context
-	FileName string    `validate:"required" json:"filename"`
-	Reader   io.Reader `validate:"required"`
+	Ctx         context.Context
+	FileName    string    `validate:"required" json:"filename"`
+	Reader      io.Reader `validate:"required"`
+	ContentType string
+	ExpiresAt   *time.Time
+	Metadata    map[string]string
+	Tags        []string
+	// * set by services that stage data under a reserved prefix (S3 multipart parts); never from client input
+	AllowReserved bool
+	// * called once the body is stored; its keys are merged into the metadata in the same
+	// * transaction that records the file's size (the S3 gateway's ETag)
+	FinalMetadata func() map[string]string
 }
@@ -4,7 +4,9 @@ import "github.com/google/uuid"
 
 type UploadResponse struct {
 	FileID              uuid.UUID
+	Filename            string
 	TotalSize           int64
+	ContentType         string
 	ChunksCount         int64
 	UniqueChunksWritten int64
 	DedupeSavedBytes    int64
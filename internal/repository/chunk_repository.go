@@ -8,5 +8,10 @@ import (
 
 type ChunkRepository interface {
 	Upsert(ctx context.Context, tx pgx.Tx, chunk domain.Chunk) (domain.Chunk, bool, error)
+	UpsertMany(ctx context.Context, tx pgx.Tx, chunks []domain.Chunk) (int64, error)
 	FindByHash(ctx context.Context, tx pgx.Tx, hash string) (domain.Chunk, error)
+	FindSizes(ctx context.Context, tx pgx.Tx, hashes []string) (map[string]int64, error)
+	Count(ctx context.Context, tx pgx.Tx) (int64, error)
+	ForEachHash(ctx context.Context, tx pgx.Tx, fn func(hash string) error) error
+	DeleteOrphan(ctx context.Context, tx pgx.Tx, hash string) (bool, error)
 }
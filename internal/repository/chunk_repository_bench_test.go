@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/domain"
+	"os"
+	"sync"
+	"testing"
+)
+
+// testDB connects to TEST_DATABASE_URL, a migrated database the benchmarks may write to.
+// Without it they are skipped.
+func testDB(tb testing.TB) *pgxpool.Pool {
+	tb.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		tb.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		tb.Fatalf("connect: %v", err)
+	}
+	tb.Cleanup(db.Close)
+	return db
+}
+
+func randomChunks(n int) []domain.Chunk {
+	chunks := make([]domain.Chunk, n)
+	raw := make([]byte, 32)
+	for i := range chunks {
+		_, _ = rand.Read(raw)
+		chunks[i] = domain.Chunk{Hash: hex.EncodeToString(raw), Size: helper.ChunkSize}
+	}
+	return chunks
+}
+
+// deleteChunksAfter removes the random chunk rows a benchmark inserted once it is done.
+func deleteChunksAfter(tb testing.TB, db *pgxpool.Pool, chunks []domain.Chunk) {
+	tb.Cleanup(func() {
+		hashes := make([]string, len(chunks))
+		for i, c := range chunks {
+			hashes[i] = c.Hash
+		}
+		if _, err := db.Exec(context.Background(), "DELETE FROM chunks WHERE hash = ANY($1)", hashes); err != nil {
+			tb.Errorf("cleanup: %v", err)
+		}
+	})
+}
+
+// BenchmarkChunkUpsert is the one-transaction-per-chunk path, with helper.Workers writers.
+func BenchmarkChunkUpsert(b *testing.B) {
+	db := testDB(b)
+	repo := NewChunkRepository()
+	ctx := context.Background()
+	chunks := randomChunks(b.N)
+	deleteChunksAfter(b, db, chunks)
+
+	in := make(chan domain.Chunk)
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for i := 0; i < helper.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range in {
+				if err := upsertOne(ctx, db, repo, c); err != nil {
+					b.Error(err)
+					// * keep draining so the sender never blocks on a dead worker
+					for range in {
+					}
+					return
+				}
+			}
+		}()
+	}
+	for _, c := range chunks {
+		in <- c
+	}
+	close(in)
+	wg.Wait()
+}
+
+func upsertOne(ctx context.Context, db *pgxpool.Pool, repo ChunkRepository, c domain.Chunk) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if _, _, err := repo.Upsert(ctx, tx, c); err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// BenchmarkChunkUpsertMany is the batched path used by the manifest batcher, helper.BatchSize
+// rows per statement.
+func BenchmarkChunkUpsertMany(b *testing.B) {
+	db := testDB(b)
+	repo := NewChunkRepository()
+	ctx := context.Background()
+	chunks := randomChunks(b.N)
+	deleteChunksAfter(b, db, chunks)
+
+	b.ResetTimer()
+	for lo := 0; lo < len(chunks); lo += helper.BatchSize {
+		hi := min(lo+helper.BatchSize, len(chunks))
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := repo.UpsertMany(ctx, tx, chunks[lo:hi]); err != nil {
+			_ = tx.Rollback(ctx)
+			b.Fatal(err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
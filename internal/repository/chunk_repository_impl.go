@@ -42,6 +42,32 @@ func (c *ChunkRepositoryImpl) Upsert(ctx context.Context, tx pgx.Tx, chunk domai
 	}
 }
 
+// UpsertMany inserts every chunk row in one statement, skipping hashes that already exist.
+// It returns how many rows were new.
+func (c *ChunkRepositoryImpl) UpsertMany(ctx context.Context, tx pgx.Tx, chunks []domain.Chunk) (int64, error) {
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+	regex := helper.HashRegex()
+	hashes := make([]string, 0, len(chunks))
+	sizes := make([]int64, 0, len(chunks))
+	for _, chunk := range chunks {
+		if chunk.Size <= 0 || !regex.MatchString(chunk.Hash) {
+			return 0, helper.ErrInvalidInput
+		}
+		hashes = append(hashes, chunk.Hash)
+		sizes = append(sizes, chunk.Size)
+	}
+
+	SQL := "INSERT INTO chunks(hash, size) SELECT * FROM unnest($1::text[], $2::bigint[]) ON CONFLICT(hash) DO NOTHING"
+
+	tag, err := tx.Exec(ctx, SQL, hashes, sizes)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
 func (c *ChunkRepositoryImpl) FindByHash(ctx context.Context, tx pgx.Tx, hash string) (domain.Chunk, error) {
 	regex := helper.HashRegex()
 	if !regex.MatchString(hash) {
@@ -60,3 +86,71 @@ func (c *ChunkRepositoryImpl) FindByHash(ctx context.Context, tx pgx.Tx, hash st
 		return domain.Chunk{}, err
 	}
 }
+
+// FindSizes returns the recorded size of every hash that has a chunk row; hashes without one
+// are absent from the map.
+func (c *ChunkRepositoryImpl) FindSizes(ctx context.Context, tx pgx.Tx, hashes []string) (map[string]int64, error) {
+	sizes := make(map[string]int64, len(hashes))
+	if len(hashes) == 0 {
+		return sizes, nil
+	}
+	rows, err := tx.Query(ctx, "SELECT hash, size FROM chunks WHERE hash = ANY($1)", hashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		var size int64
+		if err := rows.Scan(&hash, &size); err != nil {
+			return nil, err
+		}
+		sizes[hash] = size
+	}
+	return sizes, rows.Err()
+}
+
+func (c *ChunkRepositoryImpl) Count(ctx context.Context, tx pgx.Tx) (int64, error) {
+	var count int64
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM chunks").Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ForEachHash streams every chunk hash to fn without materialising the whole table.
+func (c *ChunkRepositoryImpl) ForEachHash(ctx context.Context, tx pgx.Tx, fn func(hash string) error) error {
+	rows, err := tx.Query(ctx, "SELECT hash FROM chunks")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return err
+		}
+		if err := fn(hash); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// * DeleteOrphan drops the chunk row when no manifest references it and reports whether it did;
+// * the caller removes the blob once tx has committed.
+func (c *ChunkRepositoryImpl) DeleteOrphan(ctx context.Context, tx pgx.Tx, hash string) (bool, error) {
+	regex := helper.HashRegex()
+	if !regex.MatchString(hash) {
+		return false, helper.ErrInvalidInput
+	}
+
+	SQL := "DELETE FROM chunks c WHERE c.hash = $1 AND NOT EXISTS (SELECT 1 FROM file_chunks fc WHERE fc.chunk_hash = $1)"
+	cmd, err := tx.Exec(ctx, SQL, hash)
+	if err != nil {
+		return false, err
+	}
+	return cmd.RowsAffected() > 0, nil
+}
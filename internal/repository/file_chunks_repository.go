@@ -9,5 +9,7 @@ import (
 
 type FileChunkRepository interface {
 	AddChunks(ctx context.Context, tx pgx.Tx, fileID uuid.UUID, chunks []domain.FileChunk) error
+	CloneManifest(ctx context.Context, tx pgx.Tx, srcID uuid.UUID, dstID uuid.UUID) (int64, error)
 	FindByFileID(ctx context.Context, tx pgx.Tx, fileID uuid.UUID) ([]domain.FileChunk, error)
+	DeleteFrom(ctx context.Context, tx pgx.Tx, fileID uuid.UUID, idx int64) (int64, error)
 }
@@ -24,14 +24,9 @@ func (f *FileChunkRepositoryImpl) AddChunks(ctx context.Context, tx pgx.Tx, file
 		if chunks[i].Idx < 0 || chunks[i].Size <= 0 || !regex.MatchString(chunks[i].ChunkHash) {
 			return helper.ErrInvalidInput
 		}
-		if i == 0 {
-			if chunks[i].Idx != 0 {
-				return helper.ErrInvalidInput
-			}
-		} else {
-			if chunks[i].Idx != chunks[i-1].Idx+1 {
-				return helper.ErrInvalidInput
-			}
+		// * batches after the first start mid-manifest, so only contiguity is checked
+		if i > 0 && chunks[i].Idx != chunks[i-1].Idx+1 {
+			return helper.ErrInvalidInput
 		}
 	}
 	SQL := "INSERT INTO file_chunks(file_id, idx, chunk_hash, size) VALUES($1, $2, $3, $4)"
@@ -61,6 +56,20 @@ func (f *FileChunkRepositoryImpl) AddChunks(ctx context.Context, tx pgx.Tx, file
 	return nil
 }
 
+// * CloneManifest copies srcID's manifest rows onto dstID inside the database; chunk data is shared.
+func (f *FileChunkRepositoryImpl) CloneManifest(ctx context.Context, tx pgx.Tx, srcID uuid.UUID, dstID uuid.UUID) (int64, error) {
+	if srcID == uuid.Nil || dstID == uuid.Nil || srcID == dstID {
+		return 0, helper.ErrInvalidInput
+	}
+
+	SQL := "INSERT INTO file_chunks(file_id, idx, chunk_hash, size) SELECT $2, idx, chunk_hash, size FROM file_chunks WHERE file_id = $1"
+	tag, err := tx.Exec(ctx, SQL, srcID, dstID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
 func (f *FileChunkRepositoryImpl) FindByFileID(ctx context.Context, tx pgx.Tx, fileID uuid.UUID) ([]domain.FileChunk, error) {
 	if fileID == uuid.Nil {
 		return nil, helper.ErrInvalidInput
@@ -87,3 +96,16 @@ func (f *FileChunkRepositoryImpl) FindByFileID(ctx context.Context, tx pgx.Tx, f
 	}
 	return fileChunkRows, nil
 }
+
+// * DeleteFrom drops fileID's manifest rows from idx onwards, so a manifest can be rewritten from there.
+func (f *FileChunkRepositoryImpl) DeleteFrom(ctx context.Context, tx pgx.Tx, fileID uuid.UUID, idx int64) (int64, error) {
+	if fileID == uuid.Nil || idx < 0 {
+		return 0, helper.ErrInvalidInput
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM file_chunks WHERE file_id = $1 AND idx >= $2", fileID, idx)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -5,12 +5,22 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"meliocool/bytesize/internal/model/domain"
+	"time"
 )
 
 type FileRepository interface {
 	Create(ctx context.Context, tx pgx.Tx, file domain.File) (domain.File, error)
+	Import(ctx context.Context, tx pgx.Tx, file domain.File) (bool, error)
 	FindByID(ctx context.Context, tx pgx.Tx, id uuid.UUID) (domain.File, error)
-	List(ctx context.Context, tx pgx.Tx) ([]domain.File, error)
+	FindByIDs(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) ([]domain.File, error)
+	List(ctx context.Context, tx pgx.Tx, filter domain.FileFilter) ([]domain.File, error)
+	ListAfter(ctx context.Context, tx pgx.Tx, filter domain.FileFilter, after domain.FileCursor) ([]domain.File, error)
+	FindByFilename(ctx context.Context, tx pgx.Tx, filename string) ([]domain.File, error)
+	ListExpired(ctx context.Context, tx pgx.Tx, limit int) ([]domain.File, error)
+	LockVersion(ctx context.Context, tx pgx.Tx, id uuid.UUID) (time.Time, error)
+	Replace(ctx context.Context, tx pgx.Tx, file domain.File) error
 	UpdateTotals(ctx context.Context, tx pgx.Tx, id uuid.UUID, totalSize int64) error
+	UpdateFilename(ctx context.Context, tx pgx.Tx, id uuid.UUID, filename string) (domain.File, error)
+	UpdateMetadata(ctx context.Context, tx pgx.Tx, id uuid.UUID, set map[string]string, remove []string, tags []string) (domain.File, error)
 	Delete(ctx context.Context, tx pgx.Tx, id uuid.UUID) error
 }
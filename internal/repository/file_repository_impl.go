@@ -7,6 +7,8 @@ import (
 	"github.com/jackc/pgx/v5"
 	"meliocool/bytesize/internal/helper"
 	"meliocool/bytesize/internal/model/domain"
+	"strings"
+	"time"
 )
 
 type FileRepositoryImpl struct {
@@ -16,32 +18,97 @@ func NewFileRepository() FileRepository {
 	return &FileRepositoryImpl{}
 }
 
+const fileColumns = "id, filename, total_size, content_type, created_at, updated_at, expires_at, metadata, tags"
+
+// * visibleFile hides rows whose expires_at has passed.
+const visibleFile = "(expires_at IS NULL OR expires_at > NOW())"
+
+// notReserved drops files under any of the reserved prefixes in $4 unless the list prefix $3
+// is itself under that prefix.
+const notReserved = "NOT EXISTS (SELECT 1 FROM unnest($4::text[]) AS r(prefix) WHERE starts_with(filename || '/', r.prefix) AND NOT starts_with($3, r.prefix))"
+
+func scanFile(row pgx.Row) (domain.File, error) {
+	file := domain.File{}
+	err := row.Scan(&file.ID, &file.Filename, &file.TotalSize, &file.ContentType, &file.CreatedAt, &file.UpdatedAt, &file.ExpiresAt, &file.Metadata, &file.Tags)
+	return file, err
+}
+
+func scanFiles(rows pgx.Rows) ([]domain.File, error) {
+	defer rows.Close()
+
+	var fileRows []domain.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		fileRows = append(fileRows, file)
+	}
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return fileRows, nil
+}
+
 func (f *FileRepositoryImpl) Create(ctx context.Context, tx pgx.Tx, file domain.File) (domain.File, error) {
 	if file.TotalSize < 0 || file.Filename == "" {
 		return domain.File{}, helper.ErrInvalidInput
 	}
+	// * metadata keys are case-insensitive: they are stored, and filtered on, in lowercase
+	metadata := helper.LowerKeys(file.Metadata)
+	tags := file.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
 
-	SQL := "INSERT INTO files (filename, total_size) VALUES($1, $2) RETURNING id, filename, total_size, created_at, updated_at"
-
-	fileRow := domain.File{}
+	SQL := "INSERT INTO files (filename, total_size, content_type, expires_at, metadata, tags) VALUES($1, $2, $3, $4, $5, $6) RETURNING " + fileColumns
 
-	if err := tx.QueryRow(ctx, SQL, file.Filename, file.TotalSize).Scan(&fileRow.ID, &fileRow.Filename, &fileRow.TotalSize, &fileRow.CreatedAt, &fileRow.UpdatedAt); err == nil {
+	if fileRow, err := scanFile(tx.QueryRow(ctx, SQL, file.Filename, file.TotalSize, contentType, file.ExpiresAt, metadata, tags)); err == nil {
 		return fileRow, nil
 	} else {
 		return domain.File{}, err
 	}
 }
 
+// * Import inserts file as it was on another instance, keeping its id and timestamps. It reports
+// * false, and writes nothing, when a file with that id already exists.
+func (f *FileRepositoryImpl) Import(ctx context.Context, tx pgx.Tx, file domain.File) (bool, error) {
+	if file.ID == uuid.Nil || file.TotalSize < 0 || file.Filename == "" || file.CreatedAt.IsZero() || file.UpdatedAt.IsZero() {
+		return false, helper.ErrInvalidInput
+	}
+	metadata := file.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	tags := file.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	SQL := "INSERT INTO files (id, filename, total_size, content_type, created_at, updated_at, expires_at, metadata, tags) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (id) DO NOTHING"
+	tag, err := tx.Exec(ctx, SQL, file.ID, file.Filename, file.TotalSize, contentType, file.CreatedAt, file.UpdatedAt, file.ExpiresAt, metadata, tags)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
 func (f *FileRepositoryImpl) FindByID(ctx context.Context, tx pgx.Tx, id uuid.UUID) (domain.File, error) {
 	if id == uuid.Nil {
 		return domain.File{}, helper.ErrInvalidInput
 	}
 
-	SQL := "SELECT id, filename, total_size, created_at, updated_at FROM files WHERE id = $1"
+	SQL := "SELECT " + fileColumns + " FROM files WHERE id = $1 AND " + visibleFile
 
-	fileRow := domain.File{}
-
-	if err := tx.QueryRow(ctx, SQL, id).Scan(&fileRow.ID, &fileRow.Filename, &fileRow.TotalSize, &fileRow.CreatedAt, &fileRow.UpdatedAt); err == nil {
+	if fileRow, err := scanFile(tx.QueryRow(ctx, SQL, id)); err == nil {
 		return fileRow, nil
 	} else if errors.Is(err, pgx.ErrNoRows) {
 		return domain.File{}, helper.ErrNotFound
@@ -50,29 +117,150 @@ func (f *FileRepositoryImpl) FindByID(ctx context.Context, tx pgx.Tx, id uuid.UU
 	}
 }
 
-func (f *FileRepositoryImpl) List(ctx context.Context, tx pgx.Tx) ([]domain.File, error) {
-	SQL := "SELECT id, filename, total_size, created_at, updated_at FROM files ORDER BY created_at DESC"
-	rows, err := tx.Query(ctx, SQL)
+func (f *FileRepositoryImpl) List(ctx context.Context, tx pgx.Tx, filter domain.FileFilter) ([]domain.File, error) {
+	tags := filter.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	metadata := helper.LowerKeys(filter.Metadata)
+
+	// * @> lets the GIN indexes on tags/metadata serve the filter; empty values match everything.
+	// * files under a reserved prefix are not user files, so they only list under a prefix that asks for them
+	SQL := "SELECT " + fileColumns + " FROM files WHERE " + visibleFile + " AND tags @> $1 AND metadata @> $2 AND starts_with(filename, $3) AND " + notReserved + " ORDER BY created_at DESC, id"
+	args := []any{tags, metadata, filter.Prefix, helper.ReservedPrefixes}
+	if filter.Limit > 0 {
+		SQL += " LIMIT $5 OFFSET $6"
+		args = append(args, filter.Limit, max(filter.Offset, 0))
+	}
+	rows, err := tx.Query(ctx, SQL, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanFiles(rows)
+}
 
-	var fileRows []domain.File
-	for rows.Next() {
-		file := domain.File{}
-		err := rows.Scan(&file.ID, &file.Filename, &file.TotalSize, &file.CreatedAt, &file.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		fileRows = append(fileRows, file)
+// ListAfter returns up to filter.Limit visible files past after, oldest first, so a caller can
+// walk every file without the offsets shifting under it. filter.Offset is ignored.
+func (f *FileRepositoryImpl) ListAfter(ctx context.Context, tx pgx.Tx, filter domain.FileFilter, after domain.FileCursor) ([]domain.File, error) {
+	if filter.Limit <= 0 {
+		return nil, helper.ErrInvalidInput
 	}
-	if rowErr := rows.Err(); rowErr != nil {
-		return nil, rowErr
+	tags := filter.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	metadata := helper.LowerKeys(filter.Metadata)
+
+	SQL := "SELECT " + fileColumns + " FROM files WHERE " + visibleFile + " AND tags @> $1 AND metadata @> $2 AND starts_with(filename, $3) AND " + notReserved + " AND (created_at, id) > ($5, $6) ORDER BY created_at, id LIMIT $7"
+	rows, err := tx.Query(ctx, SQL, tags, metadata, filter.Prefix, helper.ReservedPrefixes, after.CreatedAt, after.ID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanFiles(rows)
+}
+
+// * FindByFilename returns every visible file with exactly this filename, newest first.
+func (f *FileRepositoryImpl) FindByFilename(ctx context.Context, tx pgx.Tx, filename string) ([]domain.File, error) {
+	if filename == "" {
+		return nil, helper.ErrInvalidInput
+	}
+
+	SQL := "SELECT " + fileColumns + " FROM files WHERE filename = $1 AND " + visibleFile + " ORDER BY created_at DESC"
+	rows, err := tx.Query(ctx, SQL, filename)
+	if err != nil {
+		return nil, err
+	}
+	return scanFiles(rows)
+}
+
+// * ListExpired returns up to limit files whose expires_at has passed, oldest expiry first.
+func (f *FileRepositoryImpl) ListExpired(ctx context.Context, tx pgx.Tx, limit int) ([]domain.File, error) {
+	if limit <= 0 {
+		return nil, helper.ErrInvalidInput
+	}
+
+	SQL := "SELECT " + fileColumns + " FROM files WHERE expires_at IS NOT NULL AND expires_at <= NOW() ORDER BY expires_at ASC LIMIT $1"
+	rows, err := tx.Query(ctx, SQL, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanFiles(rows)
+}
+
+// * FindByIDs returns the visible files among ids, in the order the ids were given.
+func (f *FileRepositoryImpl) FindByIDs(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) ([]domain.File, error) {
+	if len(ids) == 0 {
+		return nil, helper.ErrInvalidInput
+	}
+
+	SQL := "SELECT " + fileColumns + " FROM files WHERE id = ANY($1) AND " + visibleFile
+	rows, err := tx.Query(ctx, SQL, ids)
+	if err != nil {
+		return nil, err
+	}
+	found, err := scanFiles(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]domain.File, len(found))
+	for _, file := range found {
+		byID[file.ID] = file
+	}
+	fileRows := make([]domain.File, 0, len(found))
+	for _, id := range ids {
+		if file, ok := byID[id]; ok {
+			fileRows = append(fileRows, file)
+			delete(byID, id)
+		}
 	}
 	return fileRows, nil
 }
 
+// * LockVersion locks a file's row, expired or not, for the rest of tx and returns its updated_at.
+func (f *FileRepositoryImpl) LockVersion(ctx context.Context, tx pgx.Tx, id uuid.UUID) (time.Time, error) {
+	if id == uuid.Nil {
+		return time.Time{}, helper.ErrInvalidInput
+	}
+
+	var updatedAt time.Time
+	err := tx.QueryRow(ctx, "SELECT updated_at FROM files WHERE id = $1 FOR UPDATE", id).Scan(&updatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, helper.ErrNotFound
+	}
+	return updatedAt, err
+}
+
+// * Replace overwrites every column of an existing file with file's, timestamps included, as
+// * another instance has it; the manifest is the caller's to replace.
+func (f *FileRepositoryImpl) Replace(ctx context.Context, tx pgx.Tx, file domain.File) error {
+	if file.ID == uuid.Nil || file.TotalSize < 0 || file.Filename == "" || file.CreatedAt.IsZero() || file.UpdatedAt.IsZero() {
+		return helper.ErrInvalidInput
+	}
+	metadata := file.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	tags := file.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	SQL := "UPDATE files SET filename = $2, total_size = $3, content_type = $4, created_at = $5, updated_at = $6, expires_at = $7, metadata = $8, tags = $9 WHERE id = $1"
+	tag, err := tx.Exec(ctx, SQL, file.ID, file.Filename, file.TotalSize, contentType, file.CreatedAt, file.UpdatedAt, file.ExpiresAt, metadata, tags)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return helper.ErrNotFound
+	}
+	return nil
+}
+
 func (f *FileRepositoryImpl) UpdateTotals(ctx context.Context, tx pgx.Tx, id uuid.UUID, totalSize int64) error {
 	if id == uuid.Nil || totalSize < 0 {
 		return helper.ErrInvalidInput
@@ -91,6 +279,49 @@ func (f *FileRepositoryImpl) UpdateTotals(ctx context.Context, tx pgx.Tx, id uui
 	return nil
 }
 
+// * UpdateFilename renames a visible file in place; its manifest is untouched.
+func (f *FileRepositoryImpl) UpdateFilename(ctx context.Context, tx pgx.Tx, id uuid.UUID, filename string) (domain.File, error) {
+	if id == uuid.Nil || filename == "" {
+		return domain.File{}, helper.ErrInvalidInput
+	}
+
+	SQL := "UPDATE files SET filename = $2, updated_at = NOW() WHERE id = $1 AND " + visibleFile + " RETURNING " + fileColumns
+
+	if fileRow, err := scanFile(tx.QueryRow(ctx, SQL, id, filename)); err == nil {
+		return fileRow, nil
+	} else if errors.Is(err, pgx.ErrNoRows) {
+		return domain.File{}, helper.ErrNotFound
+	} else {
+		return domain.File{}, err
+	}
+}
+
+// * UpdateMetadata merges set into metadata, drops the remove keys, and replaces tags when tags is non-nil.
+func (f *FileRepositoryImpl) UpdateMetadata(ctx context.Context, tx pgx.Tx, id uuid.UUID, set map[string]string, remove []string, tags []string) (domain.File, error) {
+	if id == uuid.Nil {
+		return domain.File{}, helper.ErrInvalidInput
+	}
+	set = helper.LowerKeys(set)
+	lowered := make([]string, 0, len(remove))
+	for _, k := range remove {
+		lowered = append(lowered, strings.ToLower(k))
+	}
+	replaceTags := tags != nil
+	if tags == nil {
+		tags = []string{}
+	}
+
+	SQL := "UPDATE files SET metadata = (metadata - $2::text[]) || $3::jsonb, tags = CASE WHEN $4 THEN $5::text[] ELSE tags END, updated_at = NOW() WHERE id = $1 AND " + visibleFile + " RETURNING " + fileColumns
+
+	if fileRow, err := scanFile(tx.QueryRow(ctx, SQL, id, lowered, set, replaceTags, tags)); err == nil {
+		return fileRow, nil
+	} else if errors.Is(err, pgx.ErrNoRows) {
+		return domain.File{}, helper.ErrNotFound
+	} else {
+		return domain.File{}, err
+	}
+}
+
 func (r *FileRepositoryImpl) Delete(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
 	if id == uuid.Nil {
 		return helper.ErrInvalidInput
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"meliocool/bytesize/internal/model/domain"
+	"time"
+)
+
+type ReplicationRepository interface {
+	ListEvents(ctx context.Context, tx pgx.Tx, after int64, limit int) ([]domain.ReplicationEvent, error)
+	SettledSeq(ctx context.Context, tx pgx.Tx, before time.Time) (int64, error)
+	Backlog(ctx context.Context, tx pgx.Tx, after int64) (int64, time.Time, error)
+	FindCheckpoint(ctx context.Context, tx pgx.Tx, peer string) (domain.ReplicationCheckpoint, error)
+	SaveCheckpoint(ctx context.Context, tx pgx.Tx, checkpoint domain.ReplicationCheckpoint) error
+	Prune(ctx context.Context, tx pgx.Tx, upTo int64) (int64, error)
+}
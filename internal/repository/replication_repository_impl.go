@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/domain"
+	"time"
+)
+
+type ReplicationRepositoryImpl struct {
+}
+
+func NewReplicationRepository() ReplicationRepository {
+	return &ReplicationRepositoryImpl{}
+}
+
+const replicationEventColumns = "seq, file_id, op, filename, updated_at, logged_at"
+
+// * ListEvents returns up to limit change log events after seq after, in seq order.
+func (r *ReplicationRepositoryImpl) ListEvents(ctx context.Context, tx pgx.Tx, after int64, limit int) ([]domain.ReplicationEvent, error) {
+	if after < 0 || limit <= 0 {
+		return nil, helper.ErrInvalidInput
+	}
+
+	SQL := "SELECT " + replicationEventColumns + " FROM replication_log WHERE seq > $1 ORDER BY seq LIMIT $2"
+	rows, err := tx.Query(ctx, SQL, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []domain.ReplicationEvent
+	for rows.Next() {
+		event := domain.ReplicationEvent{}
+		if err := rows.Scan(&event.Seq, &event.FileID, &event.Op, &event.Filename, &event.UpdatedAt, &event.LoggedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return events, nil
+}
+
+// * SettledSeq returns the last seq logged before before, or 0 when there is none. A transaction
+// * still open at that point may yet commit a lower seq, so callers leave it some time to.
+func (r *ReplicationRepositoryImpl) SettledSeq(ctx context.Context, tx pgx.Tx, before time.Time) (int64, error) {
+	var seq int64
+	err := tx.QueryRow(ctx, "SELECT COALESCE(MAX(seq), 0) FROM replication_log WHERE logged_at < $1", before).Scan(&seq)
+	return seq, err
+}
+
+// * Backlog counts the events after seq after and returns when the oldest of them was logged;
+// * that time is zero when there are none.
+func (r *ReplicationRepositoryImpl) Backlog(ctx context.Context, tx pgx.Tx, after int64) (int64, time.Time, error) {
+	var count int64
+	var oldest *time.Time
+	err := tx.QueryRow(ctx, "SELECT COUNT(*), MIN(logged_at) FROM replication_log WHERE seq > $1", after).Scan(&count, &oldest)
+	if err != nil || oldest == nil {
+		return count, time.Time{}, err
+	}
+	return count, *oldest, nil
+}
+
+func (r *ReplicationRepositoryImpl) FindCheckpoint(ctx context.Context, tx pgx.Tx, peer string) (domain.ReplicationCheckpoint, error) {
+	if peer == "" {
+		return domain.ReplicationCheckpoint{}, helper.ErrInvalidInput
+	}
+
+	checkpoint := domain.ReplicationCheckpoint{}
+	SQL := "SELECT peer, seq, backfill, cursor_time, cursor_id, updated_at FROM replication_checkpoints WHERE peer = $1"
+	err := tx.QueryRow(ctx, SQL, peer).Scan(&checkpoint.Peer, &checkpoint.Seq, &checkpoint.Backfill, &checkpoint.Cursor.CreatedAt, &checkpoint.Cursor.ID, &checkpoint.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.ReplicationCheckpoint{}, helper.ErrNotFound
+	}
+	return checkpoint, err
+}
+
+func (r *ReplicationRepositoryImpl) SaveCheckpoint(ctx context.Context, tx pgx.Tx, checkpoint domain.ReplicationCheckpoint) error {
+	if checkpoint.Peer == "" || checkpoint.Seq < 0 {
+		return helper.ErrInvalidInput
+	}
+
+	SQL := "INSERT INTO replication_checkpoints (peer, seq, backfill, cursor_time, cursor_id, updated_at) VALUES($1, $2, $3, $4, $5, NOW()) ON CONFLICT (peer) DO UPDATE SET seq = EXCLUDED.seq, backfill = EXCLUDED.backfill, cursor_time = EXCLUDED.cursor_time, cursor_id = EXCLUDED.cursor_id, updated_at = NOW()"
+	_, err := tx.Exec(ctx, SQL, checkpoint.Peer, checkpoint.Seq, checkpoint.Backfill, checkpoint.Cursor.CreatedAt, checkpoint.Cursor.ID)
+	return err
+}
+
+// * Prune deletes the events up to seq upTo, but none a peer's checkpoint has yet to pass, and
+// * returns how many it deleted. A peer that is retired must have its checkpoint deleted too.
+func (r *ReplicationRepositoryImpl) Prune(ctx context.Context, tx pgx.Tx, upTo int64) (int64, error) {
+	if upTo <= 0 {
+		return 0, nil
+	}
+	SQL := "DELETE FROM replication_log WHERE seq <= LEAST($1, (SELECT MIN(seq) FROM replication_checkpoints))"
+	tag, err := tx.Exec(ctx, SQL, upTo)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
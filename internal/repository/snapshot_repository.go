@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"meliocool/bytesize/internal/model/domain"
+)
+
+type SnapshotRepository interface {
+	Create(ctx context.Context, tx pgx.Tx, snapshot domain.Snapshot) (domain.Snapshot, error)
+	AddEntries(ctx context.Context, tx pgx.Tx, snapshotID uuid.UUID, entries []domain.SnapshotEntry) error
+	FindByID(ctx context.Context, tx pgx.Tx, id uuid.UUID) (domain.Snapshot, error)
+	List(ctx context.Context, tx pgx.Tx, filter domain.SnapshotFilter) ([]domain.Snapshot, error)
+	FindEntries(ctx context.Context, tx pgx.Tx, snapshotID uuid.UUID) ([]domain.SnapshotEntry, error)
+	Delete(ctx context.Context, tx pgx.Tx, id uuid.UUID) error
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/domain"
+)
+
+type SnapshotRepositoryImpl struct {
+}
+
+func NewSnapshotRepository() SnapshotRepository {
+	return &SnapshotRepositoryImpl{}
+}
+
+const snapshotColumns = "id, hostname, paths, tags, taken_at, file_count, total_size, created_at"
+
+const snapshotEntryColumns = "snapshot_id, path, type, mode, mtime, size, link_target, digest, file_id"
+
+func scanSnapshot(row pgx.Row) (domain.Snapshot, error) {
+	snapshot := domain.Snapshot{}
+	err := row.Scan(&snapshot.ID, &snapshot.Hostname, &snapshot.Paths, &snapshot.Tags, &snapshot.TakenAt, &snapshot.FileCount, &snapshot.TotalSize, &snapshot.CreatedAt)
+	return snapshot, err
+}
+
+func (s *SnapshotRepositoryImpl) Create(ctx context.Context, tx pgx.Tx, snapshot domain.Snapshot) (domain.Snapshot, error) {
+	if snapshot.FileCount < 0 || snapshot.TotalSize < 0 || snapshot.TakenAt.IsZero() {
+		return domain.Snapshot{}, helper.ErrInvalidInput
+	}
+	paths := snapshot.Paths
+	if paths == nil {
+		paths = []string{}
+	}
+	tags := snapshot.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	SQL := "INSERT INTO snapshots (hostname, paths, tags, taken_at, file_count, total_size) VALUES($1, $2, $3, $4, $5, $6) RETURNING " + snapshotColumns
+
+	if snapshotRow, err := scanSnapshot(tx.QueryRow(ctx, SQL, snapshot.Hostname, paths, tags, snapshot.TakenAt, snapshot.FileCount, snapshot.TotalSize)); err == nil {
+		return snapshotRow, nil
+	} else {
+		return domain.Snapshot{}, err
+	}
+}
+
+func (s *SnapshotRepositoryImpl) AddEntries(ctx context.Context, tx pgx.Tx, snapshotID uuid.UUID, entries []domain.SnapshotEntry) error {
+	if snapshotID == uuid.Nil || len(entries) == 0 {
+		return helper.ErrInvalidInput
+	}
+	SQL := "INSERT INTO snapshot_entries(" + snapshotEntryColumns + ") VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+	batch := &pgx.Batch{}
+	for _, entry := range entries {
+		if entry.Path == "" || entry.Size < 0 {
+			return helper.ErrInvalidInput
+		}
+		batch.Queue(SQL, snapshotID, entry.Path, entry.Type, entry.Mode, entry.ModTime, entry.Size, entry.LinkTarget, entry.Digest, entry.FileID)
+	}
+
+	br := tx.SendBatch(ctx, batch)
+	for i := 0; i < len(entries); i++ {
+		if _, err := br.Exec(); err != nil {
+			_ = br.Close()
+			return err
+		}
+	}
+	return br.Close()
+}
+
+func (s *SnapshotRepositoryImpl) FindByID(ctx context.Context, tx pgx.Tx, id uuid.UUID) (domain.Snapshot, error) {
+	if id == uuid.Nil {
+		return domain.Snapshot{}, helper.ErrInvalidInput
+	}
+
+	SQL := "SELECT " + snapshotColumns + " FROM snapshots WHERE id = $1"
+
+	if snapshotRow, err := scanSnapshot(tx.QueryRow(ctx, SQL, id)); err == nil {
+		return snapshotRow, nil
+	} else if errors.Is(err, pgx.ErrNoRows) {
+		return domain.Snapshot{}, helper.ErrNotFound
+	} else {
+		return domain.Snapshot{}, err
+	}
+}
+
+// * List returns matching snapshots newest first; an empty hostname or tag list matches everything.
+func (s *SnapshotRepositoryImpl) List(ctx context.Context, tx pgx.Tx, filter domain.SnapshotFilter) ([]domain.Snapshot, error) {
+	tags := filter.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	SQL := "SELECT " + snapshotColumns + " FROM snapshots WHERE ($1 = '' OR hostname = $1) AND tags @> $2 ORDER BY taken_at DESC, id"
+	rows, err := tx.Query(ctx, SQL, filter.Hostname, tags)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshotRows []domain.Snapshot
+	for rows.Next() {
+		snapshot, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshotRows = append(snapshotRows, snapshot)
+	}
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return snapshotRows, nil
+}
+
+// * FindEntries returns a snapshot's entries by path, so parents come before their children.
+func (s *SnapshotRepositoryImpl) FindEntries(ctx context.Context, tx pgx.Tx, snapshotID uuid.UUID) ([]domain.SnapshotEntry, error) {
+	if snapshotID == uuid.Nil {
+		return nil, helper.ErrInvalidInput
+	}
+
+	SQL := "SELECT " + snapshotEntryColumns + " FROM snapshot_entries WHERE snapshot_id = $1 ORDER BY path COLLATE \"C\""
+	rows, err := tx.Query(ctx, SQL, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entryRows []domain.SnapshotEntry
+	for rows.Next() {
+		entry := domain.SnapshotEntry{}
+		err := rows.Scan(&entry.SnapshotID, &entry.Path, &entry.Type, &entry.Mode, &entry.ModTime, &entry.Size, &entry.LinkTarget, &entry.Digest, &entry.FileID)
+		if err != nil {
+			return nil, err
+		}
+		entryRows = append(entryRows, entry)
+	}
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return entryRows, nil
+}
+
+func (s *SnapshotRepositoryImpl) Delete(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	if id == uuid.Nil {
+		return helper.ErrInvalidInput
+	}
+	cmd, err := tx.Exec(ctx, "DELETE FROM snapshots WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return helper.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"meliocool/bytesize/internal/model/web"
+)
+
+type ArchiveService interface {
+	Prepare(ctx context.Context, req web.ArchiveRequest) (Plan, error)
+	Stream(ctx context.Context, plan Plan, w io.Writer) error
+}
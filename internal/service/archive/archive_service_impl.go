@@ -0,0 +1,305 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/repository"
+	"meliocool/bytesize/internal/service/download"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	FormatZip   = "zip"
+	FormatTar   = "tar"
+	FormatTarGz = "tar.gz"
+)
+
+// Plan is a resolved archive: the member files and the names they get inside the archive.
+type Plan struct {
+	Format      string
+	Compression string
+	Files       []domain.File
+	Names       []string
+}
+
+// ContentType is the MIME type of the archive container.
+func (p Plan) ContentType() string {
+	switch p.Format {
+	case FormatTar:
+		return "application/x-tar"
+	case FormatTarGz:
+		return "application/gzip"
+	default:
+		return "application/zip"
+	}
+}
+
+func (p Plan) Filename(now time.Time) string {
+	return "bytesize-" + now.UTC().Format("20060102-150405") + "." + p.Format
+}
+
+type ArchiveServiceImpl struct {
+	FileRepository      repository.FileRepository
+	FileChunkRepository repository.FileChunkRepository
+	DownloadService     download.DownloadService
+	DB                  *pgxpool.Pool
+	Validate            *validator.Validate
+	Logger              *slog.Logger
+}
+
+func NewArchiveService(fileRepository repository.FileRepository, fileChunkRepository repository.FileChunkRepository, downloadService download.DownloadService, db *pgxpool.Pool, validate *validator.Validate, logger *slog.Logger) ArchiveService {
+	return &ArchiveServiceImpl{
+		FileRepository:      fileRepository,
+		FileChunkRepository: fileChunkRepository,
+		DownloadService:     downloadService,
+		DB:                  db,
+		Validate:            validate,
+		Logger:              logger,
+	}
+}
+
+func (a *ArchiveServiceImpl) Prepare(ctx context.Context, req web.ArchiveRequest) (Plan, error) {
+	if err := a.Validate.Struct(req); err != nil {
+		return Plan{}, helper.ErrInvalidInput
+	}
+	// * an empty filter would archive the whole store; make the caller ask for something
+	if len(req.IDs) == 0 && req.Prefix == "" && len(req.Tags) == 0 && len(req.Metadata) == 0 {
+		return Plan{}, helper.ErrInvalidInput
+	}
+	if err := helper.ValidateLabels(req.Metadata, req.Tags); err != nil {
+		return Plan{}, helper.ErrInvalidInput
+	}
+
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		return Plan{}, helper.ErrInternal
+	}
+	var files []domain.File
+	if len(req.IDs) > 0 {
+		files, err = a.FileRepository.FindByIDs(ctx, tx, req.IDs)
+	} else {
+		files, err = a.FileRepository.List(ctx, tx, domain.FileFilter{Prefix: req.Prefix, Tags: req.Tags, Metadata: req.Metadata})
+	}
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		a.Logger.Error("archive_err", slog.String("stage", "resolve_files"), slog.Any("err", err))
+		return Plan{}, helper.ErrInternal
+	}
+	if len(files) > helper.MaxArchiveFiles {
+		_ = tx.Rollback(ctx)
+		return Plan{}, helper.ErrTooLarge
+	}
+	files, err = a.complete(ctx, tx, files)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		a.Logger.Error("archive_err", slog.String("stage", "find_manifest"), slog.Any("err", err))
+		return Plan{}, helper.ErrInternal
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Plan{}, helper.ErrInternal
+	}
+
+	if len(files) == 0 {
+		return Plan{}, helper.ErrNotFound
+	}
+
+	plan := Plan{
+		Format:      req.Format,
+		Compression: req.Compression,
+		Files:       files,
+		Names:       memberNames(files),
+	}
+	if plan.Format == "" {
+		plan.Format = FormatZip
+	}
+	if plan.Compression == "" {
+		plan.Compression = "auto"
+	}
+	return plan, nil
+}
+
+// complete leaves out files that are still being written: reserved rows (tus and multipart
+// uploads) and uploads whose manifest does not add up to total_size yet. Those would fail
+// mid-stream, or, in a tar, not match the size already written in the member header.
+func (a *ArchiveServiceImpl) complete(ctx context.Context, tx pgx.Tx, files []domain.File) ([]domain.File, error) {
+	out := files[:0]
+	for _, f := range files {
+		if helper.ReservedFilename(f.Filename) {
+			continue
+		}
+		manifest, err := a.FileChunkRepository.FindByFileID(ctx, tx, f.ID)
+		if err != nil {
+			return nil, err
+		}
+		var size int64
+		for _, fc := range manifest {
+			size += fc.Size
+		}
+		if size != f.TotalSize {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+func (a *ArchiveServiceImpl) Stream(ctx context.Context, plan Plan, w io.Writer) error {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("archive").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("archive").Observe(time.Since(start).Seconds()) }()
+	a.Logger.Info("archive_start", slog.String("format", plan.Format), slog.Int("files", len(plan.Files)))
+
+	var err error
+	switch plan.Format {
+	case FormatZip:
+		err = a.writeZip(ctx, plan, w)
+	case FormatTar:
+		err = a.writeTar(ctx, plan, w)
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		err = a.writeTar(ctx, plan, gz)
+		if err == nil {
+			err = gz.Close()
+		}
+	default:
+		err = helper.ErrInvalidInput
+	}
+	if err != nil {
+		a.Logger.Error("archive_err", slog.String("stage", "stream"), slog.String("format", plan.Format), slog.Any("err", err))
+		metrics.ErrorsTotal.WithLabelValues("archive").Inc()
+		return err
+	}
+
+	var totalSize int64
+	for _, f := range plan.Files {
+		totalSize += f.TotalSize
+	}
+	a.Logger.Info(
+		"archive_ok",
+		slog.String("format", plan.Format),
+		slog.Int("files", len(plan.Files)),
+		slog.Int64("total_size", totalSize),
+		slog.Duration("took", time.Since(start)),
+	)
+	return nil
+}
+
+// writeZip streams members with data descriptors; archive/zip switches a member and the
+// central directory to Zip64 on its own once sizes or offsets pass 4 GiB.
+func (a *ArchiveServiceImpl) writeZip(ctx context.Context, plan Plan, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for i, f := range plan.Files {
+		header := &zip.FileHeader{
+			Name:     plan.Names[i],
+			Method:   zipMethod(plan.Compression, f.ContentType),
+			Modified: f.UpdatedAt,
+		}
+		member, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := a.DownloadService.Stream(ctx, f.ID, member); err != nil {
+			return fmt.Errorf("member %s: %w", f.ID, err)
+		}
+	}
+	return zw.Close()
+}
+
+func (a *ArchiveServiceImpl) writeTar(ctx context.Context, plan Plan, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for i, f := range plan.Files {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     plan.Names[i],
+			Mode:     0o644,
+			Size:     f.TotalSize,
+			ModTime:  f.UpdatedAt,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := a.DownloadService.Stream(ctx, f.ID, tw); err != nil {
+			return fmt.Errorf("member %s: %w", f.ID, err)
+		}
+	}
+	return tw.Close()
+}
+
+// zipMethod stores content that is already compressed instead of burning CPU deflating it again.
+func zipMethod(compression string, contentType string) uint16 {
+	switch compression {
+	case "store":
+		return zip.Store
+	case "deflate":
+		return zip.Deflate
+	}
+	if isCompressed(contentType) {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+func isCompressed(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	if strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml" && mediaType != "image/bmp" {
+		return true
+	}
+	if strings.HasPrefix(mediaType, "video/") || (strings.HasPrefix(mediaType, "audio/") && mediaType != "audio/wav") {
+		return true
+	}
+	switch mediaType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+		"application/x-xz", "application/zstd", "application/x-7z-compressed", "application/vnd.rar",
+		"application/x-rar-compressed", "application/java-archive", "application/pdf",
+		"application/epub+zip", "application/vnd.android.package-archive":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "application/vnd.openxmlformats-officedocument.")
+}
+
+// memberNames turns stored filenames into safe relative archive paths and disambiguates duplicates.
+func memberNames(files []domain.File) []string {
+	used := make(map[string]bool, len(files))
+	names := make([]string, len(files))
+	for i, f := range files {
+		name := sanitizeMemberName(f.Filename)
+		if used[name] {
+			ext := path.Ext(name)
+			base := strings.TrimSuffix(name, ext)
+			for n := 2; ; n++ {
+				candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+				if !used[candidate] {
+					name = candidate
+					break
+				}
+			}
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+func sanitizeMemberName(filename string) string {
+	name := strings.ReplaceAll(filename, "\\", "/")
+	name = path.Clean("/" + name)
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || name == "." {
+		return "unnamed"
+	}
+	return name
+}
@@ -0,0 +1,16 @@
+package bundle
+
+import (
+	"context"
+	"io"
+	"meliocool/bytesize/internal/model/web"
+)
+
+// BundleService moves files between instances as a self-describing tar bundle: file metadata
+// as JSONL segments plus the chunk blobs they reference, each entry checksummed.
+type BundleService interface {
+	Admit() (func(), error)
+	PrepareExport(ctx context.Context, req web.BundleExportRequest) (ExportPlan, error)
+	Export(ctx context.Context, plan ExportPlan, w io.Writer) error
+	Import(ctx context.Context, r io.Reader) (web.BundleImportResponse, error)
+}
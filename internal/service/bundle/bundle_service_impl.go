@@ -0,0 +1,636 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/repository"
+	"meliocool/bytesize/internal/service/manifest"
+	"meliocool/bytesize/internal/service/upload"
+	"meliocool/bytesize/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Format  = "bytesize-bundle"
+	Version = 1
+
+	HeaderEntry  = "bundle.json"
+	EndEntry     = "end.json"
+	ChunkPrefix  = "chunks/"
+	SegmentNames = "files/%06d.jsonl"
+
+	// ChecksumRecord is the PAX record holding every entry's hex SHA-256; CursorRecord holds the
+	// position of a segment's last file, where a resumed export picks up.
+	ChecksumRecord = "BYTESIZE.sha256"
+	CursorRecord   = "BYTESIZE.cursor"
+)
+
+// ErrBadBundle is an import stream that is not a well-formed bundle; the wrapped message says
+// which entry is wrong.
+var ErrBadBundle = errors.New("invalid bundle")
+
+func badBundle(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrBadBundle, fmt.Sprintf(format, args...))
+}
+
+// ExportPlan is a validated export: the files to walk and where the stream starts.
+type ExportPlan struct {
+	Filter  domain.FileFilter
+	After   domain.FileCursor
+	Segment int
+}
+
+func (p ExportPlan) Filename(now time.Time) string {
+	return "bytesize-" + now.UTC().Format("20060102-150405") + ".bundle.tar"
+}
+
+type BundleServiceImpl struct {
+	UploadService       upload.UploadService
+	FileRepository      repository.FileRepository
+	FileChunkRepository repository.FileChunkRepository
+	ChunkRepository     repository.ChunkRepository
+	ChunkStore          storage.ChunkStore
+	DB                  *pgxpool.Pool
+	Logger              *slog.Logger
+}
+
+func NewBundleService(
+	uploadService upload.UploadService,
+	fileRepository repository.FileRepository,
+	fileChunkRepository repository.FileChunkRepository,
+	chunkRepository repository.ChunkRepository,
+	chunkStore storage.ChunkStore,
+	db *pgxpool.Pool,
+	logger *slog.Logger,
+) BundleService {
+	return &BundleServiceImpl{
+		UploadService:       uploadService,
+		FileRepository:      fileRepository,
+		FileChunkRepository: fileChunkRepository,
+		ChunkRepository:     chunkRepository,
+		ChunkStore:          chunkStore,
+		DB:                  db,
+		Logger:              logger,
+	}
+}
+
+func (b *BundleServiceImpl) Admit() (func(), error) {
+	return b.UploadService.Admit()
+}
+
+// EncodeCursor renders a listing position as it appears in segments, end.json and ?after=.
+func EncodeCursor(c domain.FileCursor) string {
+	return c.CreatedAt.UTC().Format(time.RFC3339Nano) + "/" + c.ID.String()
+}
+
+func decodeCursor(s string) (domain.FileCursor, error) {
+	rawTime, rawID, ok := strings.Cut(s, "/")
+	if !ok {
+		return domain.FileCursor{}, helper.ErrInvalidInput
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, rawTime)
+	if err != nil {
+		return domain.FileCursor{}, helper.ErrInvalidInput
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return domain.FileCursor{}, helper.ErrInvalidInput
+	}
+	return domain.FileCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+func (b *BundleServiceImpl) PrepareExport(ctx context.Context, req web.BundleExportRequest) (ExportPlan, error) {
+	if err := helper.ValidateLabels(req.Metadata, req.Tags); err != nil {
+		return ExportPlan{}, err
+	}
+	// * a continuation needs both halves: where the last segment ended and its number
+	if req.Segment < 0 || (req.After == "") != (req.Segment == 0) {
+		return ExportPlan{}, helper.ErrInvalidInput
+	}
+	plan := ExportPlan{
+		Filter:  domain.FileFilter{Prefix: req.Prefix, Tags: req.Tags, Metadata: req.Metadata, Limit: helper.BundlePageSize},
+		Segment: req.Segment,
+	}
+	if req.After != "" {
+		after, err := decodeCursor(req.After)
+		if err != nil {
+			return ExportPlan{}, err
+		}
+		plan.After = after
+	}
+	return plan, nil
+}
+
+// Export writes the files matching plan to w, oldest first, a page at a time: the chunks the
+// page needs that this stream has not carried yet, then the page's metadata as one segment.
+// A chunk always precedes the first segment that uses it, so an import never waits on one.
+func (b *BundleServiceImpl) Export(ctx context.Context, plan ExportPlan, w io.Writer) error {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("bundle_export").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("bundle_export").Observe(time.Since(start).Seconds()) }()
+
+	tw := tar.NewWriter(w)
+	if plan.Segment == 0 {
+		header := web.BundleHeader{
+			Format:    Format,
+			Version:   Version,
+			CreatedAt: start.UTC(),
+			ChunkSize: helper.ChunkSize,
+			Filter:    web.BundleFilter{Prefix: plan.Filter.Prefix, Tags: plan.Filter.Tags, Metadata: plan.Filter.Metadata},
+		}
+		if err := writeJSON(tw, HeaderEntry, header, nil); err != nil {
+			metrics.ErrorsTotal.WithLabelValues("bundle_export").Inc()
+			return err
+		}
+	}
+
+	// * dedupe only within this stream; a resumed export may repeat chunks, which import tolerates
+	sent := make(map[string]bool)
+	var files, chunks, chunkBytes int64
+	segment, cursor := plan.Segment, plan.After
+	for {
+		page, manifests, next, more, err := b.page(ctx, plan.Filter, cursor)
+		if err != nil {
+			b.Logger.Error("bundle_export_err", slog.String("stage", "list"), slog.Any("err", err))
+			metrics.ErrorsTotal.WithLabelValues("bundle_export").Inc()
+			return err
+		}
+		for i := range page {
+			for _, c := range manifests[i] {
+				if sent[c.ChunkHash] {
+					continue
+				}
+				n, err := b.writeChunk(tw, c.ChunkHash)
+				if err != nil {
+					b.Logger.Error("bundle_export_err", slog.String("stage", "chunk"), slog.String("hash", c.ChunkHash), slog.Any("err", err))
+					metrics.ErrorsTotal.WithLabelValues("bundle_export").Inc()
+					return err
+				}
+				sent[c.ChunkHash] = true
+				chunks++
+				chunkBytes += n
+			}
+		}
+		if len(page) > 0 {
+			segment++
+			if err := writeSegment(tw, segment, page, manifests, next); err != nil {
+				metrics.ErrorsTotal.WithLabelValues("bundle_export").Inc()
+				return err
+			}
+			files += int64(len(page))
+		}
+		cursor = next
+		if !more {
+			break
+		}
+	}
+
+	if err := writeJSON(tw, EndEntry, web.BundleEnd{Segments: segment, Cursor: EncodeCursor(cursor)}, nil); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("bundle_export").Inc()
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("bundle_export").Inc()
+		return err
+	}
+	metrics.BytesStreamedTotal.Add(float64(chunkBytes))
+	b.Logger.Info(
+		"bundle_export_ok",
+		slog.Int64("files", files),
+		slog.Int64("chunks", chunks),
+		slog.Int64("bytes", chunkBytes),
+		slog.Int("segments", segment-plan.Segment),
+		slog.Duration("took", time.Since(start)),
+	)
+	return nil
+}
+
+// page lists the next files after cursor with their manifests in one transaction. Reserved
+// files (in-progress uploads, snapshot manifests) are left out, but still advance the cursor.
+func (b *BundleServiceImpl) page(ctx context.Context, filter domain.FileFilter, cursor domain.FileCursor) ([]domain.File, [][]domain.FileChunk, domain.FileCursor, bool, error) {
+	tx, err := b.DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, cursor, false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := b.FileRepository.ListAfter(ctx, tx, filter, cursor)
+	if err != nil {
+		return nil, nil, cursor, false, err
+	}
+	var files []domain.File
+	var manifests [][]domain.FileChunk
+	for _, f := range rows {
+		cursor = domain.FileCursor{CreatedAt: f.CreatedAt, ID: f.ID}
+		if helper.ReservedFilename(f.Filename) {
+			continue
+		}
+		manifest, err := b.FileChunkRepository.FindByFileID(ctx, tx, f.ID)
+		if err != nil {
+			return nil, nil, cursor, false, err
+		}
+		files = append(files, f)
+		manifests = append(manifests, manifest)
+	}
+	return files, manifests, cursor, len(rows) == filter.Limit, nil
+}
+
+// writeChunk copies one chunk into the bundle after checking it against its hash, so a corrupt
+// store never produces a bundle that looks sound.
+func (b *BundleServiceImpl) writeChunk(tw *tar.Writer, hash string) (int64, error) {
+	rc, _, err := b.ChunkStore.Get(hash)
+	if err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, helper.ChunkSize+1))
+	rc.Close()
+	if err != nil {
+		return 0, err
+	}
+	sum := sha256.Sum256(data)
+	if len(data) > helper.ChunkSize || hex.EncodeToString(sum[:]) != hash {
+		return 0, manifest.ErrChunkMismatch
+	}
+	return int64(len(data)), writeEntry(tw, ChunkPrefix+hash, data, nil)
+}
+
+func writeSegment(tw *tar.Writer, segment int, files []domain.File, manifests [][]domain.FileChunk, last domain.FileCursor) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for i, f := range files {
+		chunks := make([]web.ManifestChunk, len(manifests[i]))
+		for j, c := range manifests[i] {
+			chunks[j] = web.ManifestChunk{Hash: c.ChunkHash, Size: c.Size}
+		}
+		line := web.BundleFile{
+			ID:          f.ID,
+			Filename:    f.Filename,
+			ContentType: f.ContentType,
+			TotalSize:   f.TotalSize,
+			CreatedAt:   f.CreatedAt,
+			UpdatedAt:   f.UpdatedAt,
+			ExpiresAt:   f.ExpiresAt,
+			Metadata:    f.Metadata,
+			Tags:        f.Tags,
+			Chunks:      chunks,
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return writeEntry(tw, fmt.Sprintf(SegmentNames, segment), body.Bytes(), map[string]string{CursorRecord: EncodeCursor(last)})
+}
+
+func writeJSON(tw *tar.Writer, name string, v any, records map[string]string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeEntry(tw, name, append(data, '\n'), records)
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte, records map[string]string) error {
+	sum := sha256.Sum256(data)
+	pax := map[string]string{ChecksumRecord: hex.EncodeToString(sum[:])}
+	for k, v := range records {
+		pax[k] = v
+	}
+	hdr := &tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       name,
+		Mode:       0o644,
+		Size:       int64(len(data)),
+		ModTime:    time.Now().Truncate(time.Second),
+		Format:     tar.FormatPAX,
+		PAXRecords: pax,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Import reads a bundle from r, storing its chunks and recreating its files with their ids and
+// timestamps. Each segment is one transaction, and files that already exist are skipped, so
+// importing the same bundle again, or again after a failure, only adds what is missing.
+func (b *BundleServiceImpl) Import(ctx context.Context, r io.Reader) (web.BundleImportResponse, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("bundle_import").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("bundle_import").Observe(time.Since(start).Seconds()) }()
+
+	resp, err := b.importBundle(ctx, r)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("bundle_import").Inc()
+		b.Logger.Error(
+			"bundle_import_err",
+			slog.Int("segments", resp.Segments),
+			slog.Int64("files_created", resp.FilesCreated),
+			slog.Any("err", err),
+		)
+		return resp, err
+	}
+	b.Logger.Info(
+		"bundle_import_ok",
+		slog.Int("segments", resp.Segments),
+		slog.Int64("files_created", resp.FilesCreated),
+		slog.Int64("files_skipped", resp.FilesSkipped),
+		slog.Int64("chunks_stored", resp.ChunksStored),
+		slog.Int64("bytes_stored", resp.BytesStored),
+		slog.Duration("took", time.Since(start)),
+	)
+	return resp, nil
+}
+
+func (b *BundleServiceImpl) importBundle(ctx context.Context, r io.Reader) (web.BundleImportResponse, error) {
+	resp := web.BundleImportResponse{}
+	tr := tar.NewReader(r)
+	// * present holds the hashes known to be in the store, so each is checked or written once
+	present := make(map[string]bool)
+	started, ended := false, false
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return resp, badBundle("%v", err)
+		}
+		if ended {
+			return resp, badBundle("%s follows %s", hdr.Name, EndEntry)
+		}
+		data, err := readEntry(tr, hdr)
+		if err != nil {
+			return resp, err
+		}
+		if !started && hdr.Name != HeaderEntry {
+			return resp, badBundle("first entry is %s, not %s", hdr.Name, HeaderEntry)
+		}
+
+		switch name := hdr.Name; {
+		case name == HeaderEntry:
+			if started {
+				return resp, badBundle("second %s", HeaderEntry)
+			}
+			if err := checkHeader(data); err != nil {
+				return resp, err
+			}
+			started = true
+		case strings.HasPrefix(name, ChunkPrefix):
+			if err := b.importChunk(strings.TrimPrefix(name, ChunkPrefix), data, present, &resp); err != nil {
+				return resp, err
+			}
+		case name == EndEntry:
+			end := web.BundleEnd{}
+			if err := json.Unmarshal(data, &end); err != nil {
+				return resp, badBundle("%s: %v", name, err)
+			}
+			if end.Segments != resp.Segments {
+				return resp, badBundle("%s counts %d segments, the bundle has %d", name, end.Segments, resp.Segments)
+			}
+			ended = true
+		default:
+			segment, ok := segmentNumber(name)
+			if !ok {
+				return resp, badBundle("unexpected entry %s", name)
+			}
+			if segment != resp.Segments+1 {
+				return resp, badBundle("%s out of order after segment %d", name, resp.Segments)
+			}
+			files, err := parseSegment(name, data)
+			if err != nil {
+				return resp, err
+			}
+			created, err := b.importSegment(ctx, name, files, present)
+			if err != nil {
+				return resp, err
+			}
+			resp.Segments++
+			resp.FilesCreated += created
+			resp.FilesSkipped += int64(len(files)) - created
+		}
+	}
+	if !ended {
+		return resp, badBundle("the stream ends before %s", EndEntry)
+	}
+	return resp, nil
+}
+
+// readEntry reads one entry's body and checks it against its checksum record.
+func readEntry(tr *tar.Reader, hdr *tar.Header) ([]byte, error) {
+	limit := int64(helper.MaxMemoryBytes)
+	if strings.HasPrefix(hdr.Name, ChunkPrefix) {
+		limit = helper.ChunkSize
+	}
+	if hdr.Typeflag != tar.TypeReg || hdr.Size < 0 || hdr.Size > limit {
+		return nil, badBundle("%s: not a regular entry of at most %d bytes", hdr.Name, limit)
+	}
+	want, ok := hdr.PAXRecords[ChecksumRecord]
+	if !ok {
+		return nil, badBundle("%s: no %s record", hdr.Name, ChecksumRecord)
+	}
+	data, err := io.ReadAll(tr)
+	if err != nil {
+		return nil, badBundle("%s: %v", hdr.Name, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != want {
+		return nil, badBundle("%s: checksum mismatch", hdr.Name)
+	}
+	return data, nil
+}
+
+func checkHeader(data []byte) error {
+	header := web.BundleHeader{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return badBundle("%s: %v", HeaderEntry, err)
+	}
+	if header.Format != Format || header.Version != Version {
+		return badBundle("format %q version %d, want %q version %d", header.Format, header.Version, Format, Version)
+	}
+	// * chunks cut at another size would be stored, but never dedupe against this server's uploads
+	if header.ChunkSize != helper.ChunkSize {
+		return badBundle("chunk size %d, this server uses %d", header.ChunkSize, helper.ChunkSize)
+	}
+	return nil
+}
+
+func segmentNumber(name string) (int, bool) {
+	raw, ok := strings.CutPrefix(name, "files/")
+	if !ok {
+		return 0, false
+	}
+	raw, ok = strings.CutSuffix(raw, ".jsonl")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 || fmt.Sprintf(SegmentNames, n) != name {
+		return 0, false
+	}
+	return n, true
+}
+
+func parseSegment(name string, data []byte) ([]web.BundleFile, error) {
+	var files []web.BundleFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		f := web.BundleFile{}
+		err := dec.Decode(&f)
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, badBundle("%s: %v", name, err)
+		}
+		if err := CheckFile(f); err != nil {
+			return nil, badBundle("%s: file %s: %v", name, f.ID, err)
+		}
+		files = append(files, f)
+	}
+}
+
+// CheckFile applies the rules a manifest commit does to one imported or replicated file.
+func CheckFile(f web.BundleFile) error {
+	if f.ID == uuid.Nil || f.Filename == "" || len(f.Filename) > 1024 || helper.ReservedFilename(f.Filename) {
+		return errors.New("bad id or filename")
+	}
+	if f.CreatedAt.IsZero() || f.UpdatedAt.IsZero() {
+		return errors.New("missing timestamps")
+	}
+	if err := helper.ValidateLabels(f.Metadata, f.Tags); err != nil {
+		return errors.New("bad metadata or tags")
+	}
+	total, err := manifest.CheckChunks(f.Chunks)
+	if err != nil || total != f.TotalSize {
+		return errors.New("chunk list does not add up to total_size")
+	}
+	return nil
+}
+
+func (b *BundleServiceImpl) importChunk(hash string, data []byte, present map[string]bool, resp *web.BundleImportResponse) error {
+	if !helper.HashRegex().MatchString(hash) || len(data) == 0 {
+		return badBundle("%s%s: bad chunk name or empty chunk", ChunkPrefix, hash)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != hash {
+		return badBundle("%s%s: %v", ChunkPrefix, hash, manifest.ErrChunkMismatch)
+	}
+	if present[hash] {
+		resp.ChunksPresent++
+		return nil
+	}
+	ok, err := b.ChunkStore.Exists(hash)
+	if err != nil {
+		b.Logger.Error("bundle_import_err", slog.String("stage", "exists"), slog.String("hash", hash), slog.Any("err", err))
+		return helper.ErrInternal
+	}
+	if ok {
+		resp.ChunksPresent++
+	} else {
+		if err := b.ChunkStore.Put(hash, bytes.NewReader(data), int64(len(data))); err != nil {
+			b.Logger.Error("bundle_import_err", slog.String("stage", "put"), slog.String("hash", hash), slog.Any("err", err))
+			return helper.ErrInternal
+		}
+		resp.ChunksStored++
+		resp.BytesStored += int64(len(data))
+		metrics.BytesUploadedTotal.Add(float64(len(data)))
+	}
+	present[hash] = true
+	return nil
+}
+
+// importSegment creates one segment's files in a transaction and returns how many were new.
+// * chunk blobs are written before the rows that reference them, as the upload path does
+func (b *BundleServiceImpl) importSegment(ctx context.Context, name string, files []web.BundleFile, present map[string]bool) (int64, error) {
+	for _, f := range files {
+		for _, c := range f.Chunks {
+			if present[c.Hash] {
+				continue
+			}
+			ok, err := b.ChunkStore.Exists(c.Hash)
+			if err != nil {
+				b.Logger.Error("bundle_import_err", slog.String("stage", "exists"), slog.String("hash", c.Hash), slog.Any("err", err))
+				return 0, helper.ErrInternal
+			}
+			if !ok {
+				return 0, badBundle("%s: file %s needs chunk %s, which neither the bundle nor the store has", name, f.ID, c.Hash)
+			}
+			present[c.Hash] = true
+		}
+	}
+
+	tx, err := b.DB.Begin(ctx)
+	if err != nil {
+		return 0, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var created int64
+	for _, f := range files {
+		inserted, err := b.FileRepository.Import(ctx, tx, domain.File{
+			ID:          f.ID,
+			Filename:    f.Filename,
+			TotalSize:   f.TotalSize,
+			ContentType: f.ContentType,
+			CreatedAt:   f.CreatedAt,
+			UpdatedAt:   f.UpdatedAt,
+			ExpiresAt:   f.ExpiresAt,
+			Metadata:    f.Metadata,
+			Tags:        f.Tags,
+		})
+		if err != nil {
+			b.Logger.Error("bundle_import_err", slog.String("stage", "create_file_row"), slog.String("file_id", f.ID.String()), slog.Any("err", err))
+			return 0, helper.ErrInternal
+		}
+		if !inserted {
+			continue
+		}
+
+		seen := make(map[string]bool, len(f.Chunks))
+		var chunks []domain.Chunk
+		manifest := make([]domain.FileChunk, len(f.Chunks))
+		for i, c := range f.Chunks {
+			manifest[i] = domain.FileChunk{FileID: f.ID, Idx: int64(i), ChunkHash: c.Hash, Size: c.Size}
+			if !seen[c.Hash] {
+				seen[c.Hash] = true
+				chunks = append(chunks, domain.Chunk{Hash: c.Hash, Size: c.Size})
+			}
+		}
+		for i := 0; i < len(chunks); i += helper.BatchSize {
+			end := min(i+helper.BatchSize, len(chunks))
+			if _, err := b.ChunkRepository.UpsertMany(ctx, tx, chunks[i:end]); err != nil {
+				b.Logger.Error("bundle_import_err", slog.String("stage", "upsert_chunks"), slog.String("file_id", f.ID.String()), slog.Any("err", err))
+				return 0, helper.ErrInternal
+			}
+		}
+		for i := 0; i < len(manifest); i += helper.BatchSize {
+			end := min(i+helper.BatchSize, len(manifest))
+			if err := b.FileChunkRepository.AddChunks(ctx, tx, f.ID, manifest[i:end]); err != nil {
+				b.Logger.Error("bundle_import_err", slog.String("stage", "add_chunks"), slog.String("file_id", f.ID.String()), slog.Any("err", err))
+				return 0, helper.ErrInternal
+			}
+		}
+		created++
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, helper.ErrInternal
+	}
+	return created, nil
+}
@@ -0,0 +1,282 @@
+package dav
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+	"io"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"os"
+	"path"
+	"time"
+)
+
+// fileInfo is the os.FileInfo webdav renders into PROPFIND responses. It also answers the
+// content type and ETag from the file row, so webdav never has to open the file to sniff them.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	file    domain.File
+}
+
+func newFileInfo(name string, file domain.File) *fileInfo {
+	return &fileInfo{name: name, size: file.TotalSize, modTime: file.UpdatedAt, file: file}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() any           { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *fileInfo) ContentType(_ context.Context) (string, error) {
+	if fi.dir || fi.file.ContentType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.file.ContentType, nil
+}
+
+// * every write produces a new file row, so the row id is a strong validator
+func (fi *fileInfo) ETag(_ context.Context) (string, error) {
+	if fi.dir || fi.file.ID == uuid.Nil {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.file.ID.String() + `"`, nil
+}
+
+// davFile is a file or directory opened for reading. File reads stream from the current offset
+// through DownloadService.StreamRange; a seek to a new offset restarts the stream there.
+type davFile struct {
+	service  *DavServiceImpl
+	ctx      context.Context
+	filename string
+	info     *fileInfo
+
+	offset int64
+	stream *io.PipeReader
+	cancel context.CancelFunc
+
+	children []os.FileInfo
+	listed   bool
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if f.info.dir {
+		return 0, os.ErrInvalid
+	}
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+	if f.stream == nil {
+		f.startStream()
+	}
+	n, err := f.stream.Read(p)
+	f.offset += int64(n)
+	if errors.Is(err, io.EOF) && f.offset < f.info.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (f *davFile) startStream() {
+	ctx, cancel := context.WithCancel(f.ctx)
+	pr, pw := io.Pipe()
+	id, offset := f.info.file.ID, f.offset
+	go func() {
+		pw.CloseWithError(f.service.DownloadService.StreamRange(ctx, id, offset, -1, pw))
+	}()
+	f.stream, f.cancel = pr, cancel
+}
+
+func (f *davFile) stopStream() {
+	if f.stream == nil {
+		return
+	}
+	f.cancel()
+	_ = f.stream.Close()
+	f.stream, f.cancel = nil, nil
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if f.info.dir {
+		return 0, os.ErrInvalid
+	}
+	next := offset
+	switch whence {
+	case io.SeekCurrent:
+		next += f.offset
+	case io.SeekEnd:
+		next += f.info.size
+	}
+	if next < 0 {
+		return 0, os.ErrInvalid
+	}
+	if next != f.offset {
+		f.stopStream()
+		f.offset = next
+	}
+	return next, nil
+}
+
+// Readdir follows os.File: count <= 0 returns everything left, otherwise at most count entries
+// and io.EOF once the directory is exhausted.
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.dir {
+		return nil, os.ErrInvalid
+	}
+	if !f.listed {
+		children, err := f.service.readdir(f.ctx, f.filename)
+		if err != nil {
+			return nil, err
+		}
+		f.children, f.listed = children, true
+	}
+	if count <= 0 {
+		out := f.children
+		f.children = nil
+		return out, nil
+	}
+	if len(f.children) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(f.children))
+	out := f.children[:n]
+	f.children = f.children[n:]
+	return out, nil
+}
+
+func (f *davFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *davFile) Write(_ []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (f *davFile) Close() error {
+	f.stopStream()
+	return nil
+}
+
+type uploadResult struct {
+	id  uuid.UUID
+	err error
+}
+
+// davWriter is a file opened for writing. Bytes written are piped into the upload pipeline as a
+// new file that replaces the path's current one on Close. When webdav's COPY feeds it another
+// davFile, nothing is streamed: Close clones the source manifest instead.
+type davWriter struct {
+	service  *DavServiceImpl
+	ctx      context.Context
+	filename string
+	modTime  time.Time
+
+	written int64
+	pipe    *io.PipeWriter
+	done    chan uploadResult
+	clone   *davFile
+	failed  error
+	closed  bool
+}
+
+func (w *davWriter) start() {
+	pr, pw := io.Pipe()
+	w.pipe, w.done = pw, make(chan uploadResult, 1)
+	go func() {
+		resp, err := w.service.UploadService.Upload(w.ctx, web.UploadRequest{
+			Ctx:      w.ctx,
+			FileName: w.filename,
+			Reader:   pr,
+		})
+		// * unblock the writer if the upload gave up before reading everything
+		pr.CloseWithError(err)
+		w.done <- uploadResult{id: resp.FileID, err: err}
+	}()
+}
+
+func (w *davWriter) Write(p []byte) (int, error) {
+	if w.clone != nil || w.failed != nil {
+		return 0, os.ErrInvalid
+	}
+	if w.pipe == nil {
+		w.start()
+	}
+	n, err := w.pipe.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// ReadFrom is what io.Copy uses. A whole-file copy from another davFile becomes a manifest
+// clone; anything else is streamed, and a failed read aborts the upload on Close instead of
+// committing a truncated file.
+func (w *davWriter) ReadFrom(r io.Reader) (int64, error) {
+	if src, ok := r.(*davFile); ok && !src.info.dir && src.offset == 0 && w.pipe == nil && w.clone == nil {
+		w.clone = src
+		w.written = src.info.size
+		return src.info.size, nil
+	}
+	n, err := io.Copy(struct{ io.Writer }{w}, r)
+	if err != nil {
+		w.failed = err
+	}
+	return n, err
+}
+
+func (w *davWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var id uuid.UUID
+	var err error
+	switch {
+	case w.failed != nil:
+		if w.pipe != nil {
+			w.pipe.CloseWithError(w.failed)
+			<-w.done
+		}
+		return w.failed
+	case w.clone != nil:
+		id, err = w.service.cloneFile(w.ctx, w.clone.info.file, w.filename)
+	case w.pipe == nil:
+		id, err = w.service.createEmpty(w.ctx, w.filename)
+	default:
+		_ = w.pipe.Close()
+		res := <-w.done
+		id, err = res.id, res.err
+	}
+	if err != nil {
+		return err
+	}
+	w.service.replaceOlder(w.ctx, w.filename, id)
+	return nil
+}
+
+func (w *davWriter) Stat() (os.FileInfo, error) {
+	return &fileInfo{name: path.Base(w.filename), size: w.written, modTime: w.modTime}, nil
+}
+
+func (w *davWriter) Read(_ []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (w *davWriter) Seek(_ int64, _ int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (w *davWriter) Readdir(_ int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
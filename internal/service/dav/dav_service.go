@@ -0,0 +1,10 @@
+package dav
+
+import "golang.org/x/net/webdav"
+
+// DavService is the ByteSize file tree as seen by WebDAV clients. Paths map to filenames
+// ("/a/b.txt" is the file named "a/b.txt"); directories are implied by "/" in filenames, and
+// empty ones are kept alive by a zero-byte marker file named "<dir>/".
+type DavService interface {
+	webdav.FileSystem
+}
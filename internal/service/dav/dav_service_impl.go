@@ -0,0 +1,362 @@
+package dav
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/webdav"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/repository"
+	deletefile "meliocool/bytesize/internal/service/delete"
+	"meliocool/bytesize/internal/service/download"
+	"meliocool/bytesize/internal/service/upload"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+type DavServiceImpl struct {
+	UploadService       upload.UploadService
+	DownloadService     download.DownloadService
+	DeleteService       deletefile.DeleteService
+	FileRepository      repository.FileRepository
+	FileChunkRepository repository.FileChunkRepository
+	DB                  *pgxpool.Pool
+	Logger              *slog.Logger
+}
+
+func NewDavService(
+	uploadService upload.UploadService,
+	downloadService download.DownloadService,
+	deleteService deletefile.DeleteService,
+	fileRepository repository.FileRepository,
+	fileChunkRepository repository.FileChunkRepository,
+	db *pgxpool.Pool,
+	logger *slog.Logger,
+) DavService {
+	return &DavServiceImpl{
+		UploadService:       uploadService,
+		DownloadService:     downloadService,
+		DeleteService:       deleteService,
+		FileRepository:      fileRepository,
+		FileChunkRepository: fileChunkRepository,
+		DB:                  db,
+		Logger:              logger,
+	}
+}
+
+// fileName maps a WebDAV path to a filename; the root maps to "".
+func fileName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// * gateway bookkeeping (S3 multipart parts, tus uploads) is not part of the visible tree
+func hidden(filename string) bool {
+	return helper.ReservedFilename(filename)
+}
+
+func (d *DavServiceImpl) Mkdir(ctx context.Context, name string, _ os.FileMode) error {
+	fn := fileName(name)
+	if fn == "" {
+		return os.ErrExist
+	}
+	if hidden(fn) {
+		return os.ErrPermission
+	}
+	if _, err := d.stat(ctx, fn); err == nil {
+		return os.ErrExist
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := d.requireParent(ctx, fn); err != nil {
+		return err
+	}
+
+	tx, err := d.DB.Begin(ctx)
+	if err != nil {
+		return helper.ErrInternal
+	}
+	_, err = d.FileRepository.Create(ctx, tx, domain.File{Filename: fn + "/", ContentType: helper.DirectoryContentType})
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return helper.ErrInternal
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return helper.ErrInternal
+	}
+	return nil
+}
+
+func (d *DavServiceImpl) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	fn := fileName(name)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		info, err := d.stat(ctx, fn)
+		if err != nil {
+			return nil, err
+		}
+		return &davFile{service: d, ctx: ctx, filename: fn, info: info}, nil
+	}
+
+	if fn == "" || hidden(fn) || flag&os.O_APPEND != 0 {
+		return nil, os.ErrPermission
+	}
+	info, err := d.stat(ctx, fn)
+	if err == nil && info.IsDir() {
+		return nil, os.ErrPermission
+	}
+	if err == nil && flag&os.O_EXCL != 0 {
+		return nil, os.ErrExist
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := d.requireParent(ctx, fn); err != nil {
+		return nil, err
+	}
+	return &davWriter{service: d, ctx: ctx, filename: fn, modTime: time.Now()}, nil
+}
+
+func (d *DavServiceImpl) RemoveAll(ctx context.Context, name string) error {
+	fn := fileName(name)
+	if fn == "" || hidden(fn) {
+		return os.ErrPermission
+	}
+
+	tx, err := d.DB.Begin(ctx)
+	if err != nil {
+		return helper.ErrInternal
+	}
+	files, err := d.FileRepository.FindByFilename(ctx, tx, fn)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return helper.ErrInternal
+	}
+	children, err := d.FileRepository.List(ctx, tx, domain.FileFilter{Prefix: fn + "/"})
+	_ = tx.Rollback(ctx)
+	if err != nil {
+		return helper.ErrInternal
+	}
+
+	for _, f := range append(files, children...) {
+		if _, err := d.DeleteService.Delete(ctx, f.ID); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename moves a file, or a directory with everything under it, by rewriting filenames in
+// one transaction. No chunk data moves.
+func (d *DavServiceImpl) Rename(ctx context.Context, oldName string, newName string) error {
+	from, to := fileName(oldName), fileName(newName)
+	if from == "" || to == "" || hidden(from) || hidden(to) || strings.HasPrefix(to+"/", from+"/") {
+		return os.ErrPermission
+	}
+	if err := d.requireParent(ctx, to); err != nil {
+		return err
+	}
+
+	tx, err := d.DB.Begin(ctx)
+	if err != nil {
+		return helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	files, err := d.FileRepository.FindByFilename(ctx, tx, from)
+	if err != nil {
+		return helper.ErrInternal
+	}
+	children, err := d.FileRepository.List(ctx, tx, domain.FileFilter{Prefix: from + "/"})
+	if err != nil {
+		return helper.ErrInternal
+	}
+	if len(files) == 0 && len(children) == 0 {
+		return os.ErrNotExist
+	}
+
+	for _, f := range files {
+		if _, err := d.FileRepository.UpdateFilename(ctx, tx, f.ID, to); err != nil {
+			return helper.ErrInternal
+		}
+	}
+	for _, f := range children {
+		if _, err := d.FileRepository.UpdateFilename(ctx, tx, f.ID, to+"/"+strings.TrimPrefix(f.Filename, from+"/")); err != nil {
+			return helper.ErrInternal
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return helper.ErrInternal
+	}
+	return nil
+}
+
+func (d *DavServiceImpl) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return d.stat(ctx, fileName(name))
+}
+
+// stat resolves fn to the newest file with that name or, failing that, to a directory if any
+// filename lives under it.
+func (d *DavServiceImpl) stat(ctx context.Context, fn string) (*fileInfo, error) {
+	if fn == "" {
+		return &fileInfo{name: "/", dir: true, modTime: time.Now()}, nil
+	}
+	if hidden(fn) {
+		return nil, os.ErrNotExist
+	}
+
+	tx, err := d.DB.Begin(ctx)
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	files, err := d.FileRepository.FindByFilename(ctx, tx, fn)
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+	if len(files) > 0 {
+		return newFileInfo(path.Base(fn), files[0]), nil
+	}
+	children, err := d.FileRepository.List(ctx, tx, domain.FileFilter{Prefix: fn + "/"})
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+	if len(children) == 0 {
+		return nil, os.ErrNotExist
+	}
+	// * listings come newest first, so a directory's mtime is its most recent change
+	return &fileInfo{name: path.Base(fn), dir: true, modTime: children[0].UpdatedAt}, nil
+}
+
+// requireParent reports os.ErrNotExist unless fn's parent directory exists, which webdav turns
+// into 409 Conflict as RFC 4918 asks for.
+func (d *DavServiceImpl) requireParent(ctx context.Context, fn string) error {
+	parent := path.Dir(fn)
+	if parent == "." {
+		return nil
+	}
+	info, err := d.stat(ctx, parent)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// readdir lists the direct children of directory dir: the newest version of each file plus one
+// entry per subdirectory.
+func (d *DavServiceImpl) readdir(ctx context.Context, dir string) ([]os.FileInfo, error) {
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	tx, err := d.DB.Begin(ctx)
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+	files, err := d.FileRepository.List(ctx, tx, domain.FileFilter{Prefix: prefix})
+	_ = tx.Rollback(ctx)
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+
+	seen := make(map[string]bool)
+	var out []os.FileInfo
+	for _, f := range files {
+		rest := strings.TrimPrefix(f.Filename, prefix)
+		if rest == "" || hidden(f.Filename) {
+			continue
+		}
+		child, _, nested := strings.Cut(rest, "/")
+		if child == "" || seen[child] {
+			continue
+		}
+		seen[child] = true
+		if nested {
+			out = append(out, &fileInfo{name: child, dir: true, modTime: f.UpdatedAt})
+		} else {
+			out = append(out, newFileInfo(child, f))
+		}
+	}
+	slices.SortFunc(out, func(a, b os.FileInfo) int { return strings.Compare(a.Name(), b.Name()) })
+	return out, nil
+}
+
+// cloneFile creates dst as a copy of src by duplicating its manifest rows: content addressing
+// means the copy shares every chunk with the source.
+func (d *DavServiceImpl) cloneFile(ctx context.Context, src domain.File, dst string) (uuid.UUID, error) {
+	tx, err := d.DB.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	file, err := d.FileRepository.Create(ctx, tx, domain.File{
+		Filename:    dst,
+		TotalSize:   src.TotalSize,
+		ContentType: src.ContentType,
+		ExpiresAt:   src.ExpiresAt,
+		Metadata:    src.Metadata,
+		Tags:        src.Tags,
+	})
+	if err != nil {
+		return uuid.Nil, helper.ErrInternal
+	}
+	if _, err := d.FileChunkRepository.CloneManifest(ctx, tx, src.ID, file.ID); err != nil {
+		return uuid.Nil, helper.ErrInternal
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, helper.ErrInternal
+	}
+	metrics.DavCopiedBytesTotal.Add(float64(src.TotalSize))
+	return file.ID, nil
+}
+
+func (d *DavServiceImpl) createEmpty(ctx context.Context, filename string) (uuid.UUID, error) {
+	tx, err := d.DB.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, helper.ErrInternal
+	}
+	file, err := d.FileRepository.Create(ctx, tx, domain.File{Filename: filename})
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return uuid.Nil, helper.ErrInternal
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, helper.ErrInternal
+	}
+	return file.ID, nil
+}
+
+// replaceOlder deletes every other file named filename once a write has landed, so the tree
+// keeps one file per path. A failure only leaves an older version behind that reads never see.
+func (d *DavServiceImpl) replaceOlder(ctx context.Context, filename string, keep uuid.UUID) {
+	tx, err := d.DB.Begin(ctx)
+	if err != nil {
+		d.Logger.Error("dav_replace_err", slog.String("filename", filename), slog.Any("err", err))
+		return
+	}
+	files, err := d.FileRepository.FindByFilename(ctx, tx, filename)
+	_ = tx.Rollback(ctx)
+	if err != nil {
+		d.Logger.Error("dav_replace_err", slog.String("filename", filename), slog.Any("err", err))
+		return
+	}
+	for _, f := range files {
+		if f.ID == keep {
+			continue
+		}
+		if _, err := d.DeleteService.Delete(ctx, f.ID); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			d.Logger.Error("dav_replace_err", slog.String("filename", filename), slog.String("file_id", f.ID.String()), slog.Any("err", err))
+		}
+	}
+}
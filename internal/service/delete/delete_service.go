@@ -7,4 +7,5 @@ import (
 
 type DeleteService interface {
 	Delete(ctx context.Context, id uuid.UUID) (Result, error)
+	PurgeExpired(ctx context.Context, limit int) (PurgeResult, error)
 }
@@ -3,8 +3,10 @@ package delete
 import (
 	"context"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
 	"meliocool/bytesize/internal/repository"
 	"meliocool/bytesize/internal/storage"
 )
@@ -15,15 +17,22 @@ type Result struct {
 	OrphanBytesDeleted  int64     `json:"orphan_bytes_deleted"`
 }
 
+type PurgeResult struct {
+	FilesDeleted        int64 `json:"files_deleted"`
+	OrphanChunksDeleted int64 `json:"orphan_chunks_deleted"`
+	OrphanBytesDeleted  int64 `json:"orphan_bytes_deleted"`
+}
+
 type DeleteServiceImpl struct {
 	FileRepo      repository.FileRepository
 	FileChunkRepo repository.FileChunkRepository
+	ChunkRepo     repository.ChunkRepository
 	ChunkStore    storage.ChunkStore
 	DB            *pgxpool.Pool
 }
 
-func NewDeleteService(fileRepo repository.FileRepository, fileChunkRepo repository.FileChunkRepository, chunkStore storage.ChunkStore, db *pgxpool.Pool) DeleteService {
-	return &DeleteServiceImpl{FileRepo: fileRepo, FileChunkRepo: fileChunkRepo, ChunkStore: chunkStore, DB: db}
+func NewDeleteService(fileRepo repository.FileRepository, fileChunkRepo repository.FileChunkRepository, chunkRepo repository.ChunkRepository, chunkStore storage.ChunkStore, db *pgxpool.Pool) DeleteService {
+	return &DeleteServiceImpl{FileRepo: fileRepo, FileChunkRepo: fileChunkRepo, ChunkRepo: chunkRepo, ChunkStore: chunkStore, DB: db}
 }
 
 func (s *DeleteServiceImpl) Delete(ctx context.Context, id uuid.UUID) (Result, error) {
@@ -37,13 +46,65 @@ func (s *DeleteServiceImpl) Delete(ctx context.Context, id uuid.UUID) (Result, e
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	_, err = s.FileRepo.FindByID(ctx, tx, id)
+	// * no FindByID here: it hides expired rows, and those must stay deletable by hand
+	res, err := s.deleteFile(ctx, tx, id)
 	if err != nil {
-		if err == helper.ErrNotFound {
-			return Result{}, helper.ErrNotFound
+		return Result{}, err
+	}
+	metrics.ReclaimedBytesTotal.WithLabelValues("delete").Add(float64(res.OrphanBytesDeleted))
+	return res, nil
+}
+
+// PurgeExpired deletes up to limit files past their expires_at, one transaction per file.
+func (s *DeleteServiceImpl) PurgeExpired(ctx context.Context, limit int) (PurgeResult, error) {
+	if limit <= 0 {
+		return PurgeResult{}, helper.ErrInvalidInput
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return PurgeResult{}, helper.ErrInternal
+	}
+	expired, err := s.FileRepo.ListExpired(ctx, tx, limit)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return PurgeResult{}, helper.ErrInternal
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return PurgeResult{}, helper.ErrInternal
+	}
+
+	var out PurgeResult
+	for _, f := range expired {
+		if ctx.Err() != nil {
+			return out, ctx.Err()
 		}
-		return Result{}, helper.ErrInternal
+		ftx, err := s.DB.Begin(ctx)
+		if err != nil {
+			return out, helper.ErrInternal
+		}
+		res, err := s.deleteFile(ctx, ftx, f.ID)
+		if err != nil {
+			_ = ftx.Rollback(ctx)
+			// * another reaper (or a manual delete) got there first
+			if err == helper.ErrNotFound {
+				continue
+			}
+			return out, err
+		}
+		out.FilesDeleted++
+		out.OrphanChunksDeleted += res.OrphanChunksDeleted
+		out.OrphanBytesDeleted += res.OrphanBytesDeleted
 	}
+
+	metrics.ExpiredFilesReapedTotal.Add(float64(out.FilesDeleted))
+	metrics.ReclaimedBytesTotal.WithLabelValues("expiry").Add(float64(out.OrphanBytesDeleted))
+	return out, nil
+}
+
+// deleteFile removes the file row (manifest cascades), garbage-collects orphan chunk rows,
+// commits tx and then removes the orphaned chunk blobs from the store.
+func (s *DeleteServiceImpl) deleteFile(ctx context.Context, tx pgx.Tx, id uuid.UUID) (Result, error) {
 	manifest, err := s.FileChunkRepo.FindByFileID(ctx, tx, id)
 	if err != nil {
 		return Result{}, helper.ErrInternal
@@ -66,15 +127,11 @@ func (s *DeleteServiceImpl) Delete(ctx context.Context, id uuid.UUID) (Result, e
 	var orphanHashes []string
 	var orphanBytes int64
 	for h, sz := range seen {
-		cmd, derr := tx.Exec(ctx, `
-            DELETE FROM chunks c
-            WHERE c.hash = $1
-              AND NOT EXISTS (SELECT 1 FROM file_chunks fc WHERE fc.chunk_hash = $1)
-        `, h)
+		orphan, derr := s.ChunkRepo.DeleteOrphan(ctx, tx, h)
 		if derr != nil {
 			return Result{}, helper.ErrInternal
 		}
-		if cmd.RowsAffected() > 0 {
+		if orphan {
 			orphanHashes = append(orphanHashes, h)
 			orphanBytes += sz
 		}
@@ -0,0 +1,65 @@
+package delete
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Reaper periodically purges expired files through DeleteService.PurgeExpired.
+type Reaper struct {
+	Service   DeleteService
+	Interval  time.Duration
+	BatchSize int
+	Logger    *slog.Logger
+}
+
+func NewReaper(service DeleteService, interval time.Duration, batchSize int, logger *slog.Logger) *Reaper {
+	return &Reaper{
+		Service:   service,
+		Interval:  interval,
+		BatchSize: batchSize,
+		Logger:    logger,
+	}
+}
+
+// Run blocks until ctx is cancelled, sweeping once per Interval.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep keeps purging full batches so a backlog of expired files drains in one tick.
+func (r *Reaper) sweep(ctx context.Context) {
+	for {
+		start := time.Now()
+		res, err := r.Service.PurgeExpired(ctx, r.BatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.Logger.Error("reaper_err", slog.String("stage", "purge_expired"), slog.Any("err", err))
+			}
+			return
+		}
+		if res.FilesDeleted > 0 {
+			r.Logger.Info(
+				"reaper_ok",
+				slog.Int64("files_deleted", res.FilesDeleted),
+				slog.Int64("orphan_chunks_deleted", res.OrphanChunksDeleted),
+				slog.Int64("orphan_bytes_deleted", res.OrphanBytesDeleted),
+				slog.Duration("took", time.Since(start)),
+			)
+		}
+		if res.FilesDeleted < int64(r.BatchSize) {
+			return
+		}
+	}
+}
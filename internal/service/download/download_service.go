@@ -8,4 +8,5 @@ import (
 
 type DownloadService interface {
 	Stream(ctx context.Context, fileID uuid.UUID, w io.Writer) error
+	StreamRange(ctx context.Context, fileID uuid.UUID, offset int64, length int64, w io.Writer) error
 }
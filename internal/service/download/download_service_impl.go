@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"meliocool/bytesize/internal/helper"
 	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
 	"meliocool/bytesize/internal/repository"
 	"meliocool/bytesize/internal/storage"
 	"time"
@@ -17,24 +18,34 @@ type DownloadServiceImpl struct {
 	FileRepository      repository.FileRepository
 	FileChunkRepository repository.FileChunkRepository
 	ChunkStore          storage.ChunkStore
+	PrefetchDepth       int
 	DB                  *pgxpool.Pool
 	Logger              *slog.Logger
 }
 
-func NewDownloadService(fileRepository repository.FileRepository, fileChunkRepository repository.FileChunkRepository, chunkStore storage.ChunkStore, db *pgxpool.Pool, logger *slog.Logger) DownloadService {
+// NewDownloadService builds the download service. prefetchDepth is how many chunks Stream
+// fetches ahead of the writer; 0 picks the chunk store's default (storage.PrefetchDepth).
+func NewDownloadService(fileRepository repository.FileRepository, fileChunkRepository repository.FileChunkRepository, chunkStore storage.ChunkStore, prefetchDepth int, db *pgxpool.Pool, logger *slog.Logger) DownloadService {
 	return &DownloadServiceImpl{
 		FileRepository:      fileRepository,
 		FileChunkRepository: fileChunkRepository,
 		ChunkStore:          chunkStore,
+		PrefetchDepth:       prefetchDepth,
 		DB:                  db,
 		Logger:              logger,
 	}
 }
 
 func (d *DownloadServiceImpl) Stream(ctx context.Context, fileID uuid.UUID, w io.Writer) error {
+	return d.StreamRange(ctx, fileID, 0, -1, w)
+}
+
+// StreamRange writes length bytes of the file starting at offset; length < 0 means to the end.
+// Only the chunks overlapping the range are fetched.
+func (d *DownloadServiceImpl) StreamRange(ctx context.Context, fileID uuid.UUID, offset int64, length int64, w io.Writer) error {
 	start := time.Now()
 	metrics.RequestsTotal.WithLabelValues("download").Inc()
-	defer metrics.RequestDuration.WithLabelValues("download").Observe(time.Since(start).Seconds())
+	defer func() { metrics.RequestDuration.WithLabelValues("download").Observe(time.Since(start).Seconds()) }()
 	d.Logger.Info("download_start", slog.String("file_id", fileID.String()))
 
 	if fileID == uuid.Nil {
@@ -97,45 +108,57 @@ func (d *DownloadServiceImpl) Stream(ctx context.Context, fileID uuid.UUID, w io
 		return helper.ErrInternal
 	}
 
-	byteSize := helper.StreamByteSize
-	if byteSize <= 0 {
-		byteSize = 64 * 1024
+	if length < 0 {
+		length = totalSize - offset
+	}
+	if offset < 0 || offset > totalSize || offset+length > totalSize {
+		metrics.ErrorsTotal.WithLabelValues("download").Inc()
+		return helper.ErrInvalidInput
 	}
+	selected, skip := sliceManifest(manifest, offset, length)
+
+	depth := d.PrefetchDepth
+	if depth <= 0 {
+		depth = storage.PrefetchDepth(d.ChunkStore)
+	}
+
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	futures := prefetchChunks(fetchCtx, d.ChunkStore, selected, depth)
 
-	buffer := make([]byte, byteSize)
 	var writtenTotal int64 = 0
 
-	for _, fc := range manifest {
-		if ctx.Err() != nil {
+	for _, fc := range selected {
+		result, ok := <-futures
+		if !ok {
 			return ctx.Err()
 		}
-		rc, _, getErr := d.ChunkStore.Get(fc.ChunkHash)
-		if getErr != nil {
-			d.Logger.Error("download_err", slog.String("stage", "chunk_get"), slog.String("file_id", fileID.String()), slog.String("hash", fc.ChunkHash), slog.Any("err", getErr))
-			metrics.ErrorsTotal.WithLabelValues("download").Inc()
-			return helper.ErrInternal
-		}
-		n, copyErr := io.CopyBuffer(w, rc, buffer)
-		closeErr := rc.Close()
-		if closeErr != nil {
+		fetched := awaitChunk(ctx, result)
+		if fetched.err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			d.Logger.Error("download_err", slog.String("stage", "chunk_get"), slog.String("file_id", fileID.String()), slog.String("hash", fc.ChunkHash), slog.Any("err", fetched.err))
 			metrics.ErrorsTotal.WithLabelValues("download").Inc()
 			return helper.ErrInternal
 		}
-		if copyErr != nil {
-			d.Logger.Error("download_err", slog.String("stage", "copy"), slog.String("file_id", fileID.String()), slog.String("hash", fc.ChunkHash), slog.Any("err", copyErr))
-			metrics.ErrorsTotal.WithLabelValues("download").Inc()
-			return helper.ErrInternal
+		data := fetched.data[skip:]
+		skip = 0
+		if remaining := length - writtenTotal; int64(len(data)) > remaining {
+			data = data[:remaining]
 		}
-		if fc.Size != n {
+		n, writeErr := w.Write(data)
+		if writeErr != nil {
+			d.Logger.Error("download_err", slog.String("stage", "copy"), slog.String("file_id", fileID.String()), slog.String("hash", fc.ChunkHash), slog.Any("err", writeErr))
 			metrics.ErrorsTotal.WithLabelValues("download").Inc()
 			return helper.ErrInternal
 		}
-		writtenTotal += n
+		writtenTotal += int64(n)
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
 	}
-	if writtenTotal != totalSize {
+	if writtenTotal != length {
 		metrics.ErrorsTotal.WithLabelValues("download").Inc()
 		return helper.ErrInternal
 	}
@@ -143,6 +166,7 @@ func (d *DownloadServiceImpl) Stream(ctx context.Context, fileID uuid.UUID, w io
 		"download_ok",
 		slog.String("file_id", fileID.String()),
 		slog.Int64("total_size", totalSize),
+		slog.Int64("written", writtenTotal),
 		slog.Duration("took", time.Since(start)),
 	)
 
@@ -150,3 +174,30 @@ func (d *DownloadServiceImpl) Stream(ctx context.Context, fileID uuid.UUID, w io
 
 	return nil
 }
+
+// sliceManifest returns the chunks overlapping [offset, offset+length) and how many bytes of
+// the first one precede offset.
+func sliceManifest(manifest []domain.FileChunk, offset int64, length int64) ([]domain.FileChunk, int64) {
+	if length == 0 {
+		return nil, 0
+	}
+	var pos int64
+	first, last := -1, -1
+	var skip int64
+	for i, fc := range manifest {
+		end := pos + fc.Size
+		if first < 0 && end > offset {
+			first = i
+			skip = offset - pos
+		}
+		if end >= offset+length {
+			last = i
+			break
+		}
+		pos = end
+	}
+	if first < 0 || last < 0 {
+		return nil, 0
+	}
+	return manifest[first : last+1], skip
+}
@@ -0,0 +1,72 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/storage"
+	"time"
+)
+
+type fetchedChunk struct {
+	data []byte
+	err  error
+}
+
+// prefetchChunks fetches manifest chunks up to depth ahead of the consumer and yields them in
+// manifest order. Each pending chunk owns a one-slot result channel; the futures channel
+// holds at most depth of them, which bounds buffered memory to about depth chunks.
+// Cancelling ctx stops the producer and any fetch that has not started.
+func prefetchChunks(ctx context.Context, store storage.ChunkStore, manifest []domain.FileChunk, depth int) <-chan chan fetchedChunk {
+	futures := make(chan chan fetchedChunk, max(depth-1, 0))
+	go func() {
+		defer close(futures)
+		for _, fc := range manifest {
+			result := make(chan fetchedChunk, 1)
+			select {
+			case futures <- result:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				if ctx.Err() != nil {
+					result <- fetchedChunk{err: ctx.Err()}
+					return
+				}
+				result <- fetchChunk(store, fc)
+			}()
+		}
+	}()
+	return futures
+}
+
+func fetchChunk(store storage.ChunkStore, fc domain.FileChunk) fetchedChunk {
+	rc, _, err := store.Get(fc.ChunkHash)
+	if err != nil {
+		return fetchedChunk{err: fmt.Errorf("chunk_get %s: %w", fc.ChunkHash, err)}
+	}
+	defer rc.Close()
+	data := make([]byte, fc.Size)
+	if _, err := io.ReadFull(rc, data); err != nil {
+		return fetchedChunk{err: fmt.Errorf("chunk_read %s: %w", fc.ChunkHash, err)}
+	}
+	// * a longer blob than the manifest says is as wrong as a shorter one
+	if n, _ := rc.Read(make([]byte, 1)); n > 0 {
+		return fetchedChunk{err: fmt.Errorf("chunk_read %s: longer than %d bytes", fc.ChunkHash, fc.Size)}
+	}
+	return fetchedChunk{data: data}
+}
+
+// awaitChunk waits for the next prefetched chunk and records how long the writer stalled.
+func awaitChunk(ctx context.Context, result chan fetchedChunk) fetchedChunk {
+	start := time.Now()
+	select {
+	case fetched := <-result:
+		metrics.DownloadPrefetchWaitSeconds.Observe(time.Since(start).Seconds())
+		return fetched
+	case <-ctx.Done():
+		return fetchedChunk{err: ctx.Err()}
+	}
+}
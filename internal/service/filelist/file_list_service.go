@@ -1,7 +1,10 @@
 package filelist
 
-import "context"
+import (
+	"context"
+	"meliocool/bytesize/internal/model/domain"
+)
 
 type FileListService interface {
-	List(ctx context.Context) ([]FileDTO, error)
+	List(ctx context.Context, filter domain.FileFilter) ([]FileDTO, error)
 }
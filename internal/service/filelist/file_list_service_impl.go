@@ -5,16 +5,21 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/domain"
 	"meliocool/bytesize/internal/repository"
 	"time"
 )
 
 type FileDTO struct {
-	ID        uuid.UUID
-	Filename  string
-	TotalSize int64
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          uuid.UUID
+	Filename    string
+	TotalSize   int64
+	ContentType string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ExpiresAt   *time.Time
+	Metadata    map[string]string
+	Tags        []string
 }
 
 type FileListServiceImpl struct {
@@ -29,12 +34,15 @@ func NewFileListService(fileRepo repository.FileRepository, db *pgxpool.Pool) Fi
 	}
 }
 
-func (s *FileListServiceImpl) List(ctx context.Context) ([]FileDTO, error) {
+func (s *FileListServiceImpl) List(ctx context.Context, filter domain.FileFilter) ([]FileDTO, error) {
+	if err := helper.ValidateLabels(filter.Metadata, filter.Tags); err != nil {
+		return nil, helper.ErrInvalidInput
+	}
 	tx, err := s.DB.Begin(ctx)
 	if err != nil {
 		return nil, helper.ErrInternal
 	}
-	files, qerr := s.FileRepository.List(ctx, tx)
+	files, qerr := s.FileRepository.List(ctx, tx, filter)
 	if qerr != nil {
 		_ = tx.Rollback(ctx)
 		return nil, helper.ErrInternal
@@ -46,11 +54,15 @@ func (s *FileListServiceImpl) List(ctx context.Context) ([]FileDTO, error) {
 	out := make([]FileDTO, 0, len(files))
 	for _, f := range files {
 		out = append(out, FileDTO{
-			ID:        f.ID,
-			Filename:  f.Filename,
-			TotalSize: f.TotalSize,
-			CreatedAt: f.CreatedAt,
-			UpdatedAt: f.UpdatedAt,
+			ID:          f.ID,
+			Filename:    f.Filename,
+			TotalSize:   f.TotalSize,
+			ContentType: f.ContentType,
+			CreatedAt:   f.CreatedAt,
+			UpdatedAt:   f.UpdatedAt,
+			ExpiresAt:   f.ExpiresAt,
+			Metadata:    f.Metadata,
+			Tags:        f.Tags,
 		})
 	}
 	return out, nil
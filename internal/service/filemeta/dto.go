@@ -9,7 +9,11 @@ type MetaDataDTO struct {
 	ID          uuid.UUID
 	Filename    string
 	TotalSize   int64
+	ContentType string
 	ChunksCount int64
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	ExpiresAt   *time.Time
+	Metadata    map[string]string
+	Tags        []string
 }
@@ -3,8 +3,10 @@ package filemeta
 import (
 	"context"
 	"github.com/google/uuid"
+	"meliocool/bytesize/internal/model/web"
 )
 
 type FileMetaDataService interface {
 	GetMeta(ctx context.Context, fileID uuid.UUID) (MetaDataDTO, error)
+	UpdateMeta(ctx context.Context, fileID uuid.UUID, req web.MetadataPatchRequest) (MetaDataDTO, error)
 }
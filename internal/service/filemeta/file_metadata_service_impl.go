@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"meliocool/bytesize/internal/helper"
 	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/web"
 	"meliocool/bytesize/internal/repository"
 	"time"
 )
@@ -31,7 +32,7 @@ func NewFileMetaDataService(fileRepository repository.FileRepository, fileChunkR
 func (f *FileMetaDataServiceImpl) GetMeta(ctx context.Context, fileID uuid.UUID) (MetaDataDTO, error) {
 	start := time.Now()
 	metrics.RequestsTotal.WithLabelValues("filemeta").Inc()
-	defer metrics.RequestDuration.WithLabelValues("filemeta").Observe(time.Since(start).Seconds())
+	defer func() { metrics.RequestDuration.WithLabelValues("filemeta").Observe(time.Since(start).Seconds()) }()
 	f.Logger.Info("meta_start", slog.String("file_id", fileID.String()))
 
 	if fileID == uuid.Nil {
@@ -75,9 +76,13 @@ func (f *FileMetaDataServiceImpl) GetMeta(ctx context.Context, fileID uuid.UUID)
 		ID:          fileRow.ID,
 		Filename:    fileRow.Filename,
 		TotalSize:   fileRow.TotalSize,
+		ContentType: fileRow.ContentType,
 		ChunksCount: chunksCount,
 		CreatedAt:   fileRow.CreatedAt,
 		UpdatedAt:   fileRow.UpdatedAt,
+		ExpiresAt:   fileRow.ExpiresAt,
+		Metadata:    fileRow.Metadata,
+		Tags:        fileRow.Tags,
 	}
 
 	f.Logger.Info(
@@ -90,3 +95,99 @@ func (f *FileMetaDataServiceImpl) GetMeta(ctx context.Context, fileID uuid.UUID)
 
 	return MetaData, nil
 }
+
+func (f *FileMetaDataServiceImpl) UpdateMeta(ctx context.Context, fileID uuid.UUID, req web.MetadataPatchRequest) (MetaDataDTO, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("filemeta_patch").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("filemeta_patch").Observe(time.Since(start).Seconds()) }()
+	f.Logger.Info("meta_patch_start", slog.String("file_id", fileID.String()))
+
+	if fileID == uuid.Nil {
+		metrics.ErrorsTotal.WithLabelValues("filemeta_patch").Inc()
+		return MetaDataDTO{}, helper.ErrInvalidInput
+	}
+
+	set := make(map[string]string)
+	var remove []string
+	for k, v := range req.Metadata {
+		// * the gateway and tus keep their state under reserved keys that clients must not rewrite
+		if helper.ReservedMetadataKey(k) {
+			metrics.ErrorsTotal.WithLabelValues("filemeta_patch").Inc()
+			return MetaDataDTO{}, helper.ErrInvalidInput
+		}
+		if v == nil {
+			remove = append(remove, k)
+			continue
+		}
+		set[k] = *v
+	}
+	var tags []string
+	if req.Tags != nil {
+		tags = helper.SplitTags(*req.Tags)
+	}
+	if err := helper.ValidateLabels(set, tags); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("filemeta_patch").Inc()
+		return MetaDataDTO{}, helper.ErrInvalidInput
+	}
+	if err := helper.ValidateLabels(nil, remove); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("filemeta_patch").Inc()
+		return MetaDataDTO{}, helper.ErrInvalidInput
+	}
+
+	tx, dbErr := f.DB.Begin(ctx)
+	if dbErr != nil {
+		metrics.ErrorsTotal.WithLabelValues("filemeta_patch").Inc()
+		return MetaDataDTO{}, helper.ErrInternal
+	}
+	fileRow, err := f.FileRepository.UpdateMetadata(ctx, tx, fileID, set, remove, tags)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		f.Logger.Error("meta_patch_err", slog.String("stage", "update_metadata"), slog.String("file_id", fileID.String()), slog.Any("err", err))
+		metrics.ErrorsTotal.WithLabelValues("filemeta_patch").Inc()
+		if errors.Is(err, helper.ErrNotFound) {
+			return MetaDataDTO{}, helper.ErrNotFound
+		}
+		if errors.Is(err, helper.ErrInvalidInput) {
+			return MetaDataDTO{}, helper.ErrInvalidInput
+		}
+		return MetaDataDTO{}, helper.ErrInternal
+	}
+	if len(fileRow.Metadata) > helper.MaxMetadataEntries || len(fileRow.Tags) > helper.MaxTags {
+		_ = tx.Rollback(ctx)
+		metrics.ErrorsTotal.WithLabelValues("filemeta_patch").Inc()
+		return MetaDataDTO{}, helper.ErrInvalidInput
+	}
+	manifest, err := f.FileChunkRepository.FindByFileID(ctx, tx, fileID)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		f.Logger.Error("meta_patch_err", slog.String("stage", "find_manifest"), slog.String("file_id", fileID.String()), slog.Any("err", err))
+		metrics.ErrorsTotal.WithLabelValues("filemeta_patch").Inc()
+		return MetaDataDTO{}, helper.ErrInternal
+	}
+	if commErr := tx.Commit(ctx); commErr != nil {
+		f.Logger.Error("meta_patch_err", slog.String("stage", "commit"), slog.String("file_id", fileID.String()), slog.Any("err", commErr))
+		metrics.ErrorsTotal.WithLabelValues("filemeta_patch").Inc()
+		return MetaDataDTO{}, helper.ErrInternal
+	}
+
+	f.Logger.Info(
+		"meta_patch_ok",
+		slog.String("file_id", fileID.String()),
+		slog.Int("metadata_set", len(set)),
+		slog.Int("metadata_removed", len(remove)),
+		slog.Duration("took", time.Since(start)),
+	)
+
+	return MetaDataDTO{
+		ID:          fileRow.ID,
+		Filename:    fileRow.Filename,
+		TotalSize:   fileRow.TotalSize,
+		ContentType: fileRow.ContentType,
+		ChunksCount: int64(len(manifest)),
+		CreatedAt:   fileRow.CreatedAt,
+		UpdatedAt:   fileRow.UpdatedAt,
+		ExpiresAt:   fileRow.ExpiresAt,
+		Metadata:    fileRow.Metadata,
+		Tags:        fileRow.Tags,
+	}, nil
+}
@@ -0,0 +1,35 @@
+package filemeta
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/web"
+	"testing"
+)
+
+func TestUpdateMetaRejectsReservedKeys(t *testing.T) {
+	// * the keys are refused before the database is touched, so the service needs none
+	service := NewFileMetaDataService(nil, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	value := "forged"
+	for _, key := range []string{"s3:etag", "S3:Key", "tus:upload-id", "TUS:length"} {
+		for _, patch := range []map[string]*string{{key: &value}, {key: nil}} {
+			_, err := service.UpdateMeta(context.Background(), uuid.New(), web.MetadataPatchRequest{Metadata: patch})
+			if !errors.Is(err, helper.ErrInvalidInput) {
+				t.Fatalf("patch %q (remove=%v) = %v; want ErrInvalidInput", key, patch[key] == nil, err)
+			}
+		}
+	}
+}
+
+func TestUpdateMetaRejectsKeysDifferingOnlyInCase(t *testing.T) {
+	service := NewFileMetaDataService(nil, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	a, b := "1", "2"
+	_, err := service.UpdateMeta(context.Background(), uuid.New(), web.MetadataPatchRequest{Metadata: map[string]*string{"Owner": &a, "owner": &b}})
+	if !errors.Is(err, helper.ErrInvalidInput) {
+		t.Fatalf("patch with Owner and owner = %v; want ErrInvalidInput", err)
+	}
+}
@@ -0,0 +1,18 @@
+package manifest
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"io"
+	"meliocool/bytesize/internal/model/web"
+)
+
+// ManifestService lets a client that chunks and hashes files itself upload only the chunks
+// the store lacks, then commit a file from their hashes.
+type ManifestService interface {
+	Admit() (func(), error)
+	Missing(ctx context.Context, hashes []string) ([]string, error)
+	PutChunk(ctx context.Context, hash string, body io.Reader) (bool, error)
+	Commit(ctx context.Context, req web.ManifestCommitRequest) (web.UploadResponse, error)
+	Get(ctx context.Context, fileID uuid.UUID) ([]web.ManifestChunk, error)
+}
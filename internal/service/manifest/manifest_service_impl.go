@@ -0,0 +1,417 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/repository"
+	deletefile "meliocool/bytesize/internal/service/delete"
+	"meliocool/bytesize/internal/service/upload"
+	"meliocool/bytesize/internal/storage"
+	"time"
+)
+
+var ErrChunkMismatch = errors.New("chunk body does not match its hash")
+var ErrChunkSizeMismatch = errors.New("chunk size does not match the stored chunk")
+
+// MissingChunksError is a commit that names chunks the store does not hold; the client uploads
+// them and commits again.
+type MissingChunksError struct {
+	Hashes []string
+}
+
+func (e *MissingChunksError) Error() string {
+	return "manifest references missing chunks"
+}
+
+type ManifestServiceImpl struct {
+	UploadService       upload.UploadService
+	DeleteService       deletefile.DeleteService
+	FileRepository      repository.FileRepository
+	FileChunkRepository repository.FileChunkRepository
+	ChunkRepository     repository.ChunkRepository
+	ChunkStore          storage.ChunkStore
+	DB                  *pgxpool.Pool
+	Validate            *validator.Validate
+	Logger              *slog.Logger
+}
+
+func NewManifestService(
+	uploadService upload.UploadService,
+	deleteService deletefile.DeleteService,
+	fileRepository repository.FileRepository,
+	fileChunkRepository repository.FileChunkRepository,
+	chunkRepository repository.ChunkRepository,
+	chunkStore storage.ChunkStore,
+	db *pgxpool.Pool,
+	validate *validator.Validate,
+	logger *slog.Logger,
+) ManifestService {
+	return &ManifestServiceImpl{
+		UploadService:       uploadService,
+		DeleteService:       deleteService,
+		FileRepository:      fileRepository,
+		FileChunkRepository: fileChunkRepository,
+		ChunkRepository:     chunkRepository,
+		ChunkStore:          chunkStore,
+		DB:                  db,
+		Validate:            validate,
+		Logger:              logger,
+	}
+}
+
+func (m *ManifestServiceImpl) Admit() (func(), error) {
+	return m.UploadService.Admit()
+}
+
+// Missing returns the hashes the chunk store does not hold, in request order without repeats.
+// * like the upload store workers, presence is the blob in the store; rows are written on commit
+func (m *ManifestServiceImpl) Missing(ctx context.Context, hashes []string) ([]string, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("chunk_missing").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("chunk_missing").Observe(time.Since(start).Seconds()) }()
+
+	missing, err := m.missing(hashes)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("chunk_missing").Inc()
+		return nil, err
+	}
+	return missing, nil
+}
+
+func (m *ManifestServiceImpl) missing(hashes []string) ([]string, error) {
+	if len(hashes) > helper.MaxMissingHashes {
+		return nil, helper.ErrInvalidInput
+	}
+	regex := helper.HashRegex()
+	seen := make(map[string]bool, len(hashes))
+	missing := []string{}
+	for _, hash := range hashes {
+		if !regex.MatchString(hash) {
+			return nil, helper.ErrInvalidInput
+		}
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		ok, err := m.ChunkStore.Exists(hash)
+		if err != nil {
+			m.Logger.Error("manifest_err", slog.String("stage", "exists"), slog.String("hash", hash), slog.Any("err", err))
+			return nil, helper.ErrInternal
+		}
+		if !ok {
+			missing = append(missing, hash)
+		}
+	}
+	return missing, nil
+}
+
+// PutChunk stores one chunk after checking body against hash. It reports whether the chunk was
+// written; a chunk the store already holds is left alone.
+// * the chunk gets its row from the Commit that references it; a chunk no commit ever
+// * references has no row, so file deletes and the reaper never collect it (see README)
+func (m *ManifestServiceImpl) PutChunk(ctx context.Context, hash string, body io.Reader) (bool, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("chunk_put").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("chunk_put").Observe(time.Since(start).Seconds()) }()
+
+	if !helper.HashRegex().MatchString(hash) {
+		metrics.ErrorsTotal.WithLabelValues("chunk_put").Inc()
+		return false, helper.ErrInvalidInput
+	}
+	data, err := io.ReadAll(io.LimitReader(body, helper.ChunkSize+1))
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("chunk_put").Inc()
+		return false, err
+	}
+	if len(data) == 0 {
+		metrics.ErrorsTotal.WithLabelValues("chunk_put").Inc()
+		return false, helper.ErrInvalidInput
+	}
+	if len(data) > helper.ChunkSize {
+		metrics.ErrorsTotal.WithLabelValues("chunk_put").Inc()
+		return false, helper.ErrTooLarge
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != hash {
+		metrics.ErrorsTotal.WithLabelValues("chunk_put").Inc()
+		return false, ErrChunkMismatch
+	}
+
+	ok, err := m.ChunkStore.Exists(hash)
+	if err != nil {
+		m.Logger.Error("manifest_err", slog.String("stage", "exists"), slog.String("hash", hash), slog.Any("err", err))
+		metrics.ErrorsTotal.WithLabelValues("chunk_put").Inc()
+		return false, helper.ErrInternal
+	}
+	if ok {
+		return false, nil
+	}
+	if err := m.ChunkStore.Put(hash, bytes.NewReader(data), int64(len(data))); err != nil {
+		m.Logger.Error("manifest_err", slog.String("stage", "put"), slog.String("hash", hash), slog.Any("err", err))
+		metrics.ErrorsTotal.WithLabelValues("chunk_put").Inc()
+		return false, helper.ErrInternal
+	}
+	metrics.BytesUploadedTotal.Add(float64(len(data)))
+	return true, nil
+}
+
+// Commit creates a file whose manifest is req.Chunks, in one transaction. Every chunk must
+// already be in the store; otherwise it returns a *MissingChunksError and writes nothing.
+func (m *ManifestServiceImpl) Commit(ctx context.Context, req web.ManifestCommitRequest) (web.UploadResponse, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("manifest_commit").Inc()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues("manifest_commit").Observe(time.Since(start).Seconds())
+	}()
+
+	resp, err := m.commit(ctx, req)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("manifest_commit").Inc()
+		return web.UploadResponse{}, err
+	}
+	if req.Replace {
+		m.replaceOlder(ctx, req.Filename, resp.FileID)
+	}
+	return resp, nil
+}
+
+func (m *ManifestServiceImpl) commit(ctx context.Context, req web.ManifestCommitRequest) (web.UploadResponse, error) {
+	if err := m.Validate.Struct(req); err != nil || helper.ReservedFilename(req.Filename) {
+		return web.UploadResponse{}, helper.ErrInvalidInput
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return web.UploadResponse{}, helper.ErrInvalidInput
+	}
+	if err := helper.ValidateLabels(req.Metadata, req.Tags); err != nil {
+		return web.UploadResponse{}, err
+	}
+
+	totalSize, err := CheckChunks(req.Chunks)
+	if err != nil {
+		return web.UploadResponse{}, err
+	}
+
+	seen := make(map[string]bool, len(req.Chunks))
+	var hashes []string
+	var chunks []domain.Chunk
+	for _, c := range req.Chunks {
+		if !seen[c.Hash] {
+			seen[c.Hash] = true
+			hashes = append(hashes, c.Hash)
+			chunks = append(chunks, domain.Chunk{Hash: c.Hash, Size: c.Size})
+		}
+	}
+	missing, err := m.missing(hashes)
+	if err != nil {
+		return web.UploadResponse{}, err
+	}
+	if len(missing) > 0 {
+		return web.UploadResponse{}, &MissingChunksError{Hashes: missing}
+	}
+
+	if req.ContentType == "" {
+		req.ContentType, err = m.sniff(req.Chunks)
+		if err != nil {
+			m.Logger.Error("manifest_err", slog.String("stage", "sniff"), slog.String("filename", req.Filename), slog.Any("err", err))
+			return web.UploadResponse{}, helper.ErrInternal
+		}
+	}
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return web.UploadResponse{}, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := m.checkSizes(ctx, tx, chunks); err != nil {
+		return web.UploadResponse{}, err
+	}
+
+	file, err := m.FileRepository.Create(ctx, tx, domain.File{
+		Filename:    req.Filename,
+		ContentType: req.ContentType,
+		ExpiresAt:   req.ExpiresAt,
+		Metadata:    req.Metadata,
+		Tags:        req.Tags,
+	})
+	if err != nil {
+		m.Logger.Error("manifest_err", slog.String("stage", "create_file_row"), slog.String("filename", req.Filename), slog.Any("err", err))
+		return web.UploadResponse{}, helper.ErrInternal
+	}
+
+	manifest := make([]domain.FileChunk, len(req.Chunks))
+	for i, c := range req.Chunks {
+		manifest[i] = domain.FileChunk{FileID: file.ID, Idx: int64(i), ChunkHash: c.Hash, Size: c.Size}
+	}
+	for i := 0; i < len(chunks); i += helper.BatchSize {
+		end := min(i+helper.BatchSize, len(chunks))
+		if _, err := m.ChunkRepository.UpsertMany(ctx, tx, chunks[i:end]); err != nil {
+			m.Logger.Error("manifest_err", slog.String("stage", "upsert_chunks"), slog.String("file_id", file.ID.String()), slog.Any("err", err))
+			return web.UploadResponse{}, helper.ErrInternal
+		}
+	}
+	for i := 0; i < len(manifest); i += helper.BatchSize {
+		end := min(i+helper.BatchSize, len(manifest))
+		if err := m.FileChunkRepository.AddChunks(ctx, tx, file.ID, manifest[i:end]); err != nil {
+			m.Logger.Error("manifest_err", slog.String("stage", "add_chunks"), slog.String("file_id", file.ID.String()), slog.Any("err", err))
+			return web.UploadResponse{}, helper.ErrInternal
+		}
+	}
+	if err := m.FileRepository.UpdateTotals(ctx, tx, file.ID, totalSize); err != nil {
+		return web.UploadResponse{}, helper.ErrInternal
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return web.UploadResponse{}, helper.ErrInternal
+	}
+
+	return web.UploadResponse{
+		FileID:      file.ID,
+		Filename:    file.Filename,
+		TotalSize:   totalSize,
+		ContentType: file.ContentType,
+		ChunksCount: int64(len(manifest)),
+	}, nil
+}
+
+// CheckChunks validates a client-built chunk list and returns the file size it describes.
+// * the chunk boundaries must be the upload chunker's, or these chunks would never dedupe against uploads
+func CheckChunks(chunks []web.ManifestChunk) (int64, error) {
+	regex := helper.HashRegex()
+	var totalSize int64
+	for i, c := range chunks {
+		last := i == len(chunks)-1
+		if !regex.MatchString(c.Hash) || c.Size <= 0 || c.Size > helper.ChunkSize || (!last && c.Size != helper.ChunkSize) {
+			return 0, helper.ErrInvalidInput
+		}
+		totalSize += c.Size
+	}
+	if totalSize > helper.MaxBytes {
+		return 0, helper.ErrTooLarge
+	}
+	return totalSize, nil
+}
+
+// checkSizes rejects chunks whose claimed size differs from the chunk's row or, for a hash
+// with no row yet, from the stored blob. UpsertMany keeps an existing row as it is, so a wrong
+// size would otherwise only surface as a short or corrupt download.
+func (m *ManifestServiceImpl) checkSizes(ctx context.Context, tx pgx.Tx, chunks []domain.Chunk) error {
+	for i := 0; i < len(chunks); i += helper.BatchSize {
+		batch := chunks[i:min(i+helper.BatchSize, len(chunks))]
+		hashes := make([]string, len(batch))
+		for j, c := range batch {
+			hashes[j] = c.Hash
+		}
+		sizes, err := m.ChunkRepository.FindSizes(ctx, tx, hashes)
+		if err != nil {
+			m.Logger.Error("manifest_err", slog.String("stage", "find_sizes"), slog.Any("err", err))
+			return helper.ErrInternal
+		}
+		for _, c := range batch {
+			size, ok := sizes[c.Hash]
+			if !ok {
+				rc, stored, err := m.ChunkStore.Get(c.Hash)
+				if errors.Is(err, storage.ErrChunkNotFound) {
+					return &MissingChunksError{Hashes: []string{c.Hash}}
+				}
+				if err != nil {
+					m.Logger.Error("manifest_err", slog.String("stage", "stat_chunk"), slog.String("hash", c.Hash), slog.Any("err", err))
+					return helper.ErrInternal
+				}
+				_ = rc.Close()
+				size = stored
+			}
+			if size != c.Size {
+				return ErrChunkSizeMismatch
+			}
+		}
+	}
+	return nil
+}
+
+// sniff detects the content type from the head of the first chunk, as Upload does.
+func (m *ManifestServiceImpl) sniff(chunks []web.ManifestChunk) (string, error) {
+	if len(chunks) == 0 {
+		return mimetype.Detect(nil).String(), nil
+	}
+	rc, _, err := m.ChunkStore.Get(chunks[0].Hash)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	head := make([]byte, helper.SniffBytes)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return mimetype.Detect(head[:n]).String(), nil
+}
+
+// replaceOlder deletes every other file named filename. Failures only leave an older version
+// behind, so they are logged rather than returned.
+func (m *ManifestServiceImpl) replaceOlder(ctx context.Context, filename string, keep uuid.UUID) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		m.Logger.Error("manifest_replace_err", slog.String("filename", filename), slog.Any("err", err))
+		return
+	}
+	files, err := m.FileRepository.FindByFilename(ctx, tx, filename)
+	_ = tx.Rollback(ctx)
+	if err != nil {
+		m.Logger.Error("manifest_replace_err", slog.String("filename", filename), slog.Any("err", err))
+		return
+	}
+	for _, f := range files {
+		if f.ID == keep {
+			continue
+		}
+		if _, err := m.DeleteService.Delete(ctx, f.ID); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			m.Logger.Error("manifest_replace_err", slog.String("filename", filename), slog.String("file_id", f.ID.String()), slog.Any("err", err))
+		}
+	}
+}
+
+// Get returns a file's chunks in order, so a client can tell which of them it already has.
+func (m *ManifestServiceImpl) Get(ctx context.Context, fileID uuid.UUID) ([]web.ManifestChunk, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("manifest_get").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("manifest_get").Observe(time.Since(start).Seconds()) }()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("manifest_get").Inc()
+		return nil, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := m.FileRepository.FindByID(ctx, tx, fileID); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("manifest_get").Inc()
+		if errors.Is(err, helper.ErrNotFound) {
+			return nil, helper.ErrNotFound
+		}
+		return nil, helper.ErrInternal
+	}
+	rows, err := m.FileChunkRepository.FindByFileID(ctx, tx, fileID)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("manifest_get").Inc()
+		return nil, helper.ErrInternal
+	}
+	chunks := make([]web.ManifestChunk, len(rows))
+	for i, r := range rows {
+		chunks[i] = web.ManifestChunk{Hash: r.ChunkHash, Size: r.Size}
+	}
+	return chunks, nil
+}
@@ -0,0 +1,249 @@
+package object
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"strings"
+	"time"
+)
+
+// * an in-progress multipart upload is a marker file plus one file per part under helper.MultipartPrefix.
+// * Both carry an expiry, so the reaper cleans up uploads that are never completed or aborted.
+const multipartContentType = "application/x-bytesize-multipart"
+
+var (
+	ErrNoSuchUpload     = errors.New("no such upload")
+	ErrInvalidPart      = errors.New("invalid part")
+	ErrInvalidPartOrder = errors.New("invalid part order")
+)
+
+func markerName(uploadID string) string {
+	return helper.MultipartPrefix + uploadID + "/upload"
+}
+
+func partName(uploadID string, partNumber int) string {
+	return fmt.Sprintf("%s%s/part-%05d", helper.MultipartPrefix, uploadID, partNumber)
+}
+
+func (o *ObjectServiceImpl) CreateMultipart(ctx context.Context, key string, contentType string, metadata map[string]string) (string, error) {
+	if key == "" || len(key) > 1024 || helper.ReservedFilename(key) {
+		return "", helper.ErrInvalidInput
+	}
+	if err := helper.ValidateLabels(metadata, nil); err != nil {
+		return "", err
+	}
+	uploadID := uuid.NewString()
+	marker := map[string]string{metaKey: key, metaContentType: contentType}
+	for k, v := range metadata {
+		if strings.HasPrefix(k, "s3:") {
+			return "", helper.ErrInvalidInput
+		}
+		marker[k] = v
+	}
+	expiresAt := time.Now().Add(helper.MultipartUploadTTL)
+
+	tx, err := o.DB.Begin(ctx)
+	if err != nil {
+		return "", helper.ErrInternal
+	}
+	_, err = o.FileRepository.Create(ctx, tx, domain.File{
+		Filename:    markerName(uploadID),
+		ContentType: multipartContentType,
+		ExpiresAt:   &expiresAt,
+		Metadata:    marker,
+	})
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return "", helper.ErrInternal
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", helper.ErrInternal
+	}
+	return uploadID, nil
+}
+
+func (o *ObjectServiceImpl) PutPart(ctx context.Context, uploadID string, partNumber int, r io.Reader) (Info, error) {
+	if partNumber < 1 || partNumber > helper.MaxMultipartParts {
+		return Info{}, helper.ErrInvalidInput
+	}
+	marker, err := o.marker(ctx, uploadID)
+	if err != nil {
+		return Info{}, err
+	}
+
+	name := partName(uploadID, partNumber)
+	info, err := o.store(ctx, web.UploadRequest{
+		Ctx:           ctx,
+		FileName:      name,
+		ContentType:   multipartContentType,
+		ExpiresAt:     marker.ExpiresAt,
+		AllowReserved: true,
+	}, r)
+	if err != nil {
+		return Info{}, err
+	}
+	// * re-uploading a part number replaces the earlier attempt
+	o.replaceOlder(ctx, name, info.ID)
+	return info, nil
+}
+
+// CompleteMultipart stitches the parts' manifests into one new file in a single transaction.
+// No chunk data is copied: the object references the chunks the parts already stored.
+func (o *ObjectServiceImpl) CompleteMultipart(ctx context.Context, uploadID string, key string, parts []web.S3CompletedPart) (Info, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("s3_complete_multipart").Inc()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues("s3_complete_multipart").Observe(time.Since(start).Seconds())
+	}()
+
+	info, err := o.completeMultipart(ctx, uploadID, key, parts)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("s3_complete_multipart").Inc()
+		return Info{}, err
+	}
+	o.replaceOlder(ctx, key, info.ID)
+	if err := o.AbortMultipart(ctx, uploadID); err != nil {
+		o.Logger.Error("s3_multipart_cleanup_err", slog.String("upload_id", uploadID), slog.Any("err", err))
+	}
+	return info, nil
+}
+
+func (o *ObjectServiceImpl) completeMultipart(ctx context.Context, uploadID string, key string, parts []web.S3CompletedPart) (Info, error) {
+	if len(parts) == 0 {
+		return Info{}, ErrInvalidPart
+	}
+	marker, err := o.marker(ctx, uploadID)
+	if err != nil {
+		return Info{}, err
+	}
+	if marker.Metadata[metaKey] != key {
+		return Info{}, ErrNoSuchUpload
+	}
+
+	tx, err := o.DB.Begin(ctx)
+	if err != nil {
+		return Info{}, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// * the multipart ETag is the MD5 of the concatenated binary part MD5s, suffixed with the part count
+	etagSum := md5.New()
+	var manifest []domain.FileChunk
+	var total int64
+	for i, p := range parts {
+		if i > 0 && p.PartNumber <= parts[i-1].PartNumber {
+			return Info{}, ErrInvalidPartOrder
+		}
+		versions, err := o.FileRepository.FindByFilename(ctx, tx, partName(uploadID, p.PartNumber))
+		if err != nil {
+			return Info{}, helper.ErrInternal
+		}
+		if len(versions) == 0 {
+			return Info{}, ErrInvalidPart
+		}
+		part := versions[0]
+		etag := part.Metadata[metaETag]
+		if etag == "" || strings.Trim(p.ETag, `"`) != etag {
+			return Info{}, ErrInvalidPart
+		}
+		raw, err := hex.DecodeString(etag)
+		if err != nil {
+			return Info{}, ErrInvalidPart
+		}
+		etagSum.Write(raw)
+
+		chunks, err := o.FileChunkRepository.FindByFileID(ctx, tx, part.ID)
+		if err != nil {
+			return Info{}, helper.ErrInternal
+		}
+		manifest = append(manifest, chunks...)
+		total += part.TotalSize
+	}
+
+	metadata := make(map[string]string)
+	for k, v := range marker.Metadata {
+		if !strings.HasPrefix(k, "s3:") {
+			metadata[k] = v
+		}
+	}
+	metadata[metaETag] = fmt.Sprintf("%s-%d", hex.EncodeToString(etagSum.Sum(nil)), len(parts))
+
+	file, err := o.FileRepository.Create(ctx, tx, domain.File{
+		Filename:    key,
+		ContentType: marker.Metadata[metaContentType],
+		Metadata:    metadata,
+	})
+	if err != nil {
+		return Info{}, helper.ErrInternal
+	}
+	for i := range manifest {
+		manifest[i].FileID = file.ID
+		manifest[i].Idx = int64(i)
+	}
+	for i := 0; i < len(manifest); i += helper.BatchSize {
+		end := min(i+helper.BatchSize, len(manifest))
+		if err := o.FileChunkRepository.AddChunks(ctx, tx, file.ID, manifest[i:end]); err != nil {
+			return Info{}, helper.ErrInternal
+		}
+	}
+	if err := o.FileRepository.UpdateTotals(ctx, tx, file.ID, total); err != nil {
+		return Info{}, helper.ErrInternal
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Info{}, helper.ErrInternal
+	}
+	file.TotalSize = total
+	return newInfo(file), nil
+}
+
+// AbortMultipart deletes the upload's parts and its marker; the marker goes last so a failed
+// abort can be retried.
+func (o *ObjectServiceImpl) AbortMultipart(ctx context.Context, uploadID string) error {
+	if _, err := o.marker(ctx, uploadID); err != nil {
+		return err
+	}
+	files, err := o.list(ctx, helper.MultipartPrefix+uploadID+"/")
+	if err != nil {
+		return err
+	}
+	var marker *domain.File
+	for i, f := range files {
+		if f.Filename == markerName(uploadID) {
+			marker = &files[i]
+			continue
+		}
+		if _, err := o.DeleteService.Delete(ctx, f.ID); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			return err
+		}
+	}
+	if marker != nil {
+		if _, err := o.DeleteService.Delete(ctx, marker.ID); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *ObjectServiceImpl) marker(ctx context.Context, uploadID string) (domain.File, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return domain.File{}, ErrNoSuchUpload
+	}
+	file, err := o.latest(ctx, markerName(uploadID))
+	if err != nil {
+		if errors.Is(err, helper.ErrNotFound) {
+			return domain.File{}, ErrNoSuchUpload
+		}
+		return domain.File{}, err
+	}
+	return file, nil
+}
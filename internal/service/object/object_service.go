@@ -0,0 +1,21 @@
+package object
+
+import (
+	"context"
+	"io"
+	"meliocool/bytesize/internal/model/web"
+)
+
+type ObjectService interface {
+	Admit() (func(), error)
+	Put(ctx context.Context, req web.ObjectPutRequest) (Info, error)
+	Head(ctx context.Context, key string) (Info, error)
+	Stream(ctx context.Context, info Info, offset int64, length int64, w io.Writer) error
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]Info, error)
+	Buckets(ctx context.Context) ([]Bucket, error)
+	CreateMultipart(ctx context.Context, key string, contentType string, metadata map[string]string) (string, error)
+	PutPart(ctx context.Context, uploadID string, partNumber int, r io.Reader) (Info, error)
+	CompleteMultipart(ctx context.Context, uploadID string, key string, parts []web.S3CompletedPart) (Info, error)
+	AbortMultipart(ctx context.Context, uploadID string) error
+}
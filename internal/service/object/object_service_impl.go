@@ -0,0 +1,290 @@
+package object
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/repository"
+	deletefile "meliocool/bytesize/internal/service/delete"
+	"meliocool/bytesize/internal/service/download"
+	"meliocool/bytesize/internal/service/upload"
+	"slices"
+	"strings"
+	"time"
+)
+
+// * gateway bookkeeping lives in metadata under the "s3:" namespace and is hidden from clients
+const (
+	metaETag        = "s3:etag"
+	metaKey         = "s3:key"
+	metaContentType = "s3:content-type"
+)
+
+// Info describes the current version of an object: the newest visible file with that name.
+type Info struct {
+	ID           uuid.UUID
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	Metadata     map[string]string
+}
+
+type Bucket struct {
+	Name      string
+	CreatedAt time.Time
+}
+
+func newInfo(file domain.File) Info {
+	metadata := make(map[string]string)
+	for k, v := range file.Metadata {
+		if !strings.HasPrefix(k, "s3:") {
+			metadata[k] = v
+		}
+	}
+	return Info{
+		ID:           file.ID,
+		Key:          file.Filename,
+		Size:         file.TotalSize,
+		ContentType:  file.ContentType,
+		ETag:         file.Metadata[metaETag],
+		LastModified: file.CreatedAt,
+		Metadata:     metadata,
+	}
+}
+
+// ObjectServiceImpl maps S3 object semantics onto ByteSize files: an object key is a filename,
+// a PUT uploads a new file and then deletes the older files with that name, and reads go to
+// the newest one. Bodies still flow through the normal chunk/dedupe pipeline.
+type ObjectServiceImpl struct {
+	UploadService       upload.UploadService
+	DownloadService     download.DownloadService
+	DeleteService       deletefile.DeleteService
+	FileRepository      repository.FileRepository
+	FileChunkRepository repository.FileChunkRepository
+	DB                  *pgxpool.Pool
+	Validate            *validator.Validate
+	Logger              *slog.Logger
+}
+
+func NewObjectService(
+	uploadService upload.UploadService,
+	downloadService download.DownloadService,
+	deleteService deletefile.DeleteService,
+	fileRepository repository.FileRepository,
+	fileChunkRepository repository.FileChunkRepository,
+	db *pgxpool.Pool,
+	validate *validator.Validate,
+	logger *slog.Logger,
+) ObjectService {
+	return &ObjectServiceImpl{
+		UploadService:       uploadService,
+		DownloadService:     downloadService,
+		DeleteService:       deleteService,
+		FileRepository:      fileRepository,
+		FileChunkRepository: fileChunkRepository,
+		DB:                  db,
+		Validate:            validate,
+		Logger:              logger,
+	}
+}
+
+func (o *ObjectServiceImpl) Admit() (func(), error) {
+	return o.UploadService.Admit()
+}
+
+func (o *ObjectServiceImpl) Put(ctx context.Context, req web.ObjectPutRequest) (Info, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("s3_put").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("s3_put").Observe(time.Since(start).Seconds()) }()
+
+	if err := o.Validate.Struct(req); err != nil || helper.ReservedFilename(req.Key) {
+		metrics.ErrorsTotal.WithLabelValues("s3_put").Inc()
+		return Info{}, helper.ErrInvalidInput
+	}
+	for k := range req.Metadata {
+		if strings.HasPrefix(k, "s3:") {
+			metrics.ErrorsTotal.WithLabelValues("s3_put").Inc()
+			return Info{}, helper.ErrInvalidInput
+		}
+	}
+
+	info, err := o.store(ctx, web.UploadRequest{
+		Ctx:         ctx,
+		FileName:    req.Key,
+		ContentType: req.ContentType,
+		Metadata:    req.Metadata,
+	}, req.Reader)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("s3_put").Inc()
+		return Info{}, err
+	}
+	o.replaceOlder(ctx, req.Key, info.ID)
+	return info, nil
+}
+
+func (o *ObjectServiceImpl) Head(ctx context.Context, key string) (Info, error) {
+	file, err := o.latest(ctx, key)
+	if err != nil {
+		return Info{}, err
+	}
+	return newInfo(file), nil
+}
+
+func (o *ObjectServiceImpl) Stream(ctx context.Context, info Info, offset int64, length int64, w io.Writer) error {
+	return o.DownloadService.StreamRange(ctx, info.ID, offset, length, w)
+}
+
+// Delete removes every file with this name. Deleting a missing key is not an error, as in S3.
+func (o *ObjectServiceImpl) Delete(ctx context.Context, key string) error {
+	files, err := o.findByName(ctx, key)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if _, err := o.DeleteService.Delete(ctx, f.ID); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the current version of every object whose key starts with prefix, sorted by key.
+func (o *ObjectServiceImpl) List(ctx context.Context, prefix string) ([]Info, error) {
+	files, err := o.list(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	// * files come newest first, so the first row per name is the current version
+	seen := make(map[string]bool)
+	var out []Info
+	for _, f := range files {
+		if seen[f.Filename] || helper.ReservedFilename(f.Filename) {
+			continue
+		}
+		seen[f.Filename] = true
+		out = append(out, newInfo(f))
+	}
+	slices.SortFunc(out, func(a, b Info) int { return strings.Compare(a.Key, b.Key) })
+	return out, nil
+}
+
+// Buckets are not stored anywhere: they are the first path segment of existing keys, and a
+// bucket's creation date is that of its oldest object.
+func (o *ObjectServiceImpl) Buckets(ctx context.Context) ([]Bucket, error) {
+	files, err := o.list(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	var out []Bucket
+	for _, f := range files {
+		name, _, ok := strings.Cut(f.Filename, "/")
+		if !ok || name == "" || helper.ReservedFilename(f.Filename) {
+			continue
+		}
+		// * files come newest first, so the last one seen per bucket is the oldest
+		if i, seen := index[name]; seen {
+			out[i].CreatedAt = f.CreatedAt
+			continue
+		}
+		index[name] = len(out)
+		out = append(out, Bucket{Name: name, CreatedAt: f.CreatedAt})
+	}
+	slices.SortFunc(out, func(a, b Bucket) int { return strings.Compare(a.Name, b.Name) })
+	return out, nil
+}
+
+// store uploads r through the upload service and records its MD5 as the object ETag, in the
+// transaction that completes the upload.
+func (o *ObjectServiceImpl) store(ctx context.Context, req web.UploadRequest, r io.Reader) (Info, error) {
+	md5sum := md5.New()
+	req.Reader = io.TeeReader(r, md5sum)
+	req.FinalMetadata = func() map[string]string {
+		return map[string]string{metaETag: hex.EncodeToString(md5sum.Sum(nil))}
+	}
+	uploaded, err := o.UploadService.Upload(ctx, req)
+	if err != nil {
+		return Info{}, err
+	}
+
+	tx, err := o.DB.Begin(ctx)
+	if err != nil {
+		return Info{}, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	file, err := o.FileRepository.FindByID(ctx, tx, uploaded.FileID)
+	if err != nil {
+		return Info{}, helper.ErrInternal
+	}
+	return newInfo(file), nil
+}
+
+// replaceOlder deletes every other file named key. Failures only leave a stale older version
+// behind, which reads never see, so they are logged rather than returned.
+func (o *ObjectServiceImpl) replaceOlder(ctx context.Context, key string, keep uuid.UUID) {
+	files, err := o.findByName(ctx, key)
+	if err != nil {
+		o.Logger.Error("s3_replace_err", slog.String("key", key), slog.Any("err", err))
+		return
+	}
+	for _, f := range files {
+		if f.ID == keep {
+			continue
+		}
+		if _, err := o.DeleteService.Delete(ctx, f.ID); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			o.Logger.Error("s3_replace_err", slog.String("key", key), slog.String("file_id", f.ID.String()), slog.Any("err", err))
+		}
+	}
+}
+
+func (o *ObjectServiceImpl) latest(ctx context.Context, key string) (domain.File, error) {
+	files, err := o.findByName(ctx, key)
+	if err != nil {
+		return domain.File{}, err
+	}
+	if len(files) == 0 {
+		return domain.File{}, helper.ErrNotFound
+	}
+	return files[0], nil
+}
+
+func (o *ObjectServiceImpl) findByName(ctx context.Context, key string) ([]domain.File, error) {
+	if key == "" {
+		return nil, helper.ErrInvalidInput
+	}
+	tx, err := o.DB.Begin(ctx)
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	files, err := o.FileRepository.FindByFilename(ctx, tx, key)
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+	return files, nil
+}
+
+func (o *ObjectServiceImpl) list(ctx context.Context, prefix string) ([]domain.File, error) {
+	tx, err := o.DB.Begin(ctx)
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	files, err := o.FileRepository.List(ctx, tx, domain.FileFilter{Prefix: prefix})
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+	return files, nil
+}
@@ -0,0 +1,16 @@
+package replication
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"meliocool/bytesize/internal/model/web"
+	"time"
+)
+
+// ReplicationService is the receiving end of replication: it applies another instance's file
+// writes and deletes here, keeping ids and versions, and refuses any that would overwrite a
+// newer local version with helper.ErrConflict.
+type ReplicationService interface {
+	Apply(ctx context.Context, id uuid.UUID, file web.BundleFile) (web.ReplicationResponse, error)
+	Remove(ctx context.Context, id uuid.UUID, version time.Time, force bool) (web.ReplicationResponse, error)
+}
@@ -0,0 +1,300 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/repository"
+	"meliocool/bytesize/internal/service/bundle"
+	"meliocool/bytesize/internal/service/manifest"
+	"meliocool/bytesize/internal/storage"
+	"time"
+)
+
+const (
+	ResultCreated   = "created"
+	ResultUpdated   = "updated"
+	ResultUnchanged = "unchanged"
+	ResultDeleted   = "deleted"
+	ResultAbsent    = "absent"
+)
+
+type ReplicationServiceImpl struct {
+	FileRepository      repository.FileRepository
+	FileChunkRepository repository.FileChunkRepository
+	ChunkRepository     repository.ChunkRepository
+	ChunkStore          storage.ChunkStore
+	DB                  *pgxpool.Pool
+	Logger              *slog.Logger
+}
+
+func NewReplicationService(
+	fileRepository repository.FileRepository,
+	fileChunkRepository repository.FileChunkRepository,
+	chunkRepository repository.ChunkRepository,
+	chunkStore storage.ChunkStore,
+	db *pgxpool.Pool,
+	logger *slog.Logger,
+) ReplicationService {
+	return &ReplicationServiceImpl{
+		FileRepository:      fileRepository,
+		FileChunkRepository: fileChunkRepository,
+		ChunkRepository:     chunkRepository,
+		ChunkStore:          chunkStore,
+		DB:                  db,
+		Logger:              logger,
+	}
+}
+
+// Apply makes the local copy of file id what file says, in one transaction: it creates the
+// file, or replaces an older version of it, manifest included. A version equal to the local
+// one is left alone. Every chunk must already be in the store; otherwise it returns a
+// *manifest.MissingChunksError and writes nothing.
+func (s *ReplicationServiceImpl) Apply(ctx context.Context, id uuid.UUID, file web.BundleFile) (web.ReplicationResponse, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("replication_apply").Inc()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues("replication_apply").Observe(time.Since(start).Seconds())
+	}()
+
+	resp, err := s.apply(ctx, id, file)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("replication_apply").Inc()
+		return web.ReplicationResponse{}, err
+	}
+	s.Logger.Info("replication_apply_ok", slog.String("file_id", id.String()), slog.String("result", resp.Result), slog.Duration("took", time.Since(start)))
+	return resp, nil
+}
+
+func (s *ReplicationServiceImpl) apply(ctx context.Context, id uuid.UUID, file web.BundleFile) (web.ReplicationResponse, error) {
+	if file.ID == uuid.Nil {
+		file.ID = id
+	}
+	if id == uuid.Nil || file.ID != id || bundle.CheckFile(file) != nil {
+		return web.ReplicationResponse{}, helper.ErrInvalidInput
+	}
+
+	seen := make(map[string]bool, len(file.Chunks))
+	var missing []string
+	for _, c := range file.Chunks {
+		if seen[c.Hash] {
+			continue
+		}
+		seen[c.Hash] = true
+		ok, err := s.ChunkStore.Exists(c.Hash)
+		if err != nil {
+			s.Logger.Error("replication_apply_err", slog.String("stage", "exists"), slog.String("hash", c.Hash), slog.Any("err", err))
+			return web.ReplicationResponse{}, helper.ErrInternal
+		}
+		if !ok {
+			missing = append(missing, c.Hash)
+		}
+	}
+	if len(missing) > 0 {
+		return web.ReplicationResponse{}, &manifest.MissingChunksError{Hashes: missing}
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	row := domain.File{
+		ID:          file.ID,
+		Filename:    file.Filename,
+		TotalSize:   file.TotalSize,
+		ContentType: file.ContentType,
+		CreatedAt:   file.CreatedAt,
+		UpdatedAt:   file.UpdatedAt,
+		ExpiresAt:   file.ExpiresAt,
+		Metadata:    file.Metadata,
+		Tags:        file.Tags,
+	}
+	version, err := s.FileRepository.LockVersion(ctx, tx, id)
+	switch {
+	case errors.Is(err, helper.ErrNotFound):
+		inserted, err := s.FileRepository.Import(ctx, tx, row)
+		if err != nil {
+			s.Logger.Error("replication_apply_err", slog.String("stage", "create_file_row"), slog.String("file_id", id.String()), slog.Any("err", err))
+			return web.ReplicationResponse{}, helper.ErrInternal
+		}
+		// * a concurrent apply of the same file got there first; a retry compares against it
+		if !inserted {
+			return web.ReplicationResponse{}, helper.ErrUnavailable
+		}
+		if err := s.writeManifest(ctx, tx, id, file.Chunks); err != nil {
+			return web.ReplicationResponse{}, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return web.ReplicationResponse{}, helper.ErrInternal
+		}
+		return web.ReplicationResponse{FileID: id, Result: ResultCreated}, nil
+	case err != nil:
+		s.Logger.Error("replication_apply_err", slog.String("stage", "lock_file_row"), slog.String("file_id", id.String()), slog.Any("err", err))
+		return web.ReplicationResponse{}, helper.ErrInternal
+	case version.Equal(file.UpdatedAt):
+		return web.ReplicationResponse{FileID: id, Result: ResultUnchanged}, nil
+	case version.After(file.UpdatedAt):
+		return web.ReplicationResponse{}, helper.ErrConflict
+	}
+
+	previous, err := s.FileChunkRepository.FindByFileID(ctx, tx, id)
+	if err != nil {
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	if err := s.FileRepository.Replace(ctx, tx, row); err != nil {
+		s.Logger.Error("replication_apply_err", slog.String("stage", "replace_file_row"), slog.String("file_id", id.String()), slog.Any("err", err))
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	if _, err := s.FileChunkRepository.DeleteFrom(ctx, tx, id, 0); err != nil {
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	if err := s.writeManifest(ctx, tx, id, file.Chunks); err != nil {
+		return web.ReplicationResponse{}, err
+	}
+
+	// * chunks only the old version used are freed as a delete would free them
+	dropped := make(map[string]int64)
+	for _, fc := range previous {
+		if !seen[fc.ChunkHash] {
+			dropped[fc.ChunkHash] = fc.Size
+		}
+	}
+	orphans, orphanBytes, err := s.releaseChunks(ctx, tx, dropped)
+	if err != nil {
+		return web.ReplicationResponse{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	s.dropBlobs(orphans, orphanBytes)
+	return web.ReplicationResponse{FileID: id, Result: ResultUpdated}, nil
+}
+
+// Remove deletes file id if its local version is version or older, or whatever it is when
+// force is set; a newer local version is a helper.ErrConflict. A file that is not here is not
+// an error.
+func (s *ReplicationServiceImpl) Remove(ctx context.Context, id uuid.UUID, version time.Time, force bool) (web.ReplicationResponse, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("replication_remove").Inc()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues("replication_remove").Observe(time.Since(start).Seconds())
+	}()
+
+	resp, err := s.remove(ctx, id, version, force)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("replication_remove").Inc()
+		return web.ReplicationResponse{}, err
+	}
+	s.Logger.Info("replication_remove_ok", slog.String("file_id", id.String()), slog.String("result", resp.Result), slog.Bool("force", force), slog.Duration("took", time.Since(start)))
+	return resp, nil
+}
+
+func (s *ReplicationServiceImpl) remove(ctx context.Context, id uuid.UUID, version time.Time, force bool) (web.ReplicationResponse, error) {
+	if id == uuid.Nil || version.IsZero() {
+		return web.ReplicationResponse{}, helper.ErrInvalidInput
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	local, err := s.FileRepository.LockVersion(ctx, tx, id)
+	if errors.Is(err, helper.ErrNotFound) {
+		return web.ReplicationResponse{FileID: id, Result: ResultAbsent}, nil
+	}
+	if err != nil {
+		s.Logger.Error("replication_remove_err", slog.String("stage", "lock_file_row"), slog.String("file_id", id.String()), slog.Any("err", err))
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	if local.After(version) && !force {
+		return web.ReplicationResponse{}, helper.ErrConflict
+	}
+
+	manifest, err := s.FileChunkRepository.FindByFileID(ctx, tx, id)
+	if err != nil {
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	sizes := make(map[string]int64)
+	for _, fc := range manifest {
+		sizes[fc.ChunkHash] = fc.Size
+	}
+	if err := s.FileRepository.Delete(ctx, tx, id); err != nil {
+		s.Logger.Error("replication_remove_err", slog.String("stage", "delete_file_row"), slog.String("file_id", id.String()), slog.Any("err", err))
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	orphans, orphanBytes, err := s.releaseChunks(ctx, tx, sizes)
+	if err != nil {
+		return web.ReplicationResponse{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return web.ReplicationResponse{}, helper.ErrInternal
+	}
+	s.dropBlobs(orphans, orphanBytes)
+	return web.ReplicationResponse{FileID: id, Result: ResultDeleted}, nil
+}
+
+func (s *ReplicationServiceImpl) writeManifest(ctx context.Context, tx pgx.Tx, id uuid.UUID, chunks []web.ManifestChunk) error {
+	seen := make(map[string]bool, len(chunks))
+	var rows []domain.Chunk
+	manifest := make([]domain.FileChunk, len(chunks))
+	for i, c := range chunks {
+		manifest[i] = domain.FileChunk{FileID: id, Idx: int64(i), ChunkHash: c.Hash, Size: c.Size}
+		if !seen[c.Hash] {
+			seen[c.Hash] = true
+			rows = append(rows, domain.Chunk{Hash: c.Hash, Size: c.Size})
+		}
+	}
+	for i := 0; i < len(rows); i += helper.BatchSize {
+		end := min(i+helper.BatchSize, len(rows))
+		if _, err := s.ChunkRepository.UpsertMany(ctx, tx, rows[i:end]); err != nil {
+			s.Logger.Error("replication_apply_err", slog.String("stage", "upsert_chunks"), slog.String("file_id", id.String()), slog.Any("err", err))
+			return helper.ErrInternal
+		}
+	}
+	for i := 0; i < len(manifest); i += helper.BatchSize {
+		end := min(i+helper.BatchSize, len(manifest))
+		if err := s.FileChunkRepository.AddChunks(ctx, tx, id, manifest[i:end]); err != nil {
+			s.Logger.Error("replication_apply_err", slog.String("stage", "add_chunks"), slog.String("file_id", id.String()), slog.Any("err", err))
+			return helper.ErrInternal
+		}
+	}
+	return nil
+}
+
+// releaseChunks drops the rows of the chunks in sizes that nothing references any more and
+// returns their hashes and total size; their blobs go once tx has committed.
+func (s *ReplicationServiceImpl) releaseChunks(ctx context.Context, tx pgx.Tx, sizes map[string]int64) ([]string, int64, error) {
+	var orphans []string
+	var orphanBytes int64
+	for h, sz := range sizes {
+		orphan, err := s.ChunkRepository.DeleteOrphan(ctx, tx, h)
+		if err != nil {
+			return nil, 0, helper.ErrInternal
+		}
+		if orphan {
+			orphans = append(orphans, h)
+			orphanBytes += sz
+		}
+	}
+	return orphans, orphanBytes, nil
+}
+
+func (s *ReplicationServiceImpl) dropBlobs(hashes []string, size int64) {
+	for _, h := range hashes {
+		if err := s.ChunkStore.Delete(h); err != nil {
+			s.Logger.Error("replication_err", slog.String("stage", "delete_chunk"), slog.String("hash", h), slog.Any("err", err))
+		}
+	}
+	metrics.ReclaimedBytesTotal.WithLabelValues("replication").Add(float64(size))
+}
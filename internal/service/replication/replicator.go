@@ -0,0 +1,480 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/repository"
+	"meliocool/bytesize/internal/storage"
+	"meliocool/bytesize/pkg/client"
+	"time"
+)
+
+// Results a Replicator counts besides the peer's own.
+const (
+	ResultSkipped  = "skipped"
+	ResultConflict = "conflict"
+	ResultRejected = "rejected"
+)
+
+// SyncResult counts what one Sync did.
+type SyncResult struct {
+	// Files is how many files the backfill walked, Events how many change log events were
+	// sent after coalescing.
+	Files     int64
+	Events    int64
+	Conflicts int64
+	Rejected  int64
+	Pruned    int64
+}
+
+// Replicator pushes this instance's file changes to Peer. A peer it has no checkpoint for is
+// first backfilled with every existing file; after that it follows the change log in seq
+// order, saving its checkpoint as it goes, so a restart resumes where it stopped. Chunks are
+// sent only when the peer reports them missing.
+//
+// A write the peer refuses because its copy is newer is logged, counted and passed over; so is
+// a delete of a file the peer has since changed, unless ForceDeletes is set. Any other failure
+// ends the round, and Run retries it with exponential backoff.
+//
+// With a nil Peer, Sync only prunes the change log.
+type Replicator struct {
+	Peer                  *client.Client
+	PeerName              string
+	FileRepository        repository.FileRepository
+	FileChunkRepository   repository.FileChunkRepository
+	ReplicationRepository repository.ReplicationRepository
+	ChunkStore            storage.ChunkStore
+	DB                    *pgxpool.Pool
+	Interval              time.Duration
+	BatchSize             int
+	// GapTimeout is how long a hole in seq is waited on before it is taken for a rolled-back
+	// transaction; it must outlast the longest transaction that writes files.
+	GapTimeout   time.Duration
+	MaxBackoff   time.Duration
+	ForceDeletes bool
+	Logger       *slog.Logger
+}
+
+func NewReplicator(
+	peer *client.Client,
+	peerName string,
+	fileRepository repository.FileRepository,
+	fileChunkRepository repository.FileChunkRepository,
+	replicationRepository repository.ReplicationRepository,
+	chunkStore storage.ChunkStore,
+	db *pgxpool.Pool,
+	interval time.Duration,
+	forceDeletes bool,
+	logger *slog.Logger,
+) *Replicator {
+	return &Replicator{
+		Peer:                  peer,
+		PeerName:              peerName,
+		FileRepository:        fileRepository,
+		FileChunkRepository:   fileChunkRepository,
+		ReplicationRepository: replicationRepository,
+		ChunkStore:            chunkStore,
+		DB:                    db,
+		Interval:              interval,
+		BatchSize:             helper.ReplicationBatchSize,
+		GapTimeout:            helper.ReplicationGapTimeout,
+		MaxBackoff:            helper.ReplicationMaxBackoff,
+		ForceDeletes:          forceDeletes,
+		Logger:                logger,
+	}
+}
+
+// Run blocks until ctx is cancelled, syncing once per Interval, or later after failures.
+func (r *Replicator) Run(ctx context.Context) {
+	failures := 0
+	for {
+		start := time.Now()
+		res, err := r.Sync(ctx)
+		delay := r.Interval
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			failures++
+			delay = r.backoff(failures)
+			r.Logger.Error(
+				"replication_err",
+				slog.String("stage", "sync"),
+				slog.String("peer", r.PeerName),
+				slog.Int("failures", failures),
+				slog.Duration("retry_in", delay),
+				slog.Any("err", err),
+			)
+		} else {
+			failures = 0
+		}
+		if res.Files > 0 || res.Events > 0 || res.Pruned > 0 {
+			r.Logger.Info(
+				"replication_ok",
+				slog.String("peer", r.PeerName),
+				slog.Int64("files", res.Files),
+				slog.Int64("events", res.Events),
+				slog.Int64("conflicts", res.Conflicts),
+				slog.Int64("rejected", res.Rejected),
+				slog.Int64("pruned", res.Pruned),
+				slog.Duration("took", time.Since(start)),
+			)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *Replicator) backoff(failures int) time.Duration {
+	d := r.Interval
+	for i := 0; i < failures && d < r.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, r.MaxBackoff)
+}
+
+// Sync brings the peer up to date with every change logged so far, then prunes the change
+// log up to the checkpoint. It returns what it did even when it fails partway.
+func (r *Replicator) Sync(ctx context.Context) (SyncResult, error) {
+	res := SyncResult{}
+	if r.Peer == nil {
+		pruned, err := r.prune(ctx, 0)
+		res.Pruned = pruned
+		return res, err
+	}
+
+	checkpoint, err := r.checkpoint(ctx)
+	if err != nil {
+		return res, err
+	}
+	if checkpoint.Backfill {
+		if err := r.backfill(ctx, &checkpoint, &res); err != nil {
+			r.observe(ctx, checkpoint.Seq)
+			return res, err
+		}
+	}
+	for {
+		more, err := r.replay(ctx, &checkpoint, &res)
+		if err != nil {
+			r.observe(ctx, checkpoint.Seq)
+			return res, err
+		}
+		if !more {
+			break
+		}
+	}
+
+	pruned, err := r.prune(ctx, checkpoint.Seq)
+	res.Pruned = pruned
+	r.observe(ctx, checkpoint.Seq)
+	return res, err
+}
+
+// checkpoint loads the peer's checkpoint, starting one for a new peer: a backfill of the files
+// there are now, then the change log from where it has settled.
+func (r *Replicator) checkpoint(ctx context.Context) (domain.ReplicationCheckpoint, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return domain.ReplicationCheckpoint{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	checkpoint, err := r.ReplicationRepository.FindCheckpoint(ctx, tx, r.PeerName)
+	if err == nil || !errors.Is(err, helper.ErrNotFound) {
+		return checkpoint, err
+	}
+	// * events that may still be joined by lower seqs are replayed after the backfill; sending a
+	// * file twice only makes the peer answer unchanged
+	seq, err := r.ReplicationRepository.SettledSeq(ctx, tx, time.Now().Add(-r.GapTimeout))
+	if err != nil {
+		return domain.ReplicationCheckpoint{}, err
+	}
+	checkpoint = domain.ReplicationCheckpoint{Peer: r.PeerName, Seq: seq, Backfill: true}
+	if err := r.ReplicationRepository.SaveCheckpoint(ctx, tx, checkpoint); err != nil {
+		return domain.ReplicationCheckpoint{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return domain.ReplicationCheckpoint{}, err
+	}
+	r.Logger.Info("replication_ok", slog.String("stage", "backfill_start"), slog.String("peer", r.PeerName), slog.Int64("seq", seq))
+	return checkpoint, nil
+}
+
+func (r *Replicator) saveCheckpoint(ctx context.Context, checkpoint domain.ReplicationCheckpoint) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := r.ReplicationRepository.SaveCheckpoint(ctx, tx, checkpoint); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// backfill walks the existing files oldest first from the checkpoint's cursor, a page at a
+// time, and pushes each.
+func (r *Replicator) backfill(ctx context.Context, checkpoint *domain.ReplicationCheckpoint, res *SyncResult) error {
+	for {
+		tx, err := r.DB.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		files, err := r.FileRepository.ListAfter(ctx, tx, domain.FileFilter{Limit: r.BatchSize}, checkpoint.Cursor)
+		_ = tx.Rollback(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			var result string
+			var err error
+			if helper.ReservedFilename(f.Filename) {
+				result = ResultSkipped
+			} else {
+				result, err = r.push(ctx, f.ID)
+			}
+			if err := r.settle("backfill", f.ID, result, err, res); err != nil {
+				return errors.Join(err, r.saveCheckpoint(ctx, *checkpoint))
+			}
+			res.Files++
+			checkpoint.Cursor = domain.FileCursor{CreatedAt: f.CreatedAt, ID: f.ID}
+		}
+		if len(files) < r.BatchSize {
+			checkpoint.Backfill = false
+		}
+		if err := r.saveCheckpoint(ctx, *checkpoint); err != nil {
+			return err
+		}
+		if !checkpoint.Backfill {
+			r.Logger.Info("replication_ok", slog.String("stage", "backfill_done"), slog.String("peer", r.PeerName), slog.Int64("files", res.Files))
+			return nil
+		}
+	}
+}
+
+// replay sends the next batch of change log events and reports whether there may be more.
+func (r *Replicator) replay(ctx context.Context, checkpoint *domain.ReplicationCheckpoint, res *SyncResult) (bool, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	events, err := r.ReplicationRepository.ListEvents(ctx, tx, checkpoint.Seq, r.BatchSize)
+	_ = tx.Rollback(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// * seq is drawn at insert but only seen at commit, so a hole may be a transaction that is
+	// * still open; it is waited on until the event after it is GapTimeout old
+	ready := 0
+	next := checkpoint.Seq + 1
+	for _, ev := range events {
+		if ev.Seq != next && time.Since(ev.LoggedAt) < r.GapTimeout {
+			break
+		}
+		ready++
+		next = ev.Seq + 1
+	}
+
+	// * only a file's last event in the batch is sent: the push reads the file as it is now, and
+	// * a delete carries the last version
+	last := make(map[uuid.UUID]int64, ready)
+	for _, ev := range events[:ready] {
+		last[ev.FileID] = ev.Seq
+	}
+	for _, ev := range events[:ready] {
+		if last[ev.FileID] != ev.Seq {
+			checkpoint.Seq = ev.Seq
+			continue
+		}
+		if err := r.send(ctx, ev, res); err != nil {
+			return false, errors.Join(err, r.saveCheckpoint(ctx, *checkpoint))
+		}
+		res.Events++
+		checkpoint.Seq = ev.Seq
+		if err := r.saveCheckpoint(ctx, *checkpoint); err != nil {
+			return false, err
+		}
+	}
+	return ready == len(events) && len(events) == r.BatchSize, nil
+}
+
+func (r *Replicator) send(ctx context.Context, ev domain.ReplicationEvent, res *SyncResult) error {
+	// * in-progress uploads and snapshot manifests stay local; a finished upload logs its own event
+	if helper.ReservedFilename(ev.Filename) {
+		return r.settle(ev.Op, ev.FileID, ResultSkipped, nil, res)
+	}
+	if ev.Op == domain.ReplicationDelete {
+		result, err := r.Peer.ReplicateDelete(ctx, ev.FileID, ev.UpdatedAt, r.ForceDeletes)
+		return r.settle(ev.Op, ev.FileID, result, err, res)
+	}
+	result, err := r.push(ctx, ev.FileID)
+	return r.settle(ev.Op, ev.FileID, result, err, res)
+}
+
+// settle counts the outcome of sending one change and returns nil when replication can move
+// past it: it went through, the peer's copy is newer, or the peer will never take it.
+func (r *Replicator) settle(op string, id uuid.UUID, result string, err error, res *SyncResult) error {
+	switch {
+	case err == nil:
+	case errors.Is(err, client.ErrConflict):
+		result = ResultConflict
+		res.Conflicts++
+		r.Logger.Warn("replication_conflict", slog.String("peer", r.PeerName), slog.String("op", op), slog.String("file_id", id.String()))
+	case errors.Is(err, client.ErrBadRequest), errors.Is(err, client.ErrTooLarge):
+		result = ResultRejected
+		res.Rejected++
+		r.Logger.Error("replication_err", slog.String("stage", "rejected"), slog.String("peer", r.PeerName), slog.String("op", op), slog.String("file_id", id.String()), slog.Any("err", err))
+	default:
+		return err
+	}
+	metrics.ReplicationEventsTotal.WithLabelValues(op, result).Inc()
+	return nil
+}
+
+// push sends file id as it is now. A file that is gone or expired, or whose upload has not
+// finished, is skipped; the event that deletes or finishes it comes later in the log.
+func (r *Replicator) push(ctx context.Context, id uuid.UUID) (string, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	file, err := r.FileRepository.FindByID(ctx, tx, id)
+	if errors.Is(err, helper.ErrNotFound) {
+		_ = tx.Rollback(ctx)
+		return ResultSkipped, nil
+	}
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return "", err
+	}
+	manifest, err := r.FileChunkRepository.FindByFileID(ctx, tx, id)
+	_ = tx.Rollback(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	replica := client.ReplicaFile{
+		ID:          file.ID,
+		Filename:    file.Filename,
+		ContentType: file.ContentType,
+		TotalSize:   file.TotalSize,
+		CreatedAt:   file.CreatedAt,
+		UpdatedAt:   file.UpdatedAt,
+		ExpiresAt:   file.ExpiresAt,
+		Metadata:    file.Metadata,
+		Tags:        file.Tags,
+		Chunks:      make([]client.Chunk, len(manifest)),
+	}
+	var size int64
+	for i, fc := range manifest {
+		replica.Chunks[i] = client.Chunk{Hash: fc.ChunkHash, Size: fc.Size}
+		size += fc.Size
+	}
+	if size != file.TotalSize {
+		return ResultSkipped, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := r.sendChunks(ctx, replica.Chunks); err != nil {
+			return "", err
+		}
+		result, err := r.Peer.ReplicateFile(ctx, replica)
+		// * the peer may have collected a chunk between the two calls; negotiate once more
+		if errors.Is(err, client.ErrMissingChunks) && attempt == 0 {
+			continue
+		}
+		return result, err
+	}
+}
+
+// sendChunks uploads the chunks the peer reports missing.
+func (r *Replicator) sendChunks(ctx context.Context, chunks []client.Chunk) error {
+	seen := make(map[string]bool, len(chunks))
+	var hashes []string
+	for _, c := range chunks {
+		if !seen[c.Hash] {
+			seen[c.Hash] = true
+			hashes = append(hashes, c.Hash)
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	missing, err := r.Peer.MissingChunks(ctx, hashes)
+	if err != nil {
+		return err
+	}
+	for _, hash := range missing {
+		rc, _, err := r.ChunkStore.Get(hash)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, helper.ChunkSize+1))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := r.Peer.PutChunk(ctx, hash, data); err != nil {
+			return err
+		}
+		metrics.ReplicationBytesSentTotal.Add(float64(len(data)))
+	}
+	return nil
+}
+
+// prune drops the change log up to upTo, or, without a peer, everything logged so far; the
+// repository never prunes past any peer's checkpoint.
+func (r *Replicator) prune(ctx context.Context, upTo int64) (int64, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if r.Peer == nil {
+		if upTo, err = r.ReplicationRepository.SettledSeq(ctx, tx, time.Now()); err != nil {
+			return 0, err
+		}
+	}
+	pruned, err := r.ReplicationRepository.Prune(ctx, tx, upTo)
+	if err != nil {
+		return 0, err
+	}
+	return pruned, tx.Commit(ctx)
+}
+
+// observe sets the lag gauges from what is left after seq.
+func (r *Replicator) observe(ctx context.Context, seq int64) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	pending, oldest, err := r.ReplicationRepository.Backlog(ctx, tx, seq)
+	if err != nil {
+		return
+	}
+	metrics.ReplicationPendingEvents.Set(float64(pending))
+	if pending == 0 {
+		metrics.ReplicationLagSeconds.Set(0)
+		return
+	}
+	metrics.ReplicationLagSeconds.Set(time.Since(oldest).Seconds())
+}
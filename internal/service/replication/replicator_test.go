@@ -0,0 +1,497 @@
+package replication_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/app"
+	"meliocool/bytesize/internal/controller"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/repository"
+	deletefile "meliocool/bytesize/internal/service/delete"
+	"meliocool/bytesize/internal/service/download"
+	"meliocool/bytesize/internal/service/filelist"
+	"meliocool/bytesize/internal/service/filemeta"
+	"meliocool/bytesize/internal/service/manifest"
+	"meliocool/bytesize/internal/service/replication"
+	"meliocool/bytesize/internal/service/upload"
+	"meliocool/bytesize/internal/storage"
+	"meliocool/bytesize/pkg/client"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testPeer = "peer"
+
+// testSchema gives the test a freshly migrated schema of TEST_DATABASE_URL, so two instances
+// can share one database without seeing each other's tables. Without it the test is skipped.
+func testSchema(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := "replication_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		admin.Close()
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+		admin.Close()
+	})
+
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parse url: %v", err)
+	}
+	// * public stays on the path for the extensions the migrations expect to find there
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ", public"
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	migrations, err := filepath.Glob("../../../migrations/*.sql")
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("find migrations: %v", err)
+	}
+	slices.Sort(migrations)
+	for _, path := range migrations {
+		sql, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		if _, err := db.Exec(ctx, string(sql)); err != nil {
+			t.Fatalf("apply %s: %v", filepath.Base(path), err)
+		}
+	}
+	return db
+}
+
+// instance is one ByteSize server: its own schema and chunk directory behind the real REST
+// router, with a client pointed at it.
+type instance struct {
+	DB                    *pgxpool.Pool
+	Store                 storage.ChunkStore
+	FileRepository        repository.FileRepository
+	FileChunkRepository   repository.FileChunkRepository
+	ReplicationRepository repository.ReplicationRepository
+	Client                *client.Client
+	// applyBudget is how many more replicated writes the server takes before it answers them
+	// 500; negative means no limit.
+	applyBudget atomic.Int64
+}
+
+func newInstance(t *testing.T) *instance {
+	t.Helper()
+	db := testSchema(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	validate := validator.New()
+
+	chunkRepository := repository.NewChunkRepository()
+	fileRepository := repository.NewFileRepository()
+	fileChunksRepository := repository.NewFileChunksRepository()
+	chunkStorage := storage.NewFSChunkStore(t.TempDir())
+
+	deleteService := deletefile.NewDeleteService(fileRepository, fileChunksRepository, chunkRepository, chunkStorage, db)
+	admission := upload.NewAdmission(helper.MaxConcurrentUploads, helper.UploadMemoryBytes)
+	uploadService := upload.NewUploadService(chunkRepository, fileRepository, fileChunksRepository, chunkStorage, deleteService, helper.HashWorkers, admission, db, validate, logger)
+	downloadService := download.NewDownloadService(fileRepository, fileChunksRepository, chunkStorage, 0, db, logger)
+	fileMetaDataService := filemeta.NewFileMetaDataService(fileRepository, fileChunksRepository, db, logger)
+	fileListService := filelist.NewFileListService(fileRepository, db)
+	manifestService := manifest.NewManifestService(uploadService, deleteService, fileRepository, fileChunksRepository, chunkRepository, chunkStorage, db, validate, logger)
+	replicationService := replication.NewReplicationService(fileRepository, fileChunksRepository, chunkRepository, chunkStorage, db, logger)
+
+	inst := &instance{
+		DB:                    db,
+		Store:                 chunkStorage,
+		FileRepository:        fileRepository,
+		FileChunkRepository:   fileChunksRepository,
+		ReplicationRepository: repository.NewReplicationRepository(),
+	}
+	inst.applyBudget.Store(-1)
+
+	router := app.NewRouter(app.Controllers{
+		Upload:       controller.NewUploadController(uploadService),
+		FileList:     controller.NewFileListController(fileListService),
+		FileMetaData: controller.NewFileMetaDataController(fileMetaDataService),
+		Download:     controller.NewDownloadController(downloadService, fileMetaDataService),
+		Delete:       controller.NewDeleteController(deleteService),
+		Archive:      controller.NewArchiveController(nil),
+		Tus:          controller.NewTusController(nil, "/files/tus"),
+		Manifest:     controller.NewManifestController(manifestService),
+		Snapshot:     controller.NewSnapshotController(nil),
+		Bundle:       controller.NewBundleController(nil),
+		Replication:  controller.NewReplicationController(replicationService),
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodPut && strings.HasPrefix(request.URL.Path, "/replication/files/") {
+			if inst.applyBudget.Load() == 0 {
+				helper.WriteErr(writer, helper.ErrInternal)
+				return
+			}
+			inst.applyBudget.Add(-1)
+		}
+		router.ServeHTTP(writer, request)
+	}))
+	t.Cleanup(srv.Close)
+
+	apiKey := os.Getenv("MIDDLEWARE_KEY")
+	if apiKey == "" {
+		apiKey = "LOVEMELOVEME"
+	}
+	inst.Client = client.New(srv.URL, apiKey)
+	// * a failed write should end the round at once, not after the client's backoff
+	inst.Client.MaxRetries = 0
+	return inst
+}
+
+// newReplicator builds a replicator from src to peer the way main does; each call is a fresh
+// process as far as the replicator knows, so all it has is the checkpoint.
+func newReplicator(src *instance, peer *instance) *replication.Replicator {
+	var peerClient *client.Client
+	if peer != nil {
+		peerClient = peer.Client
+	}
+	r := replication.NewReplicator(peerClient, testPeer, src.FileRepository, src.FileChunkRepository, src.ReplicationRepository, src.Store, src.DB, time.Hour, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r.BatchSize = 2
+	r.GapTimeout = time.Hour
+	return r
+}
+
+func (inst *instance) upload(t *testing.T, name string, data []byte) uuid.UUID {
+	t.Helper()
+	res, err := inst.Client.Upload(context.Background(), name, bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("upload %s: %v", name, err)
+	}
+	return res.FileID
+}
+
+func (inst *instance) checkpoint(t *testing.T, peer string) domain.ReplicationCheckpoint {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := inst.DB.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	checkpoint, err := inst.ReplicationRepository.FindCheckpoint(ctx, tx, peer)
+	if err != nil {
+		t.Fatalf("find checkpoint: %v", err)
+	}
+	return checkpoint
+}
+
+func (inst *instance) saveCheckpoint(t *testing.T, checkpoint domain.ReplicationCheckpoint) {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := inst.DB.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := inst.ReplicationRepository.SaveCheckpoint(ctx, tx, checkpoint); err != nil {
+		t.Fatalf("save checkpoint: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+func (inst *instance) query(t *testing.T, sql string, args ...any) int64 {
+	t.Helper()
+	var n int64
+	if err := inst.DB.QueryRow(context.Background(), sql, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	return n
+}
+
+func (inst *instance) lastSeq(t *testing.T) int64 {
+	t.Helper()
+	return inst.query(t, "SELECT COALESCE(MAX(seq), 0) FROM replication_log")
+}
+
+// assertReplica checks that peer holds id with data, under the same id.
+func assertReplica(t *testing.T, peer *instance, id uuid.UUID, data []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := peer.Client.Download(context.Background(), id, &buf, nil); err != nil {
+		t.Fatalf("peer download %s: %v", id, err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("peer copy of %s is %d bytes and differs from the %d sent", id, buf.Len(), len(data))
+	}
+}
+
+func assertNoReplica(t *testing.T, peer *instance, id uuid.UUID) {
+	t.Helper()
+	if _, err := peer.Client.Stat(context.Background(), id); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("peer stat %s = %v; want ErrNotFound", id, err)
+	}
+}
+
+func randomData(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	return data
+}
+
+func mustSync(t *testing.T, r *replication.Replicator) replication.SyncResult {
+	t.Helper()
+	res, err := r.Sync(context.Background())
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	return res
+}
+
+func TestReplicatorBackfillsThenReplays(t *testing.T) {
+	src, peer := newInstance(t), newInstance(t)
+
+	shared := randomData(t, 3*helper.ChunkSize/2)
+	ids := make([]uuid.UUID, 5)
+	contents := make([][]byte, 5)
+	for i := range ids {
+		contents[i] = randomData(t, 1000+i)
+		if i%2 == 0 {
+			// * the even files share their first chunk
+			contents[i] = append(slices.Clone(shared), contents[i]...)
+		}
+		ids[i] = src.upload(t, "backfill-"+string(rune('a'+i)), contents[i])
+	}
+
+	r := newReplicator(src, peer)
+	res := mustSync(t, r)
+	if res.Files != 5 {
+		t.Fatalf("backfill walked %d files; want 5", res.Files)
+	}
+	for i, id := range ids {
+		assertReplica(t, peer, id, contents[i])
+	}
+	checkpoint := src.checkpoint(t, testPeer)
+	if checkpoint.Backfill || checkpoint.Seq != src.lastSeq(t) {
+		t.Fatalf("checkpoint = %+v; want the backfill done and seq %d", checkpoint, src.lastSeq(t))
+	}
+
+	// * after the backfill only the change log is followed
+	added := randomData(t, 4096)
+	addedID := src.upload(t, "replayed.bin", added)
+	if _, err := src.Client.Delete(context.Background(), ids[1]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	res = mustSync(t, r)
+	if res.Files != 0 || res.Events == 0 {
+		t.Fatalf("replay result = %+v; want events and no backfill", res)
+	}
+	assertReplica(t, peer, addedID, added)
+	assertNoReplica(t, peer, ids[1])
+	for _, i := range []int{0, 2, 3, 4} {
+		assertReplica(t, peer, ids[i], contents[i])
+	}
+
+	// * a file created and deleted between syncs never reaches the peer
+	gone := src.upload(t, "short-lived.bin", randomData(t, 64))
+	if _, err := src.Client.Delete(context.Background(), gone); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	mustSync(t, r)
+	assertNoReplica(t, peer, gone)
+	if checkpoint := src.checkpoint(t, testPeer); checkpoint.Seq != src.lastSeq(t) {
+		t.Fatalf("checkpoint seq = %d; want %d", checkpoint.Seq, src.lastSeq(t))
+	}
+}
+
+func TestReplicatorResumesFromCheckpoint(t *testing.T) {
+	src, peer := newInstance(t), newInstance(t)
+	ids := make([]uuid.UUID, 5)
+	contents := make([][]byte, 5)
+	for i := range ids {
+		contents[i] = randomData(t, 2048)
+		ids[i] = src.upload(t, "resume-"+string(rune('a'+i)), contents[i])
+	}
+
+	// * the backfill dies on its fourth file
+	peer.applyBudget.Store(3)
+	res, err := newReplicator(src, peer).Sync(context.Background())
+	if err == nil {
+		t.Fatal("sync succeeded though the peer failed a write")
+	}
+	if res.Files != 3 {
+		t.Fatalf("first sync walked %d files; want 3", res.Files)
+	}
+	checkpoint := src.checkpoint(t, testPeer)
+	if !checkpoint.Backfill || checkpoint.Cursor.ID != ids[2] {
+		t.Fatalf("checkpoint = %+v; want a backfill stopped after %s", checkpoint, ids[2])
+	}
+
+	// * a new replicator picks the backfill up at the cursor instead of starting over
+	peer.applyBudget.Store(-1)
+	res = mustSync(t, newReplicator(src, peer))
+	if res.Files != 2 {
+		t.Fatalf("resumed backfill walked %d files; want 2", res.Files)
+	}
+	for i, id := range ids {
+		assertReplica(t, peer, id, contents[i])
+	}
+
+	// * the replay saves its place after every event, so a failure loses none of them
+	var more []uuid.UUID
+	var moreContents [][]byte
+	for i := 0; i < 3; i++ {
+		data := randomData(t, 512)
+		more = append(more, src.upload(t, "more-"+string(rune('a'+i)), data))
+		moreContents = append(moreContents, data)
+	}
+	before := src.checkpoint(t, testPeer).Seq
+	peer.applyBudget.Store(1)
+	if _, err := newReplicator(src, peer).Sync(context.Background()); err == nil {
+		t.Fatal("sync succeeded though the peer failed a write")
+	}
+	stopped := src.checkpoint(t, testPeer)
+	if stopped.Backfill || stopped.Seq <= before || stopped.Seq >= src.lastSeq(t) {
+		t.Fatalf("checkpoint seq = %d; want between %d and %d", stopped.Seq, before, src.lastSeq(t))
+	}
+	assertReplica(t, peer, more[0], moreContents[0])
+
+	peer.applyBudget.Store(-1)
+	mustSync(t, newReplicator(src, peer))
+	for i, id := range more {
+		assertReplica(t, peer, id, moreContents[i])
+	}
+	if seq := src.checkpoint(t, testPeer).Seq; seq != src.lastSeq(t) {
+		t.Fatalf("checkpoint seq = %d; want %d", seq, src.lastSeq(t))
+	}
+}
+
+func TestReplicatorWaitsOnSeqHoles(t *testing.T) {
+	src, peer := newInstance(t), newInstance(t)
+	ctx := context.Background()
+	r := newReplicator(src, peer)
+	mustSync(t, r)
+
+	// * an open transaction holds a seq below the upload's; the replay must not pass it
+	open, err := src.DB.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer func() { _ = open.Rollback(ctx) }()
+	if _, err := open.Exec(ctx, "INSERT INTO replication_log (file_id, op, filename, updated_at) VALUES ($1, 'upsert', 'in-flight.bin', now())", uuid.New()); err != nil {
+		t.Fatalf("log in-flight event: %v", err)
+	}
+	held := src.lastSeq(t)
+	data := randomData(t, 1024)
+	id := src.upload(t, "after-hole.bin", data)
+
+	res := mustSync(t, r)
+	if res.Events != 0 {
+		t.Fatalf("sent %d events past an open hole; want 0", res.Events)
+	}
+	assertNoReplica(t, peer, id)
+	if seq := src.checkpoint(t, testPeer).Seq; seq != held {
+		t.Fatalf("checkpoint seq = %d; want it held at %d", seq, held)
+	}
+
+	// * once the hole commits, everything after it goes
+	if err := open.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	mustSync(t, r)
+	assertReplica(t, peer, id, data)
+
+	// * a rolled-back transaction leaves a hole that never fills; it is waited on for GapTimeout
+	rolledBack, err := src.DB.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := rolledBack.Exec(ctx, "INSERT INTO replication_log (file_id, op, filename, updated_at) VALUES ($1, 'upsert', 'rolled-back.bin', now())", uuid.New()); err != nil {
+		t.Fatalf("log rolled-back event: %v", err)
+	}
+	if err := rolledBack.Rollback(ctx); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	data = randomData(t, 1024)
+	id = src.upload(t, "after-rollback.bin", data)
+
+	mustSync(t, r)
+	assertNoReplica(t, peer, id)
+
+	r.GapTimeout = 50 * time.Millisecond
+	time.Sleep(2 * r.GapTimeout)
+	mustSync(t, r)
+	assertReplica(t, peer, id, data)
+	if seq := src.checkpoint(t, testPeer).Seq; seq != src.lastSeq(t) {
+		t.Fatalf("checkpoint seq = %d; want %d", seq, src.lastSeq(t))
+	}
+}
+
+func TestReplicatorPruneKeepsEventsAPeerHasNotPassed(t *testing.T) {
+	src, peer := newInstance(t), newInstance(t)
+	for i := 0; i < 3; i++ {
+		src.upload(t, "early-"+string(rune('a'+i)), randomData(t, 256))
+	}
+
+	// * a second peer that has only seen the first three uploads
+	laggard := domain.ReplicationCheckpoint{Peer: "laggard", Seq: src.lastSeq(t)}
+	src.saveCheckpoint(t, laggard)
+	for i := 0; i < 3; i++ {
+		src.upload(t, "late-"+string(rune('a'+i)), randomData(t, 256))
+	}
+	prunable := src.query(t, "SELECT COUNT(*) FROM replication_log WHERE seq <= $1", laggard.Seq)
+
+	r := newReplicator(src, peer)
+	r.GapTimeout = 0
+	res := mustSync(t, r)
+	if res.Pruned != prunable {
+		t.Fatalf("pruned %d events; want the %d the laggard has passed", res.Pruned, prunable)
+	}
+	if first := src.query(t, "SELECT MIN(seq) FROM replication_log"); first <= laggard.Seq {
+		t.Fatalf("oldest event left is %d; want past the laggard's %d", first, laggard.Seq)
+	}
+
+	// * without a peer the replicator prunes everything logged, still up to the laggard only
+	src.upload(t, "no-peer.bin", randomData(t, 256))
+	local := newReplicator(src, nil)
+	if _, err := local.Sync(context.Background()); err != nil {
+		t.Fatalf("sync without peer: %v", err)
+	}
+	if first := src.query(t, "SELECT MIN(seq) FROM replication_log"); first <= laggard.Seq {
+		t.Fatalf("oldest event left is %d; want past the laggard's %d", first, laggard.Seq)
+	}
+
+	// * once the laggard catches up, the rest can go
+	laggard.Seq = src.lastSeq(t)
+	src.saveCheckpoint(t, laggard)
+	mustSync(t, r)
+	if left := src.query(t, "SELECT COUNT(*) FROM replication_log"); left != 0 {
+		t.Fatalf("%d events left after every peer passed them; want 0", left)
+	}
+}
@@ -0,0 +1,55 @@
+package snapshot
+
+import (
+	"fmt"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"slices"
+	"strings"
+	"time"
+)
+
+type retentionRule struct {
+	keep   int
+	reason string
+	bucket func(s domain.Snapshot) string
+}
+
+// retain applies req's keep counts to snapshots, newest first. Each rule keeps the newest
+// snapshot of each of its most recent buckets; a snapshot is kept if any rule keeps it.
+// It returns the reasons for each kept snapshot, by index.
+func retain(snapshots []domain.Snapshot, req web.SnapshotForgetRequest) map[int][]string {
+	rules := []retentionRule{
+		{req.KeepLast, "last snapshot", func(s domain.Snapshot) string { return s.ID.String() }},
+		{req.KeepDaily, "daily snapshot", func(s domain.Snapshot) string { return s.TakenAt.UTC().Format(time.DateOnly) }},
+		{req.KeepWeekly, "weekly snapshot", func(s domain.Snapshot) string {
+			year, week := s.TakenAt.UTC().ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{req.KeepMonthly, "monthly snapshot", func(s domain.Snapshot) string { return s.TakenAt.UTC().Format("2006-01") }},
+	}
+
+	kept := make(map[int][]string)
+	for _, rule := range rules {
+		left, last := rule.keep, ""
+		for i, s := range snapshots {
+			if left == 0 {
+				break
+			}
+			if bucket := rule.bucket(s); bucket != last {
+				kept[i] = append(kept[i], rule.reason)
+				last = bucket
+				left--
+			}
+		}
+	}
+	return kept
+}
+
+// groupKey puts snapshots of the same hostname and paths together, so backups of different
+// trees do not crowd each other out of the policy.
+func groupKey(s domain.Snapshot) string {
+	paths := slices.Clone(s.Paths)
+	slices.Sort(paths)
+	return s.Hostname + "\x00" + strings.Join(paths, "\x00")
+}
@@ -0,0 +1,22 @@
+package snapshot
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"io"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+)
+
+// SnapshotService records directory trees whose file chunks are already in the store, and
+// restores, compares and expires them.
+type SnapshotService interface {
+	Create(ctx context.Context, req web.SnapshotCreateRequest) (web.SnapshotResponse, error)
+	List(ctx context.Context, filter domain.SnapshotFilter) ([]web.SnapshotResponse, error)
+	Get(ctx context.Context, id uuid.UUID) (web.SnapshotResponse, error)
+	Diff(ctx context.Context, from uuid.UUID, to uuid.UUID) (web.SnapshotDiffResponse, error)
+	PrepareRestore(ctx context.Context, id uuid.UUID, subpath string, format string) (RestorePlan, error)
+	Restore(ctx context.Context, plan RestorePlan, w io.Writer) error
+	Forget(ctx context.Context, id uuid.UUID) error
+	ForgetPolicy(ctx context.Context, req web.SnapshotForgetRequest) (web.SnapshotForgetResponse, error)
+}
@@ -0,0 +1,631 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/repository"
+	deletefile "meliocool/bytesize/internal/service/delete"
+	"meliocool/bytesize/internal/service/download"
+	"meliocool/bytesize/internal/service/manifest"
+	"meliocool/bytesize/internal/storage"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	FormatTar   = "tar"
+	FormatTarGz = "tar.gz"
+)
+
+// RestorePlan is a resolved restore: the snapshot and the entries that go into the tar stream.
+type RestorePlan struct {
+	Snapshot domain.Snapshot
+	Entries  []domain.SnapshotEntry
+	Format   string
+}
+
+func (p RestorePlan) ContentType() string {
+	if p.Format == FormatTarGz {
+		return "application/gzip"
+	}
+	return "application/x-tar"
+}
+
+func (p RestorePlan) Filename() string {
+	return "snapshot-" + p.Snapshot.ID.String()[:8] + "-" + p.Snapshot.TakenAt.UTC().Format("20060102-150405") + "." + p.Format
+}
+
+type SnapshotServiceImpl struct {
+	SnapshotRepository  repository.SnapshotRepository
+	FileRepository      repository.FileRepository
+	FileChunkRepository repository.FileChunkRepository
+	ChunkRepository     repository.ChunkRepository
+	ChunkStore          storage.ChunkStore
+	DownloadService     download.DownloadService
+	DeleteService       deletefile.DeleteService
+	DB                  *pgxpool.Pool
+	Validate            *validator.Validate
+	Logger              *slog.Logger
+}
+
+func NewSnapshotService(
+	snapshotRepository repository.SnapshotRepository,
+	fileRepository repository.FileRepository,
+	fileChunkRepository repository.FileChunkRepository,
+	chunkRepository repository.ChunkRepository,
+	chunkStore storage.ChunkStore,
+	downloadService download.DownloadService,
+	deleteService deletefile.DeleteService,
+	db *pgxpool.Pool,
+	validate *validator.Validate,
+	logger *slog.Logger,
+) SnapshotService {
+	return &SnapshotServiceImpl{
+		SnapshotRepository:  snapshotRepository,
+		FileRepository:      fileRepository,
+		FileChunkRepository: fileChunkRepository,
+		ChunkRepository:     chunkRepository,
+		ChunkStore:          chunkStore,
+		DownloadService:     downloadService,
+		DeleteService:       deleteService,
+		DB:                  db,
+		Validate:            validate,
+		Logger:              logger,
+	}
+}
+
+// Create records req as a new snapshot in one transaction. Every chunk must already be in the
+// store; otherwise it returns a *manifest.MissingChunksError and writes nothing.
+func (s *SnapshotServiceImpl) Create(ctx context.Context, req web.SnapshotCreateRequest) (web.SnapshotResponse, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("snapshot_create").Inc()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues("snapshot_create").Observe(time.Since(start).Seconds())
+	}()
+
+	snapshot, err := s.create(ctx, req)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("snapshot_create").Inc()
+		return web.SnapshotResponse{}, err
+	}
+	s.Logger.Info(
+		"snapshot_ok",
+		slog.String("snapshot_id", snapshot.ID.String()),
+		slog.Int("entries", len(req.Entries)),
+		slog.Int64("files", snapshot.FileCount),
+		slog.Int64("total_size", snapshot.TotalSize),
+		slog.Duration("took", time.Since(start)),
+	)
+	return toSnapshotResponse(snapshot, nil), nil
+}
+
+func (s *SnapshotServiceImpl) create(ctx context.Context, req web.SnapshotCreateRequest) (domain.Snapshot, error) {
+	if err := s.Validate.Struct(req); err != nil || len(req.Entries) == 0 {
+		return domain.Snapshot{}, helper.ErrInvalidInput
+	}
+	if err := helper.ValidateLabels(nil, req.Tags); err != nil {
+		return domain.Snapshot{}, err
+	}
+	takenAt := time.Now()
+	if req.TakenAt != nil {
+		takenAt = *req.TakenAt
+	}
+
+	entries, manifests, err := checkEntries(req.Entries)
+	if err != nil {
+		return domain.Snapshot{}, err
+	}
+	snapshot := domain.Snapshot{Hostname: req.Hostname, Paths: req.Paths, Tags: req.Tags, TakenAt: takenAt}
+	seen := make(map[string]bool)
+	var chunks []domain.Chunk
+	var missing []string
+	for i, entry := range entries {
+		if entry.Type != domain.EntryFile {
+			continue
+		}
+		snapshot.FileCount++
+		snapshot.TotalSize += entry.Size
+		for _, c := range manifests[i] {
+			if seen[c.Hash] {
+				continue
+			}
+			seen[c.Hash] = true
+			chunks = append(chunks, domain.Chunk{Hash: c.Hash, Size: c.Size})
+			ok, err := s.ChunkStore.Exists(c.Hash)
+			if err != nil {
+				s.Logger.Error("snapshot_err", slog.String("stage", "exists"), slog.String("hash", c.Hash), slog.Any("err", err))
+				return domain.Snapshot{}, helper.ErrInternal
+			}
+			if !ok {
+				missing = append(missing, c.Hash)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return domain.Snapshot{}, &manifest.MissingChunksError{Hashes: missing}
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return domain.Snapshot{}, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	snapshot, err = s.SnapshotRepository.Create(ctx, tx, snapshot)
+	if err != nil {
+		s.Logger.Error("snapshot_err", slog.String("stage", "create_snapshot_row"), slog.Any("err", err))
+		return domain.Snapshot{}, helper.ErrInternal
+	}
+	for i := 0; i < len(chunks); i += helper.BatchSize {
+		end := min(i+helper.BatchSize, len(chunks))
+		if _, err := s.ChunkRepository.UpsertMany(ctx, tx, chunks[i:end]); err != nil {
+			s.Logger.Error("snapshot_err", slog.String("stage", "upsert_chunks"), slog.String("snapshot_id", snapshot.ID.String()), slog.Any("err", err))
+			return domain.Snapshot{}, helper.ErrInternal
+		}
+	}
+
+	// * each regular file gets a hidden file row holding its manifest, so downloads, deletes and
+	// * chunk GC treat snapshot content like any other file
+	prefix := helper.SnapshotPrefix + snapshot.ID.String() + "/"
+	for i := range entries {
+		if entries[i].Type != domain.EntryFile {
+			continue
+		}
+		file, err := s.FileRepository.Create(ctx, tx, domain.File{Filename: prefix + entries[i].Path})
+		if err != nil {
+			s.Logger.Error("snapshot_err", slog.String("stage", "create_file_row"), slog.String("path", entries[i].Path), slog.Any("err", err))
+			return domain.Snapshot{}, helper.ErrInternal
+		}
+		if err := s.addManifest(ctx, tx, file.ID, manifests[i]); err != nil {
+			s.Logger.Error("snapshot_err", slog.String("stage", "add_chunks"), slog.String("path", entries[i].Path), slog.Any("err", err))
+			return domain.Snapshot{}, helper.ErrInternal
+		}
+		if err := s.FileRepository.UpdateTotals(ctx, tx, file.ID, entries[i].Size); err != nil {
+			return domain.Snapshot{}, helper.ErrInternal
+		}
+		entries[i].FileID = &file.ID
+	}
+	for i := 0; i < len(entries); i += helper.BatchSize {
+		end := min(i+helper.BatchSize, len(entries))
+		if err := s.SnapshotRepository.AddEntries(ctx, tx, snapshot.ID, entries[i:end]); err != nil {
+			s.Logger.Error("snapshot_err", slog.String("stage", "add_entries"), slog.String("snapshot_id", snapshot.ID.String()), slog.Any("err", err))
+			return domain.Snapshot{}, helper.ErrInternal
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return domain.Snapshot{}, helper.ErrInternal
+	}
+	return snapshot, nil
+}
+
+func (s *SnapshotServiceImpl) addManifest(ctx context.Context, tx pgx.Tx, fileID uuid.UUID, chunks []web.ManifestChunk) error {
+	rows := make([]domain.FileChunk, len(chunks))
+	for i, c := range chunks {
+		rows[i] = domain.FileChunk{FileID: fileID, Idx: int64(i), ChunkHash: c.Hash, Size: c.Size}
+	}
+	for i := 0; i < len(rows); i += helper.BatchSize {
+		end := min(i+helper.BatchSize, len(rows))
+		if err := s.FileChunkRepository.AddChunks(ctx, tx, fileID, rows[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEntries validates the tree and turns it into entry rows, returning each regular file's
+// chunks at its entry's index.
+func checkEntries(reqEntries []web.SnapshotEntryRequest) ([]domain.SnapshotEntry, [][]web.ManifestChunk, error) {
+	types := make(map[string]string, len(reqEntries))
+	for _, e := range reqEntries {
+		if !validEntryPath(e.Path) || types[e.Path] != "" {
+			return nil, nil, helper.ErrInvalidInput
+		}
+		types[e.Path] = e.Type
+	}
+
+	entries := make([]domain.SnapshotEntry, len(reqEntries))
+	manifests := make([][]web.ManifestChunk, len(reqEntries))
+	for i, e := range reqEntries {
+		// * nothing may sit below a file or symlink, or the tree could not be restored
+		for dir := path.Dir(e.Path); dir != "."; dir = path.Dir(dir) {
+			if t, ok := types[dir]; ok && t != domain.EntryDir {
+				return nil, nil, helper.ErrInvalidInput
+			}
+		}
+		entry := domain.SnapshotEntry{Path: e.Path, Type: e.Type, Mode: e.Mode, ModTime: e.ModTime}
+		switch e.Type {
+		case domain.EntryFile:
+			if e.Target != "" {
+				return nil, nil, helper.ErrInvalidInput
+			}
+			size, err := manifest.CheckChunks(e.Chunks)
+			if err != nil {
+				return nil, nil, err
+			}
+			entry.Size = size
+			entry.Digest = chunksDigest(e.Chunks)
+			manifests[i] = e.Chunks
+		case domain.EntrySymlink:
+			if e.Target == "" || len(e.Chunks) > 0 {
+				return nil, nil, helper.ErrInvalidInput
+			}
+			entry.LinkTarget = e.Target
+		default:
+			if e.Target != "" || len(e.Chunks) > 0 {
+				return nil, nil, helper.ErrInvalidInput
+			}
+		}
+		entries[i] = entry
+	}
+	return entries, manifests, nil
+}
+
+// validEntryPath accepts clean relative slash paths that stay inside the tree.
+func validEntryPath(p string) bool {
+	if p == "" || p == "." || p == ".." || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "../") || strings.ContainsRune(p, 0) {
+		return false
+	}
+	return path.Clean(p) == p
+}
+
+// chunksDigest identifies a file's content by its chunk list: the SHA-256 of the hex chunk
+// hashes, concatenated.
+func chunksDigest(chunks []web.ManifestChunk) string {
+	h := sha256.New()
+	for _, c := range chunks {
+		io.WriteString(h, c.Hash)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func toSnapshotResponse(snapshot domain.Snapshot, entries []domain.SnapshotEntry) web.SnapshotResponse {
+	resp := web.SnapshotResponse{
+		ID:        snapshot.ID,
+		Hostname:  snapshot.Hostname,
+		Paths:     snapshot.Paths,
+		Tags:      snapshot.Tags,
+		TakenAt:   snapshot.TakenAt,
+		FileCount: snapshot.FileCount,
+		TotalSize: snapshot.TotalSize,
+	}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, web.SnapshotEntryResponse{
+			Path:    e.Path,
+			Type:    e.Type,
+			Mode:    e.Mode,
+			ModTime: e.ModTime,
+			Size:    e.Size,
+			Target:  e.LinkTarget,
+			Digest:  e.Digest,
+		})
+	}
+	return resp
+}
+
+func (s *SnapshotServiceImpl) List(ctx context.Context, filter domain.SnapshotFilter) ([]web.SnapshotResponse, error) {
+	if err := helper.ValidateLabels(nil, filter.Tags); err != nil {
+		return nil, helper.ErrInvalidInput
+	}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	snapshots, err := s.SnapshotRepository.List(ctx, tx, filter)
+	if err != nil {
+		s.Logger.Error("snapshot_err", slog.String("stage", "list"), slog.Any("err", err))
+		return nil, helper.ErrInternal
+	}
+	out := make([]web.SnapshotResponse, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		out = append(out, toSnapshotResponse(snapshot, nil))
+	}
+	return out, nil
+}
+
+// Get returns a snapshot with its entries.
+func (s *SnapshotServiceImpl) Get(ctx context.Context, id uuid.UUID) (web.SnapshotResponse, error) {
+	snapshot, entries, err := s.load(ctx, id)
+	if err != nil {
+		return web.SnapshotResponse{}, err
+	}
+	return toSnapshotResponse(snapshot, entries), nil
+}
+
+func (s *SnapshotServiceImpl) load(ctx context.Context, id uuid.UUID) (domain.Snapshot, []domain.SnapshotEntry, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return domain.Snapshot{}, nil, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	snapshot, err := s.SnapshotRepository.FindByID(ctx, tx, id)
+	if err != nil {
+		if errors.Is(err, helper.ErrNotFound) {
+			return domain.Snapshot{}, nil, helper.ErrNotFound
+		}
+		return domain.Snapshot{}, nil, helper.ErrInternal
+	}
+	entries, err := s.SnapshotRepository.FindEntries(ctx, tx, id)
+	if err != nil {
+		s.Logger.Error("snapshot_err", slog.String("stage", "find_entries"), slog.String("snapshot_id", id.String()), slog.Any("err", err))
+		return domain.Snapshot{}, nil, helper.ErrInternal
+	}
+	return snapshot, entries, nil
+}
+
+// Diff lists the paths that differ from snapshot from to snapshot to, by path.
+func (s *SnapshotServiceImpl) Diff(ctx context.Context, from uuid.UUID, to uuid.UUID) (web.SnapshotDiffResponse, error) {
+	_, oldEntries, err := s.load(ctx, from)
+	if err != nil {
+		return web.SnapshotDiffResponse{}, err
+	}
+	_, newEntries, err := s.load(ctx, to)
+	if err != nil {
+		return web.SnapshotDiffResponse{}, err
+	}
+
+	return diffEntries(from, to, oldEntries, newEntries), nil
+}
+
+// diffEntries compares two entry lists sorted by path.
+func diffEntries(from uuid.UUID, to uuid.UUID, oldEntries []domain.SnapshotEntry, newEntries []domain.SnapshotEntry) web.SnapshotDiffResponse {
+	diff := web.SnapshotDiffResponse{From: from, To: to, Changes: []web.SnapshotChange{}}
+	// * both lists are sorted by path, so one merge pass finds every change in order
+	i, j := 0, 0
+	for i < len(oldEntries) || j < len(newEntries) {
+		switch {
+		case j == len(newEntries) || (i < len(oldEntries) && oldEntries[i].Path < newEntries[j].Path):
+			old := oldEntries[i]
+			diff.Removed++
+			diff.RemovedBytes += old.Size
+			diff.Changes = append(diff.Changes, web.SnapshotChange{Path: old.Path, Change: "removed", Type: old.Type, OldSize: old.Size})
+			i++
+		case i == len(oldEntries) || newEntries[j].Path < oldEntries[i].Path:
+			cur := newEntries[j]
+			diff.Added++
+			diff.AddedBytes += cur.Size
+			diff.Changes = append(diff.Changes, web.SnapshotChange{Path: cur.Path, Change: "added", Type: cur.Type, NewSize: cur.Size})
+			j++
+		default:
+			old, cur := oldEntries[i], newEntries[j]
+			change := web.SnapshotChange{Path: cur.Path, Type: cur.Type, OldSize: old.Size, NewSize: cur.Size}
+			switch {
+			case old.Type != cur.Type || old.Digest != cur.Digest || old.LinkTarget != cur.LinkTarget:
+				change.Change = "modified"
+				diff.Modified++
+				diff.AddedBytes += cur.Size
+				diff.RemovedBytes += old.Size
+			case old.Mode != cur.Mode || !old.ModTime.Equal(cur.ModTime):
+				change.Change = "metadata"
+				diff.Metadata++
+			}
+			if change.Change != "" {
+				diff.Changes = append(diff.Changes, change)
+			}
+			i++
+			j++
+		}
+	}
+	return diff
+}
+
+// PrepareRestore resolves the entries a restore writes: the whole tree, or only subpath and what
+// is below it.
+func (s *SnapshotServiceImpl) PrepareRestore(ctx context.Context, id uuid.UUID, subpath string, format string) (RestorePlan, error) {
+	if format == "" {
+		format = FormatTar
+	}
+	if format != FormatTar && format != FormatTarGz {
+		return RestorePlan{}, helper.ErrInvalidInput
+	}
+	if subpath != "" && !validEntryPath(subpath) {
+		return RestorePlan{}, helper.ErrInvalidInput
+	}
+
+	snapshot, entries, err := s.load(ctx, id)
+	if err != nil {
+		return RestorePlan{}, err
+	}
+	plan := RestorePlan{Snapshot: snapshot, Format: format}
+	for _, entry := range entries {
+		if subpath != "" && entry.Path != subpath && !strings.HasPrefix(entry.Path, subpath+"/") {
+			continue
+		}
+		if entry.Type == domain.EntryFile && entry.FileID == nil {
+			s.Logger.Error("snapshot_err", slog.String("stage", "restore"), slog.String("snapshot_id", id.String()), slog.String("path", entry.Path), slog.String("err", "manifest row deleted"))
+			return RestorePlan{}, helper.ErrInternal
+		}
+		plan.Entries = append(plan.Entries, entry)
+	}
+	if len(plan.Entries) == 0 {
+		return RestorePlan{}, helper.ErrNotFound
+	}
+	return plan, nil
+}
+
+// Restore streams plan as a tar archive with the entries' modes, mtimes and symlinks.
+func (s *SnapshotServiceImpl) Restore(ctx context.Context, plan RestorePlan, w io.Writer) error {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("snapshot_restore").Inc()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues("snapshot_restore").Observe(time.Since(start).Seconds())
+	}()
+
+	var err error
+	if plan.Format == FormatTarGz {
+		gz := gzip.NewWriter(w)
+		err = s.writeTar(ctx, plan, gz)
+		if err == nil {
+			err = gz.Close()
+		}
+	} else {
+		err = s.writeTar(ctx, plan, w)
+	}
+	if err != nil {
+		s.Logger.Error("snapshot_err", slog.String("stage", "restore"), slog.String("snapshot_id", plan.Snapshot.ID.String()), slog.Any("err", err))
+		metrics.ErrorsTotal.WithLabelValues("snapshot_restore").Inc()
+		return err
+	}
+	s.Logger.Info(
+		"snapshot_restore_ok",
+		slog.String("snapshot_id", plan.Snapshot.ID.String()),
+		slog.Int("entries", len(plan.Entries)),
+		slog.Duration("took", time.Since(start)),
+	)
+	return nil
+}
+
+func (s *SnapshotServiceImpl) writeTar(ctx context.Context, plan RestorePlan, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, entry := range plan.Entries {
+		header := &tar.Header{Name: entry.Path, Mode: entry.Mode, ModTime: entry.ModTime, Format: tar.FormatPAX}
+		switch entry.Type {
+		case domain.EntryDir:
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+		case domain.EntrySymlink:
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.LinkTarget
+		default:
+			header.Typeflag = tar.TypeReg
+			header.Size = entry.Size
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.Type == domain.EntryFile && entry.Size > 0 {
+			if err := s.DownloadService.Stream(ctx, *entry.FileID, tw); err != nil {
+				return fmt.Errorf("entry %s: %w", entry.Path, err)
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// Forget deletes a snapshot and the manifests of its files; chunks no longer referenced by any
+// file are garbage-collected as on any delete.
+func (s *SnapshotServiceImpl) Forget(ctx context.Context, id uuid.UUID) error {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("snapshot_forget").Inc()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues("snapshot_forget").Observe(time.Since(start).Seconds())
+	}()
+
+	if err := s.forget(ctx, id); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("snapshot_forget").Inc()
+		return err
+	}
+	return nil
+}
+
+func (s *SnapshotServiceImpl) forget(ctx context.Context, id uuid.UUID) error {
+	_, entries, err := s.load(ctx, id)
+	if err != nil {
+		return err
+	}
+	// * manifests go first: a forget cut short leaves the snapshot listed, and running it again finishes the job
+	for _, entry := range entries {
+		if entry.FileID == nil {
+			continue
+		}
+		if _, err := s.DeleteService.Delete(ctx, *entry.FileID); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			s.Logger.Error("snapshot_err", slog.String("stage", "forget_file"), slog.String("snapshot_id", id.String()), slog.String("path", entry.Path), slog.Any("err", err))
+			return helper.ErrInternal
+		}
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := s.SnapshotRepository.Delete(ctx, tx, id); err != nil {
+		if errors.Is(err, helper.ErrNotFound) {
+			return helper.ErrNotFound
+		}
+		return helper.ErrInternal
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return helper.ErrInternal
+	}
+	s.Logger.Info("snapshot_forget_ok", slog.String("snapshot_id", id.String()), slog.Int("entries", len(entries)))
+	return nil
+}
+
+// ForgetPolicy keeps the snapshots req's retention policy selects and forgets the others, or
+// only reports them when req.DryRun is set.
+func (s *SnapshotServiceImpl) ForgetPolicy(ctx context.Context, req web.SnapshotForgetRequest) (web.SnapshotForgetResponse, error) {
+	if err := s.Validate.Struct(req); err != nil {
+		return web.SnapshotForgetResponse{}, helper.ErrInvalidInput
+	}
+	// * a policy that keeps nothing would forget every matching snapshot; make the caller ask for something
+	if req.KeepLast+req.KeepDaily+req.KeepWeekly+req.KeepMonthly == 0 {
+		return web.SnapshotForgetResponse{}, helper.ErrInvalidInput
+	}
+	if err := helper.ValidateLabels(nil, req.Tags); err != nil {
+		return web.SnapshotForgetResponse{}, helper.ErrInvalidInput
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return web.SnapshotForgetResponse{}, helper.ErrInternal
+	}
+	snapshots, err := s.SnapshotRepository.List(ctx, tx, domain.SnapshotFilter{Hostname: req.Hostname, Tags: req.Tags})
+	_ = tx.Rollback(ctx)
+	if err != nil {
+		s.Logger.Error("snapshot_err", slog.String("stage", "list"), slog.Any("err", err))
+		return web.SnapshotForgetResponse{}, helper.ErrInternal
+	}
+
+	groups := make(map[string][]domain.Snapshot)
+	var order []string
+	for _, snapshot := range snapshots {
+		key := groupKey(snapshot)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], snapshot)
+	}
+
+	resp := web.SnapshotForgetResponse{Keep: []web.SnapshotKept{}, Remove: []web.SnapshotResponse{}, DryRun: req.DryRun}
+	var remove []uuid.UUID
+	for _, key := range order {
+		group := groups[key]
+		kept := retain(group, req)
+		for i, snapshot := range group {
+			if reasons, ok := kept[i]; ok {
+				resp.Keep = append(resp.Keep, web.SnapshotKept{Snapshot: toSnapshotResponse(snapshot, nil), Reasons: reasons})
+				continue
+			}
+			resp.Remove = append(resp.Remove, toSnapshotResponse(snapshot, nil))
+			remove = append(remove, snapshot.ID)
+		}
+	}
+	if req.DryRun {
+		return resp, nil
+	}
+	for _, id := range remove {
+		if err := s.Forget(ctx, id); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			return web.SnapshotForgetResponse{}, err
+		}
+	}
+	return resp, nil
+}
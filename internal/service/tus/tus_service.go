@@ -0,0 +1,16 @@
+package tus
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"io"
+	"meliocool/bytesize/internal/model/web"
+)
+
+type TusService interface {
+	Admit() (func(), error)
+	Create(ctx context.Context, req web.TusCreateRequest) (Upload, error)
+	Get(ctx context.Context, id uuid.UUID) (Upload, error)
+	Write(ctx context.Context, id uuid.UUID, offset int64, body io.Reader, checksum *Checksum) (Upload, error)
+	Terminate(ctx context.Context, id uuid.UUID) error
+}
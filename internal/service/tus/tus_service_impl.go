@@ -0,0 +1,536 @@
+package tus
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"hash"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	"meliocool/bytesize/internal/repository"
+	deletefile "meliocool/bytesize/internal/service/delete"
+	"meliocool/bytesize/internal/service/upload"
+	"meliocool/bytesize/internal/storage"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// * an unfinished upload is a file row named helper.TusUploadPrefix + filename whose total_size is
+// * the upload offset and whose manifest holds every byte received so far. Its expiry is the tus
+// * upload expiry, so the reaper cleans up abandoned uploads. On completion the manifest moves to
+// * the real file, which keeps the upload id in its metadata for HEAD after completion.
+const (
+	metaLength    = "tus:length"
+	metaExpiresAt = "tus:expires-at"
+	metaType      = "tus:content-type"
+	metaUploadID  = "tus:upload-id"
+)
+
+var (
+	ErrOffsetMismatch   = errors.New("upload offset mismatch")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// ChecksumAlgorithms lists the Upload-Checksum algorithms Write accepts.
+var ChecksumAlgorithms = []string{"sha1", "sha256", "md5"}
+
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	case "md5":
+		return md5.New()
+	}
+	return nil
+}
+
+type Upload struct {
+	ID        uuid.UUID
+	Filename  string
+	Length    int64
+	Offset    int64
+	ExpiresAt *time.Time
+	// * FileID is set once the upload is complete
+	FileID uuid.UUID
+}
+
+type TusServiceImpl struct {
+	UploadService       upload.UploadService
+	DeleteService       deletefile.DeleteService
+	FileRepository      repository.FileRepository
+	FileChunkRepository repository.FileChunkRepository
+	ChunkRepository     repository.ChunkRepository
+	ChunkStore          storage.ChunkStore
+	DB                  *pgxpool.Pool
+	Validate            *validator.Validate
+	Logger              *slog.Logger
+
+	locks sync.Map
+}
+
+func NewTusService(
+	uploadService upload.UploadService,
+	deleteService deletefile.DeleteService,
+	fileRepository repository.FileRepository,
+	fileChunkRepository repository.FileChunkRepository,
+	chunkRepository repository.ChunkRepository,
+	chunkStore storage.ChunkStore,
+	db *pgxpool.Pool,
+	validate *validator.Validate,
+	logger *slog.Logger,
+) TusService {
+	return &TusServiceImpl{
+		UploadService:       uploadService,
+		DeleteService:       deleteService,
+		FileRepository:      fileRepository,
+		FileChunkRepository: fileChunkRepository,
+		ChunkRepository:     chunkRepository,
+		ChunkStore:          chunkStore,
+		DB:                  db,
+		Validate:            validate,
+		Logger:              logger,
+	}
+}
+
+// lock serialises PATCH and DELETE per upload within this process; the offset is re-checked in
+// the commit transaction for anything that slips past it.
+func (t *TusServiceImpl) lock(id uuid.UUID) func() {
+	mu, _ := t.locks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+func newUpload(f domain.File) (Upload, error) {
+	length, err := strconv.ParseInt(f.Metadata[metaLength], 10, 64)
+	if err != nil || !strings.HasPrefix(f.Filename, helper.TusUploadPrefix) {
+		return Upload{}, helper.ErrNotFound
+	}
+	return Upload{
+		ID:        f.ID,
+		Filename:  strings.TrimPrefix(f.Filename, helper.TusUploadPrefix),
+		Length:    length,
+		Offset:    f.TotalSize,
+		ExpiresAt: f.ExpiresAt,
+	}, nil
+}
+
+func (t *TusServiceImpl) Admit() (func(), error) {
+	return t.UploadService.Admit()
+}
+
+func (t *TusServiceImpl) Create(ctx context.Context, req web.TusCreateRequest) (Upload, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("tus_create").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("tus_create").Observe(time.Since(start).Seconds()) }()
+
+	if err := t.Validate.Struct(req); err != nil || helper.ReservedFilename(req.Filename) {
+		metrics.ErrorsTotal.WithLabelValues("tus_create").Inc()
+		return Upload{}, helper.ErrInvalidInput
+	}
+	if req.Length > helper.MaxBytes {
+		metrics.ErrorsTotal.WithLabelValues("tus_create").Inc()
+		return Upload{}, helper.ErrTooLarge
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		metrics.ErrorsTotal.WithLabelValues("tus_create").Inc()
+		return Upload{}, helper.ErrInvalidInput
+	}
+	if err := helper.ValidateLabels(req.Metadata, req.Tags); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("tus_create").Inc()
+		return Upload{}, helper.ErrInvalidInput
+	}
+	metadata := map[string]string{metaLength: strconv.FormatInt(req.Length, 10)}
+	for k, v := range req.Metadata {
+		if strings.HasPrefix(k, "tus:") {
+			metrics.ErrorsTotal.WithLabelValues("tus_create").Inc()
+			return Upload{}, helper.ErrInvalidInput
+		}
+		metadata[k] = v
+	}
+	if req.ExpiresAt != nil {
+		metadata[metaExpiresAt] = req.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	if req.ContentType != "" {
+		metadata[metaType] = req.ContentType
+	}
+	expiresAt := time.Now().Add(helper.TusUploadTTL)
+
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("tus_create").Inc()
+		return Upload{}, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	staged, err := t.FileRepository.Create(ctx, tx, domain.File{
+		Filename:    helper.TusUploadPrefix + req.Filename,
+		ContentType: req.ContentType,
+		ExpiresAt:   &expiresAt,
+		Metadata:    metadata,
+		Tags:        req.Tags,
+	})
+	if err != nil {
+		t.Logger.Error("tus_err", slog.String("stage", "create"), slog.String("filename", req.Filename), slog.Any("err", err))
+		metrics.ErrorsTotal.WithLabelValues("tus_create").Inc()
+		return Upload{}, helper.ErrInternal
+	}
+	up, _ := newUpload(staged)
+
+	// * an empty upload is complete as soon as it exists
+	if req.Length == 0 {
+		file, err := t.complete(ctx, tx, staged)
+		if err != nil {
+			metrics.ErrorsTotal.WithLabelValues("tus_create").Inc()
+			return Upload{}, err
+		}
+		up.FileID, up.ExpiresAt = file.ID, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("tus_create").Inc()
+		return Upload{}, helper.ErrInternal
+	}
+	t.Logger.Info("tus_create", slog.String("upload_id", up.ID.String()), slog.String("filename", up.Filename), slog.Int64("length", up.Length))
+	return up, nil
+}
+
+// Get returns the upload's progress. A completed upload is found through the file it became.
+func (t *TusServiceImpl) Get(ctx context.Context, id uuid.UUID) (Upload, error) {
+	if id == uuid.Nil {
+		return Upload{}, helper.ErrNotFound
+	}
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		return Upload{}, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	staged, err := t.FileRepository.FindByID(ctx, tx, id)
+	if err == nil {
+		return newUpload(staged)
+	}
+	if !errors.Is(err, helper.ErrNotFound) {
+		return Upload{}, helper.ErrInternal
+	}
+
+	files, err := t.FileRepository.List(ctx, tx, domain.FileFilter{Metadata: map[string]string{metaUploadID: id.String()}})
+	if err != nil {
+		return Upload{}, helper.ErrInternal
+	}
+	if len(files) == 0 {
+		return Upload{}, helper.ErrNotFound
+	}
+	return Upload{
+		ID:       id,
+		Filename: files[0].Filename,
+		Length:   files[0].TotalSize,
+		Offset:   files[0].TotalSize,
+		FileID:   files[0].ID,
+	}, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Write appends body at offset. The chunker only cuts chunks at multiples of helper.ChunkSize,
+// so when the offset falls inside a chunk, that partial last chunk is read back and re-chunked
+// together with the new bytes. Chunks reach the ChunkStore as they are read; their rows and the
+// manifest are committed once the body ends. An interrupted body keeps what arrived, unless a
+// checksum was given, in which case nothing is committed unless the whole body matches.
+func (t *TusServiceImpl) Write(ctx context.Context, id uuid.UUID, offset int64, body io.Reader, checksum *Checksum) (Upload, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("tus_patch").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("tus_patch").Observe(time.Since(start).Seconds()) }()
+
+	var sum hash.Hash
+	if checksum != nil {
+		if sum = newChecksumHash(checksum.Algorithm); sum == nil {
+			metrics.ErrorsTotal.WithLabelValues("tus_patch").Inc()
+			return Upload{}, helper.ErrInvalidInput
+		}
+	}
+
+	unlock := t.lock(id)
+	defer unlock()
+
+	up, err := t.Get(ctx, id)
+	if err != nil {
+		metrics.ErrorsTotal.WithLabelValues("tus_patch").Inc()
+		return Upload{}, err
+	}
+	if offset != up.Offset {
+		metrics.ErrorsTotal.WithLabelValues("tus_patch").Inc()
+		return up, ErrOffsetMismatch
+	}
+	remaining := up.Length - up.Offset
+
+	// * the request context dies with the connection, but whatever arrived is still committed
+	storeCtx := context.WithoutCancel(ctx)
+
+	firstIdx := up.Offset / helper.ChunkSize
+	var tail domain.FileChunk
+	var tailBytes []byte
+	if up.Offset%helper.ChunkSize != 0 {
+		tail, tailBytes, err = t.readTail(storeCtx, up.ID)
+		if err != nil {
+			t.Logger.Error("tus_err", slog.String("stage", "read_tail"), slog.String("upload_id", up.ID.String()), slog.Any("err", err))
+			metrics.ErrorsTotal.WithLabelValues("tus_patch").Inc()
+			return Upload{}, helper.ErrInternal
+		}
+	}
+
+	var in io.Reader = io.LimitReader(body, remaining)
+	if sum != nil {
+		in = io.TeeReader(in, sum)
+	}
+	counter := &countingReader{r: in}
+	chunks, readErr := t.UploadService.StoreChunks(storeCtx, io.MultiReader(bytes.NewReader(tailBytes), counter), firstIdx)
+	if chunks == nil && errors.Is(readErr, helper.ErrInternal) {
+		metrics.ErrorsTotal.WithLabelValues("tus_patch").Inc()
+		return Upload{}, helper.ErrInternal
+	}
+	if readErr != nil {
+		t.Logger.Warn("tus_interrupted", slog.String("upload_id", up.ID.String()), slog.Int64("received", counter.n), slog.Any("err", readErr))
+	}
+
+	if readErr == nil && counter.n == remaining {
+		var extra [1]byte
+		if n, _ := io.ReadFull(body, extra[:]); n > 0 {
+			metrics.ErrorsTotal.WithLabelValues("tus_patch").Inc()
+			return up, helper.ErrTooLarge
+		}
+	}
+	if sum != nil && (readErr != nil || !bytes.Equal(sum.Sum(nil), checksum.Sum)) {
+		metrics.ErrorsTotal.WithLabelValues("tus_patch").Inc()
+		return up, ErrChecksumMismatch
+	}
+	if counter.n == 0 {
+		return up, nil
+	}
+
+	staged, err := t.commit(storeCtx, up, chunks, tail, counter.n)
+	if err != nil {
+		if !errors.Is(err, ErrOffsetMismatch) {
+			t.Logger.Error("tus_err", slog.String("stage", "commit"), slog.String("upload_id", up.ID.String()), slog.Any("err", err))
+		}
+		metrics.ErrorsTotal.WithLabelValues("tus_patch").Inc()
+		return Upload{}, err
+	}
+	metrics.BytesUploadedTotal.Add(float64(counter.n))
+
+	up.Offset += counter.n
+	if up.Offset == up.Length {
+		up.FileID, up.ExpiresAt = staged.ID, nil
+		t.locks.Delete(up.ID)
+		t.Logger.Info("tus_complete", slog.String("upload_id", up.ID.String()), slog.String("file_id", staged.ID.String()), slog.Int64("total_size", up.Length))
+	}
+	return up, nil
+}
+
+// readTail returns the last manifest entry of the upload and its bytes.
+func (t *TusServiceImpl) readTail(ctx context.Context, id uuid.UUID) (domain.FileChunk, []byte, error) {
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		return domain.FileChunk{}, nil, err
+	}
+	manifest, err := t.FileChunkRepository.FindByFileID(ctx, tx, id)
+	_ = tx.Rollback(ctx)
+	if err != nil {
+		return domain.FileChunk{}, nil, err
+	}
+	if len(manifest) == 0 {
+		return domain.FileChunk{}, nil, helper.ErrInternal
+	}
+	tail := manifest[len(manifest)-1]
+
+	rc, _, err := t.ChunkStore.Get(tail.ChunkHash)
+	if err != nil {
+		return domain.FileChunk{}, nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return domain.FileChunk{}, nil, err
+	}
+	if int64(len(data)) != tail.Size {
+		return domain.FileChunk{}, nil, helper.ErrInternal
+	}
+	return tail, data, nil
+}
+
+// commit records chunks as the manifest from their first index on, replacing the old partial
+// tail, and moves the offset forward by received bytes. The last write also completes the upload.
+// It returns the finished file, or the zero File while the upload is still open.
+func (t *TusServiceImpl) commit(ctx context.Context, up Upload, chunks []domain.FileChunk, tail domain.FileChunk, received int64) (domain.File, error) {
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		return domain.File{}, helper.ErrInternal
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	staged, err := t.FileRepository.FindByID(ctx, tx, up.ID)
+	if err != nil {
+		return domain.File{}, err
+	}
+	if staged.TotalSize != up.Offset {
+		return domain.File{}, ErrOffsetMismatch
+	}
+
+	rows := make([]domain.Chunk, 0, len(chunks))
+	seen := make(map[string]bool, len(chunks))
+	for _, c := range chunks {
+		if seen[c.ChunkHash] {
+			continue
+		}
+		seen[c.ChunkHash] = true
+		rows = append(rows, domain.Chunk{Hash: c.ChunkHash, Size: c.Size})
+	}
+	if _, err := t.ChunkRepository.UpsertMany(ctx, tx, rows); err != nil {
+		return domain.File{}, err
+	}
+	if tail.ChunkHash != "" {
+		if _, err := t.FileChunkRepository.DeleteFrom(ctx, tx, up.ID, tail.Idx); err != nil {
+			return domain.File{}, err
+		}
+	}
+	if err := t.FileChunkRepository.AddChunks(ctx, tx, up.ID, chunks); err != nil {
+		return domain.File{}, err
+	}
+	staged.TotalSize = up.Offset + received
+	if err := t.FileRepository.UpdateTotals(ctx, tx, up.ID, staged.TotalSize); err != nil {
+		return domain.File{}, err
+	}
+	orphanTail := false
+	if tail.ChunkHash != "" && !seen[tail.ChunkHash] {
+		if orphanTail, err = t.ChunkRepository.DeleteOrphan(ctx, tx, tail.ChunkHash); err != nil {
+			return domain.File{}, err
+		}
+	}
+
+	var file domain.File
+	if staged.TotalSize == up.Length {
+		if file, err = t.complete(ctx, tx, staged); err != nil {
+			return domain.File{}, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return domain.File{}, err
+	}
+	if orphanTail {
+		_ = t.ChunkStore.Delete(tail.ChunkHash)
+	}
+	return file, nil
+}
+
+// complete turns the staged upload into the real file: a new row carrying the declared name,
+// type, expiry and labels, the staged manifest cloned onto it, and the staged row dropped.
+func (t *TusServiceImpl) complete(ctx context.Context, tx pgx.Tx, staged domain.File) (domain.File, error) {
+	file := domain.File{
+		Filename:    strings.TrimPrefix(staged.Filename, helper.TusUploadPrefix),
+		TotalSize:   staged.TotalSize,
+		ContentType: staged.Metadata[metaType],
+		Metadata:    map[string]string{metaUploadID: staged.ID.String()},
+		Tags:        staged.Tags,
+	}
+	for k, v := range staged.Metadata {
+		if !strings.HasPrefix(k, "tus:") {
+			file.Metadata[k] = v
+		}
+	}
+	if raw, ok := staged.Metadata[metaExpiresAt]; ok {
+		expiresAt, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return domain.File{}, helper.ErrInternal
+		}
+		file.ExpiresAt = &expiresAt
+	}
+	if file.ContentType == "" {
+		contentType, err := t.sniff(ctx, tx, staged.ID)
+		if err != nil {
+			return domain.File{}, helper.ErrInternal
+		}
+		file.ContentType = contentType
+	}
+
+	created, err := t.FileRepository.Create(ctx, tx, file)
+	if err != nil {
+		return domain.File{}, err
+	}
+	if _, err := t.FileChunkRepository.CloneManifest(ctx, tx, staged.ID, created.ID); err != nil {
+		return domain.File{}, err
+	}
+	if err := t.FileRepository.Delete(ctx, tx, staged.ID); err != nil {
+		return domain.File{}, err
+	}
+	return created, nil
+}
+
+// sniff detects the content type from the head of the first chunk, as Upload does.
+func (t *TusServiceImpl) sniff(ctx context.Context, tx pgx.Tx, id uuid.UUID) (string, error) {
+	manifest, err := t.FileChunkRepository.FindByFileID(ctx, tx, id)
+	if err != nil {
+		return "", err
+	}
+	if len(manifest) == 0 {
+		return mimetype.Detect(nil).String(), nil
+	}
+	rc, _, err := t.ChunkStore.Get(manifest[0].ChunkHash)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	head := make([]byte, helper.SniffBytes)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return mimetype.Detect(head[:n]).String(), nil
+}
+
+// Terminate deletes an unfinished upload and the chunks only it referenced.
+func (t *TusServiceImpl) Terminate(ctx context.Context, id uuid.UUID) error {
+	unlock := t.lock(id)
+	defer unlock()
+
+	up, err := t.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if up.FileID != uuid.Nil {
+		return helper.ErrNotFound
+	}
+	if _, err := t.DeleteService.Delete(ctx, up.ID); err != nil {
+		return err
+	}
+	t.locks.Delete(id)
+	t.Logger.Info("tus_terminate", slog.String("upload_id", id.String()))
+	return nil
+}
@@ -0,0 +1,123 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/sync/semaphore"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"sync"
+)
+
+// Admission bounds server-wide upload load: at most MaxUploads uploads run at once and all
+// pipelines together hold at most MemoryBytes of chunk buffers. A nil *Admission admits
+// everything.
+type Admission struct {
+	MaxUploads  int64
+	MemoryBytes int64
+	slots       *semaphore.Weighted
+	memory      *semaphore.Weighted
+}
+
+func NewAdmission(maxUploads int, memoryBytes int64) *Admission {
+	// * a budget below one chunk would stall every pipeline on its first read
+	memoryBytes = max(memoryBytes, helper.ChunkSize)
+	return &Admission{
+		MaxUploads:  int64(maxUploads),
+		MemoryBytes: memoryBytes,
+		slots:       semaphore.NewWeighted(int64(maxUploads)),
+		memory:      semaphore.NewWeighted(memoryBytes),
+	}
+}
+
+// Admit takes an upload slot without waiting. It returns helper.ErrUnavailable when every
+// slot is taken; otherwise the caller must call release once the upload is finished.
+func (a *Admission) Admit() (func(), error) {
+	if a == nil {
+		return func() {}, nil
+	}
+	if !a.slots.TryAcquire(1) {
+		metrics.UploadsRejectedTotal.Inc()
+		return nil, helper.ErrUnavailable
+	}
+	metrics.UploadsInFlight.Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.slots.Release(1)
+			metrics.UploadsInFlight.Dec()
+		})
+	}, nil
+}
+
+// bufferLease tracks the budget one pipeline holds so an aborted pipeline can hand back
+// whatever its in-flight chunks still hold.
+type bufferLease struct {
+	admission *Admission
+	mu        sync.Mutex
+	held      int64
+	closed    bool
+}
+
+var errLeaseClosed = errors.New("upload buffer lease closed")
+
+func (a *Admission) lease() *bufferLease {
+	return &bufferLease{admission: a}
+}
+
+// acquire takes n bytes of the budget. It fails once ctx is done or the lease is closed: a
+// stage still running after its upload gave up must not take budget nothing will hand back.
+func (l *bufferLease) acquire(ctx context.Context, n int64) error {
+	// * a semaphore Acquire can succeed on a done ctx, so that is checked first
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l.admission != nil {
+		if err := l.admission.memory.Acquire(ctx, n); err != nil {
+			return err
+		}
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		if l.admission != nil {
+			l.admission.memory.Release(n)
+		}
+		return errLeaseClosed
+	}
+	l.held += n
+	l.mu.Unlock()
+	metrics.UploadInFlightBytes.Add(float64(n))
+	return nil
+}
+
+func (l *bufferLease) release(n int64) {
+	l.mu.Lock()
+	n = min(n, l.held)
+	l.held -= n
+	l.mu.Unlock()
+	if n <= 0 {
+		return
+	}
+	if l.admission != nil {
+		l.admission.memory.Release(n)
+	}
+	metrics.UploadInFlightBytes.Sub(float64(n))
+}
+
+// close hands back everything the lease holds and refuses later acquires; buffers released
+// after it are no-ops.
+func (l *bufferLease) close() {
+	l.mu.Lock()
+	l.closed = true
+	n := l.held
+	l.mu.Unlock()
+	l.release(n)
+}
+
+var chunkBuffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, helper.ChunkSize)
+		return &b
+	},
+}
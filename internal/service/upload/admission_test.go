@@ -0,0 +1,122 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/storage"
+	"testing"
+	"time"
+)
+
+// failingStore fails every Put after the first ok ones.
+type failingStore struct {
+	*memStore
+	ok int
+}
+
+func (f *failingStore) Put(hash string, reader io.Reader, size int64) error {
+	f.mu.Lock()
+	stored := len(f.chunks)
+	f.mu.Unlock()
+	if stored >= f.ok {
+		return errors.New("disk full")
+	}
+	return f.memStore.Put(hash, reader, size)
+}
+
+// gatedStore blocks every Put until gate is closed.
+type gatedStore struct {
+	*memStore
+	gate chan struct{}
+}
+
+func (g *gatedStore) Put(hash string, reader io.Reader, size int64) error {
+	<-g.gate
+	return g.memStore.Put(hash, reader, size)
+}
+
+func newAbortService(store storage.ChunkStore) *UploadServiceImpl {
+	return &UploadServiceImpl{
+		ChunkStore:  store,
+		HashWorkers: 2,
+		Admission:   NewAdmission(4, 2*helper.ChunkSize),
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// assertBudgetReturned fails unless the whole memory budget can be taken again shortly.
+func assertBudgetReturned(t *testing.T, a *Admission) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !a.memory.TryAcquire(a.MemoryBytes) {
+		if time.Now().After(deadline) {
+			t.Fatal("upload buffer budget was not handed back")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.memory.Release(a.MemoryBytes)
+}
+
+func randomChunks(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n*helper.ChunkSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestStoreChunksReturnsBudgetWhenStoreFails(t *testing.T) {
+	for range 5 {
+		u := newAbortService(&failingStore{memStore: newMemStore(), ok: 1})
+
+		if _, err := u.StoreChunks(context.Background(), bytes.NewReader(randomChunks(t, 8)), 0); err == nil {
+			t.Fatal("StoreChunks succeeded against a failing store")
+		}
+		assertBudgetReturned(t, u.Admission)
+	}
+}
+
+func TestStoreChunksReturnsBudgetWhenCancelled(t *testing.T) {
+	store := &gatedStore{memStore: newMemStore(), gate: make(chan struct{})}
+	u := newAbortService(store)
+
+	// * the stores are held, so the chunker stalls on the budget until the ctx is cancelled
+	data := randomChunks(t, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = u.StoreChunks(ctx, bytes.NewReader(data), 0)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	close(store.gate)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StoreChunks did not return after its ctx was cancelled")
+	}
+	assertBudgetReturned(t, u.Admission)
+}
+
+func TestLeaseRefusesAcquireAfterClose(t *testing.T) {
+	a := NewAdmission(1, helper.ChunkSize)
+	lease := a.lease()
+	if err := lease.acquire(context.Background(), helper.ChunkSize); err != nil {
+		t.Fatal(err)
+	}
+	lease.close()
+	if err := lease.acquire(context.Background(), helper.ChunkSize); !errors.Is(err, errLeaseClosed) {
+		t.Fatalf("acquire after close = %v; want errLeaseClosed", err)
+	}
+	// * a buffer released after close must not hand its budget back a second time
+	lease.release(helper.ChunkSize)
+	assertBudgetReturned(t, a)
+}
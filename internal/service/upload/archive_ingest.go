@@ -0,0 +1,208 @@
+package upload
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/metrics"
+	"meliocool/bytesize/internal/model/web"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicZip  = []byte("PK\x03\x04")
+)
+
+// archiveMember is one regular file pulled out of an archive.
+type archiveMember struct {
+	Name   string
+	Size   int64
+	Reader io.Reader
+}
+
+// UploadArchive runs every regular member of a tar/zip through Upload as its own file,
+// keeping the member path (under req.Prefix) as the filename. When a member fails, the members
+// already stored are deleted again, so the archive is ingested whole or not at all.
+func (u *UploadServiceImpl) UploadArchive(ctx context.Context, req web.ArchiveUploadRequest) (web.ArchiveUploadResponse, error) {
+	start := time.Now()
+	metrics.RequestsTotal.WithLabelValues("upload_archive").Inc()
+	defer func() { metrics.RequestDuration.WithLabelValues("upload_archive").Observe(time.Since(start).Seconds()) }()
+	u.Logger.Info("upload_archive_start", slog.String("prefix", req.Prefix))
+
+	if err := u.Validate.Struct(req); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("upload_archive").Inc()
+		return web.ArchiveUploadResponse{}, helper.ErrInvalidInput
+	}
+
+	resp := web.ArchiveUploadResponse{Members: []web.UploadResponse{}}
+	var expanded int64
+	store := func(member archiveMember) error {
+		if resp.FilesCount >= helper.MaxArchiveMembers {
+			return helper.ErrTooLarge
+		}
+		// * declared sizes are enforced by archive/tar and archive/zip, so this bounds decompression
+		expanded += member.Size
+		if expanded > helper.MaxArchiveExpandedBytes {
+			return helper.ErrTooLarge
+		}
+		uploaded, err := u.Upload(ctx, web.UploadRequest{
+			Ctx:       ctx,
+			FileName:  path.Join(req.Prefix, member.Name),
+			Reader:    member.Reader,
+			ExpiresAt: req.ExpiresAt,
+			Metadata:  req.Metadata,
+			Tags:      req.Tags,
+		})
+		if err != nil {
+			return err
+		}
+		resp.Members = append(resp.Members, uploaded)
+		resp.FilesCount++
+		resp.TotalSize += uploaded.TotalSize
+		resp.ChunksCount += uploaded.ChunksCount
+		resp.UniqueChunksWritten += uploaded.UniqueChunksWritten
+		resp.DedupeSavedBytes += uploaded.DedupeSavedBytes
+		return nil
+	}
+
+	if err := walkArchive(req, store); err != nil {
+		u.Logger.Error("upload_archive_err", slog.String("stage", "walk"), slog.Int64("files_stored", resp.FilesCount), slog.Any("err", err))
+		metrics.ErrorsTotal.WithLabelValues("upload_archive").Inc()
+		u.discardMembers(ctx, resp.Members)
+		switch {
+		case errors.Is(err, helper.ErrTooLarge):
+			return web.ArchiveUploadResponse{}, helper.ErrTooLarge
+		case errors.Is(err, helper.ErrInvalidInput), errors.Is(err, helper.ErrBadRequest):
+			return web.ArchiveUploadResponse{}, helper.ErrInvalidInput
+		default:
+			return web.ArchiveUploadResponse{}, helper.ErrInternal
+		}
+	}
+
+	u.Logger.Info(
+		"upload_archive_ok",
+		slog.Int64("files_count", resp.FilesCount),
+		slog.Int64("total_size", resp.TotalSize),
+		slog.Int64("dedupe_saved_bytes", resp.DedupeSavedBytes),
+		slog.Duration("took", time.Since(start)),
+	)
+	return resp, nil
+}
+
+// * discardMembers deletes the members stored before an archive failed, so a retry of the whole
+// * archive does not leave a second copy of them behind.
+func (u *UploadServiceImpl) discardMembers(ctx context.Context, members []web.UploadResponse) {
+	// * the request context is often what failed, so the cleanup must not depend on it
+	ctx = context.WithoutCancel(ctx)
+	for _, m := range members {
+		if _, err := u.DeleteService.Delete(ctx, m.FileID); err != nil && !errors.Is(err, helper.ErrNotFound) {
+			u.Logger.Error("upload_archive_err", slog.String("stage", "discard"), slog.String("file_id", m.FileID.String()), slog.Any("err", err))
+		}
+	}
+}
+
+// walkArchive sniffs the container format from its magic bytes and hands each member to fn.
+func walkArchive(req web.ArchiveUploadRequest, fn func(archiveMember) error) error {
+	br := bufio.NewReader(req.Reader)
+	head, _ := br.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(head, magicZip):
+		ra, ok := req.Reader.(io.ReaderAt)
+		if !ok || req.Size <= 0 {
+			return helper.ErrInvalidInput
+		}
+		return walkZip(ra, req.Size, fn)
+	case bytes.HasPrefix(head, magicGzip):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return helper.ErrBadRequest
+		}
+		defer gz.Close()
+		return walkTar(gz, fn)
+	case bytes.HasPrefix(head, magicZstd):
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return helper.ErrBadRequest
+		}
+		defer dec.Close()
+		return walkTar(dec, fn)
+	default:
+		return walkTar(br, fn)
+	}
+}
+
+func walkTar(r io.Reader, fn func(archiveMember) error) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Join(helper.ErrBadRequest, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, ok := memberPath(header.Name)
+		if !ok {
+			continue
+		}
+		if err := fn(archiveMember{Name: name, Size: header.Size, Reader: tr}); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(ra io.ReaderAt, size int64, fn func(archiveMember) error) error {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return errors.Join(helper.ErrBadRequest, err)
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		name, ok := memberPath(f.Name)
+		if !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return errors.Join(helper.ErrBadRequest, err)
+		}
+		err = fn(archiveMember{Name: name, Size: int64(f.UncompressedSize64), Reader: rc})
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberPath normalises an archive path to a clean relative one and drops anything
+// that would escape the archive root.
+func memberPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	return clean, true
+}
@@ -0,0 +1,173 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/storage"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+// memStore keeps chunks in a map, so the pipeline can be measured without disk or Postgres.
+type memStore struct {
+	mu     sync.RWMutex
+	chunks map[string][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{chunks: make(map[string][]byte)}
+}
+
+func (m *memStore) Put(hash string, reader io.Reader, size int64) error {
+	data, err := io.ReadAll(io.LimitReader(reader, size))
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.chunks[hash]; !ok {
+		m.chunks[hash] = data
+	}
+	return nil
+}
+
+func (m *memStore) Get(hash string) (io.ReadCloser, int64, error) {
+	m.mu.RLock()
+	data, ok := m.chunks[hash]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, 0, storage.ErrChunkNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func (m *memStore) Exists(hash string) (bool, error) {
+	m.mu.RLock()
+	_, ok := m.chunks[hash]
+	m.mu.RUnlock()
+	return ok, nil
+}
+
+func (m *memStore) Delete(hash string) error {
+	m.mu.Lock()
+	delete(m.chunks, hash)
+	m.mu.Unlock()
+	return nil
+}
+
+// runPipeline runs the chunk → hash → store stages of Upload over r against store, without
+// the database, and returns the stored chunks in index order. It fails when an index
+// arrives twice or not at all.
+func runPipeline(ctx context.Context, r io.Reader, store storage.ChunkStore, hashWorkers int, storeWorkers int) ([]storedChunkItem, error) {
+	u := &UploadServiceImpl{ChunkStore: store, HashWorkers: hashWorkers}
+
+	lease := u.Admission.lease()
+	defer lease.close()
+	chCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, 1)
+	chunksCh := make(chan chunkItem, 8)
+	hashedCh := make(chan hashedChunkItem, 8)
+	storedCh := make(chan storedChunkItem, 8)
+	var wg sync.WaitGroup
+	var wwg sync.WaitGroup
+
+	u.startChunker(chCtx, &wg, r, chunksCh, errCh, helper.ChunkSize, lease)
+	u.startHasher(chCtx, &wg, chunksCh, hashedCh, u.HashWorkers)
+	u.startStoreWorkers(chCtx, &wwg, hashedCh, storedCh, errCh, storeWorkers, lease)
+	closeStoredWhenWorkersDone(&wwg, storedCh)
+
+	byIdx := make(map[int64]storedChunkItem)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for item := range storedCh {
+			if _, dup := byIdx[item.Idx]; dup {
+				select {
+				case errCh <- fmt.Errorf("chunk %d delivered twice", item.Idx):
+				default:
+				}
+				return
+			}
+			byIdx[item.Idx] = item
+		}
+	}()
+
+	if err := waitForPipeline(&wg, errCh); err != nil {
+		return nil, err
+	}
+	out := make([]storedChunkItem, len(byIdx))
+	for i := range out {
+		item, ok := byIdx[int64(i)]
+		if !ok {
+			return nil, fmt.Errorf("chunk %d missing", i)
+		}
+		out[i] = item
+	}
+	return out, nil
+}
+
+func TestPipelineChunksShortReads(t *testing.T) {
+	data := make([]byte, 2*helper.ChunkSize+12345)
+	_, _ = rand.Read(data)
+
+	// * HalfReader returns half of every read, so the chunker sees plenty of short reads
+	stored, err := runPipeline(context.Background(), iotest.HalfReader(bytes.NewReader(data)), newMemStore(), 2, 2)
+	if err != nil {
+		t.Fatalf("pipeline: %v", err)
+	}
+	want := []int64{helper.ChunkSize, helper.ChunkSize, 12345}
+	if len(stored) != len(want) {
+		t.Fatalf("got %d chunks; want %d", len(stored), len(want))
+	}
+	for i, item := range stored {
+		if item.Size != want[i] {
+			t.Fatalf("chunk %d is %d bytes; want %d", i, item.Size, want[i])
+		}
+	}
+}
+
+func TestPipelineDedupes(t *testing.T) {
+	chunk := make([]byte, helper.ChunkSize)
+	_, _ = rand.Read(chunk)
+	data := bytes.Repeat(chunk, 3)
+
+	store := newMemStore()
+	stored, err := runPipeline(context.Background(), bytes.NewReader(data), store, 4, 1)
+	if err != nil {
+		t.Fatalf("pipeline: %v", err)
+	}
+	reused := 0
+	for _, item := range stored {
+		if item.Reused {
+			reused++
+		}
+	}
+	if len(store.chunks) != 1 || reused != 2 {
+		t.Fatalf("stored %d chunks, reused %d; want 1 stored, 2 reused", len(store.chunks), reused)
+	}
+}
+
+// BenchmarkPipeline measures the pipeline's throughput for several hash worker counts, so
+// the effect of HASH_WORKERS can be compared without Postgres or disk.
+func BenchmarkPipeline(b *testing.B) {
+	// * one random buffer reused for every run, so the generator is not what gets measured
+	data := make([]byte, 64<<20)
+	_, _ = rand.Read(data)
+
+	for _, hashWorkers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("hash-workers=%d", hashWorkers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := runPipeline(context.Background(), bytes.NewReader(data), newMemStore(), hashWorkers, helper.Workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
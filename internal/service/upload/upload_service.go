@@ -2,9 +2,14 @@ package upload
 
 import (
 	"context"
+	"io"
+	"meliocool/bytesize/internal/model/domain"
 	"meliocool/bytesize/internal/model/web"
 )
 
 type UploadService interface {
+	Admit() (func(), error)
 	Upload(ctx context.Context, request web.UploadRequest) (web.UploadResponse, error)
+	UploadArchive(ctx context.Context, request web.ArchiveUploadRequest) (web.ArchiveUploadResponse, error)
+	StoreChunks(ctx context.Context, reader io.Reader, firstIdx int64) ([]domain.FileChunk, error)
 }
@@ -1,10 +1,12 @@
 package upload
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"github.com/gabriel-vasile/mimetype"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,6 +17,7 @@ import (
 	"meliocool/bytesize/internal/model/domain"
 	"meliocool/bytesize/internal/model/web"
 	"meliocool/bytesize/internal/repository"
+	deletefile "meliocool/bytesize/internal/service/delete"
 	"meliocool/bytesize/internal/storage"
 	"sync"
 	"time"
@@ -25,6 +28,9 @@ type UploadServiceImpl struct {
 	FileRepository      repository.FileRepository
 	FileChunkRepository repository.FileChunkRepository
 	ChunkStore          storage.ChunkStore
+	DeleteService       deletefile.DeleteService
+	HashWorkers         int
+	Admission           *Admission
 	DB                  *pgxpool.Pool
 	Validate            *validator.Validate
 	Logger              *slog.Logger
@@ -35,6 +41,9 @@ func NewUploadService(
 	fileRepo repository.FileRepository,
 	fileChunkRepo repository.FileChunkRepository,
 	chunkStore storage.ChunkStore,
+	deleteService deletefile.DeleteService,
+	hashWorkers int,
+	admission *Admission,
 	db *pgxpool.Pool,
 	validate *validator.Validate,
 	logger *slog.Logger,
@@ -44,6 +53,9 @@ func NewUploadService(
 		FileRepository:      fileRepo,
 		FileChunkRepository: fileChunkRepo,
 		ChunkStore:          chunkStore,
+		DeleteService:       deleteService,
+		HashWorkers:         hashWorkers,
+		Admission:           admission,
 		DB:                  db,
 		Validate:            validate,
 		Logger:              logger,
@@ -54,6 +66,7 @@ type chunkItem struct {
 	Idx   int64
 	Bytes []byte
 	Size  int64
+	buf   *[]byte
 }
 
 type hashedChunkItem struct {
@@ -61,6 +74,7 @@ type hashedChunkItem struct {
 	Bytes []byte
 	Size  int64
 	Hash  string
+	buf   *[]byte
 }
 
 type storedChunkItem struct {
@@ -78,12 +92,19 @@ type uploadCounters struct {
 }
 
 // * createFileRow inserts the initial file row
-func (u *UploadServiceImpl) createFileRow(ctx context.Context, filename string) (domain.File, error) {
+func (u *UploadServiceImpl) createFileRow(ctx context.Context, req web.UploadRequest) (domain.File, error) {
 	tx, err := u.DB.Begin(ctx)
 	if err != nil {
 		return domain.File{}, err
 	}
-	file := domain.File{Filename: filename, TotalSize: 0}
+	file := domain.File{
+		Filename:    req.FileName,
+		TotalSize:   0,
+		ContentType: req.ContentType,
+		ExpiresAt:   req.ExpiresAt,
+		Metadata:    req.Metadata,
+		Tags:        req.Tags,
+	}
 	createdFile, err := u.FileRepository.Create(ctx, tx, file)
 	if err != nil {
 		_ = tx.Rollback(ctx)
@@ -96,6 +117,7 @@ func (u *UploadServiceImpl) createFileRow(ctx context.Context, filename string)
 }
 
 // * startChunker reads from io.Reader and sends chunks into out channel.
+// * each chunk borrows a pooled buffer and chunkSize bytes of the lease; startStoreWorkers returns both
 func (u *UploadServiceImpl) startChunker(
 	chCtx context.Context,
 	wg *sync.WaitGroup,
@@ -103,33 +125,41 @@ func (u *UploadServiceImpl) startChunker(
 	out chan<- chunkItem,
 	errCh chan<- error,
 	chunkSize int,
+	lease *bufferLease,
 ) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		defer close(out)
 
-		buffer := make([]byte, chunkSize)
 		var idx int64 = 0
 
 		for {
-			select {
-			case <-chCtx.Done():
+			buf := chunkBuffers.Get().(*[]byte)
+			if len(*buf) < chunkSize {
+				*buf = make([]byte, chunkSize)
+			}
+			if err := lease.acquire(chCtx, int64(len(*buf))); err != nil {
+				chunkBuffers.Put(buf)
 				return
-			default:
 			}
 
-			n, readErr := r.Read(buffer)
+			// * fill the whole chunk so boundaries sit at multiples of chunkSize whatever the reader's read size
+			n, readErr := io.ReadFull(r, (*buf)[:chunkSize])
+			if readErr == io.ErrUnexpectedEOF {
+				readErr = io.EOF
+			}
 			if n > 0 {
-				chunkCopy := make([]byte, n)
-				copy(chunkCopy, buffer[:n])
-				ch := chunkItem{Idx: idx, Bytes: chunkCopy, Size: int64(n)}
+				ch := chunkItem{Idx: idx, Bytes: (*buf)[:n], Size: int64(n), buf: buf}
 				select {
 				case out <- ch:
 					idx++
 				case <-chCtx.Done():
 					return
 				}
+			} else {
+				lease.release(int64(len(*buf)))
+				chunkBuffers.Put(buf)
 			}
 
 			if readErr == io.EOF {
@@ -146,37 +176,49 @@ func (u *UploadServiceImpl) startChunker(
 	}()
 }
 
-// startHasher consumes chunkItem, hashes it, then sends hashedChunkItem.
+// startHasher runs a pool of workers that hash chunkItem and send hashedChunkItem.
+// * output order is not preserved; runManifestBatcher reorders by Idx
 func (u *UploadServiceImpl) startHasher(
 	chCtx context.Context,
 	wg *sync.WaitGroup,
 	in <-chan chunkItem,
 	out chan<- hashedChunkItem,
+	workers int,
 ) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		defer close(out)
 
-		for ch := range in {
-			sum := sha256.Sum256(ch.Bytes)
-			hash := hex.EncodeToString(sum[:])
-			hc := hashedChunkItem{
-				Idx:   ch.Idx,
-				Bytes: ch.Bytes,
-				Size:  ch.Size,
-				Hash:  hash,
-			}
-			select {
-			case out <- hc:
-			case <-chCtx.Done():
-				return
-			}
+		var hwg sync.WaitGroup
+		for i := 0; i < max(workers, 1); i++ {
+			hwg.Add(1)
+			go func() {
+				defer hwg.Done()
+				for ch := range in {
+					sum := sha256.Sum256(ch.Bytes)
+					hash := hex.EncodeToString(sum[:])
+					hc := hashedChunkItem{
+						Idx:   ch.Idx,
+						Bytes: ch.Bytes,
+						Size:  ch.Size,
+						Hash:  hash,
+						buf:   ch.buf,
+					}
+					select {
+					case out <- hc:
+					case <-chCtx.Done():
+						return
+					}
+				}
+			}()
 		}
+		hwg.Wait()
 	}()
 }
 
-// startStoreWorkers runs a pool of workers that put chunks in FS + Metadata in DB.
+// startStoreWorkers runs a pool of workers that put chunks in the ChunkStore.
+// * chunk rows are written later by runManifestBatcher, one statement per batch
 func (u *UploadServiceImpl) startStoreWorkers(
 	chCtx context.Context,
 	wwg *sync.WaitGroup,
@@ -184,6 +226,7 @@ func (u *UploadServiceImpl) startStoreWorkers(
 	out chan<- storedChunkItem,
 	errCh chan<- error,
 	workers int,
+	lease *bufferLease,
 ) {
 	for i := 0; i < workers; i++ {
 		wwg.Add(1)
@@ -199,6 +242,8 @@ func (u *UploadServiceImpl) startStoreWorkers(
 				reused := false
 				ok, exErr := u.ChunkStore.Exists(ch.Hash)
 				if exErr != nil {
+					lease.release(int64(len(*ch.buf)))
+					chunkBuffers.Put(ch.buf)
 					select {
 					case errCh <- exErr:
 					default:
@@ -210,6 +255,8 @@ func (u *UploadServiceImpl) startStoreWorkers(
 				} else {
 					reader := bytes.NewReader(ch.Bytes)
 					if putErr := u.ChunkStore.Put(ch.Hash, reader, ch.Size); putErr != nil {
+						lease.release(int64(len(*ch.buf)))
+						chunkBuffers.Put(ch.buf)
 						select {
 						case errCh <- putErr:
 						default:
@@ -218,30 +265,9 @@ func (u *UploadServiceImpl) startStoreWorkers(
 					}
 				}
 
-				tx, txErr := u.DB.Begin(chCtx)
-				if txErr != nil {
-					select {
-					case errCh <- txErr:
-					default:
-					}
-					return
-				}
-				_, _, upsertErr := u.ChunkRepository.Upsert(chCtx, tx, domain.Chunk{Hash: ch.Hash, Size: ch.Size})
-				if upsertErr != nil {
-					_ = tx.Rollback(chCtx)
-					select {
-					case errCh <- upsertErr:
-					default:
-					}
-					return
-				}
-				if err := tx.Commit(chCtx); err != nil {
-					select {
-					case errCh <- err:
-					default:
-					}
-					return
-				}
+				// * the store has copied or written the bytes, so the buffer can go back
+				lease.release(int64(len(*ch.buf)))
+				chunkBuffers.Put(ch.buf)
 
 				sc := storedChunkItem{Idx: ch.Idx, Hash: ch.Hash, Size: ch.Size, Reused: reused}
 				select {
@@ -262,7 +288,8 @@ func closeStoredWhenWorkersDone(wwg *sync.WaitGroup, out chan<- storedChunkItem)
 	}()
 }
 
-// runManifestBatcher consumes storedChunkItem, batches inserts into DB, and updates totals.
+// runManifestBatcher consumes storedChunkItem, upserts chunk rows and inserts file_chunks
+// rows per batch in a single tx, and updates totals.
 func (u *UploadServiceImpl) runManifestBatcher(
 	chCtx context.Context,
 	wg *sync.WaitGroup,
@@ -289,6 +316,23 @@ func (u *UploadServiceImpl) runManifestBatcher(
 				}
 				return false
 			}
+			chunks := make([]domain.Chunk, 0, len(pending))
+			seen := make(map[string]struct{}, len(pending))
+			for _, fc := range pending {
+				if _, dup := seen[fc.ChunkHash]; dup {
+					continue
+				}
+				seen[fc.ChunkHash] = struct{}{}
+				chunks = append(chunks, domain.Chunk{Hash: fc.ChunkHash, Size: fc.Size})
+			}
+			if _, err := u.ChunkRepository.UpsertMany(chCtx, tx, chunks); err != nil {
+				_ = tx.Rollback(chCtx)
+				select {
+				case errCh <- err:
+				default:
+				}
+				return false
+			}
 			err := u.FileChunkRepository.AddChunks(chCtx, tx, fileID, pending)
 			if err != nil {
 				_ = tx.Rollback(chCtx)
@@ -364,8 +408,8 @@ func waitForPipeline(wg *sync.WaitGroup, errCh <-chan error) error {
 	}
 }
 
-// updates the file row with final total size.
-func (u *UploadServiceImpl) updateFileTotals(ctx context.Context, fileID uuid.UUID, totalSize int64) error {
+// updates the file row with final total size and, when given, the final metadata.
+func (u *UploadServiceImpl) updateFileTotals(ctx context.Context, fileID uuid.UUID, totalSize int64, final func() map[string]string) error {
 	tx, err := u.DB.Begin(ctx)
 	if err != nil {
 		return err
@@ -375,27 +419,136 @@ func (u *UploadServiceImpl) updateFileTotals(ctx context.Context, fileID uuid.UU
 		_ = tx.Rollback(ctx)
 		return err
 	}
+	if final != nil {
+		if _, err := u.FileRepository.UpdateMetadata(ctx, tx, fileID, final(), nil, nil); err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+	}
 	return tx.Commit(ctx)
 }
 
+// * discardFileRow drops the row of a failed upload so a partial file never becomes visible.
+// * Chunks from flushed batches keep their rows, which later uploads dedupe against but nothing
+// * deletes; blobs stored after the last flush have no row at all and stay in the store (see README)
+func (u *UploadServiceImpl) discardFileRow(ctx context.Context, fileID uuid.UUID) {
+	// * the request context is often what failed, so the cleanup must not depend on it
+	ctx = context.WithoutCancel(ctx)
+	tx, err := u.DB.Begin(ctx)
+	if err != nil {
+		u.Logger.Error("upload_err", slog.String("stage", "discard"), slog.String("file_id", fileID.String()), slog.Any("err", err))
+		return
+	}
+	if err := u.FileRepository.Delete(ctx, tx, fileID); err != nil {
+		_ = tx.Rollback(ctx)
+		u.Logger.Error("upload_err", slog.String("stage", "discard"), slog.String("file_id", fileID.String()), slog.Any("err", err))
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		u.Logger.Error("upload_err", slog.String("stage", "discard"), slog.String("file_id", fileID.String()), slog.Any("err", err))
+	}
+}
+
+// cutReader ends the stream at the first read error and keeps it, so the pipeline drains the
+// chunks read so far instead of aborting.
+type cutReader struct {
+	r   io.Reader
+	err error
+}
+
+func (c *cutReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil && err != io.EOF {
+		c.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// StoreChunks runs reader through the chunk, hash and store stages and returns its manifest in
+// order, numbered from firstIdx. No rows are written; the caller commits chunk and manifest rows.
+// A read error ends the input early: the chunks read before it are returned along with the error.
+func (u *UploadServiceImpl) StoreChunks(ctx context.Context, reader io.Reader, firstIdx int64) ([]domain.FileChunk, error) {
+	// * deferred calls run last-in first-out: the stages are cancelled before the lease closes
+	lease := u.Admission.lease()
+	defer lease.close()
+	chCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, 1)
+	chunksCh := make(chan chunkItem, 8)
+	hashedCh := make(chan hashedChunkItem, 8)
+	storedCh := make(chan storedChunkItem, 8)
+	var wg sync.WaitGroup
+	var wwg sync.WaitGroup
+
+	cut := &cutReader{r: reader}
+	u.startChunker(chCtx, &wg, cut, chunksCh, errCh, helper.ChunkSize, lease)
+	u.startHasher(chCtx, &wg, chunksCh, hashedCh, u.HashWorkers)
+	u.startStoreWorkers(chCtx, &wwg, hashedCh, storedCh, errCh, helper.Workers, lease)
+	closeStoredWhenWorkersDone(&wwg, storedCh)
+
+	var stored []storedChunkItem
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for item := range storedCh {
+			stored = append(stored, item)
+		}
+	}()
+
+	if err := waitForPipeline(&wg, errCh); err != nil {
+		u.Logger.Error("upload_err", slog.String("stage", "store_chunks"), slog.Any("err", err))
+		return nil, helper.ErrInternal
+	}
+
+	manifest := make([]domain.FileChunk, len(stored))
+	for _, item := range stored {
+		manifest[item.Idx] = domain.FileChunk{Idx: firstIdx + item.Idx, ChunkHash: item.Hash, Size: item.Size}
+	}
+	return manifest, cut.err
+}
+
+// Admit takes one of the server-wide upload slots; see Admission.Admit.
+func (u *UploadServiceImpl) Admit() (func(), error) {
+	return u.Admission.Admit()
+}
+
 func (u *UploadServiceImpl) Upload(ctx context.Context, req web.UploadRequest) (web.UploadResponse, error) {
 	start := time.Now()
 	metrics.RequestsTotal.WithLabelValues("upload").Inc()
-	defer metrics.RequestDuration.WithLabelValues("upload").Observe(time.Since(start).Seconds())
+	defer func() { metrics.RequestDuration.WithLabelValues("upload").Observe(time.Since(start).Seconds()) }()
 	u.Logger.Info("upload_start", slog.String("filename", req.FileName))
 
-	if err := u.Validate.Struct(req); err != nil {
+	if err := u.Validate.Struct(req); err != nil || (helper.ReservedFilename(req.FileName) && !req.AllowReserved) {
+		metrics.ErrorsTotal.WithLabelValues("upload").Inc()
+		return web.UploadResponse{}, helper.ErrInvalidInput
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
 		metrics.ErrorsTotal.WithLabelValues("upload").Inc()
 		return web.UploadResponse{}, helper.ErrInvalidInput
 	}
+	if err := helper.ValidateLabels(req.Metadata, req.Tags); err != nil {
+		metrics.ErrorsTotal.WithLabelValues("upload").Inc()
+		return web.UploadResponse{}, helper.ErrInvalidInput
+	}
+
+	// * sniff the head of the first chunk unless the client told us the type
+	reader := bufio.NewReaderSize(req.Reader, helper.SniffBytes)
+	if req.ContentType == "" {
+		head, _ := reader.Peek(helper.SniffBytes)
+		req.ContentType = mimetype.Detect(head).String()
+	}
 
-	createdFile, err := u.createFileRow(ctx, req.FileName)
+	createdFile, err := u.createFileRow(ctx, req)
 	if err != nil {
 		u.Logger.Error("upload_err", slog.String("stage", "create_file_row"), slog.String("filename", req.FileName), slog.Any("err", err))
 		metrics.ErrorsTotal.WithLabelValues("upload").Inc()
 		return web.UploadResponse{}, helper.ErrInternal
 	}
 
+	// * deferred calls run last-in first-out: the stages are cancelled before the lease closes
+	lease := u.Admission.lease()
+	defer lease.close()
 	chCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	errCh := make(chan error, 1)
@@ -406,21 +559,23 @@ func (u *UploadServiceImpl) Upload(ctx context.Context, req web.UploadRequest) (
 	var wwg sync.WaitGroup
 	totals := &uploadCounters{}
 
-	u.startChunker(chCtx, &wg, req.Reader, chunksCh, errCh, helper.ChunkSize)
-	u.startHasher(chCtx, &wg, chunksCh, hashedCh)
-	u.startStoreWorkers(chCtx, &wwg, hashedCh, storedCh, errCh, helper.Workers)
+	u.startChunker(chCtx, &wg, reader, chunksCh, errCh, helper.ChunkSize, lease)
+	u.startHasher(chCtx, &wg, chunksCh, hashedCh, u.HashWorkers)
+	u.startStoreWorkers(chCtx, &wwg, hashedCh, storedCh, errCh, helper.Workers, lease)
 	closeStoredWhenWorkersDone(&wwg, storedCh)
 	u.runManifestBatcher(chCtx, &wg, storedCh, createdFile.ID, helper.BatchSize, totals, errCh)
 
 	if err := waitForPipeline(&wg, errCh); err != nil {
 		u.Logger.Error("upload_err", slog.String("stage", "pipeline"), slog.String("file_id", createdFile.ID.String()), slog.Any("err", err))
 		metrics.ErrorsTotal.WithLabelValues("upload").Inc()
+		u.discardFileRow(ctx, createdFile.ID)
 		return web.UploadResponse{}, helper.ErrInternal
 	}
 
-	if err := u.updateFileTotals(ctx, createdFile.ID, totals.TotalSize); err != nil {
+	if err := u.updateFileTotals(ctx, createdFile.ID, totals.TotalSize, req.FinalMetadata); err != nil {
 		u.Logger.Error("upload_err", slog.String("stage", "update_totals"), slog.String("file_id", createdFile.ID.String()), slog.Any("err", err))
 		metrics.ErrorsTotal.WithLabelValues("upload").Inc()
+		u.discardFileRow(ctx, createdFile.ID)
 		return web.UploadResponse{}, helper.ErrInternal
 	}
 
@@ -438,7 +593,9 @@ func (u *UploadServiceImpl) Upload(ctx context.Context, req web.UploadRequest) (
 
 	return web.UploadResponse{
 		FileID:              createdFile.ID,
+		Filename:            createdFile.Filename,
 		TotalSize:           totals.TotalSize,
+		ContentType:         createdFile.ContentType,
 		ChunksCount:         totals.ChunksCount,
 		UniqueChunksWritten: totals.UniqueChunksWritten,
 		DedupeSavedBytes:    totals.DedupeSavedBytes,
@@ -0,0 +1,23 @@
+package upload
+
+import (
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"log/slog"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/web"
+	"strings"
+	"testing"
+)
+
+func TestUploadRejectsReservedFilenames(t *testing.T) {
+	// * no DB: a reserved name must be refused before the file row is created
+	u := &UploadServiceImpl{Validate: validator.New(), Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	for _, name := range []string{".tus/a.bin", ".tus", ".s3-multipart/x/part-00001", ".snapshots/id/etc/hosts"} {
+		_, err := u.Upload(t.Context(), web.UploadRequest{FileName: name, Reader: strings.NewReader("data")})
+		if !errors.Is(err, helper.ErrInvalidInput) {
+			t.Errorf("Upload(%q) = %v; want ErrInvalidInput", name, err)
+		}
+	}
+}
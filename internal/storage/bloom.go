@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"encoding/hex"
+	"math"
+	"sync/atomic"
+)
+
+// bloomFilter is a lock-free Bloom filter keyed by hex SHA-256 chunk hashes. The hash bits
+// are already uniform, so the k probe positions come from double hashing two 64-bit words
+// of the digest instead of rehashing.
+type bloomFilter struct {
+	bits []atomic.Uint64
+	m    uint64
+	k    uint64
+}
+
+// newBloomFilter sizes the filter for n entries at false-positive rate p.
+func newBloomFilter(n int64, p float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) &^ 63
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]atomic.Uint64, m/64), m: m, k: k}
+}
+
+func (f *bloomFilter) add(hash string) {
+	h1, h2, ok := bloomWords(hash)
+	if !ok {
+		return
+	}
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64].Or(1 << (bit % 64))
+	}
+}
+
+// mayContain is false only when hash was never added.
+func (f *bloomFilter) mayContain(hash string) bool {
+	h1, h2, ok := bloomWords(hash)
+	if !ok {
+		return true
+	}
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomWords(hash string) (uint64, uint64, bool) {
+	if len(hash) < 32 {
+		return 0, 0, false
+	}
+	var raw [16]byte
+	if _, err := hex.Decode(raw[:], []byte(hash[:32])); err != nil {
+		return 0, 0, false
+	}
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(raw[i])
+		h2 = h2<<8 | uint64(raw[8+i])
+	}
+	return h1, h2 | 1, true
+}
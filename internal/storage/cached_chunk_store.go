@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"golang.org/x/sync/singleflight"
+	"hash/fnv"
+	"io"
+	"meliocool/bytesize/internal/metrics"
+	"sync"
+)
+
+type cacheShard struct {
+	mu       sync.Mutex
+	capacity int64
+	bytes    int64
+	entries  map[string][]byte
+	lru      *lruPolicy
+	// * gen moves on every invalidation, so a fill that read the inner store before a
+	// * delete can tell its data may be stale and must not be cached
+	gen uint64
+}
+
+// CachedChunkStore keeps recently read chunks in memory in front of any ChunkStore.
+// The cache is split into LRU shards by hash so readers rarely contend on one lock, and
+// concurrent misses on the same hash share a single read of the inner store.
+type CachedChunkStore struct {
+	Inner    ChunkStore
+	Capacity int64
+
+	shards []*cacheShard
+	group  singleflight.Group
+}
+
+func NewCachedChunkStore(inner ChunkStore, capacity int64, shards int) *CachedChunkStore {
+	if shards <= 0 {
+		shards = 1
+	}
+	s := &CachedChunkStore{Inner: inner, Capacity: capacity, shards: make([]*cacheShard, shards)}
+	for i := range s.shards {
+		s.shards[i] = &cacheShard{
+			capacity: capacity / int64(shards),
+			entries:  make(map[string][]byte),
+			lru:      newLRUPolicy(),
+		}
+	}
+	return s
+}
+
+// Put goes straight to the inner store; freshly uploaded chunks are not assumed to be hot.
+func (s *CachedChunkStore) Put(hash string, reader io.Reader, size int64) error {
+	return s.Inner.Put(hash, reader, size)
+}
+
+func (s *CachedChunkStore) Get(hash string) (io.ReadCloser, int64, error) {
+	if data, ok := s.shard(hash).get(hash); ok {
+		metrics.ChunkCacheHitsTotal.Inc()
+		return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+	}
+	metrics.ChunkCacheMissesTotal.Inc()
+
+	v, err, shared := s.group.Do(hash, func() (any, error) {
+		shard := s.shard(hash)
+		gen := shard.generation()
+		rc, size, err := s.Inner.Get(hash)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := readChunk(rc, size)
+		if err != nil {
+			return nil, err
+		}
+		shard.add(hash, data, gen)
+		return data, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if shared {
+		metrics.ChunkCacheCoalescedTotal.Inc()
+	}
+	data := v.([]byte)
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+// Exists always asks the inner store: a cached copy says nothing about whether the chunk is
+// still stored, and upload dedupe must never skip writing a chunk that is gone.
+func (s *CachedChunkStore) Exists(hash string) (bool, error) {
+	return s.Inner.Exists(hash)
+}
+
+// Delete invalidates after the inner delete, so no read in between can cache the chunk again.
+func (s *CachedChunkStore) Delete(hash string) error {
+	err := s.Inner.Delete(hash)
+	s.shard(hash).invalidate(hash)
+	s.group.Forget(hash)
+	return err
+}
+
+func (s *CachedChunkStore) shard(hash string) *cacheShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(hash))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+func (c *cacheShard) get(hash string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.entries[hash]
+	if ok {
+		c.lru.touch(hash)
+	}
+	return data, ok
+}
+
+func (c *cacheShard) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// add caches data read at generation gen, evicting least recently used chunks until the
+// shard fits. Chunks larger than the whole shard, and data read before an invalidation,
+// are not cached.
+func (c *cacheShard) add(hash string, data []byte, gen uint64) {
+	size := int64(len(data))
+	if size > c.capacity {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if _, ok := c.entries[hash]; ok {
+		c.lru.touch(hash)
+		return
+	}
+	c.entries[hash] = data
+	c.bytes += size
+	c.lru.add(hash)
+	metrics.ChunkCacheBytes.Add(float64(size))
+
+	var victims []string
+	excess := c.bytes - c.capacity
+	if excess > 0 {
+		c.lru.victims(func(h string) bool {
+			if h == hash {
+				return true
+			}
+			victims = append(victims, h)
+			excess -= int64(len(c.entries[h]))
+			return excess > 0
+		})
+	}
+	for _, h := range victims {
+		c.removeLocked(h)
+		metrics.ChunkCacheEvictionsTotal.Inc()
+	}
+}
+
+func (c *cacheShard) invalidate(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.removeLocked(hash)
+}
+
+func (c *cacheShard) removeLocked(hash string) {
+	data, ok := c.entries[hash]
+	if !ok {
+		return
+	}
+	c.bytes -= int64(len(data))
+	delete(c.entries, hash)
+	c.lru.remove(hash)
+	metrics.ChunkCacheBytes.Sub(float64(len(data)))
+}
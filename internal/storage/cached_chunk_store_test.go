@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// gatedStore holds every Get until release is closed, after telling started.
+type gatedStore struct {
+	ChunkStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedStore) Get(hash string) (io.ReadCloser, int64, error) {
+	g.started <- struct{}{}
+	<-g.release
+	return g.ChunkStore.Get(hash)
+}
+
+func TestCachedChunkStoreExistsAsksInner(t *testing.T) {
+	inner := NewFSChunkStore(t.TempDir())
+	store := NewCachedChunkStore(inner, 1<<20, 1)
+	hash, _ := putTestChunk(t, store, 1<<10)
+	if _, err := readTestChunk(store, hash); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	// * gone from the inner store behind the cache's back
+	if err := inner.Delete(hash); err != nil {
+		t.Fatalf("inner delete: %v", err)
+	}
+	if ok, err := store.Exists(hash); err != nil || ok {
+		t.Fatalf("exists = %v, %v; want false while only the cache holds the chunk", ok, err)
+	}
+}
+
+func TestCachedChunkStoreDeleteInvalidates(t *testing.T) {
+	store := NewCachedChunkStore(NewFSChunkStore(t.TempDir()), 1<<20, 1)
+	hash, _ := putTestChunk(t, store, 1<<10)
+	if _, err := readTestChunk(store, hash); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if err := store.Delete(hash); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := readTestChunk(store, hash); !errors.Is(err, ErrChunkNotFound) {
+		t.Fatalf("get after delete = %v; want ErrChunkNotFound", err)
+	}
+}
+
+func TestCachedChunkStoreDeleteDuringFill(t *testing.T) {
+	inner := &gatedStore{ChunkStore: NewFSChunkStore(t.TempDir()), started: make(chan struct{}), release: make(chan struct{})}
+	store := NewCachedChunkStore(inner, 1<<20, 1)
+	hash, _ := putTestChunk(t, store, 1<<10)
+
+	done := make(chan error)
+	go func() {
+		_, err := readTestChunk(store, hash)
+		done <- err
+	}()
+	<-inner.started
+
+	// * the fill is past its generation check but has not read the chunk yet
+	shard := store.shard(hash)
+	shard.invalidate(hash)
+	close(inner.release)
+	if err := <-done; err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if _, ok := shard.get(hash); ok {
+		t.Fatal("a fill that started before an invalidation repopulated the cache")
+	}
+}
@@ -1,6 +1,15 @@
 package storage
 
-import "io"
+import (
+	"errors"
+	"io"
+)
+
+// ErrChunkNotFound is returned by Get when the store has no blob for the hash.
+var ErrChunkNotFound = errors.New("chunk not found")
+
+// ErrStoreClosed is returned by a store that keeps open files once it has been closed.
+var ErrStoreClosed = errors.New("chunk store closed")
 
 type ChunkStore interface {
 	Put(hash string, reader io.Reader, size int64) error
@@ -8,3 +17,20 @@ type ChunkStore interface {
 	Exists(hash string) (bool, error)
 	Delete(hash string) error
 }
+
+// Close releases store and the stores it decorates: a write-back hot tier is flushed and
+// pack segments are closed. Stores that hold nothing open are left alone.
+func Close(store ChunkStore) error {
+	switch s := store.(type) {
+	case *CachedChunkStore:
+		return Close(s.Inner)
+	case *IndexedChunkStore:
+		return Close(s.Inner)
+	case *TieredChunkStore:
+		return errors.Join(s.Close(), Close(s.Cold))
+	case *PackChunkStore:
+		return s.Close()
+	default:
+		return nil
+	}
+}
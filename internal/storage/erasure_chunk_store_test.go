@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+const (
+	testDataShards   = 4
+	testParityShards = 2
+)
+
+// newTestErasureStore builds a 4+2 store over one FSChunkStore directory per shard.
+func newTestErasureStore(t *testing.T) (*ErasureChunkStore, []*FSChunkStore) {
+	t.Helper()
+	var dirs []*FSChunkStore
+	var targets []Replica
+	for i := 0; i < testDataShards+testParityShards; i++ {
+		fs := NewFSChunkStore(t.TempDir())
+		dirs = append(dirs, fs)
+		targets = append(targets, Replica{Name: fmt.Sprintf("shard-%d", i), Store: fs})
+	}
+	store, err := NewErasureChunkStore(testDataShards, testParityShards, testDataShards+1, targets...)
+	if err != nil {
+		t.Fatalf("new erasure store: %v", err)
+	}
+	return store, dirs
+}
+
+func putTestChunk(t *testing.T, store ChunkStore, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if err := store.Put(hash, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	return hash, data
+}
+
+func readTestChunk(store ChunkStore, hash string) ([]byte, error) {
+	rc, _, err := store.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func deleteShard(t *testing.T, fs *FSChunkStore, hash string) {
+	t.Helper()
+	if err := fs.Delete(hash); err != nil {
+		t.Fatalf("delete shard: %v", err)
+	}
+}
+
+func corruptShard(t *testing.T, fs *FSChunkStore, hash string) {
+	t.Helper()
+	path := fs.pathFromHash(hash)
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	payload[len(payload)-1] ^= 0xff
+	if err := os.WriteFile(path, payload, 0o644); err != nil {
+		t.Fatalf("write shard: %v", err)
+	}
+}
+
+func TestErasureChunkStoreRoundTrip(t *testing.T) {
+	store, _ := newTestErasureStore(t)
+	// * an odd size exercises the padding of the last data shard
+	hash, data := putTestChunk(t, store, 1<<20+3)
+
+	got, err := readTestChunk(store, hash)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("chunk read back differs from the one written")
+	}
+	if ok, err := store.Exists(hash); err != nil || !ok {
+		t.Fatalf("exists = %v, %v; want true", ok, err)
+	}
+}
+
+func TestErasureChunkStoreSurvivesParityLosses(t *testing.T) {
+	cases := []struct {
+		name      string
+		deleted   []int
+		corrupted []int
+	}{
+		{"one missing data shard", []int{0}, nil},
+		{"missing data shards", []int{1, 3}, nil},
+		{"missing data and parity shard", []int{2, 5}, nil},
+		{"corrupt data shards", nil, []int{0, 2}},
+		{"missing and corrupt shard", []int{1}, []int{4}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, dirs := newTestErasureStore(t)
+			hash, data := putTestChunk(t, store, 256<<10)
+			for _, i := range tc.deleted {
+				deleteShard(t, dirs[i], hash)
+			}
+			for _, i := range tc.corrupted {
+				corruptShard(t, dirs[i], hash)
+			}
+
+			got, err := readTestChunk(store, hash)
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("reconstructed chunk differs from the one written")
+			}
+		})
+	}
+}
+
+func TestErasureChunkStoreTooManyLosses(t *testing.T) {
+	store, dirs := newTestErasureStore(t)
+	hash, _ := putTestChunk(t, store, 64<<10)
+	for _, i := range []int{0, 3} {
+		deleteShard(t, dirs[i], hash)
+	}
+	corruptShard(t, dirs[5], hash)
+
+	if _, err := readTestChunk(store, hash); err == nil {
+		t.Fatal("get succeeded with m+1 shards lost")
+	} else if errors.Is(err, ErrChunkNotFound) {
+		t.Fatalf("get = %v; a partly lost chunk is not a missing one", err)
+	}
+	if _, err := store.Repair(hash); err == nil {
+		t.Fatal("repair succeeded with m+1 shards lost")
+	}
+}
+
+func TestErasureChunkStoreMissingChunk(t *testing.T) {
+	store, _ := newTestErasureStore(t)
+	_, _, err := store.Get(hex.EncodeToString(make([]byte, sha256.Size)))
+	if !errors.Is(err, ErrChunkNotFound) {
+		t.Fatalf("get = %v; want ErrChunkNotFound", err)
+	}
+}
+
+func TestErasureChunkStoreRepair(t *testing.T) {
+	store, dirs := newTestErasureStore(t)
+	hash, data := putTestChunk(t, store, 512<<10)
+	deleteShard(t, dirs[0], hash)
+	corruptShard(t, dirs[4], hash)
+
+	repaired, err := store.Repair(hash)
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if repaired != 2 {
+		t.Fatalf("repaired %d shards; want 2", repaired)
+	}
+
+	// * with the two repaired shards back, any other two may go
+	deleteShard(t, dirs[1], hash)
+	deleteShard(t, dirs[5], hash)
+	got, err := readTestChunk(store, hash)
+	if err != nil {
+		t.Fatalf("get after repair: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("chunk read after repair differs from the one written")
+	}
+	for _, i := range []int{0, 4} {
+		if _, _, err := store.getShard(i, hash); err != nil {
+			t.Fatalf("shard %d after repair: %v", i, err)
+		}
+	}
+
+	if repaired, err := store.Repair(hash); err != nil || repaired != 2 {
+		t.Fatalf("second repair = %d, %v; want 2, nil", repaired, err)
+	}
+	if repaired, err := store.Repair(hash); err != nil || repaired != 0 {
+		t.Fatalf("repair of a healthy chunk = %d, %v; want 0, nil", repaired, err)
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"container/list"
+	"slices"
+)
+
+// evictionPolicy orders tracked hashes for eviction. Implementations are not
+// goroutine-safe; callers hold their own lock.
+type evictionPolicy interface {
+	add(hash string)
+	touch(hash string)
+	remove(hash string)
+	// victims yields candidates from most to least evictable.
+	victims(yield func(hash string) bool)
+}
+
+func newEvictionPolicy(name string) evictionPolicy {
+	if name == "lfu" {
+		return newLFUPolicy()
+	}
+	return newLRUPolicy()
+}
+
+type lruPolicy struct {
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{order: list.New(), elems: make(map[string]*list.Element)}
+}
+
+func (p *lruPolicy) add(hash string) {
+	if _, ok := p.elems[hash]; ok {
+		p.touch(hash)
+		return
+	}
+	p.elems[hash] = p.order.PushFront(hash)
+}
+
+func (p *lruPolicy) touch(hash string) {
+	if e, ok := p.elems[hash]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) remove(hash string) {
+	if e, ok := p.elems[hash]; ok {
+		p.order.Remove(e)
+		delete(p.elems, hash)
+	}
+}
+
+func (p *lruPolicy) victims(yield func(hash string) bool) {
+	for e := p.order.Back(); e != nil; e = e.Prev() {
+		if !yield(e.Value.(string)) {
+			return
+		}
+	}
+}
+
+// lfuPolicy keeps one recency list per access count so touch stays O(1);
+// ties on frequency fall back to least recently used.
+type lfuPolicy struct {
+	freq    map[string]int
+	elems   map[string]*list.Element
+	buckets map[int]*list.List
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{
+		freq:    make(map[string]int),
+		elems:   make(map[string]*list.Element),
+		buckets: make(map[int]*list.List),
+	}
+}
+
+func (p *lfuPolicy) add(hash string) {
+	if _, ok := p.elems[hash]; ok {
+		p.touch(hash)
+		return
+	}
+	p.push(hash, 1)
+}
+
+func (p *lfuPolicy) touch(hash string) {
+	if _, ok := p.elems[hash]; !ok {
+		return
+	}
+	f := p.freq[hash]
+	p.remove(hash)
+	p.push(hash, f+1)
+}
+
+func (p *lfuPolicy) push(hash string, f int) {
+	b, ok := p.buckets[f]
+	if !ok {
+		b = list.New()
+		p.buckets[f] = b
+	}
+	p.freq[hash] = f
+	p.elems[hash] = b.PushFront(hash)
+}
+
+func (p *lfuPolicy) remove(hash string) {
+	e, ok := p.elems[hash]
+	if !ok {
+		return
+	}
+	f := p.freq[hash]
+	b := p.buckets[f]
+	b.Remove(e)
+	if b.Len() == 0 {
+		delete(p.buckets, f)
+	}
+	delete(p.elems, hash)
+	delete(p.freq, hash)
+}
+
+func (p *lfuPolicy) victims(yield func(hash string) bool) {
+	freqs := make([]int, 0, len(p.buckets))
+	for f := range p.buckets {
+		freqs = append(freqs, f)
+	}
+	slices.Sort(freqs)
+	for _, f := range freqs {
+		for e := p.buckets[f].Back(); e != nil; e = e.Prev() {
+			if !yield(e.Value.(string)) {
+				return
+			}
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type FSChunkStore struct {
@@ -87,7 +89,7 @@ func (s *FSChunkStore) Get(hash string) (io.ReadCloser, int64, error) {
 	f, err := os.Open(finalPath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, 0, fmt.Errorf("chunk not found")
+			return nil, 0, ErrChunkNotFound
 		}
 		return nil, 0, fmt.Errorf("open: %w", err)
 	}
@@ -115,6 +117,32 @@ func (s *FSChunkStore) Exists(hash string) (bool, error) {
 	return false, err
 }
 
+// Walk calls fn with the size and modification time of every stored chunk. Temp files left
+// by unfinished Puts are skipped, and a BaseDir that does not exist yet holds no chunks.
+func (s *FSChunkStore) Walk(fn func(hash string, size int64, modTime time.Time) error) error {
+	err := filepath.WalkDir(s.BaseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || len(d.Name()) != 64 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// * deleted between the directory read and the stat
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		return fn(d.Name(), info.Size(), info.ModTime())
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
 func (s *FSChunkStore) pathFromHash(hash string) string {
 	return filepath.Join(s.BaseDir, hash[0:2], hash[2:4], hash)
 }
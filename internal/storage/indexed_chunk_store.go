@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"meliocool/bytesize/internal/metrics"
+	"sync"
+	"sync/atomic"
+)
+
+// ChunkHashSource enumerates every known chunk hash, normally the chunks table.
+type ChunkHashSource interface {
+	CountChunks(ctx context.Context) (int64, error)
+	EachChunkHash(ctx context.Context, fn func(hash string) error) error
+}
+
+// IndexedChunkStore answers Exists from an in-memory Bloom filter of known hashes, so a
+// chunk that is neither in Source nor Put since the last Rebuild skips the inner store's
+// lookup entirely. A negative is not proof of absence: a blob the inner store holds without
+// a Source entry reads as missing and gets Put again. A positive is only a maybe and is
+// confirmed against the inner store; deletes leave stale positives behind until the next
+// Rebuild. Both cost work, never correctness.
+type IndexedChunkStore struct {
+	Inner  ChunkStore
+	Source ChunkHashSource
+	FPRate float64
+
+	filter atomic.Pointer[bloomFilter]
+	mu     sync.Mutex
+	next   *bloomFilter
+}
+
+func NewIndexedChunkStore(inner ChunkStore, source ChunkHashSource, fpRate float64) *IndexedChunkStore {
+	return &IndexedChunkStore{Inner: inner, Source: source, FPRate: fpRate}
+}
+
+func (s *IndexedChunkStore) Put(hash string, reader io.Reader, size int64) error {
+	if err := s.Inner.Put(hash, reader, size); err != nil {
+		return err
+	}
+	s.add(hash)
+	return nil
+}
+
+func (s *IndexedChunkStore) Get(hash string) (io.ReadCloser, int64, error) {
+	return s.Inner.Get(hash)
+}
+
+func (s *IndexedChunkStore) Exists(hash string) (bool, error) {
+	if f := s.filter.Load(); f != nil && !f.mayContain(hash) {
+		metrics.ChunkIndexSkippedTotal.Inc()
+		return false, nil
+	}
+	ok, err := s.Inner.Exists(hash)
+	if err == nil && !ok && s.filter.Load() != nil {
+		metrics.ChunkIndexFalsePositivesTotal.Inc()
+	}
+	return ok, err
+}
+
+func (s *IndexedChunkStore) Delete(hash string) error {
+	return s.Inner.Delete(hash)
+}
+
+// Rebuild loads every hash from Source into a fresh filter sized for twice the current
+// count and swaps it in. Puts that land while the load runs are recorded in both filters.
+// Until the first Rebuild succeeds, Exists passes straight through to the inner store.
+func (s *IndexedChunkStore) Rebuild(ctx context.Context) error {
+	count, err := s.Source.CountChunks(ctx)
+	if err != nil {
+		return err
+	}
+	next := newBloomFilter(max(2*count, 1<<20), s.FPRate)
+
+	s.mu.Lock()
+	s.next = next
+	s.mu.Unlock()
+
+	err = s.Source.EachChunkHash(ctx, func(hash string) error {
+		next.add(hash)
+		return nil
+	})
+
+	s.mu.Lock()
+	s.next = nil
+	if err == nil {
+		s.filter.Store(next)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	metrics.ChunkIndexEntries.Set(float64(count))
+	return nil
+}
+
+func (s *IndexedChunkStore) add(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.filter.Load(); f != nil {
+		f.add(hash)
+	}
+	if s.next != nil {
+		s.next.add(hash)
+	}
+	metrics.ChunkIndexEntries.Inc()
+}
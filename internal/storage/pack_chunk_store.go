@@ -0,0 +1,556 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"meliocool/bytesize/internal/metrics"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pack record layout: type(1) | sha256(32) | length(4) | crc32c(4) | data(length).
+// A delete is a tombstone record with no data, so a rebuild replays deletes in order.
+const (
+	packHeaderSize   = 1 + 32 + 4 + 4
+	packRecordPut    = 'P'
+	packRecordDelete = 'D'
+	packMaxRecordLen = 256 << 20
+	packFileSuffix   = ".pack"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type packLocation struct {
+	segment uint64
+	offset  int64
+	length  int64
+}
+
+type packSegment struct {
+	id        uint64
+	file      *os.File
+	size      int64
+	liveBytes int64
+}
+
+// PackChunkStore appends chunks into large segment files instead of one file per chunk.
+// The hash → (segment, offset, length) index lives in memory and is rebuilt by scanning the
+// segments on open; a torn tail left by a crash is truncated away. Deleted chunks become
+// dead space that Compact reclaims by copying live records forward and dropping the segment.
+type PackChunkStore struct {
+	Dir         string
+	SegmentSize int64
+
+	mu       sync.RWMutex
+	index    map[string]packLocation
+	segments map[uint64]*packSegment
+	active   *packSegment
+	closed   bool
+
+	stopCompactor context.CancelFunc
+	compactorWG   sync.WaitGroup
+}
+
+func NewPackChunkStore(dir string, segmentSize int64) (*PackChunkStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir: %w", err)
+	}
+	s := &PackChunkStore{
+		Dir:         dir,
+		SegmentSize: segmentSize,
+		index:       make(map[string]packLocation),
+		segments:    make(map[uint64]*packSegment),
+	}
+	if err := s.rebuild(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *PackChunkStore) Put(hash string, reader io.Reader, size int64) error {
+	raw, err := decodeHash(hash)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	_, ok := s.index[hash]
+	s.mu.RUnlock()
+	if ok {
+		_, _ = io.Copy(io.Discard, reader)
+		return nil
+	}
+
+	data, err := readChunk(reader, size)
+	if err != nil {
+		return err
+	}
+	if len(data) > packMaxRecordLen {
+		return fmt.Errorf("chunk too large for pack: %d bytes", len(data))
+	}
+
+	// * the record is fsynced before its index entry is published, outside the lock so
+	// concurrent writers can share one flush
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return ErrStoreClosed
+		}
+		if _, ok := s.index[hash]; ok {
+			s.mu.Unlock()
+			return nil
+		}
+		seg, offset, err := s.appendLocked(packRecordPut, raw, data)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if err := seg.file.Sync(); err != nil {
+			return fmt.Errorf("sync pack: %w", err)
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return ErrStoreClosed
+		}
+		// * a concurrent Put of the same hash won; this record is left as dead space
+		if _, ok := s.index[hash]; ok {
+			s.mu.Unlock()
+			return nil
+		}
+		// * the segment was compacted away before the record was published; write it again
+		if _, ok := s.segments[seg.id]; !ok {
+			s.mu.Unlock()
+			continue
+		}
+		s.index[hash] = packLocation{segment: seg.id, offset: offset, length: int64(len(data))}
+		seg.liveBytes += packHeaderSize + int64(len(data))
+		s.mu.Unlock()
+		s.observe()
+		return nil
+	}
+}
+
+func (s *PackChunkStore) Get(hash string) (io.ReadCloser, int64, error) {
+	if len(hash) != 64 {
+		return nil, 0, fmt.Errorf("invalid hash length: %d", len(hash))
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, 0, ErrStoreClosed
+	}
+
+	loc, ok := s.index[hash]
+	if !ok {
+		return nil, 0, ErrChunkNotFound
+	}
+	seg := s.segments[loc.segment]
+	record := make([]byte, packHeaderSize+loc.length)
+	if _, err := seg.file.ReadAt(record, loc.offset); err != nil {
+		return nil, 0, fmt.Errorf("read pack: %w", err)
+	}
+	data := record[packHeaderSize:]
+	if crc32.Checksum(data, castagnoli) != binary.BigEndian.Uint32(record[37:41]) {
+		return nil, 0, fmt.Errorf("pack record %s: checksum mismatch", hash)
+	}
+	return io.NopCloser(bytes.NewReader(data)), loc.length, nil
+}
+
+func (s *PackChunkStore) Exists(hash string) (bool, error) {
+	if len(hash) != 64 {
+		return false, fmt.Errorf("invalid hash length: %d", len(hash))
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false, ErrStoreClosed
+	}
+	_, ok := s.index[hash]
+	return ok, nil
+}
+
+func (s *PackChunkStore) Delete(hash string) error {
+	raw, err := decodeHash(hash)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrStoreClosed
+	}
+	loc, ok := s.index[hash]
+	if !ok {
+		s.mu.Unlock()
+		return nil
+	}
+	seg, _, err := s.appendLocked(packRecordDelete, raw, nil)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	delete(s.index, hash)
+	s.segments[loc.segment].liveBytes -= packHeaderSize + loc.length
+	s.mu.Unlock()
+
+	if err := seg.file.Sync(); err != nil {
+		return fmt.Errorf("sync pack: %w", err)
+	}
+	s.observe()
+	return nil
+}
+
+// Compact rewrites every sealed segment whose dead fraction is at least threshold (0..1):
+// live records are appended to the active segment, then the old segment file is removed.
+func (s *PackChunkStore) Compact(threshold float64) (int, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return 0, ErrStoreClosed
+	}
+	var candidates []uint64
+	for id, seg := range s.segments {
+		if seg == s.active || seg.size == 0 {
+			continue
+		}
+		if float64(seg.size-seg.liveBytes)/float64(seg.size) >= threshold {
+			candidates = append(candidates, id)
+		}
+	}
+	s.mu.RUnlock()
+	slices.Sort(candidates)
+
+	compacted := 0
+	for _, id := range candidates {
+		if err := s.compactSegment(id); err != nil {
+			return compacted, err
+		}
+		compacted++
+		metrics.PackCompactionsTotal.Inc()
+	}
+	s.observe()
+	return compacted, nil
+}
+
+// StartCompactor calls Compact every interval in the background until Close, which waits
+// for a compaction in progress to finish.
+func (s *PackChunkStore) StartCompactor(interval time.Duration, threshold float64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.stopCompactor = cancel
+	s.mu.Unlock()
+	s.compactorWG.Add(1)
+	go func() {
+		defer s.compactorWG.Done()
+		s.runCompactor(ctx, interval, threshold)
+	}()
+}
+
+func (s *PackChunkStore) runCompactor(ctx context.Context, interval time.Duration, threshold float64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = s.Compact(threshold)
+		}
+	}
+}
+
+// Close stops the compactor, releases the segment file handles and fails every later call
+// with ErrStoreClosed.
+func (s *PackChunkStore) Close() error {
+	s.mu.Lock()
+	stop := s.stopCompactor
+	s.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	s.compactorWG.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var errs []error
+	for _, seg := range s.segments {
+		if err := seg.file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compactSegment holds the write lock for the whole copy so no Put/Delete can interleave
+// a record for a hash that is being moved.
+func (s *PackChunkStore) compactSegment(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+
+	seg, ok := s.segments[id]
+	if !ok || seg == s.active {
+		return nil
+	}
+	oldest := true
+	for other := range s.segments {
+		if other < id {
+			oldest = false
+			break
+		}
+	}
+
+	type move struct {
+		hash string
+		loc  packLocation
+	}
+	var moved []move
+	err := scanSegment(seg.file, seg.size, false, func(kind byte, raw []byte, offset int64, data func() ([]byte, error), length int64) error {
+		hash := hex.EncodeToString(raw)
+		switch kind {
+		case packRecordPut:
+			loc, live := s.index[hash]
+			if !live || loc.segment != id || loc.offset != offset {
+				return nil
+			}
+			payload, err := data()
+			if err != nil {
+				return err
+			}
+			dst, dstOffset, err := s.appendLocked(packRecordPut, raw, payload)
+			if err != nil {
+				return err
+			}
+			moved = append(moved, move{hash: hash, loc: packLocation{segment: dst.id, offset: dstOffset, length: length}})
+		case packRecordDelete:
+			// * an older segment may still hold the put this tombstone cancels
+			if _, live := s.index[hash]; !live && !oldest {
+				if _, _, err := s.appendLocked(packRecordDelete, raw, nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("compact segment %d: %w", id, err)
+	}
+	if err := s.active.file.Sync(); err != nil {
+		return fmt.Errorf("sync pack: %w", err)
+	}
+
+	for _, m := range moved {
+		s.index[m.hash] = m.loc
+		s.segments[m.loc.segment].liveBytes += packHeaderSize + m.loc.length
+	}
+	_ = seg.file.Close()
+	delete(s.segments, id)
+	if err := os.Remove(seg.file.Name()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove segment: %w", err)
+	}
+	return nil
+}
+
+// appendLocked writes one record at the end of the active segment, rolling over to a new
+// segment when the active one is full. Callers hold s.mu.
+func (s *PackChunkStore) appendLocked(kind byte, raw []byte, data []byte) (*packSegment, int64, error) {
+	if s.active == nil || (s.active.size > 0 && s.active.size+packHeaderSize+int64(len(data)) > s.SegmentSize) {
+		if err := s.rollLocked(); err != nil {
+			return nil, 0, err
+		}
+	}
+	seg := s.active
+	record := make([]byte, packHeaderSize+len(data))
+	record[0] = kind
+	copy(record[1:33], raw)
+	binary.BigEndian.PutUint32(record[33:37], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[37:41], crc32.Checksum(data, castagnoli))
+	copy(record[packHeaderSize:], data)
+
+	offset := seg.size
+	if _, err := seg.file.WriteAt(record, offset); err != nil {
+		// * leave size untouched: the partial record is overwritten by the next append
+		return nil, 0, fmt.Errorf("write pack: %w", err)
+	}
+	seg.size += int64(len(record))
+	return seg, offset, nil
+}
+
+func (s *PackChunkStore) rollLocked() error {
+	var next uint64 = 1
+	for id := range s.segments {
+		if id >= next {
+			next = id + 1
+		}
+	}
+	if s.active != nil {
+		// * drop any partial record a failed append left behind before sealing the segment
+		if err := s.active.file.Truncate(s.active.size); err != nil {
+			return fmt.Errorf("seal segment: %w", err)
+		}
+		if err := s.active.file.Sync(); err != nil {
+			return fmt.Errorf("sync pack: %w", err)
+		}
+	}
+	f, err := os.OpenFile(s.segmentPath(next), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("create segment: %w", err)
+	}
+	seg := &packSegment{id: next, file: f}
+	s.segments[next] = seg
+	s.active = seg
+	return nil
+}
+
+// rebuild replays every segment in id order. Only the newest segment can hold a torn write,
+// so it alone is checksum-verified and truncated back to its last intact record.
+func (s *PackChunkStore) rebuild() error {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return fmt.Errorf("read pack dir: %w", err)
+	}
+	var ids []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), packFileSuffix)
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 16, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	for i, id := range ids {
+		f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR, 0o644)
+		if err != nil {
+			return fmt.Errorf("open segment: %w", err)
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("stat segment: %w", err)
+		}
+		seg := &packSegment{id: id, file: f, size: stat.Size()}
+		s.segments[id] = seg
+		last := i == len(ids)-1
+
+		var end int64
+		scanErr := scanSegment(f, seg.size, last, func(kind byte, raw []byte, offset int64, _ func() ([]byte, error), length int64) error {
+			hash := hex.EncodeToString(raw)
+			if old, ok := s.index[hash]; ok {
+				s.segments[old.segment].liveBytes -= packHeaderSize + old.length
+				delete(s.index, hash)
+			}
+			if kind == packRecordPut {
+				s.index[hash] = packLocation{segment: id, offset: offset, length: length}
+				seg.liveBytes += packHeaderSize + length
+			}
+			end = offset + packHeaderSize + length
+			return nil
+		})
+		if scanErr != nil {
+			if !last {
+				return fmt.Errorf("segment %d: %w", id, scanErr)
+			}
+			if err := f.Truncate(end); err != nil {
+				return fmt.Errorf("truncate torn segment: %w", err)
+			}
+			seg.size = end
+		}
+		if last {
+			s.active = seg
+		}
+	}
+	s.observe()
+	return nil
+}
+
+// scanSegment walks the records of a segment. With verify set every payload is read and
+// checksummed; otherwise payloads are skipped and only loaded when fn asks for them.
+func scanSegment(f *os.File, size int64, verify bool, fn func(kind byte, raw []byte, offset int64, data func() ([]byte, error), length int64) error) error {
+	header := make([]byte, packHeaderSize)
+	var offset int64
+	for offset < size {
+		if _, err := f.ReadAt(header, offset); err != nil {
+			return fmt.Errorf("torn header at %d: %w", offset, err)
+		}
+		kind := header[0]
+		length := int64(binary.BigEndian.Uint32(header[33:37]))
+		sum := binary.BigEndian.Uint32(header[37:41])
+		if (kind != packRecordPut && kind != packRecordDelete) || length > packMaxRecordLen || offset+packHeaderSize+length > size {
+			return fmt.Errorf("corrupt record at %d", offset)
+		}
+		recordOffset := offset
+		load := func() ([]byte, error) {
+			data := make([]byte, length)
+			if _, err := f.ReadAt(data, recordOffset+packHeaderSize); err != nil {
+				return nil, err
+			}
+			if crc32.Checksum(data, castagnoli) != sum {
+				return nil, fmt.Errorf("checksum mismatch at %d", recordOffset)
+			}
+			return data, nil
+		}
+		if verify {
+			if _, err := load(); err != nil {
+				return err
+			}
+		}
+		raw := make([]byte, 32)
+		copy(raw, header[1:33])
+		if err := fn(kind, raw, offset, load, length); err != nil {
+			return err
+		}
+		offset += packHeaderSize + length
+	}
+	return nil
+}
+
+func (s *PackChunkStore) segmentPath(id uint64) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%016x%s", id, packFileSuffix))
+}
+
+func (s *PackChunkStore) observe() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var dead int64
+	for _, seg := range s.segments {
+		dead += seg.size - seg.liveBytes
+	}
+	metrics.PackSegments.Set(float64(len(s.segments)))
+	metrics.PackDeadBytes.Set(float64(dead))
+}
+
+func decodeHash(hash string) ([]byte, error) {
+	if len(hash) != 64 {
+		return nil, fmt.Errorf("invalid hash length: %d", len(hash))
+	}
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash: %w", err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPackChunkStoreCloseStopsCompactor(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewPackChunkStore(dir, 4<<10)
+	if err != nil {
+		t.Fatalf("open pack: %v", err)
+	}
+
+	// * deletes leave sealed segments mostly dead, so the compactor has work on every tick
+	kept := make(map[string][]byte)
+	for i := 0; i < 16; i++ {
+		hash, data := putTestChunk(t, store, 1<<10)
+		if i%4 == 0 {
+			kept[hash] = data
+			continue
+		}
+		if err := store.Delete(hash); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	store.StartCompactor(time.Millisecond, 0.1)
+	time.Sleep(20 * time.Millisecond)
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if _, err := store.Compact(0.1); !errors.Is(err, ErrStoreClosed) {
+		t.Fatalf("compact after close = %v; want ErrStoreClosed", err)
+	}
+	if err := store.Put(strings.Repeat("ab", 32), bytes.NewReader([]byte("late")), 4); !errors.Is(err, ErrStoreClosed) {
+		t.Fatalf("put after close = %v; want ErrStoreClosed", err)
+	}
+
+	reopened, err := NewPackChunkStore(dir, 4<<10)
+	if err != nil {
+		t.Fatalf("reopen pack: %v", err)
+	}
+	defer reopened.Close()
+	for hash, data := range kept {
+		got, err := readTestChunk(reopened, hash)
+		if err != nil {
+			t.Fatalf("get %s after reopen: %v", hash, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("chunk %s corrupted by compaction", hash)
+		}
+	}
+}
+
+func TestPackChunkStoreConcurrentPutsPublishOnce(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewPackChunkStore(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("open pack: %v", err)
+	}
+	data := []byte("the same chunk from every writer")
+	hash := strings.Repeat("cd", 32)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Put(hash, bytes.NewReader(data), int64(len(data))); err != nil {
+				t.Errorf("put: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// * records that lost the race count as dead space, never as live
+	store.mu.RLock()
+	live := store.segments[store.index[hash].segment].liveBytes
+	store.mu.RUnlock()
+	if want := int64(packHeaderSize + len(data)); live != want {
+		t.Fatalf("live bytes = %d; want %d", live, want)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := NewPackChunkStore(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("reopen pack: %v", err)
+	}
+	defer reopened.Close()
+	got, err := readTestChunk(reopened, hash)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("get after reopen = %q, %v; want %q", got, err, data)
+	}
+}
@@ -0,0 +1,20 @@
+package storage
+
+// PrefetchDepth is how many chunks a download should fetch ahead when reading from store.
+// Local disks gain little from deep read-ahead; stores that fan out to several targets hide
+// their per-chunk latency better with more requests in flight. Decorators defer to the
+// store they wrap.
+func PrefetchDepth(store ChunkStore) int {
+	switch s := store.(type) {
+	case *CachedChunkStore:
+		return PrefetchDepth(s.Inner)
+	case *IndexedChunkStore:
+		return PrefetchDepth(s.Inner)
+	case *TieredChunkStore:
+		return PrefetchDepth(s.Cold)
+	case *ReplicatedChunkStore, *ErasureChunkStore:
+		return 8
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"meliocool/bytesize/internal/metrics"
+	"sync"
+	"sync/atomic"
+)
+
+// Replica is one underlying store of a composite store; Name labels its metrics.
+type Replica struct {
+	Name  string
+	Store ChunkStore
+}
+
+// ReplicatedChunkStore mirrors every chunk onto all replicas. A Put succeeds once
+// WriteQuorum replicas hold the chunk; Get reads from the first healthy replica,
+// falls back to the others, and re-writes the chunk to replicas found missing it.
+type ReplicatedChunkStore struct {
+	Replicas    []Replica
+	WriteQuorum int
+	healthy     []atomic.Bool
+}
+
+func NewReplicatedChunkStore(writeQuorum int, replicas ...Replica) (*ReplicatedChunkStore, error) {
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("replicated store: no replicas")
+	}
+	if writeQuorum <= 0 || writeQuorum > len(replicas) {
+		return nil, fmt.Errorf("replicated store: write quorum %d out of range 1..%d", writeQuorum, len(replicas))
+	}
+	s := &ReplicatedChunkStore{
+		Replicas:    replicas,
+		WriteQuorum: writeQuorum,
+		healthy:     make([]atomic.Bool, len(replicas)),
+	}
+	for i := range replicas {
+		s.markHealthy(i, true)
+	}
+	return s, nil
+}
+
+func (s *ReplicatedChunkStore) Put(hash string, reader io.Reader, size int64) error {
+	data, err := readChunk(reader, size)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(s.Replicas))
+	var wg sync.WaitGroup
+	for i, r := range s.Replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.Store.Put(hash, bytes.NewReader(data), int64(len(data)))
+			s.observe(i, "put", errs[i])
+		}()
+	}
+	wg.Wait()
+
+	written := 0
+	for _, e := range errs {
+		if e == nil {
+			written++
+		}
+	}
+	if written < s.WriteQuorum {
+		return fmt.Errorf("replicated put: %d/%d replicas written, quorum %d: %w", written, len(s.Replicas), s.WriteQuorum, errors.Join(errs...))
+	}
+	return nil
+}
+
+func (s *ReplicatedChunkStore) Get(hash string) (io.ReadCloser, int64, error) {
+	var missing []int
+	var errs []error
+	for _, i := range s.readOrder() {
+		rc, size, err := s.Replicas[i].Store.Get(hash)
+		if err != nil {
+			if errors.Is(err, ErrChunkNotFound) {
+				s.observe(i, "get", nil)
+				missing = append(missing, i)
+			} else {
+				s.observe(i, "get", err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		s.observe(i, "get", nil)
+		if len(missing) == 0 {
+			return rc, size, nil
+		}
+		return s.repair(hash, rc, size, missing)
+	}
+	if len(missing) == len(s.Replicas) {
+		return nil, 0, ErrChunkNotFound
+	}
+	return nil, 0, fmt.Errorf("replicated get: %w", errors.Join(errs...))
+}
+
+// Exists only reports true when a write quorum holds the chunk, so under-replicated
+// chunks are rewritten by the next upload that carries them.
+func (s *ReplicatedChunkStore) Exists(hash string) (bool, error) {
+	found := 0
+	var errs []error
+	for i, r := range s.Replicas {
+		ok, err := r.Store.Exists(hash)
+		s.observe(i, "exists", err)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			found++
+		}
+	}
+	if found >= s.WriteQuorum {
+		return true, nil
+	}
+	if len(errs) == len(s.Replicas) {
+		return false, fmt.Errorf("replicated exists: %w", errors.Join(errs...))
+	}
+	return false, nil
+}
+
+func (s *ReplicatedChunkStore) Delete(hash string) error {
+	var errs []error
+	for i, r := range s.Replicas {
+		err := r.Store.Delete(hash)
+		s.observe(i, "delete", err)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("replicated delete: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Healthy reports the per-replica health as seen by the last operation on each.
+func (s *ReplicatedChunkStore) Healthy() []bool {
+	out := make([]bool, len(s.Replicas))
+	for i := range s.Replicas {
+		out[i] = s.healthy[i].Load()
+	}
+	return out
+}
+
+// repair buffers the chunk from a good replica, verifies it against the hash and
+// writes it back to the replicas that were missing it before handing it to the caller.
+func (s *ReplicatedChunkStore) repair(hash string, rc io.ReadCloser, size int64, missing []int) (io.ReadCloser, int64, error) {
+	data, err := readChunk(rc, size)
+	_ = rc.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, 0, fmt.Errorf("replicated get: hash mismatch for %s", hash)
+	}
+	for _, i := range missing {
+		err := s.Replicas[i].Store.Put(hash, bytes.NewReader(data), int64(len(data)))
+		s.observe(i, "repair", err)
+		if err == nil {
+			metrics.ReplicaRepairsTotal.WithLabelValues(s.Replicas[i].Name).Inc()
+		}
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+// readOrder tries healthy replicas first, keeping configuration order within each group.
+func (s *ReplicatedChunkStore) readOrder() []int {
+	order := make([]int, 0, len(s.Replicas))
+	for i := range s.Replicas {
+		if s.healthy[i].Load() {
+			order = append(order, i)
+		}
+	}
+	for i := range s.Replicas {
+		if !s.healthy[i].Load() {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+func (s *ReplicatedChunkStore) observe(i int, op string, err error) {
+	if err != nil {
+		metrics.ReplicaErrorsTotal.WithLabelValues(s.Replicas[i].Name, op).Inc()
+	}
+	s.markHealthy(i, err == nil)
+}
+
+func (s *ReplicatedChunkStore) markHealthy(i int, ok bool) {
+	s.healthy[i].Store(ok)
+	v := 0.0
+	if ok {
+		v = 1
+	}
+	metrics.ReplicaHealthy.WithLabelValues(s.Replicas[i].Name).Set(v)
+}
+
+// readChunk drains a chunk into memory, honouring size the same way FSChunkStore.Put does.
+func readChunk(reader io.Reader, size int64) ([]byte, error) {
+	if size < 0 {
+		return io.ReadAll(reader)
+	}
+	data := make([]byte, size)
+	n, err := io.ReadFull(reader, data)
+	if err != nil {
+		return nil, fmt.Errorf("short read: expected %d, got %d: %w", size, n, err)
+	}
+	return data, nil
+}
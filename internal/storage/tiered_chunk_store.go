@@ -0,0 +1,360 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"meliocool/bytesize/internal/metrics"
+	"slices"
+	"sync"
+	"time"
+)
+
+type tierEntry struct {
+	size  int64
+	dirty bool
+}
+
+// TieredChunkStore keeps a size-bounded hot tier (LRU or LFU eviction) in front of a cold
+// store. Reads that miss the hot tier are promoted into it. In write-through mode Put lands
+// in cold first; in write-back mode it lands in hot and a background flusher copies it to
+// cold, and dirty chunks are never evicted before they are flushed.
+type TieredChunkStore struct {
+	Hot         ChunkStore
+	Cold        ChunkStore
+	HotCapacity int64
+	WriteBack   bool
+
+	mu       sync.Mutex
+	entries  map[string]*tierEntry
+	policy   evictionPolicy
+	hotBytes int64
+	dirty    int
+
+	flushCh chan string
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewTieredChunkStore seeds the hot-tier index from the chunks hot already holds when it can
+// list them (an FSChunkStore), so a restart neither forgets their bytes nor overfills the tier.
+func NewTieredChunkStore(hot ChunkStore, cold ChunkStore, hotCapacity int64, policy string, writeBack bool) (*TieredChunkStore, error) {
+	s := &TieredChunkStore{
+		Hot:         hot,
+		Cold:        cold,
+		HotCapacity: hotCapacity,
+		WriteBack:   writeBack,
+		entries:     make(map[string]*tierEntry),
+		policy:      newEvictionPolicy(policy),
+		flushCh:     make(chan string, 1024),
+		done:        make(chan struct{}),
+	}
+	if err := s.seed(); err != nil {
+		return nil, fmt.Errorf("tiered seed: %w", err)
+	}
+	if writeBack {
+		s.wg.Add(1)
+		go s.runFlusher()
+	}
+	return s, nil
+}
+
+func (s *TieredChunkStore) Put(hash string, reader io.Reader, size int64) error {
+	data, err := readChunk(reader, size)
+	if err != nil {
+		return err
+	}
+
+	if !s.WriteBack || int64(len(data)) > s.HotCapacity {
+		if err := s.Cold.Put(hash, bytes.NewReader(data), int64(len(data))); err != nil {
+			return err
+		}
+		// * the hot copy is only a cache here; failing to admit it is not an error
+		_ = s.admit(hash, data, false)
+		return nil
+	}
+
+	if err := s.admit(hash, data, true); err != nil {
+		return s.Cold.Put(hash, bytes.NewReader(data), int64(len(data)))
+	}
+	select {
+	case s.flushCh <- hash:
+	default:
+		// * flusher is behind: write back inline rather than let dirty bytes pile up
+		return s.flush(hash)
+	}
+	return nil
+}
+
+func (s *TieredChunkStore) Get(hash string) (io.ReadCloser, int64, error) {
+	rc, size, err := s.Hot.Get(hash)
+	if err == nil {
+		metrics.TierHitsTotal.WithLabelValues("hot").Inc()
+		s.mu.Lock()
+		_, tracked := s.entries[hash]
+		if tracked {
+			s.policy.touch(hash)
+		}
+		s.mu.Unlock()
+		if !tracked {
+			s.adopt(hash, size)
+		}
+		return rc, size, nil
+	}
+	metrics.TierMissesTotal.WithLabelValues("hot").Inc()
+
+	rc, size, err = s.Cold.Get(hash)
+	if err != nil {
+		if errors.Is(err, ErrChunkNotFound) {
+			metrics.TierMissesTotal.WithLabelValues("cold").Inc()
+		}
+		return nil, 0, err
+	}
+	metrics.TierHitsTotal.WithLabelValues("cold").Inc()
+	if size > s.HotCapacity {
+		return rc, size, nil
+	}
+
+	data, err := readChunk(rc, size)
+	_ = rc.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	_ = s.admit(hash, data, false)
+	return io.NopCloser(bytes.NewReader(data)), size, nil
+}
+
+func (s *TieredChunkStore) Exists(hash string) (bool, error) {
+	s.mu.Lock()
+	_, ok := s.entries[hash]
+	s.mu.Unlock()
+	if ok {
+		return true, nil
+	}
+	return s.Cold.Exists(hash)
+}
+
+func (s *TieredChunkStore) Delete(hash string) error {
+	s.forget(hash)
+	hotErr := s.Hot.Delete(hash)
+	coldErr := s.Cold.Delete(hash)
+	if hotErr != nil || coldErr != nil {
+		return fmt.Errorf("tiered delete: %w", errors.Join(hotErr, coldErr))
+	}
+	return nil
+}
+
+// Flush writes every dirty hot chunk back to the cold tier.
+func (s *TieredChunkStore) Flush() error {
+	s.mu.Lock()
+	var dirty []string
+	for h, e := range s.entries {
+		if e.dirty {
+			dirty = append(dirty, h)
+		}
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, h := range dirty {
+		if err := s.flush(h); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the write-back flusher and flushes whatever is still dirty.
+func (s *TieredChunkStore) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	return s.Flush()
+}
+
+// runFlusher drains the write-back queue and periodically retries chunks whose flush failed.
+func (s *TieredChunkStore) runFlusher() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case h := <-s.flushCh:
+			_ = s.flush(h)
+		case <-ticker.C:
+			_ = s.Flush()
+		}
+	}
+}
+
+func (s *TieredChunkStore) flush(hash string) error {
+	s.mu.Lock()
+	e, ok := s.entries[hash]
+	if !ok || !e.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	rc, size, err := s.Hot.Get(hash)
+	if err != nil {
+		return fmt.Errorf("tiered flush %s: %w", hash, err)
+	}
+	err = s.Cold.Put(hash, rc, size)
+	_ = rc.Close()
+	if err != nil {
+		return fmt.Errorf("tiered flush %s: %w", hash, err)
+	}
+
+	s.mu.Lock()
+	if e, ok := s.entries[hash]; ok && e.dirty {
+		e.dirty = false
+		s.dirty--
+		metrics.TierDirtyChunks.Set(float64(s.dirty))
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// admit writes data to the hot tier, tracks it, and evicts clean chunks until the tier fits.
+func (s *TieredChunkStore) admit(hash string, data []byte, dirty bool) error {
+	size := int64(len(data))
+	if size > s.HotCapacity {
+		return fmt.Errorf("tiered admit: chunk %d bytes exceeds hot capacity %d", size, s.HotCapacity)
+	}
+	// * hot writes and evictions share the lock, or a Put re-admitting a victim as dirty
+	// between its eviction and its delete would lose the only copy
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Hot.Put(hash, bytes.NewReader(data), size); err != nil {
+		return err
+	}
+	s.track(hash, size, dirty)
+	s.evictLocked(hash)
+	return nil
+}
+
+// adopt tracks a chunk found in the hot tier that the index does not know about (e.g. after
+// a restart). In write-back mode it may never have reached cold, so it is queued for flush.
+func (s *TieredChunkStore) adopt(hash string, size int64) {
+	s.mu.Lock()
+	s.track(hash, size, s.WriteBack)
+	s.evictLocked(hash)
+	s.mu.Unlock()
+
+	if !s.WriteBack {
+		return
+	}
+	select {
+	case s.flushCh <- hash:
+	default:
+		_ = s.flush(hash)
+	}
+}
+
+// seed tracks the chunks found in the hot tier, oldest modification time first so the
+// eviction order starts out as their recency. In write-back mode a chunk that cold does not
+// have yet starts dirty; the flusher's periodic pass writes it back.
+func (s *TieredChunkStore) seed() error {
+	walker, ok := s.Hot.(interface {
+		Walk(fn func(hash string, size int64, modTime time.Time) error) error
+	})
+	if !ok {
+		return nil
+	}
+	type hotChunk struct {
+		hash    string
+		size    int64
+		modTime time.Time
+	}
+	var found []hotChunk
+	err := walker.Walk(func(hash string, size int64, modTime time.Time) error {
+		found = append(found, hotChunk{hash: hash, size: size, modTime: modTime})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(found, func(a, b hotChunk) int { return a.modTime.Compare(b.modTime) })
+
+	dirty := make([]bool, len(found))
+	if s.WriteBack {
+		for i, c := range found {
+			inCold, err := s.Cold.Exists(c.hash)
+			dirty[i] = err != nil || !inCold
+		}
+	}
+
+	s.mu.Lock()
+	for i, c := range found {
+		s.track(c.hash, c.size, dirty[i])
+	}
+	s.evictLocked("")
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *TieredChunkStore) track(hash string, size int64, dirty bool) {
+	if e, ok := s.entries[hash]; ok {
+		if dirty && !e.dirty {
+			e.dirty = true
+			s.dirty++
+		}
+		s.policy.touch(hash)
+	} else {
+		s.entries[hash] = &tierEntry{size: size, dirty: dirty}
+		s.hotBytes += size
+		if dirty {
+			s.dirty++
+		}
+		s.policy.add(hash)
+	}
+	metrics.TierHotBytes.Set(float64(s.hotBytes))
+	metrics.TierDirtyChunks.Set(float64(s.dirty))
+}
+
+// evictLocked drops clean chunks other than keep from the hot tier until it fits. The caller
+// holds s.mu.
+func (s *TieredChunkStore) evictLocked(keep string) {
+	var victims []string
+	excess := s.hotBytes - s.HotCapacity
+	if excess <= 0 {
+		return
+	}
+	s.policy.victims(func(h string) bool {
+		e := s.entries[h]
+		if h == keep || e.dirty {
+			return true
+		}
+		victims = append(victims, h)
+		excess -= e.size
+		return excess > 0
+	})
+	for _, h := range victims {
+		s.hotBytes -= s.entries[h].size
+		delete(s.entries, h)
+		s.policy.remove(h)
+		_ = s.Hot.Delete(h)
+		metrics.TierEvictionsTotal.Inc()
+	}
+	metrics.TierHotBytes.Set(float64(s.hotBytes))
+}
+
+func (s *TieredChunkStore) forget(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[hash]
+	if !ok {
+		return
+	}
+	s.hotBytes -= e.size
+	if e.dirty {
+		s.dirty--
+	}
+	delete(s.entries, hash)
+	s.policy.remove(hash)
+	metrics.TierHotBytes.Set(float64(s.hotBytes))
+	metrics.TierDirtyChunks.Set(float64(s.dirty))
+}
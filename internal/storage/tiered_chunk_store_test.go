@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTieredChunkStoreSeedsFromHotDir(t *testing.T) {
+	hot := NewFSChunkStore(t.TempDir())
+	cold := NewFSChunkStore(t.TempDir())
+
+	// * three 1 KiB chunks written oldest to newest, into a hot tier that fits two
+	var hashes []string
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 3; i++ {
+		hash, _ := putTestChunk(t, hot, 1<<10)
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(hot.pathFromHash(hash), mtime, mtime); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	store, err := NewTieredChunkStore(hot, cold, 2<<10, "lru", false)
+	if err != nil {
+		t.Fatalf("new tiered store: %v", err)
+	}
+	defer store.Close()
+
+	if store.hotBytes != 2<<10 {
+		t.Fatalf("hot bytes = %d; want %d", store.hotBytes, 2<<10)
+	}
+	if ok, _ := hot.Exists(hashes[0]); ok {
+		t.Fatal("oldest chunk was not evicted on startup")
+	}
+	for _, h := range hashes[1:] {
+		if ok, _ := hot.Exists(h); !ok {
+			t.Fatalf("chunk %s evicted; want the oldest evicted first", h)
+		}
+		if _, tracked := store.entries[h]; !tracked {
+			t.Fatalf("chunk %s not tracked after seeding", h)
+		}
+	}
+}
+
+func TestTieredChunkStoreSeedWriteBackFlushes(t *testing.T) {
+	hot := NewFSChunkStore(t.TempDir())
+	cold := NewFSChunkStore(t.TempDir())
+	hash, _ := putTestChunk(t, hot, 1<<10)
+
+	store, err := NewTieredChunkStore(hot, cold, 1<<20, "lru", true)
+	if err != nil {
+		t.Fatalf("new tiered store: %v", err)
+	}
+	if store.dirty != 1 {
+		t.Fatalf("dirty = %d; want the chunk missing from cold to start dirty", store.dirty)
+	}
+	if err := Close(store); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if ok, _ := cold.Exists(hash); !ok {
+		t.Fatal("close did not flush the seeded chunk to cold")
+	}
+}
+
+// slowDeleteStore widens the window between an eviction and its hot-tier delete.
+type slowDeleteStore struct {
+	*FSChunkStore
+}
+
+func (s slowDeleteStore) Delete(hash string) error {
+	time.Sleep(time.Millisecond)
+	return s.FSChunkStore.Delete(hash)
+}
+
+func TestTieredChunkStoreWriteBackEvictionRace(t *testing.T) {
+	// * four chunks into a hot tier that fits two, so Puts keep evicting chunks that other
+	// goroutines are re-admitting as dirty
+	chunks := make(map[string][]byte)
+	for i := 0; i < 4; i++ {
+		hash, data := putTestChunk(t, NewFSChunkStore(t.TempDir()), 1<<10)
+		chunks[hash] = data
+	}
+
+	for trial := 0; trial < 20; trial++ {
+		hot := slowDeleteStore{NewFSChunkStore(t.TempDir())}
+		cold := NewFSChunkStore(t.TempDir())
+		store, err := NewTieredChunkStore(hot, cold, 2<<10, "lru", true)
+		if err != nil {
+			t.Fatalf("new tiered store: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for hash, data := range chunks {
+					_ = store.Put(hash, bytes.NewReader(data), int64(len(data)))
+				}
+			}()
+		}
+		wg.Wait()
+
+		// * every chunk the index tracks must still be in the hot tier, or a dirty one can
+		// never be flushed
+		store.mu.Lock()
+		for hash := range store.entries {
+			if ok, _ := hot.Exists(hash); !ok {
+				store.mu.Unlock()
+				t.Fatalf("chunk %s tracked but missing from the hot tier", hash)
+			}
+		}
+		store.mu.Unlock()
+		if err := Close(store); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		for hash, data := range chunks {
+			got, err := readTestChunk(cold, hash)
+			if err != nil {
+				t.Fatalf("cold get %s: %v", hash, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("chunk %s corrupted", hash)
+			}
+		}
+	}
+}
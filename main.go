@@ -1,23 +1,42 @@
 package main
 
 import (
+	"context"
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 	"github.com/julienschmidt/httprouter"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 	"log/slog"
 	"meliocool/bytesize/app"
 	"meliocool/bytesize/internal/controller"
+	"meliocool/bytesize/internal/helper"
 	"meliocool/bytesize/internal/middleware"
 	"meliocool/bytesize/internal/repository"
+	"meliocool/bytesize/internal/service/archive"
+	"meliocool/bytesize/internal/service/bundle"
+	"meliocool/bytesize/internal/service/dav"
 	deletefile "meliocool/bytesize/internal/service/delete"
 	"meliocool/bytesize/internal/service/download"
 	"meliocool/bytesize/internal/service/filelist"
 	"meliocool/bytesize/internal/service/filemeta"
+	"meliocool/bytesize/internal/service/manifest"
+	"meliocool/bytesize/internal/service/object"
+	"meliocool/bytesize/internal/service/replication"
+	"meliocool/bytesize/internal/service/snapshot"
+	"meliocool/bytesize/internal/service/tus"
 	"meliocool/bytesize/internal/service/upload"
 	"meliocool/bytesize/internal/storage"
+	"meliocool/bytesize/pkg/client"
+	bytesizev1 "meliocool/bytesize/pkg/pb/bytesize/v1"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -26,6 +45,9 @@ func main() {
 	}
 	db := app.NewDB()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		Level: slog.LevelInfo, // ➋ show info+ errors (quiet debug)
 	}))
@@ -35,42 +57,238 @@ func main() {
 	chunkRepository := repository.NewChunkRepository()
 	fileRepository := repository.NewFileRepository()
 	fileChunksRepository := repository.NewFileChunksRepository()
-	chunkStorage := storage.NewFSChunkStore(os.Getenv("BASE_DIR"))
+	// * every background loop stops with ctx and is joined before the chunk store closes
+	var background sync.WaitGroup
+	chunkStorage := app.NewChunkIndex(ctx, &background, app.NewChunkStore(), db, chunkRepository, logger)
+
+	hashWorkers := helper.HashWorkers
+	if v, err := strconv.Atoi(os.Getenv("HASH_WORKERS")); err == nil && v > 0 {
+		hashWorkers = v
+	}
+	maxUploads := helper.MaxConcurrentUploads
+	if v, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_UPLOADS")); err == nil && v > 0 {
+		maxUploads = v
+	}
+	var uploadMemory int64 = helper.UploadMemoryBytes
+	if v, err := strconv.ParseInt(os.Getenv("UPLOAD_MEMORY_BYTES"), 10, 64); err == nil && v > 0 {
+		uploadMemory = v
+	}
+
+	deleteService := deletefile.NewDeleteService(fileRepository, fileChunksRepository, chunkRepository, chunkStorage, db)
+	deleteController := controller.NewDeleteController(deleteService)
 
-	uploadService := upload.NewUploadService(chunkRepository, fileRepository, fileChunksRepository, chunkStorage, db, validate, logger)
+	admission := upload.NewAdmission(maxUploads, uploadMemory)
+	uploadService := upload.NewUploadService(chunkRepository, fileRepository, fileChunksRepository, chunkStorage, deleteService, hashWorkers, admission, db, validate, logger)
 	uploadController := controller.NewUploadController(uploadService)
 
-	downloadService := download.NewDownloadService(fileRepository, fileChunksRepository, chunkStorage, db, logger)
-	downloadController := controller.NewDownloadController(downloadService, fileRepository, db)
+	// * 0 (unset) lets the download service pick a depth for the chunk store
+	prefetchDepth := 0
+	if v := os.Getenv("PREFETCH_DEPTH"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 0 {
+			panic("invalid PREFETCH_DEPTH: " + v)
+		}
+		prefetchDepth = depth
+	}
+	downloadService := download.NewDownloadService(fileRepository, fileChunksRepository, chunkStorage, prefetchDepth, db, logger)
 
 	fileMetaDataService := filemeta.NewFileMetaDataService(fileRepository, fileChunksRepository, db, logger)
 	fileMetaDataController := controller.NewFileMetaDataController(fileMetaDataService)
+	downloadController := controller.NewDownloadController(downloadService, fileMetaDataService)
+
+	archiveService := archive.NewArchiveService(fileRepository, fileChunksRepository, downloadService, db, validate, logger)
+	archiveController := controller.NewArchiveController(archiveService)
 
 	fileListService := filelist.NewFileListService(fileRepository, db)
 	fileListController := controller.NewFileListController(fileListService)
 
-	deleteService := deletefile.NewDeleteService(fileRepository, fileChunksRepository, chunkStorage, db)
-	deleteController := controller.NewDeleteController(deleteService)
+	tusService := tus.NewTusService(uploadService, deleteService, fileRepository, fileChunksRepository, chunkRepository, chunkStorage, db, validate, logger)
+	tusController := controller.NewTusController(tusService, "/files/tus")
+
+	manifestService := manifest.NewManifestService(uploadService, deleteService, fileRepository, fileChunksRepository, chunkRepository, chunkStorage, db, validate, logger)
+	manifestController := controller.NewManifestController(manifestService)
+
+	snapshotRepository := repository.NewSnapshotRepository()
+	snapshotService := snapshot.NewSnapshotService(snapshotRepository, fileRepository, fileChunksRepository, chunkRepository, chunkStorage, downloadService, deleteService, db, validate, logger)
+	snapshotController := controller.NewSnapshotController(snapshotService)
+
+	bundleService := bundle.NewBundleService(uploadService, fileRepository, fileChunksRepository, chunkRepository, chunkStorage, db, logger)
+	bundleController := controller.NewBundleController(bundleService)
+
+	reaperInterval := helper.ReaperInterval
+	if v, err := time.ParseDuration(os.Getenv("REAPER_INTERVAL")); err == nil && v > 0 {
+		reaperInterval = v
+	}
+	reaper := deletefile.NewReaper(deleteService, reaperInterval, helper.ReaperBatchSize, logger)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		reaper.Run(ctx)
+	}()
+
+	replicationRepository := repository.NewReplicationRepository()
+	replicationService := replication.NewReplicationService(fileRepository, fileChunksRepository, chunkRepository, chunkStorage, db, logger)
+	replicationController := controller.NewReplicationController(replicationService)
 
-	router := httprouter.New()
+	// * without a peer the replicator only keeps the change log from growing
+	var peer *client.Client
+	peerURL := os.Getenv("REPLICATION_PEER_URL")
+	if peerURL != "" {
+		peer = client.New(peerURL, os.Getenv("REPLICATION_PEER_API_KEY"))
+	}
+	replicationInterval := helper.ReplicationInterval
+	if v, err := time.ParseDuration(os.Getenv("REPLICATION_INTERVAL")); err == nil && v > 0 {
+		replicationInterval = v
+	}
+	forceDeletes := os.Getenv("REPLICATION_DELETE_CONFLICT") == "delete"
+	replicator := replication.NewReplicator(peer, peerURL, fileRepository, fileChunksRepository, replicationRepository, chunkStorage, db, replicationInterval, forceDeletes, logger)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		replicator.Run(ctx)
+	}()
+
+	// * the optional frontends below register here so shutdown drains them with :8080
+	var servers []*http.Server
+	var grpcServer *grpc.Server
+
+	// * the S3 gateway is opt-in: it only starts when credentials are configured
+	s3AccessKey, s3SecretKey := os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY")
+	if s3AccessKey != "" && s3SecretKey != "" {
+		objectService := object.NewObjectService(uploadService, downloadService, deleteService, fileRepository, fileChunksRepository, db, validate, logger)
+		s3Controller := controller.NewS3Controller(objectService)
+
+		s3Addr := os.Getenv("S3_ADDR")
+		if s3Addr == "" {
+			s3Addr = ":9000"
+		}
+		s3Server := &http.Server{
+			Addr:    s3Addr,
+			Handler: app.NewS3Handler(s3Controller, s3AccessKey, s3SecretKey, os.Getenv("S3_DOMAIN")),
+		}
+		servers = append(servers, s3Server)
+		go func() {
+			if err := s3Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				panic("S3 Gateway Stopped Abruptly!")
+			}
+		}()
+	}
+
+	// * the WebDAV frontend is opt-in as well; file managers can only send Basic credentials
+	davUser, davPassword := os.Getenv("WEBDAV_USER"), os.Getenv("WEBDAV_PASSWORD")
+	if davUser != "" && davPassword != "" {
+		davService := dav.NewDavService(uploadService, downloadService, deleteService, fileRepository, fileChunksRepository, db, logger)
+		davController := controller.NewDavController(davService, uploadService, logger)
+
+		davRouter := httprouter.New()
+		for _, method := range controller.DavMethods {
+			davRouter.Handle(method, "/*path", davController.Serve)
+		}
+		davRouter.HandleOPTIONS = false
+		davRouter.RedirectTrailingSlash = false
+		davRouter.RedirectFixedPath = false
 
-	router.POST("/files/upload", uploadController.Upload)
-	router.GET("/files", fileListController.List)
-	router.GET("/files/metadata/:id", fileMetaDataController.Get)
-	router.GET("/files/download/:id", downloadController.Download)
-	router.DELETE("/files/del/:id", deleteController.Delete)
+		davAddr := os.Getenv("WEBDAV_ADDR")
+		if davAddr == "" {
+			davAddr = ":8081"
+		}
+		davServer := &http.Server{
+			Addr:    davAddr,
+			Handler: middleware.NewBasicAuthMiddleware(davRouter, davUser, davPassword, "ByteSize"),
+		}
+		servers = append(servers, davServer)
+		go func() {
+			if err := davServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				panic("WebDAV Server Stopped Abruptly!")
+			}
+		}()
+	}
+
+	// * the gRPC API shares the REST API key and metrics; it starts when GRPC_ADDR is set
+	if grpcAddr := os.Getenv("GRPC_ADDR"); grpcAddr != "" {
+		grpcServer = grpc.NewServer(
+			grpc.ChainUnaryInterceptor(middleware.UnaryMetricsInterceptor, middleware.UnaryAuthInterceptor),
+			grpc.ChainStreamInterceptor(middleware.StreamMetricsInterceptor, middleware.StreamAuthInterceptor),
+		)
+		bytesizev1.RegisterFileServiceServer(grpcServer, controller.NewGrpcFileServer(uploadService, downloadService, fileMetaDataService, fileListService, deleteService))
+
+		listener, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			panic("failed to listen for gRPC: " + err.Error())
+		}
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				panic("gRPC Server Stopped Abruptly!")
+			}
+		}()
+	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
-	mux.Handle("/", middleware.NewAuthMiddleware(router))
+	mux.Handle("/", app.NewRouter(app.Controllers{
+		Upload:       uploadController,
+		FileList:     fileListController,
+		FileMetaData: fileMetaDataController,
+		Download:     downloadController,
+		Delete:       deleteController,
+		Archive:      archiveController,
+		Tus:          tusController,
+		Manifest:     manifestController,
+		Snapshot:     snapshotController,
+		Bundle:       bundleController,
+		Replication:  replicationController,
+	}))
 
-	server := http.Server{
+	server := &http.Server{
 		Addr:    ":8080",
 		Handler: mux,
 	}
+	servers = append(servers, server)
+
+	// * every server drains its in-flight requests, all within one ShutdownTimeout
+	drained := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), helper.ShutdownTimeout)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		for _, srv := range servers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = srv.Shutdown(shutdownCtx)
+			}()
+		}
+		if grpcServer != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				stopped := make(chan struct{})
+				go func() {
+					grpcServer.GracefulStop()
+					close(stopped)
+				}()
+				select {
+				case <-stopped:
+				case <-shutdownCtx.Done():
+					// * streams still open past the deadline are cut off
+					grpcServer.Stop()
+				}
+			}()
+		}
+		wg.Wait()
+		close(drained)
+	}()
 
 	err := server.ListenAndServe()
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
 		panic("Server Stopped Abruptly!")
 	}
+	// * ListenAndServe returns as soon as Shutdown starts; wait for the drain and the loops
+	<-drained
+	background.Wait()
+	if err := storage.Close(chunkStorage); err != nil {
+		logger.Error("shutdown_err", slog.String("stage", "close_chunk_store"), slog.Any("err", err))
+	}
 }
@@ -0,0 +1,6 @@
+-- ByteSize: ADDED EXPIRES AT COLUMN
+
+ALTER TABLE files
+ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ NULL;
+
+CREATE INDEX IF NOT EXISTS idx_files_expires_at ON files(expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,8 @@
+-- ByteSize: ADDED USER METADATA AND TAGS
+
+ALTER TABLE files
+ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'::jsonb,
+ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_files_metadata ON files USING GIN (metadata jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_files_tags ON files USING GIN (tags);
@@ -0,0 +1,4 @@
+-- ByteSize: ADDED CONTENT TYPE COLUMN
+
+ALTER TABLE files
+ADD COLUMN IF NOT EXISTS content_type TEXT NOT NULL DEFAULT 'application/octet-stream';
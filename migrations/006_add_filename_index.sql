@@ -0,0 +1,3 @@
+-- ByteSize: INDEX FILENAME FOR EXACT-NAME LOOKUPS (S3 GATEWAY)
+
+CREATE INDEX IF NOT EXISTS idx_files_filename ON files(filename);
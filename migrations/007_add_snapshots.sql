@@ -0,0 +1,28 @@
+-- ByteSize: ADDED SNAPSHOTS OF DIRECTORY TREES
+
+CREATE TABLE IF NOT EXISTS snapshots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    hostname TEXT NOT NULL DEFAULT '',
+    paths TEXT[] NOT NULL DEFAULT '{}',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    taken_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    file_count BIGINT NOT NULL DEFAULT 0,
+    total_size BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshots_taken_at ON snapshots(taken_at);
+
+-- regular files keep their manifest in a hidden .snapshots/<snapshot id>/<path> file row
+CREATE TABLE IF NOT EXISTS snapshot_entries (
+    snapshot_id UUID NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    type TEXT NOT NULL,
+    mode INT NOT NULL,
+    mtime TIMESTAMPTZ NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    link_target TEXT NOT NULL DEFAULT '',
+    digest TEXT NOT NULL DEFAULT '',
+    file_id UUID NULL REFERENCES files(id) ON DELETE SET NULL,
+    PRIMARY KEY (snapshot_id, path)
+);
@@ -0,0 +1,39 @@
+-- ByteSize: ADDED CHANGE LOG FOR ASYNCHRONOUS REPLICATION
+
+-- every insert, update and delete of a file row, in commit-agnostic seq order; a rolled-back
+-- transaction leaves a gap in seq
+CREATE TABLE IF NOT EXISTS replication_log (
+    seq BIGSERIAL PRIMARY KEY,
+    file_id UUID NOT NULL,
+    op TEXT NOT NULL CHECK (op IN ('upsert', 'delete')),
+    filename TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    logged_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp()
+);
+
+-- how far each peer has been brought up to date; backfill is set while the files that predate
+-- the peer's first checkpoint are still being walked, from (cursor_time, cursor_id) on
+CREATE TABLE IF NOT EXISTS replication_checkpoints (
+    peer TEXT PRIMARY KEY,
+    seq BIGINT NOT NULL DEFAULT 0,
+    backfill BOOLEAN NOT NULL DEFAULT TRUE,
+    cursor_time TIMESTAMPTZ NOT NULL,
+    cursor_id UUID NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE OR REPLACE FUNCTION log_file_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO replication_log (file_id, op, filename, updated_at) VALUES (OLD.id, 'delete', OLD.filename, OLD.updated_at);
+        RETURN OLD;
+    END IF;
+    INSERT INTO replication_log (file_id, op, filename, updated_at) VALUES (NEW.id, 'upsert', NEW.filename, NEW.updated_at);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS files_replication_log ON files;
+CREATE TRIGGER files_replication_log
+    AFTER INSERT OR UPDATE OR DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION log_file_change();
@@ -0,0 +1,7 @@
+-- ByteSize: LOWERCASE USER METADATA KEYS
+
+-- metadata keys are matched case-insensitively by storing them in lowercase; rows written before
+-- that may still hold mixed-case keys (when two keys differ only in case, one of them wins)
+UPDATE files
+SET metadata = (SELECT jsonb_object_agg(lower(key), value) FROM jsonb_each(metadata))
+WHERE EXISTS (SELECT 1 FROM jsonb_object_keys(metadata) AS k WHERE k <> lower(k));
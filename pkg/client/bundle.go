@@ -0,0 +1,322 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bundle entry names and PAX records, as GET /export writes them.
+const (
+	bundleHeader   = "bundle.json"
+	bundleEnd      = "end.json"
+	bundleChunks   = "chunks/"
+	bundleSegments = "files/"
+	checksumRecord = "BYTESIZE.sha256"
+	cursorRecord   = "BYTESIZE.cursor"
+)
+
+// ErrIncompleteBundle is an export stream that ended before its end.json entry. What arrived
+// is sound up to its last complete segment; ResumeExport continues from there.
+var ErrIncompleteBundle = errors.New("bytesize: bundle is incomplete")
+
+// ExportOptions selects the files of an export the way GET /files does; every set criterion
+// must match.
+type ExportOptions struct {
+	Prefix   string            `json:"prefix,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"meta,omitempty"`
+}
+
+type ExportResult struct {
+	// Bytes is what this call wrote; Resumed is what it kept from an earlier, partial export.
+	Bytes    int64 `json:"bytes"`
+	Resumed  int64 `json:"resumed"`
+	Files    int64 `json:"files"`
+	Chunks   int64 `json:"chunks"`
+	Segments int   `json:"segments"`
+}
+
+// BundleState is what ReadBundle found in a bundle.
+type BundleState struct {
+	// Created is zero when the bundle.json header itself is missing or cut short.
+	Created time.Time
+	Options ExportOptions
+	// Files and Chunks count the entries up to Offset.
+	Files  int64
+	Chunks int64
+	// Segment and Cursor are the number and end position of the last complete segment, and
+	// Offset is where the bundle stops being sound: after that segment, or after end.json.
+	Segment  int
+	Cursor   string
+	Offset   int64
+	Complete bool
+}
+
+// Export writes a bundle of the matching files to w: a tar stream of the files' metadata and
+// the chunks they reference, each entry checksummed. Every entry is checked as it arrives; a
+// stream that ends early returns ErrIncompleteBundle.
+func (c *Client) Export(ctx context.Context, w io.Writer, opts *ExportOptions) (ExportResult, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	return c.export(ctx, w, *opts, "", 0)
+}
+
+// ResumeExport finishes a partial bundle in f, as left by an Export to f that failed. It keeps
+// f up to its last complete segment and appends the rest of the export, with the filter the
+// bundle recorded. A complete bundle is left as it is.
+func (c *Client) ResumeExport(ctx context.Context, f *os.File) (ExportResult, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ExportResult{}, err
+	}
+	state, err := ReadBundle(f)
+	if err != nil {
+		return ExportResult{}, err
+	}
+	if state.Created.IsZero() {
+		return ExportResult{}, fmt.Errorf("bytesize: %s has no bundle header to resume from", f.Name())
+	}
+	if state.Complete {
+		return ExportResult{Resumed: state.Offset, Files: state.Files, Chunks: state.Chunks, Segments: state.Segment}, nil
+	}
+
+	// * with no complete segment, there is nothing worth keeping past the header; start over
+	keep := state.Offset
+	if state.Segment == 0 {
+		keep = 0
+	}
+	if err := f.Truncate(keep); err != nil {
+		return ExportResult{}, err
+	}
+	if _, err := f.Seek(keep, io.SeekStart); err != nil {
+		return ExportResult{}, err
+	}
+	result, err := c.export(ctx, f, state.Options, state.Cursor, state.Segment)
+	result.Resumed = keep
+	if keep > 0 {
+		result.Files += state.Files
+		result.Chunks += state.Chunks
+	}
+	return result, err
+}
+
+func (c *Client) export(ctx context.Context, w io.Writer, opts ExportOptions, after string, segment int) (ExportResult, error) {
+	query := url.Values{}
+	if opts.Prefix != "" {
+		query.Set("prefix", opts.Prefix)
+	}
+	for _, tag := range opts.Tags {
+		query.Add("tag", tag)
+	}
+	for k, v := range opts.Metadata {
+		query.Set("meta."+k, v)
+	}
+	if after != "" {
+		query.Set("after", after)
+		query.Set("segment", strconv.Itoa(segment))
+	}
+
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodGet, "/export?"+query.Encode(), nil)
+	})
+	if err != nil {
+		return ExportResult{}, err
+	}
+	defer resp.Body.Close()
+
+	// * the server cannot signal a failure once the stream has started, so the entries are
+	// * checked on the way through; a short stream is one without end.json
+	out := &countingWriter{w: w}
+	tee := io.TeeReader(resp.Body, out)
+	state := BundleState{Segment: segment}
+	scanErr := scanBundle(tee, &state, after == "")
+	if _, err := io.Copy(io.Discard, tee); err != nil && scanErr == nil {
+		scanErr = err
+	}
+	result := ExportResult{Bytes: out.n, Files: state.Files, Chunks: state.Chunks, Segments: state.Segment}
+	switch {
+	case out.err != nil:
+		return result, out.err
+	case scanErr != nil:
+		return result, scanErr
+	case !state.Complete:
+		return result, ErrIncompleteBundle
+	}
+	return result, nil
+}
+
+// ReadBundle reads a bundle from r, checking each entry against its checksum, and reports how
+// far it is sound. A bundle that is cut short is not an error; a corrupt entry is.
+func ReadBundle(r io.Reader) (BundleState, error) {
+	state := BundleState{}
+	err := scanBundle(r, &state, true)
+	return state, err
+}
+
+// scanBundle reads entries into state until the stream ends. A stream that continues an export
+// has no header.
+func scanBundle(r io.Reader, state *BundleState, header bool) error {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	first := true
+	// * chunks only count once a segment or end.json makes them part of the sound prefix
+	var pending int64
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		end := cr.n + (hdr.Size+511)/512*512
+		if first && header && hdr.Name != bundleHeader {
+			return fmt.Errorf("bytesize: not a bundle: first entry is %s", hdr.Name)
+		}
+		first = false
+
+		h := sha256.New()
+		var small bytes.Buffer
+		sink := io.Writer(h)
+		if hdr.Name == bundleHeader {
+			sink = io.MultiWriter(h, &small)
+		}
+		lines := &lineCounter{w: sink}
+		if _, err := io.Copy(lines, tr); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != hdr.PAXRecords[checksumRecord] {
+			return fmt.Errorf("bytesize: bundle entry %s fails its checksum", hdr.Name)
+		}
+
+		switch {
+		case hdr.Name == bundleHeader:
+			var v struct {
+				CreatedAt time.Time     `json:"created_at"`
+				Filter    ExportOptions `json:"filter"`
+			}
+			if err := json.Unmarshal(small.Bytes(), &v); err != nil {
+				return fmt.Errorf("bytesize: bundle header: %w", err)
+			}
+			state.Created = v.CreatedAt
+			state.Options = v.Filter
+		case strings.HasPrefix(hdr.Name, bundleChunks):
+			pending++
+		case strings.HasPrefix(hdr.Name, bundleSegments):
+			n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(hdr.Name, bundleSegments), ".jsonl"))
+			if err != nil {
+				return fmt.Errorf("bytesize: bad bundle entry %s", hdr.Name)
+			}
+			state.Segment = n
+			state.Cursor = hdr.PAXRecords[cursorRecord]
+			state.Files += lines.n
+			state.Chunks += pending
+			state.Offset = end
+			pending = 0
+		case hdr.Name == bundleEnd:
+			state.Complete = true
+			state.Chunks += pending
+			state.Offset = end
+			pending = 0
+		}
+	}
+}
+
+type ImportOptions struct {
+	// Progress is called from the sending goroutine with the bytes of r sent so far.
+	Progress func(sent int64)
+}
+
+type ImportResult struct {
+	Segments      int   `json:"segments"`
+	FilesCreated  int64 `json:"files_created"`
+	FilesSkipped  int64 `json:"files_skipped"`
+	ChunksStored  int64 `json:"chunks_stored"`
+	ChunksPresent int64 `json:"chunks_present"`
+	BytesStored   int64 `json:"bytes_stored"`
+}
+
+// Import sends the bundle in r to POST /import. The server skips files and chunks it already
+// has, so a failed import can simply be run again; it is only retried here before any of r
+// was sent.
+func (c *Client) Import(ctx context.Context, r io.Reader, opts *ImportOptions) (ImportResult, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	var body *progressReader
+	resp, err := c.do(ctx, false, func() (*http.Request, error) {
+		if body != nil && body.sent.Load() > 0 {
+			return nil, errNotReplayable
+		}
+		body = &progressReader{r: r, progress: opts.Progress}
+		req, err := c.newRequest(ctx, http.MethodPost, "/import", body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-tar")
+		return req, nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	var envelope struct {
+		Data ImportResult `json:"data"`
+	}
+	err = decodeJSON(resp, &envelope)
+	return envelope.Data, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter keeps the first write error, so a failing destination is told apart from a
+// failing stream.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+type lineCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *lineCounter) Write(p []byte) (int, error) {
+	l.n += int64(bytes.Count(p, []byte{'\n'}))
+	return l.w.Write(p)
+}
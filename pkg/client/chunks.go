@@ -0,0 +1,168 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ChunkSize is the server's chunk size. Files committed by manifest must be cut on these
+// boundaries so their chunks dedupe against uploaded ones.
+const ChunkSize = 4 << 20
+
+// maxMissingBatch is the most hashes the server checks in one request.
+const maxMissingBatch = 10000
+
+// Chunk is one entry of a file manifest: the hex SHA-256 of the chunk and its length.
+type Chunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// HashChunks cuts r the way the server's upload pipeline does, into ChunkSize pieces with a
+// shorter last one, and hashes each. An empty r has no chunks.
+func HashChunks(r io.Reader) ([]Chunk, error) {
+	var chunks []Chunk
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			chunks = append(chunks, Chunk{Hash: hex.EncodeToString(sum[:]), Size: int64(n)})
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return chunks, nil
+		}
+		if err != nil {
+			return chunks, err
+		}
+	}
+}
+
+// MissingChunks returns which of hashes the server's chunk store lacks, without repeats.
+func (c *Client) MissingChunks(ctx context.Context, hashes []string) ([]string, error) {
+	missing := []string{}
+	for start := 0; start < len(hashes); start += maxMissingBatch {
+		body, err := json.Marshal(map[string][]string{"hashes": hashes[start:min(start+maxMissingBatch, len(hashes))]})
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(ctx, true, func() (*http.Request, error) {
+			req, err := c.newRequest(ctx, http.MethodPost, "/files/chunks/missing", bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			return req, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		var envelope struct {
+			Data struct {
+				Missing []string `json:"missing"`
+			} `json:"data"`
+		}
+		if err := decodeJSON(resp, &envelope); err != nil {
+			return nil, err
+		}
+		missing = append(missing, envelope.Data.Missing...)
+	}
+	return missing, nil
+}
+
+// PutChunk uploads one chunk. The server checks data against hash, so a chunk is named by its
+// content and the call is safe to retry.
+func (c *Client) PutChunk(ctx context.Context, hash string, data []byte) error {
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		req, err := c.newRequest(ctx, http.MethodPut, "/files/chunks/"+hash, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type CommitOptions struct {
+	// ContentType overrides sniffing the first chunk.
+	ContentType string
+	// ExpiresAt is when the server deletes the file; zero means never.
+	ExpiresAt time.Time
+	Metadata  map[string]string
+	Tags      []string
+	// Replace deletes the other files with the same filename once this one is committed.
+	Replace bool
+}
+
+// Commit creates filename from chunks already on the server. If some are missing the error
+// matches ErrMissingChunks; upload them with PutChunk and commit again.
+func (c *Client) Commit(ctx context.Context, filename string, chunks []Chunk, opts *CommitOptions) (UploadResult, error) {
+	if opts == nil {
+		opts = &CommitOptions{}
+	}
+	payload := struct {
+		Filename    string            `json:"filename"`
+		ContentType string            `json:"content_type,omitempty"`
+		ExpiresAt   *time.Time        `json:"expires_at,omitempty"`
+		Metadata    map[string]string `json:"meta,omitempty"`
+		Tags        []string          `json:"tags,omitempty"`
+		Replace     bool              `json:"replace"`
+		Chunks      []Chunk           `json:"chunks"`
+	}{filename, opts.ContentType, nil, opts.Metadata, opts.Tags, opts.Replace, chunks}
+	if !opts.ExpiresAt.IsZero() {
+		payload.ExpiresAt = &opts.ExpiresAt
+	}
+	if payload.Chunks == nil {
+		payload.Chunks = []Chunk{}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	// * each commit creates a file, so only requests the server turned away are retried
+	resp, err := c.do(ctx, false, func() (*http.Request, error) {
+		req, err := c.newRequest(ctx, http.MethodPost, "/files/manifest", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return UploadResult{}, err
+	}
+	var envelope struct {
+		Data UploadResult `json:"data"`
+	}
+	err = decodeJSON(resp, &envelope)
+	return envelope.Data, err
+}
+
+// Manifest returns a file's chunks in order.
+func (c *Client) Manifest(ctx context.Context, id uuid.UUID) ([]Chunk, error) {
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodGet, "/files/manifest/"+id.String(), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var envelope struct {
+		Data []Chunk `json:"data"`
+	}
+	err = decodeJSON(resp, &envelope)
+	return envelope.Data, err
+}
@@ -0,0 +1,197 @@
+// Package client is a Go client for the ByteSize REST API.
+//
+// Requests that are safe to repeat are retried with exponential backoff: reads and deletes on
+// network errors and 5xx responses, and any request, uploads included, that the server turned
+// away with 429 or 503 before reading it.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("bytesize: not found")
+	ErrBadRequest  = errors.New("bytesize: bad request")
+	ErrTooLarge    = errors.New("bytesize: payload too large")
+	ErrUnavailable = errors.New("bytesize: server busy")
+	// ErrMissingChunks is a Commit, CreateSnapshot or ReplicateFile naming chunks the server does not hold.
+	ErrMissingChunks = errors.New("bytesize: manifest references missing chunks")
+	// ErrConflict is a replicated write or delete refused because the server's copy is newer.
+	ErrConflict = errors.New("bytesize: server has a newer version")
+)
+
+// APIError is a non-2xx response. errors.Is matches it against the sentinel for its status.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("bytesize: %d %s", e.StatusCode, e.Status)
+	}
+	return fmt.Sprintf("bytesize: %d %s: %s", e.StatusCode, e.Status, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusRequestEntityTooLarge:
+		return ErrTooLarge
+	case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+		return ErrUnavailable
+	case http.StatusConflict:
+		return ErrMissingChunks
+	case http.StatusPreconditionFailed:
+		return ErrConflict
+	}
+	return nil
+}
+
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	// MaxRetries is how many times a retryable request is repeated after the first attempt.
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the jittered exponential backoff between attempts. A
+	// Retry-After from the server takes precedence.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func New(baseURL string, apiKey string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		HTTPClient: http.DefaultClient,
+		MaxRetries: 3,
+		MinBackoff: 200 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+	}
+}
+
+// attempt builds a fresh request for each try; it returns errNotReplayable when the body
+// cannot be sent again.
+type attempt func() (*http.Request, error)
+
+var errNotReplayable = errors.New("bytesize: request body cannot be replayed")
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	return req, nil
+}
+
+// do sends the request built by next, retrying per the package rules. idempotent says whether
+// repeating a request the server may have processed is harmless. The caller closes the body of
+// a successful response.
+func (c *Client) do(ctx context.Context, idempotent bool, next attempt) (*http.Response, error) {
+	for try := 0; ; try++ {
+		req, err := next()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.HTTPClient.Do(req)
+		if err == nil && resp.StatusCode < 400 {
+			return resp, nil
+		}
+
+		var failure error
+		var wait time.Duration
+		retry := false
+		if err != nil {
+			failure, retry = err, idempotent
+		} else {
+			failure = decodeError(resp)
+			wait = retryAfter(resp)
+			switch {
+			case resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests:
+				retry = true
+			case resp.StatusCode >= 500:
+				retry = idempotent
+			}
+		}
+		if !retry || try >= c.MaxRetries || ctx.Err() != nil {
+			return nil, failure
+		}
+		if err := sleep(ctx, max(wait, c.backoff(try))); err != nil {
+			return nil, failure
+		}
+	}
+}
+
+// backoff is full-jitter exponential backoff: a random wait up to MinBackoff * 2^try, capped.
+func (c *Client) backoff(try int) time.Duration {
+	ceiling := c.MinBackoff << min(try, 30)
+	if ceiling <= 0 || ceiling > c.MaxBackoff {
+		ceiling = c.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// decodeError reads the server's {"code", "status", "data"} error body, if it sent one, and
+// closes the response.
+func decodeError(resp *http.Response) error {
+	defer resp.Body.Close()
+	apiErr := &APIError{StatusCode: resp.StatusCode, Status: http.StatusText(resp.StatusCode)}
+	var body struct {
+		Status string `json:"status"`
+		Data   any    `json:"data"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body) == nil {
+		if msg, ok := body.Data.(string); ok {
+			apiErr.Message = msg
+		}
+	}
+	return apiErr
+}
+
+// decodeJSON decodes a successful response into v and closes it.
+func decodeJSON(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("bytesize: decode response: %w", err)
+	}
+	return nil
+}
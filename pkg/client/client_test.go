@@ -0,0 +1,491 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/google/uuid"
+	"io"
+	"meliocool/bytesize/app"
+	"meliocool/bytesize/internal/controller"
+	"meliocool/bytesize/internal/helper"
+	"meliocool/bytesize/internal/model/domain"
+	"meliocool/bytesize/internal/model/web"
+	deletefile "meliocool/bytesize/internal/service/delete"
+	"meliocool/bytesize/internal/service/filelist"
+	"meliocool/bytesize/internal/service/filemeta"
+	"meliocool/bytesize/pkg/client"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// defaultAPIKey is the key the auth middleware falls back to when MIDDLEWARE_KEY is unset.
+const defaultAPIKey = "LOVEMELOVEME"
+
+type fakeFile struct {
+	meta filemeta.MetaDataDTO
+	data []byte
+}
+
+// fakeFiles stands in for the upload, download, metadata, list and delete services, so the
+// client can be driven through the real router and controllers without Postgres. The fail
+// counters make the next calls of a method fail.
+type fakeFiles struct {
+	mu    sync.Mutex
+	files map[uuid.UUID]*fakeFile
+	// order is upload order; listings are newest first
+	order []uuid.UUID
+
+	admits, uploads, metas int
+	admitFails             int
+	uploadFails            int
+	metaFails              int
+	// cutDownloads streams cut off halfway through the range they were asked for
+	cutDownloads int
+	// lostDeletes delete the file but answer 500, as if the response never arrived
+	lostDeletes int
+	// offsets records where each StreamRange started
+	offsets []int64
+}
+
+func newFakeFiles() *fakeFiles {
+	return &fakeFiles{files: make(map[uuid.UUID]*fakeFile)}
+}
+
+func (f *fakeFiles) Admit() (func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.admits++
+	if f.admitFails > 0 {
+		f.admitFails--
+		return nil, helper.ErrUnavailable
+	}
+	return func() {}, nil
+}
+
+func (f *fakeFiles) Upload(_ context.Context, req web.UploadRequest) (web.UploadResponse, error) {
+	data, err := io.ReadAll(req.Reader)
+	if err != nil {
+		return web.UploadResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploads++
+	if f.uploadFails > 0 {
+		f.uploadFails--
+		return web.UploadResponse{}, helper.ErrInternal
+	}
+	id := uuid.New()
+	now := time.Now()
+	f.files[id] = &fakeFile{data: data, meta: filemeta.MetaDataDTO{
+		ID:          id,
+		Filename:    req.FileName,
+		TotalSize:   int64(len(data)),
+		ContentType: req.ContentType,
+		ChunksCount: 1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ExpiresAt:   req.ExpiresAt,
+		Metadata:    req.Metadata,
+		Tags:        req.Tags,
+	}}
+	f.order = append(f.order, id)
+	return web.UploadResponse{FileID: id, Filename: req.FileName, TotalSize: int64(len(data)), ContentType: req.ContentType, ChunksCount: 1, UniqueChunksWritten: 1}, nil
+}
+
+func (f *fakeFiles) UploadArchive(context.Context, web.ArchiveUploadRequest) (web.ArchiveUploadResponse, error) {
+	return web.ArchiveUploadResponse{}, helper.ErrInternal
+}
+
+func (f *fakeFiles) StoreChunks(context.Context, io.Reader, int64) ([]domain.FileChunk, error) {
+	return nil, helper.ErrInternal
+}
+
+func (f *fakeFiles) Stream(ctx context.Context, fileID uuid.UUID, w io.Writer) error {
+	f.mu.Lock()
+	file, ok := f.files[fileID]
+	f.mu.Unlock()
+	if !ok {
+		return helper.ErrNotFound
+	}
+	return f.StreamRange(ctx, fileID, 0, int64(len(file.data)), w)
+}
+
+func (f *fakeFiles) StreamRange(_ context.Context, fileID uuid.UUID, offset int64, length int64, w io.Writer) error {
+	f.mu.Lock()
+	file, ok := f.files[fileID]
+	f.offsets = append(f.offsets, offset)
+	cut := f.cutDownloads > 0
+	if cut {
+		f.cutDownloads--
+	}
+	f.mu.Unlock()
+	if !ok {
+		return helper.ErrNotFound
+	}
+	if cut {
+		// * the controller already sent Content-Length, so returning early breaks the body off
+		_, _ = w.Write(file.data[offset : offset+length/2])
+		return helper.ErrInternal
+	}
+	_, err := w.Write(file.data[offset : offset+length])
+	return err
+}
+
+func (f *fakeFiles) GetMeta(_ context.Context, fileID uuid.UUID) (filemeta.MetaDataDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metas++
+	if f.metaFails > 0 {
+		f.metaFails--
+		return filemeta.MetaDataDTO{}, helper.ErrInternal
+	}
+	file, ok := f.files[fileID]
+	if !ok {
+		return filemeta.MetaDataDTO{}, helper.ErrNotFound
+	}
+	return file.meta, nil
+}
+
+func (f *fakeFiles) UpdateMeta(context.Context, uuid.UUID, web.MetadataPatchRequest) (filemeta.MetaDataDTO, error) {
+	return filemeta.MetaDataDTO{}, helper.ErrInternal
+}
+
+func (f *fakeFiles) List(_ context.Context, filter domain.FileFilter) ([]filelist.FileDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []filelist.FileDTO
+	for i := len(f.order) - 1; i >= 0; i-- {
+		m := f.files[f.order[i]].meta
+		if !strings.HasPrefix(m.Filename, filter.Prefix) {
+			continue
+		}
+		out = append(out, filelist.FileDTO{ID: m.ID, Filename: m.Filename, TotalSize: m.TotalSize, ContentType: m.ContentType, CreatedAt: m.CreatedAt, UpdatedAt: m.UpdatedAt, Metadata: m.Metadata, Tags: m.Tags})
+	}
+	out = out[min(filter.Offset, len(out)):]
+	if filter.Limit > 0 {
+		out = out[:min(filter.Limit, len(out))]
+	}
+	return out, nil
+}
+
+func (f *fakeFiles) Delete(_ context.Context, id uuid.UUID) (deletefile.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, ok := f.files[id]
+	if !ok {
+		return deletefile.Result{}, helper.ErrNotFound
+	}
+	delete(f.files, id)
+	for i, o := range f.order {
+		if o == id {
+			f.order = append(f.order[:i], f.order[i+1:]...)
+			break
+		}
+	}
+	if f.lostDeletes > 0 {
+		f.lostDeletes--
+		return deletefile.Result{}, helper.ErrInternal
+	}
+	return deletefile.Result{FileID: id, OrphanChunksDeleted: 1, OrphanBytesDeleted: int64(len(file.data))}, nil
+}
+
+func (f *fakeFiles) PurgeExpired(context.Context, int) (deletefile.PurgeResult, error) {
+	return deletefile.PurgeResult{}, nil
+}
+
+// newTestServer serves the real REST router over files; controllers the client tests do not
+// reach get nil services.
+func newTestServer(t *testing.T) (*client.Client, *fakeFiles) {
+	t.Helper()
+	files := newFakeFiles()
+	srv := httptest.NewServer(app.NewRouter(app.Controllers{
+		Upload:       controller.NewUploadController(files),
+		FileList:     controller.NewFileListController(files),
+		FileMetaData: controller.NewFileMetaDataController(files),
+		Download:     controller.NewDownloadController(files, files),
+		Delete:       controller.NewDeleteController(files),
+		Archive:      controller.NewArchiveController(nil),
+		Tus:          controller.NewTusController(nil, "/files/tus"),
+		Manifest:     controller.NewManifestController(nil),
+		Snapshot:     controller.NewSnapshotController(nil),
+		Bundle:       controller.NewBundleController(nil),
+		Replication:  controller.NewReplicationController(nil),
+	}))
+	t.Cleanup(srv.Close)
+
+	apiKey := os.Getenv("MIDDLEWARE_KEY")
+	if apiKey == "" {
+		apiKey = defaultAPIKey
+	}
+	c := client.New(srv.URL, apiKey)
+	c.MinBackoff = time.Millisecond
+	c.MaxBackoff = 5 * time.Millisecond
+	return c, files
+}
+
+func randomData(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	return data
+}
+
+func upload(t *testing.T, c *client.Client, name string, data []byte) uuid.UUID {
+	t.Helper()
+	res, err := c.Upload(context.Background(), name, bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("upload %s: %v", name, err)
+	}
+	return res.FileID
+}
+
+func TestUploadReportsProgress(t *testing.T) {
+	c, files := newTestServer(t)
+	data := randomData(t, 3<<20+17)
+
+	var reports []int64
+	res, err := c.Upload(context.Background(), "report.bin", bytes.NewReader(data), &client.UploadOptions{
+		ContentType: "application/x-report",
+		Metadata:    map[string]string{"owner": "qa"},
+		Tags:        []string{"a", "b"},
+		Progress:    func(sent int64) { reports = append(reports, sent) },
+	})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if res.TotalSize != int64(len(data)) || res.Filename != "report.bin" || res.ContentType != "application/x-report" {
+		t.Fatalf("upload result = %+v", res)
+	}
+	if len(reports) == 0 || reports[len(reports)-1] != int64(len(data)) {
+		t.Fatalf("progress ended at %v; want %d", reports, len(data))
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i] <= reports[i-1] {
+			t.Fatalf("progress went from %d to %d", reports[i-1], reports[i])
+		}
+	}
+
+	stored := files.files[res.FileID]
+	if !bytes.Equal(stored.data, data) || stored.meta.Metadata["owner"] != "qa" || len(stored.meta.Tags) != 2 {
+		t.Fatalf("server stored %d bytes, metadata %v, tags %v", len(stored.data), stored.meta.Metadata, stored.meta.Tags)
+	}
+}
+
+func TestDownloadRanges(t *testing.T) {
+	c, _ := newTestServer(t)
+	data := randomData(t, 64<<10)
+	id := upload(t, c, "ranges.bin", data)
+
+	cases := []struct {
+		name string
+		opts *client.DownloadOptions
+		want []byte
+	}{
+		{"whole file", nil, data},
+		{"offset to end", &client.DownloadOptions{Offset: 1000}, data[1000:]},
+		{"offset and length", &client.DownloadOptions{Offset: 10, Length: 20}, data[10:30]},
+		{"first byte", &client.DownloadOptions{Length: 1}, data[:1]},
+		{"last byte", &client.DownloadOptions{Offset: int64(len(data) - 1)}, data[len(data)-1:]},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := c.Download(context.Background(), id, &buf, tc.opts)
+			if err != nil {
+				t.Fatalf("download: %v", err)
+			}
+			if n != int64(len(tc.want)) || !bytes.Equal(buf.Bytes(), tc.want) {
+				t.Fatalf("downloaded %d bytes; want %d matching bytes", n, len(tc.want))
+			}
+		})
+	}
+
+	if _, err := c.Download(context.Background(), id, io.Discard, &client.DownloadOptions{Offset: int64(len(data))}); err == nil {
+		t.Fatal("download from past the end succeeded")
+	}
+	if _, err := c.Download(context.Background(), uuid.New(), io.Discard, nil); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("download of a missing file = %v; want ErrNotFound", err)
+	}
+}
+
+func TestDownloadResumesBrokenBody(t *testing.T) {
+	c, files := newTestServer(t)
+	data := randomData(t, 256<<10)
+	id := upload(t, c, "resume.bin", data)
+
+	files.cutDownloads = 1
+	var buf bytes.Buffer
+	n, err := c.Download(context.Background(), id, &buf, nil)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("resumed download wrote %d bytes; want the %d bytes of the file exactly once", n, len(data))
+	}
+	if len(files.offsets) != 2 || files.offsets[0] != 0 || files.offsets[1] != int64(len(data)/2) {
+		t.Fatalf("stream offsets = %v; want [0 %d]", files.offsets, len(data)/2)
+	}
+
+	// * a resumed ranged download keeps the end of the range it was asked for
+	files.cutDownloads = 1
+	files.offsets = nil
+	buf.Reset()
+	n, err = c.Download(context.Background(), id, &buf, &client.DownloadOptions{Offset: 1000, Length: 10000})
+	if err != nil {
+		t.Fatalf("ranged download: %v", err)
+	}
+	if n != 10000 || !bytes.Equal(buf.Bytes(), data[1000:11000]) {
+		t.Fatalf("resumed ranged download wrote %d bytes; want data[1000:11000]", n)
+	}
+	if len(files.offsets) != 2 || files.offsets[1] != 6000 {
+		t.Fatalf("stream offsets = %v; want [1000 6000]", files.offsets)
+	}
+
+	// * a body that keeps breaking gives up after MaxRetries resumes
+	files.cutDownloads = c.MaxRetries + 1
+	if _, err := c.Download(context.Background(), id, io.Discard, nil); err == nil {
+		t.Fatal("download succeeded though every body broke off")
+	}
+}
+
+func TestListPaginates(t *testing.T) {
+	c, _ := newTestServer(t)
+	for i := 0; i < 7; i++ {
+		upload(t, c, "logs/"+string(rune('a'+i))+".txt", []byte{byte(i)})
+	}
+	upload(t, c, "other.txt", []byte("x"))
+
+	var names []string
+	for file, err := range c.List(context.Background(), client.ListOptions{Prefix: "logs/", PageSize: 3}) {
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		names = append(names, file.Filename)
+	}
+	if want := "logs/g.txt logs/f.txt logs/e.txt logs/d.txt logs/c.txt logs/b.txt logs/a.txt"; strings.Join(names, " ") != want {
+		t.Fatalf("listed %v; want %s", names, want)
+	}
+
+	// * breaking out of the loop stops the iterator
+	seen := 0
+	for _, err := range c.List(context.Background(), client.ListOptions{PageSize: 2}) {
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		seen++
+		if seen == 3 {
+			break
+		}
+	}
+	if seen != 3 {
+		t.Fatalf("saw %d files; want 3", seen)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	c, files := newTestServer(t)
+	data := []byte("short lived")
+	id := upload(t, c, "gone.txt", data)
+
+	res, err := c.Delete(context.Background(), id)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if res.FileID != id || res.OrphanBytesDeleted != int64(len(data)) {
+		t.Fatalf("delete result = %+v", res)
+	}
+	if _, err := c.Stat(context.Background(), id); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("stat after delete = %v; want ErrNotFound", err)
+	}
+	// * a first attempt that finds nothing is a real not found
+	if _, err := c.Delete(context.Background(), id); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("second delete = %v; want ErrNotFound", err)
+	}
+
+	// * the first attempt deletes but its response is lost; the retry's 404 means success
+	id = upload(t, c, "lost.txt", data)
+	files.lostDeletes = 1
+	res, err = c.Delete(context.Background(), id)
+	if err != nil || res.FileID != id {
+		t.Fatalf("delete with a lost response = %+v, %v; want success", res, err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	t.Run("reads retry on 5xx", func(t *testing.T) {
+		c, files := newTestServer(t)
+		id := upload(t, c, "stat.txt", []byte("stat me"))
+		files.metaFails = 2
+		file, err := c.Stat(context.Background(), id)
+		if err != nil || file.ID != id || file.TotalSize != 7 {
+			t.Fatalf("stat = %+v, %v", file, err)
+		}
+		if files.metas != 3 {
+			t.Fatalf("stat took %d attempts; want 3", files.metas)
+		}
+	})
+
+	t.Run("reads give up after MaxRetries", func(t *testing.T) {
+		c, files := newTestServer(t)
+		id := upload(t, c, "stat.txt", []byte("stat me"))
+		files.metaFails = c.MaxRetries + 1
+		var apiErr *client.APIError
+		if _, err := c.Stat(context.Background(), id); !errors.As(err, &apiErr) || apiErr.StatusCode != 500 {
+			t.Fatalf("stat = %v; want a 500 APIError", err)
+		}
+		if files.metas != c.MaxRetries+1 {
+			t.Fatalf("stat took %d attempts; want %d", files.metas, c.MaxRetries+1)
+		}
+	})
+
+	t.Run("uploads are not retried after a 5xx", func(t *testing.T) {
+		c, files := newTestServer(t)
+		files.uploadFails = 1
+		if _, err := c.Upload(context.Background(), "once.txt", bytes.NewReader([]byte("once")), nil); err == nil {
+			t.Fatal("upload succeeded though the server failed it")
+		}
+		if files.uploads != 1 {
+			t.Fatalf("upload reached the service %d times; want 1", files.uploads)
+		}
+	})
+
+	t.Run("uploads turned away busy are retried", func(t *testing.T) {
+		// * the server asks for helper.RetryAfterSeconds, and the client honours it
+		if testing.Short() {
+			t.Skip("waits out Retry-After")
+		}
+		t.Parallel()
+		c, files := newTestServer(t)
+		files.admitFails = 1
+		data := randomData(t, 1<<20)
+		res, err := c.Upload(context.Background(), "busy.bin", bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if files.admits != 2 || files.uploads != 1 || !bytes.Equal(files.files[res.FileID].data, data) {
+			t.Fatalf("admits = %d, uploads = %d; want 2 and 1 with the full body", files.admits, files.uploads)
+		}
+	})
+
+	t.Run("a busy server stops retries when the context ends", func(t *testing.T) {
+		c, files := newTestServer(t)
+		files.admitFails = 100
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		_, err := c.Upload(ctx, "busy.txt", strings.NewReader("busy"), nil)
+		if !errors.Is(err, client.ErrUnavailable) {
+			t.Fatalf("upload = %v; want ErrUnavailable", err)
+		}
+		if files.admits != 1 {
+			t.Fatalf("admits = %d; want 1 before the context ended", files.admits)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type DownloadOptions struct {
+	// Offset is the first byte to fetch; resuming a partial download passes the bytes already held.
+	Offset int64
+	// Length is how many bytes to fetch from Offset; 0 means through the end of the file.
+	Length int64
+}
+
+var errShortBody = errors.New("bytesize: download ended early")
+
+// Download writes the file, or the range opts selects, to w and returns the bytes written. A
+// body that breaks off is resumed with a Range request from the first missing byte, so w only
+// ever sees each byte once.
+func (c *Client) Download(ctx context.Context, id uuid.UUID, w io.Writer, opts *DownloadOptions) (int64, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	if opts.Offset < 0 || opts.Length < 0 {
+		return 0, ErrBadRequest
+	}
+
+	var written int64
+	for resumes := 0; ; resumes++ {
+		n, err := c.downloadFrom(ctx, id, w, opts.Offset+written, opts.Length, written)
+		written += n
+		if err == nil {
+			return written, nil
+		}
+		// * only a body cut short is resumed; request-level failures were already retried by do
+		if !errors.Is(err, errShortBody) || resumes >= c.MaxRetries || ctx.Err() != nil {
+			return written, err
+		}
+		if err := sleep(ctx, c.backoff(resumes)); err != nil {
+			return written, err
+		}
+	}
+}
+
+// downloadFrom fetches from offset and copies to w. It returns errShortBody when the stream
+// breaks before the expected length; w's own errors are returned as they are.
+func (c *Client) downloadFrom(ctx context.Context, id uuid.UUID, w io.Writer, offset int64, length int64, done int64) (int64, error) {
+	rangeHeader := ""
+	if offset > 0 || length > 0 {
+		rangeHeader = "bytes=" + strconv.FormatInt(offset, 10) + "-"
+		if length > 0 {
+			rangeHeader += strconv.FormatInt(offset+length-done-1, 10)
+		}
+	}
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		req, err := c.newRequest(ctx, http.MethodGet, "/files/download/"+id.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if rangeHeader != "" {
+		if resp.StatusCode != http.StatusPartialContent {
+			return 0, fmt.Errorf("bytesize: server ignored range %q", rangeHeader)
+		}
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(offset, 10)+"-") {
+			return 0, fmt.Errorf("bytesize: unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+	}
+
+	dst := &trackingWriter{w: w}
+	n, err := io.Copy(dst, resp.Body)
+	if err != nil {
+		if dst.err != nil {
+			return n, dst.err
+		}
+		return n, fmt.Errorf("%w: %w", errShortBody, err)
+	}
+	if resp.ContentLength >= 0 && n < resp.ContentLength {
+		return n, errShortBody
+	}
+	return n, nil
+}
+
+// trackingWriter tells w's errors apart from the response body's in io.Copy.
+type trackingWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil {
+		t.err = err
+	}
+	return n, err
+}
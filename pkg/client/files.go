@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type File struct {
+	ID          uuid.UUID
+	Filename    string
+	TotalSize   int64
+	ContentType string
+	// ChunksCount is only filled in by Stat.
+	ChunksCount int64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ExpiresAt   *time.Time
+	Metadata    map[string]string
+	Tags        []string
+}
+
+type DeleteResult struct {
+	FileID              uuid.UUID `json:"file_id"`
+	OrphanChunksDeleted int64     `json:"orphan_chunks_deleted"`
+	OrphanBytesDeleted  int64     `json:"orphan_bytes_deleted"`
+}
+
+// ListOptions filters a listing the way GET /files does; every set criterion must match.
+type ListOptions struct {
+	Prefix   string
+	Tags     []string
+	Metadata map[string]string
+	// PageSize is how many files each request fetches; 0 means 100.
+	PageSize int
+}
+
+const defaultPageSize = 100
+
+func (c *Client) Stat(ctx context.Context, id uuid.UUID) (File, error) {
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodGet, "/files/metadata/"+id.String(), nil)
+	})
+	if err != nil {
+		return File{}, err
+	}
+	var file File
+	err = decodeJSON(resp, &file)
+	return file, err
+}
+
+// ListPage fetches the files at positions [offset, offset+PageSize) of the newest-first listing.
+func (c *Client) ListPage(ctx context.Context, opts ListOptions, offset int) ([]File, error) {
+	query := url.Values{}
+	if opts.Prefix != "" {
+		query.Set("prefix", opts.Prefix)
+	}
+	for _, tag := range opts.Tags {
+		query.Add("tag", tag)
+	}
+	for k, v := range opts.Metadata {
+		query.Set("meta."+k, v)
+	}
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	query.Set("limit", strconv.Itoa(pageSize))
+	query.Set("offset", strconv.Itoa(offset))
+
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodGet, "/files?"+query.Encode(), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	err = decodeJSON(resp, &files)
+	return files, err
+}
+
+// List walks the whole listing a page at a time. Iteration stops after the first error.
+// Files added while it runs can shift pages, so a file may be seen twice.
+func (c *Client) List(ctx context.Context, opts ListOptions) iter.Seq2[File, error] {
+	if opts.PageSize <= 0 {
+		opts.PageSize = defaultPageSize
+	}
+	return func(yield func(File, error) bool) {
+		for offset := 0; ; offset += opts.PageSize {
+			page, err := c.ListPage(ctx, opts, offset)
+			if err != nil {
+				yield(File{}, err)
+				return
+			}
+			for _, file := range page {
+				if !yield(file, nil) {
+					return
+				}
+			}
+			if len(page) < opts.PageSize {
+				return
+			}
+		}
+	}
+}
+
+// Delete removes a file. A retry that finds the file already gone reports success, since an
+// earlier attempt whose response was lost must have deleted it.
+func (c *Client) Delete(ctx context.Context, id uuid.UUID) (DeleteResult, error) {
+	tries := 0
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		tries++
+		return c.newRequest(ctx, http.MethodDelete, "/files/del/"+id.String(), nil)
+	})
+	if err != nil {
+		if tries > 1 && errors.Is(err, ErrNotFound) {
+			return DeleteResult{FileID: id}, nil
+		}
+		return DeleteResult{}, err
+	}
+	var result DeleteResult
+	err = decodeJSON(resp, &result)
+	return result, err
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ReplicaFile is a file as another instance has it: its id, timestamps and manifest are kept.
+// UpdatedAt is its version.
+type ReplicaFile struct {
+	ID          uuid.UUID         `json:"id"`
+	Filename    string            `json:"filename"`
+	ContentType string            `json:"content_type"`
+	TotalSize   int64             `json:"total_size"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty"`
+	Metadata    map[string]string `json:"meta"`
+	Tags        []string          `json:"tags"`
+	Chunks      []Chunk           `json:"chunks"`
+}
+
+// ReplicateFile makes the server's copy of f match it, and returns what that took: "created",
+// "updated" or "unchanged". Its chunks must already be on the server; if some are missing the
+// error matches ErrMissingChunks. A newer copy on the server is kept, and the error matches
+// ErrConflict.
+func (c *Client) ReplicateFile(ctx context.Context, f ReplicaFile) (string, error) {
+	body, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	// * the write is keyed by id and version, so repeating it is safe
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		req, err := c.newRequest(ctx, http.MethodPut, "/replication/files/"+f.ID.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return replicationResult(resp)
+}
+
+// ReplicateDelete deletes the server's copy of file id if it is version or older, and returns
+// "deleted", or "absent" when there was none. A newer copy is kept, and the error matches
+// ErrConflict, unless force is set.
+func (c *Client) ReplicateDelete(ctx context.Context, id uuid.UUID, version time.Time, force bool) (string, error) {
+	query := url.Values{}
+	query.Set("version", version.UTC().Format(time.RFC3339Nano))
+	if force {
+		query.Set("force", "true")
+	}
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodDelete, "/replication/files/"+id.String()+"?"+query.Encode(), nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	return replicationResult(resp)
+}
+
+func replicationResult(resp *http.Response) (string, error) {
+	var envelope struct {
+		Data struct {
+			Result string `json:"result"`
+		} `json:"data"`
+	}
+	err := decodeJSON(resp, &envelope)
+	return envelope.Data.Result, err
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/google/uuid"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ShareURL returns a download link for id that works without the API key until expiresAt. It is
+// signed locally with the client's API key, so the server is not contacted, and it stays valid
+// until it expires or the server's key changes. inline asks browsers to display the file.
+func (c *Client) ShareURL(id uuid.UUID, expiresAt time.Time, inline bool) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(c.APIKey))
+	mac.Write([]byte(id.String() + "\n" + expires))
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	if inline {
+		query.Set("inline", "true")
+	}
+	return c.BaseURL + "/files/download/" + id.String() + "?" + query.Encode()
+}
@@ -0,0 +1,254 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	EntryFile    = "file"
+	EntryDir     = "dir"
+	EntrySymlink = "symlink"
+)
+
+// Snapshot is a directory tree recorded at Time. Entries is only filled in by Snapshot.
+type Snapshot struct {
+	ID        uuid.UUID       `json:"id"`
+	Hostname  string          `json:"hostname"`
+	Paths     []string        `json:"paths"`
+	Tags      []string        `json:"tags"`
+	Time      time.Time       `json:"time"`
+	FileCount int64           `json:"file_count"`
+	TotalSize int64           `json:"total_size"`
+	Entries   []SnapshotEntry `json:"entries,omitempty"`
+}
+
+// SnapshotEntry is one path of a tree, slash-separated and relative to its root. Mode holds
+// the permission bits. A file lists its Chunks when a snapshot is created; the server answers
+// with its Size and Digest instead.
+type SnapshotEntry struct {
+	Path    string    `json:"path"`
+	Type    string    `json:"type"`
+	Mode    int64     `json:"mode"`
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size,omitempty"`
+	Target  string    `json:"target,omitempty"`
+	Digest  string    `json:"digest,omitempty"`
+	Chunks  []Chunk   `json:"chunks,omitempty"`
+}
+
+type SnapshotOptions struct {
+	Hostname string
+	// Paths names the backed-up source directories; retention policies group by them.
+	Paths []string
+	Tags  []string
+	// Time is when the tree was read; zero means now.
+	Time time.Time
+}
+
+// CreateSnapshot records entries as a snapshot. The chunks of every file must already be on
+// the server; if some are missing the error matches ErrMissingChunks.
+func (c *Client) CreateSnapshot(ctx context.Context, entries []SnapshotEntry, opts *SnapshotOptions) (Snapshot, error) {
+	if opts == nil {
+		opts = &SnapshotOptions{}
+	}
+	payload := struct {
+		Hostname string          `json:"hostname"`
+		Paths    []string        `json:"paths"`
+		Tags     []string        `json:"tags"`
+		Time     *time.Time      `json:"time,omitempty"`
+		Entries  []SnapshotEntry `json:"entries"`
+	}{opts.Hostname, opts.Paths, opts.Tags, nil, entries}
+	if !opts.Time.IsZero() {
+		payload.Time = &opts.Time
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	resp, err := c.do(ctx, false, func() (*http.Request, error) {
+		req, err := c.newRequest(ctx, http.MethodPost, "/snapshots", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var envelope struct {
+		Data Snapshot `json:"data"`
+	}
+	err = decodeJSON(resp, &envelope)
+	return envelope.Data, err
+}
+
+// SnapshotFilter narrows ListSnapshots; every set criterion must match.
+type SnapshotFilter struct {
+	Hostname string
+	Tags     []string
+}
+
+// ListSnapshots returns the matching snapshots newest first, without their entries.
+func (c *Client) ListSnapshots(ctx context.Context, filter SnapshotFilter) ([]Snapshot, error) {
+	query := url.Values{}
+	if filter.Hostname != "" {
+		query.Set("host", filter.Hostname)
+	}
+	for _, tag := range filter.Tags {
+		query.Add("tag", tag)
+	}
+	var envelope struct {
+		Data []Snapshot `json:"data"`
+	}
+	err := c.getJSON(ctx, "/snapshots?"+query.Encode(), &envelope)
+	return envelope.Data, err
+}
+
+// Snapshot returns a snapshot with its entries, sorted by path.
+func (c *Client) Snapshot(ctx context.Context, id uuid.UUID) (Snapshot, error) {
+	var envelope struct {
+		Data Snapshot `json:"data"`
+	}
+	err := c.getJSON(ctx, "/snapshots/"+id.String(), &envelope)
+	return envelope.Data, err
+}
+
+// SnapshotChange is one path that differs between two snapshots. Change is "added",
+// "removed", "modified" (content, type or link target) or "metadata" (mode or mtime only).
+type SnapshotChange struct {
+	Path    string `json:"path"`
+	Change  string `json:"change"`
+	Type    string `json:"type"`
+	OldSize int64  `json:"old_size"`
+	NewSize int64  `json:"new_size"`
+}
+
+type SnapshotDiff struct {
+	From         uuid.UUID        `json:"from"`
+	To           uuid.UUID        `json:"to"`
+	Added        int              `json:"added"`
+	Removed      int              `json:"removed"`
+	Modified     int              `json:"modified"`
+	Metadata     int              `json:"metadata"`
+	AddedBytes   int64            `json:"added_bytes"`
+	RemovedBytes int64            `json:"removed_bytes"`
+	Changes      []SnapshotChange `json:"changes"`
+}
+
+// DiffSnapshots lists what changed from snapshot from to snapshot to, by path.
+func (c *Client) DiffSnapshots(ctx context.Context, from uuid.UUID, to uuid.UUID) (SnapshotDiff, error) {
+	var envelope struct {
+		Data SnapshotDiff `json:"data"`
+	}
+	err := c.getJSON(ctx, "/snapshots/"+from.String()+"/diff/"+to.String(), &envelope)
+	return envelope.Data, err
+}
+
+type RestoreOptions struct {
+	// Path restores only this entry and what is below it.
+	Path string
+	Gzip bool
+}
+
+// RestoreSnapshot writes the snapshot to w as a tar stream, gzipped if asked. The server builds
+// the stream as it goes, so a broken transfer is not resumed.
+func (c *Client) RestoreSnapshot(ctx context.Context, id uuid.UUID, w io.Writer, opts *RestoreOptions) (int64, error) {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+	query := url.Values{}
+	if opts.Path != "" {
+		query.Set("path", opts.Path)
+	}
+	if opts.Gzip {
+		query.Set("format", "tar.gz")
+	}
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodGet, "/snapshots/"+id.String()+"/restore?"+query.Encode(), nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
+
+// ForgetSnapshot deletes a snapshot. Chunks no other file or snapshot uses are freed.
+func (c *Client) ForgetSnapshot(ctx context.Context, id uuid.UUID) error {
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodDelete, "/snapshots/"+id.String(), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ForgetPolicy keeps, per group of snapshots with the same hostname and paths, the KeepLast
+// newest and the newest of each of the last KeepDaily days, KeepWeekly weeks and KeepMonthly
+// months (UTC); the other matching snapshots are forgotten.
+type ForgetPolicy struct {
+	Hostname    string   `json:"hostname,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	KeepLast    int      `json:"keep_last"`
+	KeepDaily   int      `json:"keep_daily"`
+	KeepWeekly  int      `json:"keep_weekly"`
+	KeepMonthly int      `json:"keep_monthly"`
+	// DryRun only reports what the policy would forget.
+	DryRun bool `json:"dry_run"`
+}
+
+type KeptSnapshot struct {
+	Snapshot Snapshot `json:"snapshot"`
+	Reasons  []string `json:"reasons"`
+}
+
+type ForgetResult struct {
+	Keep   []KeptSnapshot `json:"keep"`
+	Remove []Snapshot     `json:"remove"`
+	DryRun bool           `json:"dry_run"`
+}
+
+// ForgetSnapshots applies policy. Forgetting is idempotent, so a failed call can be repeated.
+func (c *Client) ForgetSnapshots(ctx context.Context, policy ForgetPolicy) (ForgetResult, error) {
+	body, err := json.Marshal(policy)
+	if err != nil {
+		return ForgetResult{}, err
+	}
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		req, err := c.newRequest(ctx, http.MethodPost, "/snapshots/forget", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return ForgetResult{}, err
+	}
+	var envelope struct {
+		Data ForgetResult `json:"data"`
+	}
+	err = decodeJSON(resp, &envelope)
+	return envelope.Data, err
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, v any) error {
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodGet, path, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeJSON(resp, v)
+}
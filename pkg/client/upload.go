@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type UploadOptions struct {
+	// ContentType overrides the server's sniffing.
+	ContentType string
+	// ExpiresAt and TTL are mutually exclusive; zero values mean the file never expires.
+	ExpiresAt time.Time
+	TTL       time.Duration
+	Metadata  map[string]string
+	Tags      []string
+	// Progress is called from the sending goroutine with the total bytes of r sent so far.
+	Progress func(sent int64)
+}
+
+type UploadResult struct {
+	FileID              uuid.UUID
+	Filename            string
+	TotalSize           int64
+	ContentType         string
+	ChunksCount         int64
+	UniqueChunksWritten int64
+	DedupeSavedBytes    int64
+}
+
+// progressReader counts what the request body has consumed from the caller's reader.
+type progressReader struct {
+	r        io.Reader
+	sent     atomic.Int64
+	progress func(int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		sent := p.sent.Add(int64(n))
+		if p.progress != nil {
+			p.progress(sent)
+		}
+	}
+	return n, err
+}
+
+// Upload streams r to POST /files/upload as filename. Uploads are not idempotent, so they are
+// only retried when the server turned the request away before reading it (429 or 503), and only
+// if r is an io.Seeker or none of it had been sent yet.
+func (c *Client) Upload(ctx context.Context, filename string, r io.Reader, opts *UploadOptions) (UploadResult, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	seeker, seekable := r.(io.Seeker)
+	var start int64
+	if seekable {
+		pos, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			seekable = false
+		}
+		start = pos
+	}
+
+	var body *progressReader
+	var written chan struct{}
+	resp, err := c.do(ctx, false, func() (*http.Request, error) {
+		// * the transport closes the previous body asynchronously; its writer must stop reading r first
+		if written != nil {
+			<-written
+		}
+		if body != nil && body.sent.Load() > 0 {
+			if !seekable {
+				return nil, errNotReplayable
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		body = &progressReader{r: r, progress: opts.Progress}
+
+		pr, pw := io.Pipe()
+		form := multipart.NewWriter(pw)
+		written = make(chan struct{})
+		go func(body *progressReader, done chan struct{}) {
+			defer close(done)
+			pw.CloseWithError(writeUploadForm(form, filename, body, opts))
+		}(body, written)
+		req, err := c.newRequest(ctx, http.MethodPost, "/files/upload", pr)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		return req, nil
+	})
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	var envelope struct {
+		Data UploadResult `json:"data"`
+	}
+	err = decodeJSON(resp, &envelope)
+	return envelope.Data, err
+}
+
+// writeUploadForm writes the multipart form the upload controller reads: the option fields
+// first, then the file part.
+func writeUploadForm(form *multipart.Writer, filename string, r io.Reader, opts *UploadOptions) error {
+	fields := [][2]string{{"filename", filename}}
+	if opts.ContentType != "" {
+		fields = append(fields, [2]string{"content_type", opts.ContentType})
+	}
+	if !opts.ExpiresAt.IsZero() {
+		fields = append(fields, [2]string{"expires_at", opts.ExpiresAt.Format(time.RFC3339)})
+	}
+	if opts.TTL > 0 {
+		fields = append(fields, [2]string{"ttl", opts.TTL.String()})
+	}
+	for k, v := range opts.Metadata {
+		fields = append(fields, [2]string{"meta." + k, v})
+	}
+	if len(opts.Tags) > 0 {
+		fields = append(fields, [2]string{"tags", strings.Join(opts.Tags, ",")})
+	}
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return err
+	}
+	return form.Close()
+}